@@ -0,0 +1,40 @@
+// Command import-combos loads a Commander Spellbook-style JSON export into
+// the combo database used by the deck page.
+//
+//	go run ./cmd/import-combos -file variants.json
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	"manatomb/app/internal/combos"
+	"manatomb/app/internal/config"
+	"manatomb/app/internal/db"
+)
+
+func main() {
+	file := flag.String("file", "", "path to the combo JSON export")
+	flag.Parse()
+
+	if *file == "" {
+		log.Fatal("missing -file")
+	}
+
+	cfg := config.Load()
+	database := db.Open(cfg.DatabaseURL)
+	defer database.Close()
+
+	ctx := context.Background()
+	if err := combos.EnsureComboTables(ctx, database); err != nil {
+		log.Fatalf("failed to ensure combo tables: %v", err)
+	}
+
+	n, err := combos.ImportFile(ctx, database, *file)
+	if err != nil {
+		log.Fatalf("failed to import combos: %v", err)
+	}
+
+	log.Printf("Imported %d combos from %s", n, *file)
+}
@@ -0,0 +1,33 @@
+// Command mock-oidc is a stand-in OpenID Connect provider for trying
+// external sign-in locally. Its sign-in page asks for an email address
+// and signs in as whoever you type; never expose it.
+//
+//	go run ./cmd/mock-oidc -addr localhost:9000
+//
+// then run the server with OIDC_ISSUER=http://localhost:9000,
+// OIDC_CLIENT_ID=manatomb and OIDC_CLIENT_SECRET=secret.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"manatomb/app/internal/oidc/oidctest"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:9000", "address to listen on")
+	clientID := flag.String("client-id", "manatomb", "the one client allowed to sign in")
+	clientSecret := flag.String("client-secret", "secret", "that client's secret")
+	flag.Parse()
+
+	iss, err := oidctest.New(*clientID, *clientSecret)
+	if err != nil {
+		log.Fatalf("failed to generate signing key: %v", err)
+	}
+	iss.URL = "http://" + *addr
+
+	log.Printf("Mock OIDC issuer at %s (client %q, secret %q)", iss.URL, *clientID, *clientSecret)
+	log.Fatal(http.ListenAndServe(*addr, iss.Handler()))
+}
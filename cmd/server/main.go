@@ -4,12 +4,28 @@ import (
 	"context"
 	"log"
 	"net/http"
+	"path/filepath"
+	"time"
 
 	"manatomb/app/internal/account"
+	"manatomb/app/internal/audit"
+	"manatomb/app/internal/boosters"
 	"manatomb/app/internal/cards"
+	"manatomb/app/internal/collection"
+	"manatomb/app/internal/combos"
 	"manatomb/app/internal/config"
+	"manatomb/app/internal/cubes"
 	"manatomb/app/internal/db"
 	"manatomb/app/internal/decks"
+	"manatomb/app/internal/draft"
+	"manatomb/app/internal/events"
+	"manatomb/app/internal/games"
+	"manatomb/app/internal/groups"
+	"manatomb/app/internal/imgcache"
+	"manatomb/app/internal/live"
+	"manatomb/app/internal/mail"
+	"manatomb/app/internal/oidc"
+	"manatomb/app/internal/secretbox"
 	"manatomb/app/internal/web"
 )
 
@@ -22,11 +38,50 @@ func main() {
 	if err := account.EnsureUserTable(context.Background(), database); err != nil {
 		log.Fatalf("failed to ensure users table: %v", err)
 	}
+	if dups, err := account.DuplicateEmails(context.Background(), database); err != nil {
+		log.Fatalf("failed to check for duplicate emails: %v", err)
+	} else {
+		for email, ids := range dups {
+			log.Printf("warning: accounts %v all use %s (ignoring case); merge or change them, then restart to enforce unique emails", ids, email)
+		}
+	}
 
 	if err := account.EnsureSessionsTable(context.Background(), database); err != nil {
 		log.Fatalf("failed to ensure sessions table: %v", err)
 	}
 
+	if err := account.EnsureLoginAttemptsTable(context.Background(), database); err != nil {
+		log.Fatalf("failed to ensure login_attempts table: %v", err)
+	}
+
+	if err := account.EnsurePasswordResetsTable(context.Background(), database); err != nil {
+		log.Fatalf("failed to ensure password_resets table: %v", err)
+	}
+
+	if err := account.EnsureEmailVerificationsTable(context.Background(), database); err != nil {
+		log.Fatalf("failed to ensure email_verifications table: %v", err)
+	}
+
+	if err := account.EnsureRecoveryCodesTable(context.Background(), database); err != nil {
+		log.Fatalf("failed to ensure recovery_codes table: %v", err)
+	}
+
+	if err := account.EnsurePasskeyTables(context.Background(), database); err != nil {
+		log.Fatalf("failed to ensure passkey tables: %v", err)
+	}
+
+	if err := account.EnsureIdentitiesTable(context.Background(), database); err != nil {
+		log.Fatalf("failed to ensure identities table: %v", err)
+	}
+
+	if err := account.EnsureAPITokensTable(context.Background(), database); err != nil {
+		log.Fatalf("failed to ensure API tokens table: %v", err)
+	}
+
+	if err := audit.EnsureAuditTable(context.Background(), database); err != nil {
+		log.Fatalf("failed to ensure audit log table: %v", err)
+	}
+
 	if err := cards.EnsureCardsTable(context.Background(), database); err != nil {
 		log.Fatalf("failed to ensure cards table: %v", err)
 	}
@@ -35,10 +90,99 @@ func main() {
 		log.Fatalf("failed to ensure deck and deck_cards tables: %v", err)
 	}
 
+	if err := collection.EnsureCollectionTables(context.Background(), database); err != nil {
+		log.Fatalf("failed to ensure collection and wishlist tables: %v", err)
+	}
+
+	if err := combos.EnsureComboTables(context.Background(), database); err != nil {
+		log.Fatalf("failed to ensure combo tables: %v", err)
+	}
+
+	if err := games.EnsureGameTables(context.Background(), database); err != nil {
+		log.Fatalf("failed to ensure game tables: %v", err)
+	}
+
+	if err := groups.EnsureGroupTables(context.Background(), database); err != nil {
+		log.Fatalf("failed to ensure playgroup tables: %v", err)
+	}
+
+	if err := events.EnsureEventTables(context.Background(), database); err != nil {
+		log.Fatalf("failed to ensure event tables: %v", err)
+	}
+
+	if err := cubes.EnsureCubeTables(context.Background(), database); err != nil {
+		log.Fatalf("failed to ensure cube tables: %v", err)
+	}
+
+	if err := boosters.EnsureBoosterTables(context.Background(), database); err != nil {
+		log.Fatalf("failed to ensure set_cards table: %v", err)
+	}
+
+	if n, err := account.PromoteAdmins(context.Background(), database, cfg.AdminEmails); err != nil {
+		log.Fatalf("failed to promote admins: %v", err)
+	} else if n > 0 {
+		log.Printf("made %d account(s) admin from ADMIN_EMAILS", n)
+	}
+
+	brackets, err := decks.LoadBracketLists(filepath.Join(cfg.DataDir, "brackets"))
+	if err != nil {
+		log.Fatalf("failed to load bracket lists: %v", err)
+	}
+
+	banned, err := decks.LoadBanList(filepath.Join(cfg.DataDir, "banned.txt"))
+	if err != nil {
+		log.Fatalf("failed to load ban list: %v", err)
+	}
+
+	boosterTemplates, err := boosters.LoadTemplates(filepath.Join(cfg.DataDir, "boosters.json"))
+	if err != nil {
+		log.Fatalf("failed to load booster templates: %v", err)
+	}
+
+	images, err := imgcache.New(cfg.ImageCacheDir, int64(cfg.ImageCacheMB)<<20)
+	if err != nil {
+		log.Fatalf("failed to open image cache: %v", err)
+	}
+
+	var mailer mail.Mailer = mail.Log{}
+	if cfg.SMTPAddr != "" {
+		mailer = &mail.SMTP{
+			Addr:     cfg.SMTPAddr,
+			From:     cfg.MailFrom,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+		}
+	}
+
+	secrets, err := secretbox.New([]byte(cfg.EncryptionKey), "user secrets")
+	if err != nil {
+		log.Fatalf("failed to derive encryption key: %v", err)
+	}
+
+	var provider *oidc.Provider
+	if cfg.OIDCIssuer != "" {
+		provider = oidc.New(cfg.OIDCName, cfg.OIDCIssuer, cfg.OIDCClientID, cfg.OIDCClientSecret)
+	}
+
+	go account.Sweep(context.Background(), database, time.Hour)
+	go cards.SweepPrices(context.Background(), database, cards.PriceMaxAge)
+
 	renderer := web.NewRenderer()
 	app := &web.App{
-		DB:       database,
-		Renderer: renderer,
+		DB:            database,
+		Renderer:      renderer,
+		Brackets:      brackets,
+		Banned:        banned,
+		Tables:        live.NewHub(),
+		Drafts:        draft.NewHub(draft.DefaultPicker),
+		Boosters:      boosterTemplates,
+		Images:        images,
+		BaseURL:       cfg.BaseURL,
+		TrustProxy:    cfg.TrustProxy,
+		SessionSecret: []byte(cfg.SessionSecret),
+		Mailer:        mailer,
+		Secrets:       secrets,
+		OIDC:          provider,
 	}
 
 	mux := http.NewServeMux()
@@ -62,7 +206,42 @@ func main() {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
+	mux.HandleFunc("/login/2fa", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			app.HandleLoginTwoFactorShow(w, r)
+		case http.MethodPost:
+			app.HandleLoginTwoFactorPost(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/login/passkey/options", app.HandlePasskeyLoginOptions)
+	mux.HandleFunc("/login/passkey", app.HandlePasskeyLogin)
+	mux.HandleFunc("/login/oidc", app.HandleOIDCLogin)
+	mux.HandleFunc("/login/oidc/callback", app.HandleOIDCCallback)
 	mux.HandleFunc("/logout", app.HandleLogout)
+	mux.HandleFunc("/verify-email", app.HandleVerifyEmail)
+	mux.HandleFunc("/password/forgot", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			app.HandleForgotPasswordShow(w, r)
+		case http.MethodPost:
+			app.HandleForgotPasswordPost(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/password/reset", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			app.HandlePasswordResetShow(w, r)
+		case http.MethodPost:
+			app.HandlePasswordResetPost(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
 
 	mux.HandleFunc("/settings", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
@@ -74,43 +253,240 @@ func main() {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
+	mux.HandleFunc("/settings/passkeys/options", app.HandlePasskeyRegisterOptions)
+	mux.HandleFunc("/settings/passkeys", app.HandlePasskeyRegister)
+	mux.HandleFunc("/settings/2fa", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			app.HandleTwoFactorSetupShow(w, r)
+		case http.MethodPost:
+			app.HandleTwoFactorSetupPost(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
 
-	mux.HandleFunc("/decks", app.HandleDecksList)
+	// Deck and collection routes accept API tokens with the matching
+	// scope; every other route treats token requests as signed out.
+	mux.HandleFunc("/decks", app.Scoped(account.ScopeDecksRead, app.HandleDecksList))
 	mux.HandleFunc("/decks/new", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodGet {
 			app.HandleDeckNewShow(w, r)
 		} else if r.Method == http.MethodPost {
-			app.HandleDeckNewPost(w, r)
+			app.Scoped(account.ScopeDecksWrite, app.HandleDeckNewPost)(w, r)
 		} else {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
 	mux.HandleFunc("/decks/edit", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodGet {
-			app.HandleDeckEditShow(w, r)
+			app.Scoped(account.ScopeDecksRead, app.HandleDeckEditShow)(w, r)
 		} else if r.Method == http.MethodPost {
-			app.HandleDeckEditPost(w, r)
+			app.Scoped(account.ScopeDecksWrite, app.HandleDeckEditPost)(w, r)
 		} else {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
-	mux.HandleFunc("/decks/delete", app.HandleDeckDeletePost)
+	mux.HandleFunc("/decks/delete", app.Scoped(account.ScopeDecksWrite, app.HandleDeckDeletePost))
 
 	// NEW: public decks stub
 	mux.HandleFunc("/decks/public", app.HandlePublicDecks)
 
-	mux.HandleFunc("/decks/", app.HandleDeckShow) // /decks/{id}
+	mux.HandleFunc("/decks/", func(w http.ResponseWriter, r *http.Request) { // /decks/{id}
+		if r.Method == http.MethodGet {
+			app.Scoped(account.ScopeDecksRead, app.HandleDeckShow)(w, r)
+		} else if r.Method == http.MethodPost {
+			app.Scoped(account.ScopeDecksWrite, app.HandleDeckShow)(w, r)
+		} else {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/decks/{id}/games", app.HandleDeckGames)
+	mux.HandleFunc("/decks/{id}/proxies", app.HandleDeckProxies)
+	mux.HandleFunc("/decks/{id}/proxies.pdf", app.HandleDeckProxiesPDF)
+	mux.HandleFunc("/decks/{id}/images", app.HandleDeckImagesPost)
+	mux.HandleFunc("/decks/{id}/spoiler.jpg", app.HandleDeckSpoiler)
+	mux.HandleFunc("/decks/{id}/og.jpg", app.HandleDeckOpenGraph)
+	mux.HandleFunc("/decks/{id}/report", app.HandleDeckReportPost)
+	mux.HandleFunc("/img/{scryfall_id}/{size}", app.HandleCardImage)
 
 	mux.HandleFunc("/cards/search", app.HandleCardSearch)
-	mux.HandleFunc("/cards/add-to-deck", app.HandleCardAddToDeck)
+	mux.HandleFunc("/cards/add-to-deck", app.Scoped(account.ScopeDecksWrite, app.HandleCardAddToDeck))
 	mux.HandleFunc("/commanders/search", app.HandleCommanderSearch)
 
+	mux.HandleFunc("/collection", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			app.Scoped(account.ScopeCollectionRead, app.HandleCollectionShow)(w, r)
+		case http.MethodPost:
+			app.Scoped(account.ScopeCollectionWrite, app.HandleCollectionPost)(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/wishlist", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			app.Scoped(account.ScopeCollectionRead, app.HandleWishlistShow)(w, r)
+		case http.MethodPost:
+			app.Scoped(account.ScopeCollectionWrite, app.HandleWishlistPost)(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/trades", app.HandleTradeMatches)
+
+	mux.HandleFunc("/games", app.HandleGamesList)
+	mux.HandleFunc("/games/new", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			app.HandleGameNewShow(w, r)
+		case http.MethodPost:
+			app.HandleGameNewPost(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/games/delete", app.HandleGameDeletePost)
+
+	mux.HandleFunc("/groups", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			app.HandleGroupsList(w, r)
+		case http.MethodPost:
+			app.HandleGroupCreatePost(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/groups/{id}", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			app.HandleGroupShow(w, r)
+		case http.MethodPost:
+			app.HandleGroupPost(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/groups/join/{code}", app.HandleGroupJoin)
+
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			app.HandleEventsList(w, r)
+		case http.MethodPost:
+			app.HandleEventCreatePost(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/events/{id}", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			app.HandleEventShow(w, r)
+		case http.MethodPost:
+			app.HandleEventPost(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/events/{id}/report", app.HandleEventReport)
+
+	mux.HandleFunc("/table", app.HandleTableHome)
+	mux.HandleFunc("/table/new", app.HandleTableNewPost)
+	mux.HandleFunc("/table/join", app.HandleTableJoinPost)
+	mux.HandleFunc("/table/{code}", app.HandleTableShow)
+	mux.HandleFunc("/table/{code}/events", app.HandleTableEvents)
+	mux.HandleFunc("/table/{code}/action", app.HandleTableAction)
+
+	mux.HandleFunc("/cubes", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			app.HandleCubesList(w, r)
+		case http.MethodPost:
+			app.HandleCubeCreatePost(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/cubes/{id}", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			app.HandleCubeShow(w, r)
+		case http.MethodPost:
+			app.HandleCubePost(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/drafts", app.HandleDraftCreatePost)
+	mux.HandleFunc("/drafts/{code}", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			app.HandleDraftShow(w, r)
+		case http.MethodPost:
+			app.HandleDraftPost(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/drafts/{code}/events", app.HandleDraftEvents)
+
+	mux.HandleFunc("/sealed", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			app.HandleSealed(w, r)
+		case http.MethodPost:
+			app.HandleSealedDeckPost(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
 	// NEW: rulings stub
 	mux.HandleFunc("/rules", app.HandleRulesHome)
 
-	// Wrap with middleware (NotFound → User → Recovery)
+	// Staff area. Handlers check the role themselves.
+	mux.HandleFunc("/admin", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			app.HandleAdminUsers(w, r)
+		case http.MethodPost:
+			app.HandleAdminUsersPost(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/admin/decks", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			app.HandleAdminDecks(w, r)
+		case http.MethodPost:
+			app.HandleAdminDecksPost(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/admin/reports", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			app.HandleAdminReports(w, r)
+		case http.MethodPost:
+			app.HandleAdminReportsPost(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/admin/audit", app.HandleAdminAudit)
+	mux.HandleFunc("/admin/impersonate/stop", app.HandleStopImpersonating)
+
+	// Wrap with middleware (NotFound → Impersonation → CSRF → User → Recovery)
 	var handler http.Handler = mux
 	handler = app.WithNotFoundMiddleware(handler)
+	handler = app.WithImpersonationMiddleware(handler)
+	handler = app.WithCSRFMiddleware(handler)
 	handler = app.WithUserMiddleware(handler)
 	handler = app.WithRecoveryMiddleware(handler)
 
@@ -0,0 +1,172 @@
+package account
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Roles. Moderators look after public decks; admins can also manage
+// accounts and act as other users to see what they see.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Roles lists every role, least powerful first.
+var Roles = []string{RoleUser, RoleModerator, RoleAdmin}
+
+var ErrInvalidRole = errors.New("unknown role")
+
+// ImpersonationTTL is how long an admin may act as another user before
+// the session ends. It doesn't slide with activity.
+const ImpersonationTTL = time.Hour
+
+func (u User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+// CanModerate reports whether the user may hide, feature and review
+// reports on public decks.
+func (u User) CanModerate() bool {
+	return u.Role == RoleAdmin || u.Role == RoleModerator
+}
+
+// UserSummary is an account as the admin user list shows it.
+type UserSummary struct {
+	User
+	CreatedAt  time.Time
+	LastSeenAt sql.NullTime
+	DeckCount  int
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// SearchUsers lists accounts whose email or display name contains query,
+// or whose ID is query, newest first. An empty query lists everyone.
+func SearchUsers(ctx context.Context, db *sql.DB, query string, limit, offset int) ([]UserSummary, error) {
+	query = strings.TrimSpace(query)
+	pattern := "%" + likeEscaper.Replace(query) + "%"
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT u.id, u.email, u.display_name, u.password_hash,
+		       u.email_verified_at IS NOT NULL, u.totp_enabled_at IS NOT NULL, u.role, u.disabled_at IS NOT NULL,
+		       u.created_at,
+		       (SELECT MAX(last_seen_at) FROM sessions WHERE user_id = u.id AND impersonator_id IS NULL),
+		       (SELECT COUNT(*) FROM decks WHERE user_id = u.id)
+		FROM users u
+		WHERE $1 = ''
+		   OR u.email ILIKE $2
+		   OR u.display_name ILIKE $2
+		   OR u.id::text = $1
+		ORDER BY u.id DESC
+		LIMIT $3 OFFSET $4
+	`, query, pattern, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []UserSummary
+	for rows.Next() {
+		var s UserSummary
+		if err := rows.Scan(&s.ID, &s.Email, &s.DisplayName, &s.PasswordHash,
+			&s.EmailVerified, &s.TOTPEnabled, &s.Role, &s.Disabled,
+			&s.CreatedAt, &s.LastSeenAt, &s.DeckCount); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// SetUserRole changes what a user may do on the site.
+func SetUserRole(ctx context.Context, db *sql.DB, userID int64, role string) error {
+	if !slices.Contains(Roles, role) {
+		return ErrInvalidRole
+	}
+	_, err := db.ExecContext(ctx, `UPDATE users SET role = $1 WHERE id = $2`, role, userID)
+	return err
+}
+
+// PromoteAdmins makes the accounts with the given emails admins, so a new
+// site has someone to hand out roles. Only verified addresses count, so
+// nobody can claim the role by signing up with a listed email they don't
+// own. It returns how many changed.
+func PromoteAdmins(ctx context.Context, db *sql.DB, emails []string) (int64, error) {
+	if len(emails) == 0 {
+		return 0, nil
+	}
+	lower := make([]string, len(emails))
+	for i, e := range emails {
+		lower[i] = normalizeEmail(e)
+	}
+	res, err := db.ExecContext(ctx, `
+		UPDATE users
+		SET role = $1
+		WHERE lower(email) = ANY($2)
+		  AND email_verified_at IS NOT NULL
+		  AND role <> $1
+	`, RoleAdmin, pq.Array(lower))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// SetUserDisabled turns an account off or back on. Turning it off signs
+// the user out everywhere.
+func SetUserDisabled(ctx context.Context, db *sql.DB, userID int64, disabled bool) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if disabled {
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE users SET disabled_at = COALESCE(disabled_at, NOW()) WHERE id = $1`, userID,
+		); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = $1`, userID); err != nil {
+			return err
+		}
+	} else {
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE users SET disabled_at = NULL WHERE id = $1`, userID,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// CreateImpersonationSession signs adminID in as userID for
+// ImpersonationTTL. The session records who is behind it.
+func CreateImpersonationSession(ctx context.Context, db *sql.DB, adminID, userID int64, userAgent, ip string) (*Session, error) {
+	now := time.Now()
+	s := &Session{
+		ID:             uuid.New(),
+		UserID:         userID,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(ImpersonationTTL),
+		LastSeenAt:     now,
+		UserAgent:      truncate(userAgent, 512),
+		IP:             ip,
+		ImpersonatorID: adminID,
+	}
+
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO sessions (id, user_id, created_at, expires_at, last_seen_at, user_agent, ip, impersonator_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, s.ID, s.UserID, s.CreatedAt, s.ExpiresAt, s.LastSeenAt, s.UserAgent, s.IP, s.ImpersonatorID)
+	return s, err
+}
@@ -0,0 +1,224 @@
+package account
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidAPIToken  = errors.New("invalid or expired API token")
+	ErrAPITokenNotFound = errors.New("API token not found")
+	ErrInvalidScope     = errors.New("unknown API token scope")
+	ErrTooManyAPITokens = errors.New("too many API tokens")
+)
+
+// Scopes an API token can be granted. Each names the routes it opens up;
+// a token can't reach anything else.
+const (
+	ScopeDecksRead       = "decks:read"
+	ScopeDecksWrite      = "decks:write"
+	ScopeCollectionRead  = "collection:read"
+	ScopeCollectionWrite = "collection:write"
+)
+
+// APIScopes lists every scope, in the order settings offers them.
+var APIScopes = []string{ScopeDecksRead, ScopeDecksWrite, ScopeCollectionRead, ScopeCollectionWrite}
+
+const (
+	// APITokenPrefix starts every token, so leaked ones are easy to
+	// recognize and search for.
+	APITokenPrefix = "mt_"
+
+	// MaxAPITokens is how many tokens one user can hold at a time.
+	MaxAPITokens = 20
+
+	// APITokenTouchInterval limits how often a busy token's last-used time
+	// is written.
+	APITokenTouchInterval = time.Minute
+
+	// APITokenRetention is how long expired tokens stay listed in
+	// settings, so their owners can see why a script stopped working.
+	APITokenRetention = 30 * 24 * time.Hour
+)
+
+// APIToken lets scripts act as a user within its scopes. Only a hash of
+// the secret is stored; Hint is its last few characters, to tell tokens
+// apart.
+type APIToken struct {
+	ID         int64
+	UserID     int64
+	Name       string
+	Hint       string
+	Scopes     []string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	LastUsedAt sql.NullTime
+}
+
+func (t *APIToken) HasScope(scope string) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+func (t *APIToken) Expired() bool {
+	return !time.Now().Before(t.ExpiresAt)
+}
+
+// CreateAPIToken issues a token for a user and returns its secret, which
+// can't be recovered later.
+func CreateAPIToken(ctx context.Context, db *sql.DB, userID int64, name string, scopes []string, ttl time.Duration) (string, error) {
+	if len(scopes) == 0 {
+		return "", ErrInvalidScope
+	}
+	for _, s := range scopes {
+		if !slices.Contains(APIScopes, s) {
+			return "", ErrInvalidScope
+		}
+	}
+
+	var count int
+	if err := db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM api_tokens WHERE user_id = $1`, userID,
+	).Scan(&count); err != nil {
+		return "", err
+	}
+	if count >= MaxAPITokens {
+		return "", ErrTooManyAPITokens
+	}
+
+	raw, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	token := APITokenPrefix + raw
+
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO api_tokens (user_id, name, token_hash, hint, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, NOW() + make_interval(secs => $6))
+	`, userID, truncate(name, 64), hashToken(token), token[len(token)-4:],
+		strings.Join(scopes, ","), ttl.Seconds())
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// AuthenticateAPIToken finds the user a live token belongs to and records
+// its use. Tokens of disabled accounts don't authenticate.
+func AuthenticateAPIToken(ctx context.Context, db *sql.DB, token string) (*User, *APIToken, error) {
+	if !strings.HasPrefix(token, APITokenPrefix) {
+		return nil, nil, ErrInvalidAPIToken
+	}
+
+	var u User
+	var t APIToken
+	var scopes string
+	err := db.QueryRowContext(ctx, `
+		SELECT u.id, u.email, u.display_name, u.password_hash,
+		       u.email_verified_at IS NOT NULL, u.totp_enabled_at IS NOT NULL, u.role, u.disabled_at IS NOT NULL,
+		       t.id, t.user_id, t.name, t.hint, t.scopes, t.created_at, t.expires_at, t.last_used_at
+		FROM api_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = $1 AND t.expires_at > NOW() AND u.disabled_at IS NULL
+	`, hashToken(token)).Scan(&u.ID, &u.Email, &u.DisplayName, &u.PasswordHash, &u.EmailVerified, &u.TOTPEnabled, &u.Role, &u.Disabled,
+		&t.ID, &t.UserID, &t.Name, &t.Hint, &scopes, &t.CreatedAt, &t.ExpiresAt, &t.LastUsedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrInvalidAPIToken
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	t.Scopes = splitScopes(scopes)
+
+	if !t.LastUsedAt.Valid || time.Since(t.LastUsedAt.Time) >= APITokenTouchInterval {
+		if _, err := db.ExecContext(ctx,
+			`UPDATE api_tokens SET last_used_at = NOW() WHERE id = $1`, t.ID,
+		); err != nil {
+			return nil, nil, err
+		}
+	}
+	return &u, &t, nil
+}
+
+// ListAPITokens returns a user's tokens, newest first, expired ones
+// included until they are swept.
+func ListAPITokens(ctx context.Context, db *sql.DB, userID int64) ([]APIToken, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, user_id, name, hint, scopes, created_at, expires_at, last_used_at
+		FROM api_tokens
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []APIToken
+	for rows.Next() {
+		var t APIToken
+		var scopes string
+		if err := rows.Scan(&t.ID, &t.UserID, &t.Name, &t.Hint, &scopes, &t.CreatedAt, &t.ExpiresAt, &t.LastUsedAt); err != nil {
+			return nil, err
+		}
+		t.Scopes = splitScopes(scopes)
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// DeleteAPIToken revokes one of a user's tokens.
+func DeleteAPIToken(ctx context.Context, db *sql.DB, userID, id int64) error {
+	res, err := db.ExecContext(ctx, `DELETE FROM api_tokens WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrAPITokenNotFound
+	}
+	return nil
+}
+
+// DeleteExpiredAPITokens drops tokens that expired over APITokenRetention
+// ago.
+func DeleteExpiredAPITokens(ctx context.Context, db *sql.DB) (int64, error) {
+	res, err := db.ExecContext(ctx,
+		`DELETE FROM api_tokens WHERE expires_at < NOW() - make_interval(secs => $1)`,
+		APITokenRetention.Seconds(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func splitScopes(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+func EnsureAPITokensTable(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS api_tokens (
+            id BIGSERIAL PRIMARY KEY,
+            user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+            name TEXT NOT NULL DEFAULT '',
+            token_hash TEXT NOT NULL UNIQUE,
+            hint TEXT NOT NULL DEFAULT '',
+            scopes TEXT NOT NULL DEFAULT '',
+            created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+            expires_at TIMESTAMPTZ NOT NULL,
+            last_used_at TIMESTAMPTZ
+        );
+
+        CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens(user_id);
+    `)
+	return err
+}
@@ -0,0 +1,121 @@
+package account
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrIdentityNotFound = errors.New("identity not found")
+	ErrIdentityLinked   = errors.New("identity linked to another account")
+)
+
+// Identity links an account at an external OpenID Connect provider to a
+// user. Subject is the provider's stable ID for the account; Email is
+// what it reported last and is only for display.
+type Identity struct {
+	ID         int64
+	UserID     int64
+	Issuer     string
+	Subject    string
+	Email      string
+	CreatedAt  time.Time
+	LastUsedAt sql.NullTime
+}
+
+// GetUserByIdentity finds the user an external account is linked to and
+// records the sign-in.
+func GetUserByIdentity(ctx context.Context, db *sql.DB, issuer, subject, email string) (*User, error) {
+	var userID int64
+	err := db.QueryRowContext(ctx, `
+		UPDATE user_identities SET email = $3, last_used_at = NOW()
+		WHERE issuer = $1 AND subject = $2
+		RETURNING user_id
+	`, issuer, subject, truncate(email, 254)).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrIdentityNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return GetUser(ctx, db, userID)
+}
+
+// LinkIdentity links an external account to a user. Linking one that is
+// already the user's is a no-op; one linked elsewhere is refused.
+func LinkIdentity(ctx context.Context, db *sql.DB, userID int64, issuer, subject, email string) error {
+	var id int64
+	err := db.QueryRowContext(ctx, `
+		INSERT INTO user_identities (user_id, issuer, subject, email, last_used_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (issuer, subject) DO UPDATE
+			SET email = EXCLUDED.email, last_used_at = NOW()
+			WHERE user_identities.user_id = EXCLUDED.user_id
+		RETURNING id
+	`, userID, issuer, subject, truncate(email, 254)).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrIdentityLinked
+	}
+	return err
+}
+
+// ListIdentities returns the external accounts linked to a user, oldest
+// first.
+func ListIdentities(ctx context.Context, db *sql.DB, userID int64) ([]Identity, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, user_id, issuer, subject, email, created_at, last_used_at
+		FROM user_identities
+		WHERE user_id = $1
+		ORDER BY created_at
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []Identity
+	for rows.Next() {
+		var i Identity
+		if err := rows.Scan(&i.ID, &i.UserID, &i.Issuer, &i.Subject, &i.Email, &i.CreatedAt, &i.LastUsedAt); err != nil {
+			return nil, err
+		}
+		ids = append(ids, i)
+	}
+	return ids, rows.Err()
+}
+
+// UnlinkIdentity removes one of a user's linked external accounts and
+// returns its issuer. Every account keeps its password, so this never
+// locks anyone out.
+func UnlinkIdentity(ctx context.Context, db *sql.DB, userID, id int64) (string, error) {
+	var issuer string
+	err := db.QueryRowContext(ctx, `
+		DELETE FROM user_identities
+		WHERE id = $1 AND user_id = $2
+		RETURNING issuer
+	`, id, userID).Scan(&issuer)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrIdentityNotFound
+	}
+	return issuer, err
+}
+
+func EnsureIdentitiesTable(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS user_identities (
+            id BIGSERIAL PRIMARY KEY,
+            user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+            issuer TEXT NOT NULL,
+            subject TEXT NOT NULL,
+            email TEXT NOT NULL DEFAULT '',
+            created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+            last_used_at TIMESTAMPTZ,
+            UNIQUE (issuer, subject)
+        );
+
+        CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities(user_id);
+    `)
+	return err
+}
@@ -4,9 +4,11 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -17,16 +19,52 @@ type User struct {
 	Email        string
 	DisplayName  string
 	PasswordHash string
+
+	// EmailVerified is set once the user has followed a link sent to
+	// Email. Some features, such as public decks, need it.
+	EmailVerified bool
+
+	// TOTPEnabled means signing in also needs a code from an authenticator
+	// app or a recovery code.
+	TOTPEnabled bool
+
+	// Role is RoleUser for most people; staff roles open the admin area.
+	Role string
+
+	// Disabled accounts can't sign in, and their sessions and API tokens
+	// stop working until an admin turns the account back on.
+	Disabled bool
 }
 
 type Session struct {
-	ID        uuid.UUID
-	UserID    int64
-	CreatedAt time.Time
-	ExpiresAt time.Time
+	ID         uuid.UUID
+	UserID     int64
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	LastSeenAt time.Time
+	UserAgent  string
+	IP         string
+
+	// ImpersonatorID is the admin acting as UserID through this session,
+	// or 0 for a session the user signed in to themselves.
+	ImpersonatorID int64
 }
 
-var ErrInvalidCredentials = errors.New("invalid credentials")
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrAccountDisabled    = errors.New("account disabled")
+)
+
+// dummyHash is checked against when no account has the email, so an
+// unknown email costs the same bcrypt compare as a wrong password and
+// response times don't reveal which accounts exist.
+var dummyHash = []byte("$2a$10$UL4NKZlKZTIbIXfZpAfkAegUY9bePafFPNRqzo.YAdAUfNUE5sBzW")
+
+// normalizeEmail is how emails are stored and looked up. Addresses are
+// compared without regard to case, as mail providers treat them.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
 
 func CreateUser(ctx context.Context, db *sql.DB, email, displayName, password string) (*User, error) {
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -38,8 +76,8 @@ func CreateUser(ctx context.Context, db *sql.DB, email, displayName, password st
 	err = db.QueryRowContext(ctx, `
 		INSERT INTO users (email, password_hash, display_name)
 		VALUES ($1, $2, $3)
-		RETURNING id, email, display_name, password_hash
-	`, email, string(hash), displayName).Scan(&u.ID, &u.Email, &u.DisplayName, &u.PasswordHash)
+		RETURNING id, email, display_name, password_hash, email_verified_at IS NOT NULL, totp_enabled_at IS NOT NULL, role, disabled_at IS NOT NULL
+	`, normalizeEmail(email), string(hash), displayName).Scan(&u.ID, &u.Email, &u.DisplayName, &u.PasswordHash, &u.EmailVerified, &u.TOTPEnabled, &u.Role, &u.Disabled)
 
 	return &u, err
 }
@@ -47,12 +85,15 @@ func CreateUser(ctx context.Context, db *sql.DB, email, displayName, password st
 func Authenticate(ctx context.Context, db *sql.DB, email, password string) (*User, error) {
 	var u User
 	err := db.QueryRowContext(ctx, `
-		SELECT id, email, display_name, password_hash
+		SELECT id, email, display_name, password_hash, email_verified_at IS NOT NULL, totp_enabled_at IS NOT NULL, role, disabled_at IS NOT NULL
 		FROM users
-		WHERE email = $1
-	`, email).Scan(&u.ID, &u.Email, &u.DisplayName, &u.PasswordHash)
+		WHERE lower(email) = $1
+		ORDER BY id
+		LIMIT 1
+	`, normalizeEmail(email)).Scan(&u.ID, &u.Email, &u.DisplayName, &u.PasswordHash, &u.EmailVerified, &u.TOTPEnabled, &u.Role, &u.Disabled)
 	if err != nil {
 		if err == sql.ErrNoRows {
+			_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
 			return nil, ErrInvalidCredentials
 		}
 		return nil, err
@@ -62,39 +103,83 @@ func Authenticate(ctx context.Context, db *sql.DB, email, password string) (*Use
 		return nil, ErrInvalidCredentials
 	}
 
+	// Only someone with the password learns the account is disabled.
+	if u.Disabled {
+		return nil, ErrAccountDisabled
+	}
+
 	return &u, nil
 }
 
-func CreateSession(ctx context.Context, db *sql.DB, userID int64, ttl time.Duration) (*Session, error) {
-	id := uuid.New()
+func GetUserByEmail(ctx context.Context, db *sql.DB, email string) (*User, error) {
+	var u User
+	err := db.QueryRowContext(ctx, `
+		SELECT id, email, display_name, password_hash, email_verified_at IS NOT NULL, totp_enabled_at IS NOT NULL, role, disabled_at IS NOT NULL
+		FROM users
+		WHERE lower(email) = $1
+		ORDER BY id
+		LIMIT 1
+	`, normalizeEmail(email)).Scan(&u.ID, &u.Email, &u.DisplayName, &u.PasswordHash, &u.EmailVerified, &u.TOTPEnabled, &u.Role, &u.Disabled)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// GetUser looks a user up by ID.
+func GetUser(ctx context.Context, db *sql.DB, id int64) (*User, error) {
+	var u User
+	err := db.QueryRowContext(ctx, `
+		SELECT id, email, display_name, password_hash, email_verified_at IS NOT NULL, totp_enabled_at IS NOT NULL, role, disabled_at IS NOT NULL
+		FROM users
+		WHERE id = $1
+	`, id).Scan(&u.ID, &u.Email, &u.DisplayName, &u.PasswordHash, &u.EmailVerified, &u.TOTPEnabled, &u.Role, &u.Disabled)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// CreateSession signs a user in on one device, recording the browser and
+// address it came from.
+func CreateSession(ctx context.Context, db *sql.DB, userID int64, userAgent, ip string) (*Session, error) {
 	now := time.Now()
 	s := &Session{
-		ID:        id,
-		UserID:    userID,
-		CreatedAt: now,
-		ExpiresAt: now.Add(ttl),
+		ID:         uuid.New(),
+		UserID:     userID,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(SessionIdleTTL),
+		LastSeenAt: now,
+		UserAgent:  truncate(userAgent, 512),
+		IP:         ip,
 	}
 
 	_, err := db.ExecContext(ctx, `
-		INSERT INTO sessions (id, user_id, created_at, expires_at)
-		VALUES ($1, $2, $3, $4)
-	`, s.ID, s.UserID, s.CreatedAt, s.ExpiresAt)
+		INSERT INTO sessions (id, user_id, created_at, expires_at, last_seen_at, user_agent, ip)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, s.ID, s.UserID, s.CreatedAt, s.ExpiresAt, s.LastSeenAt, s.UserAgent, s.IP)
 	return s, err
 }
 
-func GetUserBySession(ctx context.Context, db *sql.DB, sid uuid.UUID) (*User, error) {
+// GetUserBySession returns the signed-in user and their session, if the
+// session hasn't expired and the account isn't disabled.
+func GetUserBySession(ctx context.Context, db *sql.DB, sid uuid.UUID) (*User, *Session, error) {
 	var u User
+	var s Session
 	err := db.QueryRowContext(ctx, `
-		SELECT u.id, u.email, u.display_name, u.password_hash
+		SELECT u.id, u.email, u.display_name, u.password_hash, u.email_verified_at IS NOT NULL, u.totp_enabled_at IS NOT NULL, u.role, u.disabled_at IS NOT NULL,
+		       s.id, s.user_id, s.created_at, s.expires_at, s.last_seen_at, s.user_agent, s.ip,
+		       COALESCE(s.impersonator_id, 0)
 		FROM sessions s
 		JOIN users u ON u.id = s.user_id
-		WHERE s.id = $1 AND s.expires_at > NOW()
-	`, sid).Scan(&u.ID, &u.Email, &u.DisplayName, &u.PasswordHash)
+		WHERE s.id = $1 AND s.expires_at > NOW() AND u.disabled_at IS NULL
+	`, sid).Scan(&u.ID, &u.Email, &u.DisplayName, &u.PasswordHash, &u.EmailVerified, &u.TOTPEnabled, &u.Role, &u.Disabled,
+		&s.ID, &s.UserID, &s.CreatedAt, &s.ExpiresAt, &s.LastSeenAt, &s.UserAgent, &s.IP, &s.ImpersonatorID)
 
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return &u, nil
+	return &u, &s, nil
 }
 
 func DeleteSession(ctx context.Context, db *sql.DB, sid uuid.UUID) error {
@@ -102,19 +187,74 @@ func DeleteSession(ctx context.Context, db *sql.DB, sid uuid.UUID) error {
 	return err
 }
 
+// EnsureUserTable creates the users table. Emails are unique whatever
+// their case, except that the index enforcing it isn't built while
+// existing accounts have emails that differ only in case; see
+// DuplicateEmails.
 func EnsureUserTable(ctx context.Context, db *sql.DB) error {
 	_, err := db.ExecContext(ctx, `
         CREATE TABLE IF NOT EXISTS users (
             id BIGSERIAL PRIMARY KEY,
-            email TEXT NOT NULL UNIQUE,
+            email TEXT NOT NULL,
             password_hash TEXT NOT NULL,
             display_name TEXT NOT NULL,
             created_at TIMESTAMPTZ NOT NULL DEFAULT now()
         );
+
+        UPDATE users u SET email = lower(u.email)
+        WHERE u.email <> lower(u.email)
+          AND NOT EXISTS (SELECT 1 FROM users o WHERE o.id <> u.id AND lower(o.email) = lower(u.email));
+
+        DO $$
+        BEGIN
+            IF NOT EXISTS (SELECT 1 FROM users GROUP BY lower(email) HAVING COUNT(*) > 1) THEN
+                ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+                CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_lower ON users(lower(email));
+            END IF;
+        END $$;
+
+        ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMPTZ;
+
+        ALTER TABLE users
+            ADD COLUMN IF NOT EXISTS totp_secret TEXT,
+            ADD COLUMN IF NOT EXISTS totp_enabled_at TIMESTAMPTZ,
+            ADD COLUMN IF NOT EXISTS totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+        ALTER TABLE users
+            ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'user',
+            ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMPTZ;
     `)
 	return err
 }
 
+// DuplicateEmails lists emails that more than one account uses, ignoring
+// case, with the IDs of those accounts. They date from before emails were
+// compared without case and have to be merged or changed by hand; until
+// then sign-in and password resets for them use the oldest account.
+func DuplicateEmails(ctx context.Context, db *sql.DB) (map[string][]int64, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT lower(email), array_agg(id ORDER BY id)
+		FROM users
+		GROUP BY lower(email)
+		HAVING COUNT(*) > 1
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dups := map[string][]int64{}
+	for rows.Next() {
+		var email string
+		var ids pq.Int64Array
+		if err := rows.Scan(&email, &ids); err != nil {
+			return nil, err
+		}
+		dups[email] = ids
+	}
+	return dups, rows.Err()
+}
+
 func EnsureSessionsTable(ctx context.Context, db *sql.DB) error {
 	_, err := db.ExecContext(ctx, `
         CREATE TABLE IF NOT EXISTS sessions (
@@ -123,21 +263,50 @@ func EnsureSessionsTable(ctx context.Context, db *sql.DB) error {
             created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
             expires_at TIMESTAMPTZ NOT NULL
         );
+
+        ALTER TABLE sessions
+            ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+            ADD COLUMN IF NOT EXISTS user_agent TEXT NOT NULL DEFAULT '',
+            ADD COLUMN IF NOT EXISTS ip TEXT NOT NULL DEFAULT '';
+
+        ALTER TABLE sessions
+            ADD COLUMN IF NOT EXISTS impersonator_id BIGINT REFERENCES users(id) ON DELETE CASCADE;
+
+        CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+        CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
     `)
 	return err
 }
 
-func UpdateProfile(ctx context.Context, db *sql.DB, userID int64, displayName, email string) error {
+// UpdateProfile changes a user's display name. Email addresses change only
+// through ConfirmEmail, once the new address is verified.
+func UpdateProfile(ctx context.Context, db *sql.DB, userID int64, displayName string) error {
 	_, err := db.ExecContext(ctx,
 		`UPDATE users
-		 SET display_name = $1,
-		     email = $2
-		 WHERE id = $3`,
-		displayName, email, userID,
+		 SET display_name = $1
+		 WHERE id = $2`,
+		displayName, userID,
 	)
 	return err
 }
 
+// CheckPassword returns ErrInvalidPassword unless password is the user's.
+func CheckPassword(ctx context.Context, db *sql.DB, userID int64, password string) error {
+	var hash string
+	err := db.QueryRowContext(ctx,
+		`SELECT password_hash FROM users WHERE id = $1`,
+		userID,
+	).Scan(&hash)
+	if err != nil {
+		return err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return ErrInvalidPassword
+	}
+	return nil
+}
+
 func ChangePassword(ctx context.Context, db *sql.DB, userID int64, currentPassword, newPassword string) error {
 	// Fetch hash
 	var hash string
@@ -0,0 +1,225 @@
+package account
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrPasskeyNotFound   = errors.New("passkey not found")
+	ErrPasskeyRegistered = errors.New("passkey already registered")
+	ErrInvalidChallenge  = errors.New("invalid or expired passkey challenge")
+)
+
+const (
+	// PasskeyChallengeTTL is how long a registration or sign-in prompt can
+	// stay open in the browser.
+	PasskeyChallengeTTL = 5 * time.Minute
+
+	// Purposes of passkey challenges.
+	PasskeyRegister = "register"
+	PasskeyLogin    = "login"
+)
+
+// Passkey is a WebAuthn credential a user can sign in with. PublicKey is
+// the COSE-encoded key the webauthn package verifies with.
+type Passkey struct {
+	ID           int64
+	UserID       int64
+	CredentialID []byte
+	PublicKey    []byte
+	SignCount    uint32
+	Name         string
+	Transports   []string
+	CreatedAt    time.Time
+	LastUsedAt   sql.NullTime
+}
+
+// PasskeyUserHandle returns the opaque handle passkeys store for a user,
+// creating it the first time. It carries no personal data.
+func PasskeyUserHandle(ctx context.Context, db *sql.DB, userID int64) ([]byte, error) {
+	handle := make([]byte, 32)
+	if _, err := rand.Read(handle); err != nil {
+		return nil, err
+	}
+
+	err := db.QueryRowContext(ctx, `
+		UPDATE users SET webauthn_handle = COALESCE(webauthn_handle, $1)
+		WHERE id = $2
+		RETURNING webauthn_handle
+	`, handle, userID).Scan(&handle)
+	return handle, err
+}
+
+// ListPasskeys returns a user's passkeys, most recently added first.
+func ListPasskeys(ctx context.Context, db *sql.DB, userID int64) ([]Passkey, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, user_id, credential_id, public_key, sign_count, name, transports, created_at, last_used_at
+		FROM passkeys
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []Passkey
+	for rows.Next() {
+		p, err := scanPasskey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *p)
+	}
+	return keys, rows.Err()
+}
+
+// GetPasskeyByCredentialID finds the passkey a sign-in response names.
+func GetPasskeyByCredentialID(ctx context.Context, db *sql.DB, credentialID []byte) (*Passkey, error) {
+	p, err := scanPasskey(db.QueryRowContext(ctx, `
+		SELECT id, user_id, credential_id, public_key, sign_count, name, transports, created_at, last_used_at
+		FROM passkeys
+		WHERE credential_id = $1
+	`, credentialID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPasskeyNotFound
+	}
+	return p, err
+}
+
+func scanPasskey(row interface{ Scan(...any) error }) (*Passkey, error) {
+	var p Passkey
+	var count int64
+	var transports string
+	err := row.Scan(&p.ID, &p.UserID, &p.CredentialID, &p.PublicKey, &count,
+		&p.Name, &transports, &p.CreatedAt, &p.LastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+	p.SignCount = uint32(count)
+	if transports != "" {
+		p.Transports = strings.Split(transports, ",")
+	}
+	return &p, nil
+}
+
+// AddPasskey stores a newly registered passkey.
+func AddPasskey(ctx context.Context, db *sql.DB, p *Passkey) error {
+	err := db.QueryRowContext(ctx, `
+		INSERT INTO passkeys (user_id, credential_id, public_key, sign_count, name, transports)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`, p.UserID, p.CredentialID, p.PublicKey, int64(p.SignCount), truncate(p.Name, 64),
+		strings.Join(p.Transports, ",")).Scan(&p.ID, &p.CreatedAt)
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrPasskeyRegistered
+	}
+	return err
+}
+
+// TouchPasskey records a sign-in with a passkey and its new signature
+// counter.
+func TouchPasskey(ctx context.Context, db *sql.DB, id int64, signCount uint32) error {
+	_, err := db.ExecContext(ctx,
+		`UPDATE passkeys SET sign_count = $1, last_used_at = NOW() WHERE id = $2`,
+		int64(signCount), id,
+	)
+	return err
+}
+
+// RenamePasskey changes the label a user gave one of their passkeys.
+func RenamePasskey(ctx context.Context, db *sql.DB, userID, id int64, name string) error {
+	return execOwned(ctx, db,
+		`UPDATE passkeys SET name = $1 WHERE id = $2 AND user_id = $3`,
+		truncate(name, 64), id, userID)
+}
+
+// DeletePasskey removes one of a user's passkeys.
+func DeletePasskey(ctx context.Context, db *sql.DB, userID, id int64) error {
+	return execOwned(ctx, db, `DELETE FROM passkeys WHERE id = $1 AND user_id = $2`, id, userID)
+}
+
+func execOwned(ctx context.Context, db *sql.DB, query string, args ...any) error {
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrPasskeyNotFound
+	}
+	return nil
+}
+
+// CreatePasskeyChallenge records a challenge for one registration or
+// sign-in. Registration challenges belong to the signed-in user; sign-in
+// challenges to nobody yet (userID 0).
+func CreatePasskeyChallenge(ctx context.Context, db *sql.DB, userID int64, purpose string, challenge []byte) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO passkey_challenges (challenge, user_id, purpose, expires_at)
+		VALUES ($1, NULLIF($2, 0), $3, NOW() + make_interval(secs => $4))
+	`, challenge, userID, purpose, PasskeyChallengeTTL.Seconds())
+	return err
+}
+
+// TakePasskeyChallenge spends a challenge, so each can answer only one
+// response, and returns the user it was issued to (0 for sign-ins).
+func TakePasskeyChallenge(ctx context.Context, db *sql.DB, challenge []byte, purpose string) (int64, error) {
+	var userID sql.NullInt64
+	err := db.QueryRowContext(ctx, `
+		DELETE FROM passkey_challenges
+		WHERE challenge = $1 AND purpose = $2 AND expires_at > NOW()
+		RETURNING user_id
+	`, challenge, purpose).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrInvalidChallenge
+	}
+	return userID.Int64, err
+}
+
+// DeleteExpiredPasskeyChallenges drops challenges nobody answered.
+func DeleteExpiredPasskeyChallenges(ctx context.Context, db *sql.DB) (int64, error) {
+	res, err := db.ExecContext(ctx, `DELETE FROM passkey_challenges WHERE expires_at <= NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func EnsurePasskeyTables(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+        ALTER TABLE users ADD COLUMN IF NOT EXISTS webauthn_handle BYTEA UNIQUE;
+
+        CREATE TABLE IF NOT EXISTS passkeys (
+            id BIGSERIAL PRIMARY KEY,
+            user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+            credential_id BYTEA NOT NULL UNIQUE,
+            public_key BYTEA NOT NULL,
+            sign_count BIGINT NOT NULL DEFAULT 0,
+            name TEXT NOT NULL DEFAULT '',
+            transports TEXT NOT NULL DEFAULT '',
+            created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+            last_used_at TIMESTAMPTZ
+        );
+
+        CREATE INDEX IF NOT EXISTS idx_passkeys_user_id ON passkeys(user_id);
+
+        CREATE TABLE IF NOT EXISTS passkey_challenges (
+            challenge BYTEA PRIMARY KEY,
+            user_id BIGINT REFERENCES users(id) ON DELETE CASCADE,
+            purpose TEXT NOT NULL,
+            expires_at TIMESTAMPTZ NOT NULL
+        );
+    `)
+	return err
+}
@@ -0,0 +1,147 @@
+package account
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidResetToken = errors.New("invalid or expired reset token")
+	ErrResetTooSoon      = errors.New("a reset was requested moments ago")
+)
+
+const (
+	// PasswordResetTTL is how long an emailed reset link works.
+	PasswordResetTTL = time.Hour
+
+	// passwordResetCooldown keeps repeated requests from flooding an inbox.
+	passwordResetCooldown = time.Minute
+)
+
+// CreatePasswordReset issues a single-use reset token for a user. Only a
+// hash of the token is stored, so the database alone can't be used to
+// reset passwords; the token itself goes out by email.
+func CreatePasswordReset(ctx context.Context, db *sql.DB, userID int64) (string, error) {
+	var recent bool
+	err := db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM password_resets
+			WHERE user_id = $1 AND created_at > NOW() - make_interval(secs => $2)
+		)
+	`, userID, passwordResetCooldown.Seconds()).Scan(&recent)
+	if err != nil {
+		return "", err
+	}
+	if recent {
+		return "", ErrResetTooSoon
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO password_resets (token_hash, user_id, expires_at)
+		VALUES ($1, $2, NOW() + make_interval(secs => $3))
+	`, hashToken(token), userID, PasswordResetTTL.Seconds())
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// CheckPasswordReset reports whether a reset token can still be used.
+func CheckPasswordReset(ctx context.Context, db *sql.DB, token string) error {
+	var userID int64
+	err := db.QueryRowContext(ctx, `
+		SELECT user_id FROM password_resets
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+	`, hashToken(token)).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrInvalidResetToken
+	}
+	return err
+}
+
+// ResetPassword spends a reset token on a new password. Every other
+// outstanding token for the user is discarded and all of their sessions
+// are signed out. Following the emailed link also verifies the address.
+func ResetPassword(ctx context.Context, db *sql.DB, token, newPassword string) (int64, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var userID int64
+	err = tx.QueryRowContext(ctx, `
+		UPDATE password_resets
+		SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id
+	`, hashToken(token)).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrInvalidResetToken
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE users
+		 SET password_hash = $1,
+		     email_verified_at = COALESCE(email_verified_at, NOW())
+		 WHERE id = $2`,
+		string(hash), userID,
+	); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM password_resets WHERE user_id = $1 AND used_at IS NULL`,
+		userID,
+	); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = $1`, userID); err != nil {
+		return 0, err
+	}
+
+	return userID, tx.Commit()
+}
+
+// DeleteExpiredPasswordResets drops spent and expired reset tokens.
+func DeleteExpiredPasswordResets(ctx context.Context, db *sql.DB) (int64, error) {
+	res, err := db.ExecContext(ctx,
+		`DELETE FROM password_resets WHERE used_at IS NOT NULL OR expires_at <= NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func EnsurePasswordResetsTable(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS password_resets (
+            token_hash TEXT PRIMARY KEY,
+            user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+            created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+            expires_at TIMESTAMPTZ NOT NULL,
+            used_at TIMESTAMPTZ
+        );
+
+        CREATE INDEX IF NOT EXISTS idx_password_resets_user_id ON password_resets(user_id);
+    `)
+	return err
+}
@@ -0,0 +1,189 @@
+package account
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Sessions slide: each visit pushes expiry SessionIdleTTL into the future,
+// but never past SessionMaxAge after sign-in.
+const (
+	SessionIdleTTL = 7 * 24 * time.Hour
+	SessionMaxAge  = 90 * 24 * time.Hour
+
+	// SessionTouchInterval limits how often a busy session is written
+	// back to record activity.
+	SessionTouchInterval = 5 * time.Minute
+)
+
+// TouchSession records activity on a session from ip and slides its expiry
+// forward. It returns the new expiry, or false if the session was touched
+// within the last SessionTouchInterval and was left alone. Impersonation
+// sessions never slide; they end ImpersonationTTL after they start.
+func TouchSession(ctx context.Context, db *sql.DB, sid uuid.UUID, ip string) (time.Time, bool, error) {
+	var expires time.Time
+	err := db.QueryRowContext(ctx, `
+		UPDATE sessions
+		SET last_seen_at = NOW(),
+		    ip = $2,
+		    expires_at = LEAST(NOW() + make_interval(secs => $3), created_at + make_interval(secs => $4))
+		WHERE id = $1
+		  AND expires_at > NOW()
+		  AND impersonator_id IS NULL
+		  AND last_seen_at < NOW() - make_interval(secs => $5)
+		RETURNING expires_at
+	`, sid, ip, SessionIdleTTL.Seconds(), SessionMaxAge.Seconds(), SessionTouchInterval.Seconds()).Scan(&expires)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return expires, true, nil
+}
+
+// ListSessions returns a user's live sessions, most recently active first.
+// Sessions an admin is impersonating them through aren't included.
+func ListSessions(ctx context.Context, db *sql.DB, userID int64) ([]Session, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, user_id, created_at, expires_at, last_seen_at, user_agent, ip
+		FROM sessions
+		WHERE user_id = $1 AND expires_at > NOW() AND impersonator_id IS NULL
+		ORDER BY last_seen_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		var s Session
+		if err := rows.Scan(&s.ID, &s.UserID, &s.CreatedAt, &s.ExpiresAt, &s.LastSeenAt, &s.UserAgent, &s.IP); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// DeleteUserSession signs a user out of one of their own sessions.
+func DeleteUserSession(ctx context.Context, db *sql.DB, userID int64, sid uuid.UUID) error {
+	_, err := db.ExecContext(ctx, `DELETE FROM sessions WHERE id = $1 AND user_id = $2`, sid, userID)
+	return err
+}
+
+// DeleteUserSessions signs a user out everywhere.
+func DeleteUserSessions(ctx context.Context, db *sql.DB, userID int64) error {
+	_, err := db.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = $1`, userID)
+	return err
+}
+
+// DeleteExpiredSessions purges sessions past their expiry and returns how
+// many were removed.
+func DeleteExpiredSessions(ctx context.Context, db *sql.DB) (int64, error) {
+	res, err := db.ExecContext(ctx, `DELETE FROM sessions WHERE expires_at <= NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Sweep purges expired sessions, old login attempts, spent password reset
+// and email verification tokens and long-expired API tokens every interval
+// until ctx is done.
+func Sweep(ctx context.Context, db *sql.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := DeleteExpiredSessions(ctx, db); err != nil {
+			log.Printf("session sweep error: %v", err)
+		} else if n > 0 {
+			log.Printf("session sweep: removed %d expired sessions", n)
+		}
+		if n, err := DeleteOldLoginAttempts(ctx, db, LoginAttemptRetention); err != nil {
+			log.Printf("login attempt sweep error: %v", err)
+		} else if n > 0 {
+			log.Printf("login attempt sweep: removed %d old attempts", n)
+		}
+		if _, err := DeleteExpiredPasswordResets(ctx, db); err != nil {
+			log.Printf("password reset sweep error: %v", err)
+		}
+		if _, err := DeleteExpiredEmailVerifications(ctx, db); err != nil {
+			log.Printf("email verification sweep error: %v", err)
+		}
+		if _, err := DeleteExpiredPasskeyChallenges(ctx, db); err != nil {
+			log.Printf("passkey challenge sweep error: %v", err)
+		}
+		if _, err := DeleteExpiredAPITokens(ctx, db); err != nil {
+			log.Printf("API token sweep error: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Device describes the session's browser and operating system from its
+// user agent, e.g. "Firefox on Windows".
+func (s Session) Device() string {
+	ua := s.UserAgent
+	if ua == "" {
+		return "Unknown device"
+	}
+
+	browser := "Unknown browser"
+	switch {
+	case strings.Contains(ua, "Edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "OPR/"):
+		browser = "Opera"
+	case strings.Contains(ua, "Firefox/"), strings.Contains(ua, "FxiOS/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "Chrome/"), strings.Contains(ua, "CriOS/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "Safari/"):
+		browser = "Safari"
+	case strings.HasPrefix(ua, "curl/"):
+		browser = "curl"
+	}
+
+	var os string
+	switch {
+	case strings.Contains(ua, "iPhone"):
+		os = "iPhone"
+	case strings.Contains(ua, "iPad"):
+		os = "iPad"
+	case strings.Contains(ua, "Android"):
+		os = "Android"
+	case strings.Contains(ua, "Windows"):
+		os = "Windows"
+	case strings.Contains(ua, "Mac OS X"):
+		os = "macOS"
+	case strings.Contains(ua, "CrOS"):
+		os = "ChromeOS"
+	case strings.Contains(ua, "Linux"):
+		os = "Linux"
+	}
+	if os == "" {
+		return browser
+	}
+	return browser + " on " + os
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
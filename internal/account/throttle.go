@@ -0,0 +1,225 @@
+package account
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Failed sign-ins are throttled per account and per client IP. A few
+// mistakes are free; after that each further attempt has to wait twice as
+// long as the last, and enough failures lock sign-in out for LoginLockout.
+// Failures older than LoginWindow are forgotten, as are an account's
+// failures before its last successful sign-in.
+const (
+	LoginWindow  = 15 * time.Minute
+	LoginLockout = 15 * time.Minute
+
+	accountFreeFailures = 3
+	accountLockFailures = 10
+
+	// One address may be shared by a household or a game store, so it
+	// gets more room before slowing down.
+	ipFreeFailures = 10
+	ipLockFailures = 30
+
+	maxLoginDelay = time.Minute
+
+	// LoginAttemptRetention is how long the audit trail is kept.
+	LoginAttemptRetention = 90 * 24 * time.Hour
+)
+
+// LoginAttempt is one sign-in attempt, kept as an audit trail. Attempts
+// still in progress have a NULL succeeded column and aren't listed.
+type LoginAttempt struct {
+	Email       string
+	IP          string
+	UserAgent   string
+	Succeeded   bool
+	AttemptedAt time.Time
+}
+
+// LoginThrottle says whether a sign-in may be attempted now. When Wait is
+// positive it may not; Locked tells a lockout from a short delay.
+type LoginThrottle struct {
+	Wait   time.Duration
+	Locked bool
+}
+
+// BeginLogin applies the throttling rules to a sign-in for email from ip
+// and, when it may go ahead, reserves a pending attempt that counts as a
+// failure until FailLogin or CancelLogin settles it. Checking and
+// reserving happen under locks on the email and the IP, so guesses sent in
+// parallel are counted against each other. When Wait is positive nothing
+// is reserved and the ID is zero.
+func BeginLogin(ctx context.Context, db *sql.DB, email, ip, userAgent string) (int64, LoginThrottle, error) {
+	var t LoginThrottle
+	email = normalizeEmail(email)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, t, err
+	}
+	defer tx.Rollback()
+
+	// Always the email before the IP, so two sign-ins can't deadlock.
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(1, hashtext($1))`, email); err != nil {
+		return 0, t, err
+	}
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(2, hashtext($1))`, ip); err != nil {
+		return 0, t, err
+	}
+
+	n, last, err := recentFailures(ctx, tx, `
+		SELECT COUNT(*), MAX(attempted_at)
+		FROM login_attempts
+		WHERE email = $1 AND succeeded IS NOT TRUE
+		  AND attempted_at > NOW() - make_interval(secs => $2)
+		  AND attempted_at > COALESCE((
+		      SELECT MAX(attempted_at) FROM login_attempts WHERE email = $1 AND succeeded
+		  ), '-infinity')
+	`, email, LoginWindow.Seconds())
+	if err != nil {
+		return 0, t, err
+	}
+	t.apply(n, last, accountFreeFailures, accountLockFailures)
+
+	n, last, err = recentFailures(ctx, tx, `
+		SELECT COUNT(*), MAX(attempted_at)
+		FROM login_attempts
+		WHERE ip = $1 AND succeeded IS NOT TRUE
+		  AND attempted_at > NOW() - make_interval(secs => $2)
+	`, ip, LoginWindow.Seconds())
+	if err != nil {
+		return 0, t, err
+	}
+	t.apply(n, last, ipFreeFailures, ipLockFailures)
+
+	if t.Wait > 0 {
+		return 0, t, tx.Commit()
+	}
+
+	var id int64
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO login_attempts (email, ip, user_agent, succeeded)
+		VALUES ($1, $2, $3, NULL)
+		RETURNING id
+	`, email, ip, truncate(userAgent, 512)).Scan(&id)
+	if err != nil {
+		return 0, t, err
+	}
+	return id, t, tx.Commit()
+}
+
+// FailLogin records a reserved attempt as a failed sign-in.
+func FailLogin(ctx context.Context, db *sql.DB, id int64) error {
+	_, err := db.ExecContext(ctx,
+		`UPDATE login_attempts SET succeeded = FALSE WHERE id = $1 AND succeeded IS NULL`, id)
+	return err
+}
+
+// CancelLogin drops a reserved attempt that didn't fail, such as a right
+// password that still needs a second factor. Successful sign-ins are
+// recorded by RecordLoginAttempt once every step has passed.
+func CancelLogin(ctx context.Context, db *sql.DB, id int64) error {
+	_, err := db.ExecContext(ctx,
+		`DELETE FROM login_attempts WHERE id = $1 AND succeeded IS NULL`, id)
+	return err
+}
+
+func recentFailures(ctx context.Context, tx *sql.Tx, query string, args ...any) (int, time.Time, error) {
+	var n int
+	var last sql.NullTime
+	if err := tx.QueryRowContext(ctx, query, args...).Scan(&n, &last); err != nil {
+		return 0, time.Time{}, err
+	}
+	return n, last.Time, nil
+}
+
+// apply folds one counter into the throttle, keeping the longer wait.
+func (t *LoginThrottle) apply(failures int, last time.Time, free, lock int) {
+	if failures < free {
+		return
+	}
+
+	locked := failures >= lock
+	delay := LoginLockout
+	if !locked {
+		delay = min(time.Second<<(failures-free), maxLoginDelay)
+	}
+
+	if wait := time.Until(last.Add(delay)); wait > t.Wait {
+		t.Wait = wait
+		t.Locked = locked
+	}
+}
+
+// RecordLoginAttempt adds a finished sign-in attempt to the audit trail,
+// which is also what BeginLogin counts.
+func RecordLoginAttempt(ctx context.Context, db *sql.DB, email, ip, userAgent string, succeeded bool) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO login_attempts (email, ip, user_agent, succeeded)
+		VALUES ($1, $2, $3, $4)
+	`, normalizeEmail(email), ip, truncate(userAgent, 512), succeeded)
+	return err
+}
+
+// ListFailedLogins returns the most recent failed sign-ins for an email.
+func ListFailedLogins(ctx context.Context, db *sql.DB, email string, limit int) ([]LoginAttempt, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT email, ip, user_agent, succeeded, attempted_at
+		FROM login_attempts
+		WHERE email = $1 AND NOT succeeded
+		ORDER BY attempted_at DESC
+		LIMIT $2
+	`, normalizeEmail(email), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []LoginAttempt
+	for rows.Next() {
+		var a LoginAttempt
+		if err := rows.Scan(&a.Email, &a.IP, &a.UserAgent, &a.Succeeded, &a.AttemptedAt); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
+
+// Device describes the attempt's browser and operating system.
+func (a LoginAttempt) Device() string {
+	return Session{UserAgent: a.UserAgent}.Device()
+}
+
+// DeleteOldLoginAttempts drops audit entries older than keep.
+func DeleteOldLoginAttempts(ctx context.Context, db *sql.DB, keep time.Duration) (int64, error) {
+	res, err := db.ExecContext(ctx,
+		`DELETE FROM login_attempts WHERE attempted_at < NOW() - make_interval(secs => $1)`,
+		keep.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func EnsureLoginAttemptsTable(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS login_attempts (
+            id BIGSERIAL PRIMARY KEY,
+            email TEXT NOT NULL,
+            ip TEXT NOT NULL,
+            user_agent TEXT NOT NULL DEFAULT '',
+            succeeded BOOLEAN,
+            attempted_at TIMESTAMPTZ NOT NULL DEFAULT now()
+        );
+
+        ALTER TABLE login_attempts ALTER COLUMN succeeded DROP NOT NULL;
+
+        CREATE INDEX IF NOT EXISTS idx_login_attempts_email ON login_attempts(email, attempted_at);
+        CREATE INDEX IF NOT EXISTS idx_login_attempts_ip ON login_attempts(ip, attempted_at);
+    `)
+	return err
+}
@@ -0,0 +1,349 @@
+package account
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"manatomb/app/internal/secretbox"
+)
+
+var (
+	ErrInvalidTOTPCode = errors.New("invalid two-factor code")
+	ErrTOTPEnabled     = errors.New("two-factor authentication is already on")
+	ErrTOTPNotPending  = errors.New("no two-factor enrollment in progress")
+	ErrTOTPNotEnabled  = errors.New("two-factor authentication is off")
+)
+
+// Codes are standard TOTP (RFC 6238) as authenticator apps expect: HMAC-SHA1,
+// six digits, a new code every 30 seconds. One step either side is accepted
+// for clock drift, and a code can't be used twice.
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	totpSkew   = 1
+
+	// RecoveryCodeCount is how many single-use recovery codes a user gets.
+	RecoveryCodeCount = 10
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TOTPKeyURI is the otpauth:// URI authenticator apps scan from a QR code.
+func TOTPKeyURI(secret []byte, issuer, accountName string) string {
+	q := url.Values{}
+	q.Set("secret", totpEncoding.EncodeToString(secret))
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(totpDigits))
+	q.Set("period", fmt.Sprint(totpPeriod))
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(accountName)
+	// Some apps show "+" literally, so spaces are sent as %20.
+	return "otpauth://totp/" + label + "?" + strings.ReplaceAll(q.Encode(), "+", "%20")
+}
+
+// FormatTOTPSecret renders a secret for typing into an app by hand, in
+// groups of four characters.
+func FormatTOTPSecret(secret []byte) string {
+	s := totpEncoding.EncodeToString(secret)
+	var b strings.Builder
+	for i := 0; i < len(s); i += 4 {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(s[i:min(i+4, len(s))])
+	}
+	return b.String()
+}
+
+// totpCode is the code for one time step, per RFC 4226 section 5.3.
+func totpCode(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	n := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, n%1_000_000)
+}
+
+// matchTOTP finds the time step code belongs to near now, skipping steps
+// at or before after so used codes don't match again.
+func matchTOTP(secret []byte, code string, now time.Time, after int64) (int64, bool) {
+	current := now.Unix() / totpPeriod
+	for d := int64(-totpSkew); d <= totpSkew; d++ {
+		step := current + d
+		if step > after && hmac.Equal([]byte(code), []byte(totpCode(secret, step))) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// isTOTPCode reports whether input looks like an authenticator code rather
+// than a recovery code.
+func isTOTPCode(input string) bool {
+	if len(input) != totpDigits {
+		return false
+	}
+	for _, r := range input {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// BeginTOTP starts enrollment with a fresh secret, replacing any earlier
+// unfinished one. Two-factor stays off until EnableTOTP confirms a code.
+func BeginTOTP(ctx context.Context, db *sql.DB, box *secretbox.Box, userID int64) error {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+	sealed, err := box.Seal(secret)
+	if err != nil {
+		return err
+	}
+
+	res, err := db.ExecContext(ctx, `
+		UPDATE users SET totp_secret = $1, totp_last_step = 0
+		WHERE id = $2 AND totp_enabled_at IS NULL
+	`, sealed, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrTOTPEnabled
+	}
+	return nil
+}
+
+// PendingTOTPSecret returns the secret of an enrollment in progress.
+func PendingTOTPSecret(ctx context.Context, db *sql.DB, box *secretbox.Box, userID int64) ([]byte, error) {
+	var sealed string
+	err := db.QueryRowContext(ctx, `
+		SELECT totp_secret FROM users
+		WHERE id = $1 AND totp_secret IS NOT NULL AND totp_enabled_at IS NULL
+	`, userID).Scan(&sealed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTOTPNotPending
+	}
+	if err != nil {
+		return nil, err
+	}
+	return box.Open(sealed)
+}
+
+// EnableTOTP finishes enrollment once the user proves their app works by
+// entering a code from it. It returns the user's new recovery codes, which
+// can't be recovered afterwards.
+func EnableTOTP(ctx context.Context, db *sql.DB, box *secretbox.Box, userID int64, code string) ([]string, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var sealed string
+	err = tx.QueryRowContext(ctx, `
+		SELECT totp_secret FROM users
+		WHERE id = $1 AND totp_secret IS NOT NULL AND totp_enabled_at IS NULL
+		FOR UPDATE
+	`, userID).Scan(&sealed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTOTPNotPending
+	}
+	if err != nil {
+		return nil, err
+	}
+	secret, err := box.Open(sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	step, ok := matchTOTP(secret, strings.ReplaceAll(code, " ", ""), time.Now(), 0)
+	if !ok {
+		return nil, ErrInvalidTOTPCode
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE users SET totp_enabled_at = NOW(), totp_last_step = $1 WHERE id = $2`,
+		step, userID,
+	); err != nil {
+		return nil, err
+	}
+
+	codes, err := replaceRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return codes, tx.Commit()
+}
+
+// VerifySecondFactor checks a code from the user's authenticator app or
+// one of their recovery codes, spending it either way. It reports whether
+// a recovery code was used.
+func VerifySecondFactor(ctx context.Context, db *sql.DB, box *secretbox.Box, userID int64, input string) (bool, error) {
+	if code := strings.ReplaceAll(strings.TrimSpace(input), " ", ""); isTOTPCode(code) {
+		return false, verifyTOTP(ctx, db, box, userID, code)
+	}
+	return true, useRecoveryCode(ctx, db, userID, input)
+}
+
+func verifyTOTP(ctx context.Context, db *sql.DB, box *secretbox.Box, userID int64, code string) error {
+	var sealed string
+	var lastStep int64
+	err := db.QueryRowContext(ctx, `
+		SELECT totp_secret, totp_last_step FROM users
+		WHERE id = $1 AND totp_enabled_at IS NOT NULL
+	`, userID).Scan(&sealed, &lastStep)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrTOTPNotEnabled
+	}
+	if err != nil {
+		return err
+	}
+	secret, err := box.Open(sealed)
+	if err != nil {
+		return err
+	}
+
+	step, ok := matchTOTP(secret, code, time.Now(), lastStep)
+	if !ok {
+		return ErrInvalidTOTPCode
+	}
+
+	// Claim the step; a concurrent request with the same code loses.
+	res, err := db.ExecContext(ctx,
+		`UPDATE users SET totp_last_step = $1 WHERE id = $2 AND totp_last_step < $1`,
+		step, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrInvalidTOTPCode
+	}
+	return nil
+}
+
+// DisableTOTP turns two-factor off and discards the secret and recovery
+// codes.
+func DisableTOTP(ctx context.Context, db *sql.DB, userID int64) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0
+		WHERE id = $1
+	`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Recovery codes stand in for the authenticator app when it's lost. Each
+// works once; like emailed tokens, only their hashes are stored.
+
+// RegenerateRecoveryCodes replaces all of a user's recovery codes.
+func RegenerateRecoveryCodes(ctx context.Context, db *sql.DB, userID int64) ([]string, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	codes, err := replaceRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return codes, tx.Commit()
+}
+
+// RecoveryCodesLeft counts a user's unused recovery codes.
+func RecoveryCodesLeft(ctx context.Context, db *sql.DB, userID int64) (int, error) {
+	var n int
+	err := db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL`,
+		userID,
+	).Scan(&n)
+	return n, err
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int64) ([]string, error) {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		c := strings.ToLower(totpEncoding.EncodeToString(b)[:12])
+		codes[i] = c[:4] + "-" + c[4:8] + "-" + c[8:]
+
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)`,
+			userID, hashToken(c),
+		); err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+func useRecoveryCode(ctx context.Context, db *sql.DB, userID int64, code string) error {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	res, err := db.ExecContext(ctx, `
+		UPDATE recovery_codes SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`, userID, hashToken(code))
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrInvalidTOTPCode
+	}
+	return nil
+}
+
+func EnsureRecoveryCodesTable(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS recovery_codes (
+            id BIGSERIAL PRIMARY KEY,
+            user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+            code_hash TEXT NOT NULL,
+            created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+            used_at TIMESTAMPTZ
+        );
+
+        CREATE INDEX IF NOT EXISTS idx_recovery_codes_user_id ON recovery_codes(user_id);
+    `)
+	return err
+}
@@ -0,0 +1,208 @@
+package account
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrInvalidVerifyToken = errors.New("invalid or expired verification token")
+	ErrVerifyTooSoon      = errors.New("a verification email was sent moments ago")
+	ErrEmailTaken         = errors.New("email already in use")
+)
+
+const (
+	// EmailVerificationTTL is how long an emailed verification link works.
+	EmailVerificationTTL = 24 * time.Hour
+
+	emailVerificationCooldown = time.Minute
+)
+
+// EmailChange is the outcome of following a verification link. OldEmail
+// differs from NewEmail when the link confirmed a change of address.
+type EmailChange struct {
+	UserID   int64
+	OldEmail string
+	NewEmail string
+}
+
+// Changed reports whether the user's address changed.
+func (c EmailChange) Changed() bool {
+	return c.OldEmail != c.NewEmail
+}
+
+// CreateEmailVerification issues a single-use token proving the user can
+// read mail sent to email. For the user's current address it verifies it;
+// for another address it moves the account there once followed.
+func CreateEmailVerification(ctx context.Context, db *sql.DB, userID int64, email string) (string, error) {
+	var recent bool
+	err := db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM email_verifications
+			WHERE user_id = $1 AND created_at > NOW() - make_interval(secs => $2)
+		)
+	`, userID, emailVerificationCooldown.Seconds()).Scan(&recent)
+	if err != nil {
+		return "", err
+	}
+	if recent {
+		return "", ErrVerifyTooSoon
+	}
+
+	if taken, err := emailTaken(ctx, db, userID, email); err != nil {
+		return "", err
+	} else if taken {
+		return "", ErrEmailTaken
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO email_verifications (token_hash, user_id, email, expires_at)
+		VALUES ($1, $2, $3, NOW() + make_interval(secs => $4))
+	`, hashToken(token), userID, normalizeEmail(email), EmailVerificationTTL.Seconds())
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ConfirmEmail spends a verification token: the address it was sent to
+// becomes the user's verified email, and any other pending links for the
+// user stop working, as do password reset links sent to an old address.
+func ConfirmEmail(ctx context.Context, db *sql.DB, token string) (EmailChange, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return EmailChange{}, err
+	}
+	defer tx.Rollback()
+
+	var c EmailChange
+	err = tx.QueryRowContext(ctx, `
+		UPDATE email_verifications
+		SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id, email
+	`, hashToken(token)).Scan(&c.UserID, &c.NewEmail)
+	if errors.Is(err, sql.ErrNoRows) {
+		return EmailChange{}, ErrInvalidVerifyToken
+	}
+	if err != nil {
+		return EmailChange{}, err
+	}
+
+	err = tx.QueryRowContext(ctx,
+		`SELECT email FROM users WHERE id = $1 FOR UPDATE`,
+		c.UserID,
+	).Scan(&c.OldEmail)
+	if err != nil {
+		return EmailChange{}, err
+	}
+
+	// Someone else may have taken the address since the link was sent.
+	if taken, err := emailTaken(ctx, tx, c.UserID, c.NewEmail); err != nil {
+		return EmailChange{}, err
+	} else if taken {
+		return EmailChange{}, ErrEmailTaken
+	}
+
+	// Links sent before emails were normalized may carry capitals.
+	c.NewEmail = normalizeEmail(c.NewEmail)
+	_, err = tx.ExecContext(ctx,
+		`UPDATE users SET email = $1, email_verified_at = NOW() WHERE id = $2`,
+		c.NewEmail, c.UserID,
+	)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return EmailChange{}, ErrEmailTaken
+	}
+	if err != nil {
+		return EmailChange{}, err
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM email_verifications WHERE user_id = $1 AND used_at IS NULL`,
+		c.UserID,
+	); err != nil {
+		return EmailChange{}, err
+	}
+
+	// Reset links went to the old address, whose owner may not be the
+	// account's any more.
+	if c.Changed() {
+		if _, err := tx.ExecContext(ctx,
+			`DELETE FROM password_resets WHERE user_id = $1 AND used_at IS NULL`,
+			c.UserID,
+		); err != nil {
+			return EmailChange{}, err
+		}
+	}
+
+	return c, tx.Commit()
+}
+
+// PendingEmailChange returns the address a user has asked to move to and
+// not yet confirmed, or "".
+func PendingEmailChange(ctx context.Context, db *sql.DB, userID int64) (string, error) {
+	var email string
+	err := db.QueryRowContext(ctx, `
+		SELECT v.email
+		FROM email_verifications v
+		JOIN users u ON u.id = v.user_id
+		WHERE v.user_id = $1 AND v.used_at IS NULL AND v.expires_at > NOW()
+		  AND lower(v.email) <> lower(u.email)
+		ORDER BY v.created_at DESC
+		LIMIT 1
+	`, userID).Scan(&email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return email, err
+}
+
+// DeleteExpiredEmailVerifications drops spent and expired verification
+// tokens.
+func DeleteExpiredEmailVerifications(ctx context.Context, db *sql.DB) (int64, error) {
+	res, err := db.ExecContext(ctx,
+		`DELETE FROM email_verifications WHERE used_at IS NOT NULL OR expires_at <= NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// emailTaken reports whether another account uses email, ignoring case.
+// It runs on either the database or a transaction.
+func emailTaken(ctx context.Context, db interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}, userID int64, email string) (bool, error) {
+	var taken bool
+	err := db.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM users WHERE lower(email) = lower($1) AND id <> $2)`,
+		email, userID,
+	).Scan(&taken)
+	return taken, err
+}
+
+func EnsureEmailVerificationsTable(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS email_verifications (
+            token_hash TEXT PRIMARY KEY,
+            user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+            email TEXT NOT NULL,
+            created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+            expires_at TIMESTAMPTZ NOT NULL,
+            used_at TIMESTAMPTZ
+        );
+
+        CREATE INDEX IF NOT EXISTS idx_email_verifications_user_id ON email_verifications(user_id);
+    `)
+	return err
+}
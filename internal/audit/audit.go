@@ -0,0 +1,103 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Actions recorded in the log.
+const (
+	ActionUserRole    = "user.role"
+	ActionUserDisable = "user.disable"
+	ActionUserEnable  = "user.enable"
+	ActionUserDelete  = "user.delete"
+
+	ActionImpersonateStart   = "impersonate.start"
+	ActionImpersonateStop    = "impersonate.stop"
+	ActionImpersonateRequest = "impersonate.request"
+
+	ActionDeckHide      = "deck.hide"
+	ActionDeckUnhide    = "deck.unhide"
+	ActionDeckFeature   = "deck.feature"
+	ActionDeckUnfeature = "deck.unfeature"
+	ActionReportDismiss = "report.dismiss"
+)
+
+// Kinds of thing an entry can be about.
+const (
+	TargetUser   = "user"
+	TargetDeck   = "deck"
+	TargetReport = "report"
+)
+
+// Entry is one staff action. ActorName and Summary are written at the time,
+// so entries still read sensibly after the accounts involved are deleted;
+// ActorID is 0 by then.
+type Entry struct {
+	ID         int64
+	ActorID    int64
+	ActorName  string
+	Action     string
+	TargetType string
+	TargetID   int64
+	Summary    string
+	IP         string
+	CreatedAt  time.Time
+}
+
+// Record appends an entry to the log. Entries are never changed or
+// removed.
+func Record(ctx context.Context, db *sql.DB, e Entry) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO audit_log (actor_id, actor_name, action, target_type, target_id, summary, ip)
+		VALUES (NULLIF($1, 0), $2, $3, $4, $5, $6, $7)
+	`, e.ActorID, e.ActorName, e.Action, e.TargetType, e.TargetID, e.Summary, e.IP)
+	return err
+}
+
+// List returns entries newest first. With a targetType it is narrowed to
+// entries about that one target.
+func List(ctx context.Context, db *sql.DB, targetType string, targetID int64, limit, offset int) ([]Entry, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, COALESCE(actor_id, 0), actor_name, action, target_type, target_id, summary, ip, created_at
+		FROM audit_log
+		WHERE $1 = '' OR (target_type = $1 AND target_id = $2)
+		ORDER BY id DESC
+		LIMIT $3 OFFSET $4
+	`, targetType, targetID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Entry
+	for rows.Next() {
+		var e Entry
+		if err := rows.Scan(&e.ID, &e.ActorID, &e.ActorName, &e.Action, &e.TargetType, &e.TargetID,
+			&e.Summary, &e.IP, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+func EnsureAuditTable(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS audit_log (
+            id BIGSERIAL PRIMARY KEY,
+            actor_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+            actor_name TEXT NOT NULL DEFAULT '',
+            action TEXT NOT NULL,
+            target_type TEXT NOT NULL DEFAULT '',
+            target_id BIGINT NOT NULL DEFAULT 0,
+            summary TEXT NOT NULL DEFAULT '',
+            ip TEXT NOT NULL DEFAULT '',
+            created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+        );
+
+        CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target_type, target_id);
+    `)
+	return err
+}
@@ -0,0 +1,121 @@
+package boosters
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"manatomb/app/internal/cards"
+)
+
+var ErrUnknownSet = errors.New("no booster cards found for that set")
+
+// LoadSet returns the booster printings of a set. Sets are fetched from
+// Scryfall the first time they're opened and read from set_cards after.
+func LoadSet(ctx context.Context, db *sql.DB, scry *cards.ScryfallClient, code string) ([]cards.Printing, error) {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if code == "" {
+		return nil, ErrUnknownSet
+	}
+
+	printings, err := listSetCards(ctx, db, code)
+	if err != nil || len(printings) > 0 {
+		return printings, err
+	}
+
+	printings, err = scry.SetPrintings(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if len(printings) == 0 {
+		return nil, ErrUnknownSet
+	}
+
+	if err := storeSetCards(ctx, db, code, printings); err != nil {
+		return nil, err
+	}
+	return printings, nil
+}
+
+func listSetCards(ctx context.Context, db *sql.DB, code string) ([]cards.Printing, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT collector_number, name, rarity, mana_cost, type_line, oracle_text, image_uri, color_identity, scryfall_id,
+		       color_indicator, power, toughness
+		FROM set_cards
+		WHERE set_code = $1
+	`, code)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []cards.Printing
+	for rows.Next() {
+		p := cards.Printing{Set: code}
+		if err := rows.Scan(&p.CollectorNumber, &p.Name, &p.Rarity, &p.ManaCost, &p.TypeLine, &p.OracleText, &p.ImageURI, &p.ColorIdentity, &p.ScryfallID,
+			&p.ColorIndicator, &p.Power, &p.Toughness); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+func storeSetCards(ctx context.Context, db *sql.DB, code string, printings []cards.Printing) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, p := range printings {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO set_cards (set_code, collector_number, name, rarity, mana_cost, type_line, oracle_text, image_uri, color_identity, scryfall_id,
+			                       color_indicator, power, toughness)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+			ON CONFLICT (set_code, collector_number) DO NOTHING
+		`, code, p.CollectorNumber, p.Name, p.Rarity, p.ManaCost, p.TypeLine, p.OracleText, p.ImageURI, p.ColorIdentity, p.ScryfallID,
+			p.ColorIndicator, p.Power, p.Toughness); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func EnsureBoosterTables(ctx context.Context, db *sql.DB) error {
+	// Booster printings per set, cached from Scryfall
+	if _, err := db.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS set_cards (
+            set_code TEXT NOT NULL,
+            collector_number TEXT NOT NULL,
+            name TEXT NOT NULL,
+            rarity TEXT NOT NULL,
+            mana_cost TEXT NOT NULL DEFAULT '',
+            type_line TEXT NOT NULL DEFAULT '',
+            oracle_text TEXT NOT NULL DEFAULT '',
+            image_uri TEXT NOT NULL DEFAULT '',
+            color_identity TEXT NOT NULL DEFAULT '',
+            PRIMARY KEY (set_code, collector_number)
+        );
+    `); err != nil {
+		return err
+	}
+
+	if _, err := db.ExecContext(ctx, `
+        ALTER TABLE set_cards ADD COLUMN IF NOT EXISTS scryfall_id TEXT NOT NULL DEFAULT '';
+    `); err != nil {
+		return err
+	}
+
+	if _, err := db.ExecContext(ctx, `
+        ALTER TABLE set_cards
+            ADD COLUMN IF NOT EXISTS color_indicator TEXT NOT NULL DEFAULT '',
+            ADD COLUMN IF NOT EXISTS power TEXT NOT NULL DEFAULT '',
+            ADD COLUMN IF NOT EXISTS toughness TEXT NOT NULL DEFAULT '';
+    `); err != nil {
+		return err
+	}
+
+	return nil
+}
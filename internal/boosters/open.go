@@ -0,0 +1,172 @@
+package boosters
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+
+	"manatomb/app/internal/cards"
+)
+
+// PackCard is a card opened from a pack.
+type PackCard struct {
+	cards.Printing
+	Slot string
+	Foil bool
+}
+
+// Sealed opens count packs of the template from the set's printings. The
+// same set, template, count and seed always give the same pool.
+func Sealed(set []cards.Printing, t Template, count int, seed int64) [][]PackCard {
+	// Sort so the result doesn't depend on the order the printings were
+	// loaded in.
+	printings := append([]cards.Printing(nil), set...)
+	sort.Slice(printings, func(i, j int) bool {
+		if printings[i].CollectorNumber != printings[j].CollectorNumber {
+			return printings[i].CollectorNumber < printings[j].CollectorNumber
+		}
+		return printings[i].Name < printings[j].Name
+	})
+
+	// Group by rarity once; basics are kept apart for the land slot.
+	byRarity := map[string][]cards.Printing{}
+	var basics []cards.Printing
+	for _, p := range printings {
+		if isBasic(p) {
+			basics = append(basics, p)
+			continue
+		}
+		byRarity[p.Rarity] = append(byRarity[p.Rarity], p)
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	packs := make([][]PackCard, count)
+	for i := range packs {
+		packs[i] = openPack(rng, t, byRarity, basics)
+	}
+	return packs
+}
+
+func openPack(rng *rand.Rand, t Template, byRarity map[string][]cards.Printing, basics []cards.Printing) []PackCard {
+	var pack []PackCard
+	inPack := map[string]bool{}
+
+	for _, slot := range t.Slots {
+		for n := 0; n < slot.Count; n++ {
+			var pool []cards.Printing
+			if slot.Basic {
+				pool = basics
+			} else {
+				pool = byRarity[pickRarity(rng, slot.Rarities, byRarity)]
+			}
+			if len(pool) == 0 {
+				continue
+			}
+
+			// Avoid repeats within a pack while the pool allows it; foils
+			// may repeat a non-foil, as in real packs.
+			p := pool[rng.Intn(len(pool))]
+			for tries := 0; tries < len(pool) && !slot.Foil && inPack[p.Name]; tries++ {
+				p = pool[rng.Intn(len(pool))]
+			}
+			if !slot.Foil {
+				inPack[p.Name] = true
+			}
+
+			pack = append(pack, PackCard{Printing: p, Slot: slot.Name, Foil: slot.Foil})
+		}
+	}
+	return pack
+}
+
+// pickRarity draws a rarity by weight, skipping rarities the set doesn't
+// have. With no weights, every card in the set is equally likely.
+func pickRarity(rng *rand.Rand, weights map[string]int, byRarity map[string][]cards.Printing) string {
+	if len(weights) == 0 {
+		weights = map[string]int{}
+		for r, list := range byRarity {
+			weights[r] = len(list)
+		}
+	}
+
+	// Map iteration order is random, so walk the rarities in a fixed
+	// order to keep results reproducible.
+	var names []string
+	total := 0
+	for r, w := range weights {
+		if w > 0 && len(byRarity[r]) > 0 {
+			names = append(names, r)
+			total += w
+		}
+	}
+	if total == 0 {
+		return ""
+	}
+	sort.Strings(names)
+
+	n := rng.Intn(total)
+	for _, r := range names {
+		if n < weights[r] {
+			return r
+		}
+		n -= weights[r]
+	}
+	return names[len(names)-1]
+}
+
+func isBasic(p cards.Printing) bool {
+	return strings.HasPrefix(p.TypeLine, "Basic Land")
+}
+
+// PoolCard is one distinct card in a sealed pool.
+type PoolCard struct {
+	cards.Printing
+	Count int
+	Foils int
+}
+
+// Pool merges the packs into one list of distinct cards, sorted by color
+// identity and then name, as a deck builder would lay them out.
+func Pool(packs [][]PackCard) []PoolCard {
+	index := map[string]int{}
+	var out []PoolCard
+	for _, pack := range packs {
+		for _, c := range pack {
+			i, ok := index[c.Name]
+			if !ok {
+				i = len(out)
+				index[c.Name] = i
+				out = append(out, PoolCard{Printing: c.Printing})
+			}
+			out[i].Count++
+			if c.Foil {
+				out[i].Foils++
+			}
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if ra, rb := colorRank(a.ColorIdentity), colorRank(b.ColorIdentity); ra != rb {
+			return ra < rb
+		}
+		if a.ColorIdentity != b.ColorIdentity {
+			return a.ColorIdentity < b.ColorIdentity
+		}
+		return a.Name < b.Name
+	})
+	return out
+}
+
+// colorRank orders mono-colored cards in WUBRG order, then multicolor by
+// number of colors, with colorless last.
+func colorRank(identity string) int {
+	switch len(identity) {
+	case 0:
+		return 100
+	case 1:
+		return strings.Index("WUBRG", identity)
+	default:
+		return 10 + len(identity)
+	}
+}
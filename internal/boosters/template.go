@@ -0,0 +1,68 @@
+package boosters
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+var ErrUnknownTemplate = errors.New("unknown booster template")
+
+// Slot is one kind of card in a pack. Rarities weights which rarity each
+// card in the slot is drawn at (e.g. rare 7, mythic 1); an empty map means
+// any rarity, weighted by how many cards of it the set has. Basic slots
+// draw only basic lands, and other slots never do.
+type Slot struct {
+	Name     string         `json:"name"`
+	Count    int            `json:"count"`
+	Rarities map[string]int `json:"rarities"`
+	Basic    bool           `json:"basic"`
+	Foil     bool           `json:"foil"`
+}
+
+// Template describes the contents of one booster type.
+type Template struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+	Slots []Slot `json:"slots"`
+}
+
+// Size is the number of cards in a pack.
+func (t Template) Size() int {
+	n := 0
+	for _, s := range t.Slots {
+		n += s.Count
+	}
+	return n
+}
+
+// LoadTemplates reads the booster templates from a JSON file, in the order
+// they should be offered.
+func LoadTemplates(path string) ([]Template, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []Template
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, t := range out {
+		if t.Name == "" || t.Size() == 0 {
+			return nil, fmt.Errorf("%s: template %q has no name or no cards", path, t.Name)
+		}
+	}
+	return out, nil
+}
+
+// Find returns the template with the given name.
+func Find(templates []Template, name string) (Template, error) {
+	for _, t := range templates {
+		if t.Name == name {
+			return t, nil
+		}
+	}
+	return Template{}, ErrUnknownTemplate
+}
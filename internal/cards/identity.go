@@ -0,0 +1,121 @@
+package cards
+
+import (
+	"strings"
+)
+
+// ColorIdentity computes a card's color identity under the Commander
+// rules: the colors of every mana symbol in its mana costs and rules text
+// on both faces, plus its color indicators, in WUBRG order. Reminder text
+// doesn't count, but a card that says it is all colors (Transguild
+// Courier) has all five.
+func ColorIdentity(c Card) string {
+	if strings.Contains(rulesText(c.OracleText), c.Name+" is all colors") {
+		return "WUBRG"
+	}
+
+	var colors []string
+	for _, s := range []string{
+		c.ColorIndicator,
+		c.BackColorIndicator,
+		symbolColors(c.ManaCost),
+		symbolColors(c.BackManaCost),
+		symbolColors(rulesText(c.OracleText)),
+		symbolColors(rulesText(c.BackOracleText)),
+	} {
+		for _, r := range s {
+			colors = append(colors, string(r))
+		}
+	}
+	return joinColors(colors)
+}
+
+// WithinIdentity reports whether a card with color identity card can go
+// in a deck whose commander has identity commander.
+func WithinIdentity(card, commander string) bool {
+	for _, r := range card {
+		if !strings.ContainsRune(commander, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// CanBeCommander reports whether the card can lead a Commander deck on its
+// own: a legendary creature (including one that is only a creature off
+// the battlefield), a legendary Vehicle or Spacecraft with power and
+// toughness, or a card whose text says it can be your commander. Only the
+// front face counts. Backgrounds need a partner; see IsBackground.
+func CanBeCommander(c Card) bool {
+	front := frontType(c)
+	if !strings.Contains(front, "Legendary") {
+		return strings.Contains(rulesText(c.OracleText), "can be your commander")
+	}
+
+	text := rulesText(c.OracleText)
+	switch {
+	case strings.Contains(front, "Creature"):
+		return true
+	case strings.Contains(front, "Vehicle"), strings.Contains(front, "Spacecraft"):
+		return c.Power != "" && c.Toughness != ""
+	case strings.Contains(text, "isn't on the battlefield, it's a") && strings.Contains(text, "creature"):
+		// Grist, the Hunger Tide is a creature in the command zone.
+		return true
+	}
+	return strings.Contains(text, "can be your commander")
+}
+
+// IsBackground reports whether the card is a legendary Background, which
+// can only be a second commander alongside a creature that has "Choose a
+// Background".
+func IsBackground(c Card) bool {
+	front := frontType(c)
+	return strings.Contains(front, "Legendary") && strings.Contains(front, "Background")
+}
+
+// frontType is the type line of the card's front face, or of its first
+// half for split and adventure cards.
+func frontType(c Card) string {
+	front, _, _ := strings.Cut(c.TypeLine, "//")
+	return front
+}
+
+// rulesText drops reminder text, which is in parentheses.
+func rulesText(text string) string {
+	var b strings.Builder
+	depth := 0
+	for _, r := range text {
+		switch {
+		case r == '(':
+			depth++
+		case r == ')' && depth > 0:
+			depth--
+		case depth == 0:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// symbolColors returns the colors of the mana symbols in text, skipping
+// symbols like {T} that aren't mana.
+func symbolColors(text string) string {
+	var colors []string
+	for {
+		start := strings.IndexByte(text, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(text[start:], '}')
+		if end < 0 {
+			break
+		}
+		if s, err := parseManaSymbol(strings.ToUpper(text[start+1 : start+end])); err == nil {
+			for _, r := range s.Colors {
+				colors = append(colors, string(r))
+			}
+		}
+		text = text[start+end+1:]
+	}
+	return joinColors(colors)
+}
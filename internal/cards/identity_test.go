@@ -0,0 +1,240 @@
+package cards
+
+import "testing"
+
+func TestColorIdentity(t *testing.T) {
+	tests := []struct {
+		name string
+		card Card
+		want string
+	}{
+		{
+			name: "mana cost and rules text",
+			card: Card{Name: "Llanowar Elves", ManaCost: "{G}", OracleText: "{T}: Add {G}."},
+			want: "G",
+		},
+		{
+			name: "colorless",
+			card: Card{Name: "Sol Ring", ManaCost: "{1}", OracleText: "{T}: Add {C}{C}."},
+			want: "",
+		},
+		{
+			name: "symbols in rules text only",
+			card: Card{Name: "Cabal Coffers", OracleText: "{2}, {T}: Add {B} for each Swamp you control."},
+			want: "B",
+		},
+		{
+			name: "reminder text doesn't count",
+			card: Card{
+				Name:       "Syndic of Tithes",
+				ManaCost:   "{2}{W}",
+				OracleText: "Extort (Whenever you cast a spell, you may pay {W/B}. If you do, each opponent loses 1 life and you gain that much life.)",
+			},
+			want: "W",
+		},
+		{
+			name: "hybrid",
+			card: Card{Name: "Kitchen Finks", ManaCost: "{1}{G/W}{G/W}"},
+			want: "WG",
+		},
+		{
+			name: "phyrexian",
+			card: Card{Name: "Tamiyo, Compleated Sage", ManaCost: "{2}{G}{G/U/P}{U}"},
+			want: "UG",
+		},
+		{
+			name: "split card",
+			card: Card{Name: "Fire // Ice", ManaCost: "{1}{R} // {1}{U}"},
+			want: "UR",
+		},
+		{
+			name: "modal double-faced card",
+			card: Card{
+				Name:         "Valki, God of Lies",
+				ManaCost:     "{1}{B}",
+				BackManaCost: "{5}{R}{R}",
+			},
+			want: "BR",
+		},
+		{
+			name: "color indicator",
+			card: Card{Name: "Dryad Arbor", ColorIndicator: "G"},
+			want: "G",
+		},
+		{
+			name: "back face color indicator",
+			card: Card{
+				Name:               "Civilized Scholar",
+				ManaCost:           "{2}{U}",
+				BackColorIndicator: "R",
+			},
+			want: "UR",
+		},
+		{
+			name: "back face rules text",
+			card: Card{
+				Name:           "Westvale Abbey",
+				OracleText:     "{T}: Add {C}.",
+				BackOracleText: "Flying, indestructible, haste",
+			},
+			want: "",
+		},
+		{
+			name: "all colors",
+			card: Card{Name: "Transguild Courier", ManaCost: "{4}", OracleText: "Transguild Courier is all colors."},
+			want: "WUBRG",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ColorIdentity(tt.card); got != tt.want {
+				t.Errorf("ColorIdentity(%s) = %q, want %q", tt.card.Name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithinIdentity(t *testing.T) {
+	tests := []struct {
+		card, commander string
+		want            bool
+	}{
+		{"", "", true},
+		{"", "G", true},
+		{"G", "WG", true},
+		{"WG", "WUG", true},
+		{"R", "WG", false},
+		{"WG", "G", false},
+	}
+	for _, tt := range tests {
+		if got := WithinIdentity(tt.card, tt.commander); got != tt.want {
+			t.Errorf("WithinIdentity(%q, %q) = %v, want %v", tt.card, tt.commander, got, tt.want)
+		}
+	}
+}
+
+func TestCanBeCommander(t *testing.T) {
+	tests := []struct {
+		name string
+		card Card
+		want bool
+	}{
+		{
+			name: "legendary creature",
+			card: Card{Name: "Ezuri, Renegade Leader", TypeLine: "Legendary Creature — Elf Warrior"},
+			want: true,
+		},
+		{
+			name: "nonlegendary creature",
+			card: Card{Name: "Llanowar Elves", TypeLine: "Creature — Elf Druid"},
+			want: false,
+		},
+		{
+			name: "legendary vehicle",
+			card: Card{Name: "Parhelion II", TypeLine: "Legendary Artifact — Vehicle", Power: "5", Toughness: "5"},
+			want: true,
+		},
+		{
+			name: "legendary vehicle without power and toughness",
+			card: Card{Name: "Broken Vehicle", TypeLine: "Legendary Artifact — Vehicle"},
+			want: false,
+		},
+		{
+			name: "legendary artifact",
+			card: Card{Name: "The One Ring", TypeLine: "Legendary Artifact"},
+			want: false,
+		},
+		{
+			name: "planeswalker that can be your commander",
+			card: Card{
+				Name:       "Teferi, Temporal Archmage",
+				TypeLine:   "Legendary Planeswalker — Teferi",
+				OracleText: "−1: Untap up to four target permanents.\nTeferi, Temporal Archmage can be your commander.",
+			},
+			want: true,
+		},
+		{
+			name: "planeswalker",
+			card: Card{Name: "Teferi, Hero of Dominaria", TypeLine: "Legendary Planeswalker — Teferi"},
+			want: false,
+		},
+		{
+			name: "creature off the battlefield",
+			card: Card{
+				Name:       "Grist, the Hunger Tide",
+				TypeLine:   "Legendary Planeswalker — Grist",
+				OracleText: "As long as Grist, the Hunger Tide isn't on the battlefield, it's a 1/1 Insect creature in addition to its other types.",
+			},
+			want: true,
+		},
+		{
+			name: "modal double-faced card with a creature front",
+			card: Card{Name: "Valki, God of Lies", TypeLine: "Legendary Creature — God // Legendary Planeswalker — Tibalt"},
+			want: true,
+		},
+		{
+			name: "only the back face is a legendary creature",
+			card: Card{Name: "Westvale Abbey", TypeLine: "Land // Legendary Creature — Demon"},
+			want: false,
+		},
+		{
+			name: "background",
+			card: Card{Name: "Acolyte of Bahamut", TypeLine: "Legendary Enchantment — Background"},
+			want: false,
+		},
+		{
+			name: "can be your commander in reminder text",
+			card: Card{
+				Name:       "Sample Reminder",
+				TypeLine:   "Legendary Enchantment",
+				OracleText: "(This card can be your commander.)",
+			},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CanBeCommander(tt.card); got != tt.want {
+				t.Errorf("CanBeCommander(%s) = %v, want %v", tt.card.Name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsBackground(t *testing.T) {
+	tests := []struct {
+		name string
+		card Card
+		want bool
+	}{
+		{
+			name: "background",
+			card: Card{Name: "Acolyte of Bahamut", TypeLine: "Legendary Enchantment — Background"},
+			want: true,
+		},
+		{
+			name: "legendary enchantment",
+			card: Card{Name: "Oath of Druids", TypeLine: "Legendary Enchantment"},
+			want: false,
+		},
+		{
+			name: "creature that chooses a background",
+			card: Card{
+				Name:       "Wilson, Refined Grizzly",
+				TypeLine:   "Legendary Creature — Bear Warrior",
+				OracleText: "Choose a Background (You can have a Background as a second commander.)",
+			},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsBackground(tt.card); got != tt.want {
+				t.Errorf("IsBackground(%s) = %v, want %v", tt.card.Name, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package cards
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidManaCost = errors.New("invalid mana cost")
+
+// SymbolKind is the kind of a mana symbol.
+type SymbolKind string
+
+const (
+	SymbolGeneric   SymbolKind = "generic"   // {2}
+	SymbolColored   SymbolKind = "colored"   // {W}
+	SymbolHybrid    SymbolKind = "hybrid"    // {W/U}, {2/W}
+	SymbolPhyrexian SymbolKind = "phyrexian" // {W/P}, {G/U/P}
+	SymbolX         SymbolKind = "x"         // {X}, {Y}, {Z}
+	SymbolSnow      SymbolKind = "snow"      // {S}
+	SymbolColorless SymbolKind = "colorless" // {C}
+)
+
+// ManaSymbol is one {…} symbol of a mana cost.
+type ManaSymbol struct {
+	// Raw is the symbol without braces, e.g. "W/P".
+	Raw  string
+	Kind SymbolKind
+
+	// Colors are the colors that can pay for the symbol, in WUBRG order.
+	Colors string
+
+	// Generic is the amount of a generic symbol, or the generic half of a
+	// two-brid symbol like {2/W}.
+	Generic int
+}
+
+// Value is the symbol's contribution to mana value.
+func (s ManaSymbol) Value() int {
+	switch s.Kind {
+	case SymbolGeneric:
+		return s.Generic
+	case SymbolX:
+		return 0
+	case SymbolHybrid:
+		return max(s.Generic, 1)
+	}
+	return 1
+}
+
+// ManaCost is a parsed mana cost. Split cards' costs ("{1}{R} // {2}{W}")
+// are parsed as one cost holding both halves' symbols, which is how mana
+// value counts them outside the stack.
+type ManaCost struct {
+	Symbols []ManaSymbol
+}
+
+// ParseManaCost parses a Scryfall mana cost such as "{2}{W}{U/P}". An
+// empty cost, as on lands, parses to no symbols.
+func ParseManaCost(cost string) (ManaCost, error) {
+	var mc ManaCost
+	rest := strings.TrimSpace(cost)
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, "//"):
+			rest = strings.TrimSpace(rest[2:])
+			continue
+		case rest[0] != '{':
+			return ManaCost{}, ErrInvalidManaCost
+		}
+
+		end := strings.IndexByte(rest, '}')
+		if end < 0 {
+			return ManaCost{}, ErrInvalidManaCost
+		}
+		sym, err := parseManaSymbol(strings.ToUpper(rest[1:end]))
+		if err != nil {
+			return ManaCost{}, err
+		}
+		mc.Symbols = append(mc.Symbols, sym)
+		rest = strings.TrimSpace(rest[end+1:])
+	}
+	return mc, nil
+}
+
+func parseManaSymbol(raw string) (ManaSymbol, error) {
+	s := ManaSymbol{Raw: raw}
+
+	if n, err := strconv.Atoi(raw); err == nil && n >= 0 {
+		s.Kind = SymbolGeneric
+		s.Generic = n
+		return s, nil
+	}
+
+	switch raw {
+	case "X", "Y", "Z":
+		s.Kind = SymbolX
+		return s, nil
+	case "S":
+		s.Kind = SymbolSnow
+		return s, nil
+	case "C":
+		s.Kind = SymbolColorless
+		return s, nil
+	}
+	if isManaColor(raw) {
+		s.Kind = SymbolColored
+		s.Colors = raw
+		return s, nil
+	}
+
+	parts := strings.Split(raw, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return ManaSymbol{}, ErrInvalidManaCost
+	}
+
+	s.Kind = SymbolHybrid
+	if parts[len(parts)-1] == "P" {
+		s.Kind = SymbolPhyrexian
+		parts = parts[:len(parts)-1]
+	} else if len(parts) == 3 {
+		return ManaSymbol{}, ErrInvalidManaCost
+	}
+
+	var colors []string
+	for i, p := range parts {
+		switch {
+		case isManaColor(p):
+			colors = append(colors, p)
+		case i == 0 && len(parts) == 2 && s.Kind == SymbolHybrid:
+			// {2/W} can be paid with two generic mana, {C/W} with one
+			// colorless.
+			if n, err := strconv.Atoi(p); err == nil && n > 0 {
+				s.Generic = n
+			} else if p != "C" {
+				return ManaSymbol{}, ErrInvalidManaCost
+			}
+		default:
+			return ManaSymbol{}, ErrInvalidManaCost
+		}
+	}
+	if len(colors) == 0 {
+		return ManaSymbol{}, ErrInvalidManaCost
+	}
+	s.Colors = joinColors(colors)
+	return s, nil
+}
+
+func isManaColor(s string) bool {
+	return len(s) == 1 && strings.Contains("WUBRG", s)
+}
+
+// ManaValue is the cost's mana value: X counts as zero, hybrid symbols as
+// their largest half and Phyrexian symbols as one.
+func (m ManaCost) ManaValue() int {
+	total := 0
+	for _, s := range m.Symbols {
+		total += s.Value()
+	}
+	return total
+}
+
+// Colors are the colors the cost adds to a card's color identity, in
+// WUBRG order.
+func (m ManaCost) Colors() string {
+	var colors []string
+	for _, s := range m.Symbols {
+		for _, c := range s.Colors {
+			colors = append(colors, string(c))
+		}
+	}
+	return joinColors(colors)
+}
+
+// Count is how many symbols of the kind the cost has, counting a generic
+// symbol once however large it is.
+func (m ManaCost) Count(kind SymbolKind) int {
+	n := 0
+	for _, s := range m.Symbols {
+		if s.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+// Pips is how many colored, hybrid or Phyrexian symbols the cost has
+// that can be paid with the color.
+func (m ManaCost) Pips(color rune) int {
+	n := 0
+	for _, s := range m.Symbols {
+		if strings.ContainsRune(s.Colors, color) {
+			n++
+		}
+	}
+	return n
+}
+
+func (m ManaCost) String() string {
+	var b strings.Builder
+	for _, s := range m.Symbols {
+		b.WriteString("{" + s.Raw + "}")
+	}
+	return b.String()
+}
@@ -0,0 +1,183 @@
+package cards
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestParseManaCost(t *testing.T) {
+	tests := []struct {
+		name   string
+		cost   string
+		value  int
+		colors string
+		kinds  []SymbolKind
+		str    string
+	}{
+		{
+			name: "land",
+			cost: "",
+		},
+		{
+			name:   "generic and colored",
+			cost:   "{2}{W}{U}",
+			value:  4,
+			colors: "WU",
+			kinds:  []SymbolKind{SymbolGeneric, SymbolColored, SymbolColored},
+			str:    "{2}{W}{U}",
+		},
+		{
+			name:   "colors in WUBRG order",
+			cost:   "{G}{W}",
+			value:  2,
+			colors: "WG",
+			kinds:  []SymbolKind{SymbolColored, SymbolColored},
+			str:    "{G}{W}",
+		},
+		{
+			name:   "lowercase",
+			cost:   "{1}{b}",
+			value:  2,
+			colors: "B",
+			kinds:  []SymbolKind{SymbolGeneric, SymbolColored},
+			str:    "{1}{B}",
+		},
+		{
+			name:   "hybrid",
+			cost:   "{1}{G/W}{G/W}",
+			value:  3,
+			colors: "WG",
+			kinds:  []SymbolKind{SymbolGeneric, SymbolHybrid, SymbolHybrid},
+			str:    "{1}{G/W}{G/W}",
+		},
+		{
+			name:   "two-brid counts its generic half",
+			cost:   "{2/W}{2/W}{2/W}",
+			value:  6,
+			colors: "W",
+			kinds:  []SymbolKind{SymbolHybrid, SymbolHybrid, SymbolHybrid},
+			str:    "{2/W}{2/W}{2/W}",
+		},
+		{
+			name:   "colorless hybrid",
+			cost:   "{C/W}",
+			value:  1,
+			colors: "W",
+			kinds:  []SymbolKind{SymbolHybrid},
+			str:    "{C/W}",
+		},
+		{
+			name:   "phyrexian",
+			cost:   "{U/P}",
+			value:  1,
+			colors: "U",
+			kinds:  []SymbolKind{SymbolPhyrexian},
+			str:    "{U/P}",
+		},
+		{
+			name:   "hybrid phyrexian",
+			cost:   "{2}{G}{G/U/P}{U}",
+			value:  5,
+			colors: "UG",
+			kinds:  []SymbolKind{SymbolGeneric, SymbolColored, SymbolPhyrexian, SymbolColored},
+			str:    "{2}{G}{G/U/P}{U}",
+		},
+		{
+			name:   "split card holds both halves",
+			cost:   "{1}{R} // {1}{U}",
+			value:  4,
+			colors: "UR",
+			kinds:  []SymbolKind{SymbolGeneric, SymbolColored, SymbolGeneric, SymbolColored},
+			str:    "{1}{R}{1}{U}",
+		},
+		{
+			name:   "X counts as zero",
+			cost:   "{X}{X}{R}",
+			value:  1,
+			colors: "R",
+			kinds:  []SymbolKind{SymbolX, SymbolX, SymbolColored},
+			str:    "{X}{X}{R}",
+		},
+		{
+			name:  "colorless and snow",
+			cost:  "{C}{S}",
+			value: 2,
+			kinds: []SymbolKind{SymbolColorless, SymbolSnow},
+			str:   "{C}{S}",
+		},
+		{
+			name:  "zero",
+			cost:  "{0}",
+			kinds: []SymbolKind{SymbolGeneric},
+			str:   "{0}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mc, err := ParseManaCost(tt.cost)
+			if err != nil {
+				t.Fatalf("ParseManaCost(%q): %v", tt.cost, err)
+			}
+			if got := mc.ManaValue(); got != tt.value {
+				t.Errorf("ManaValue() = %d, want %d", got, tt.value)
+			}
+			if got := mc.Colors(); got != tt.colors {
+				t.Errorf("Colors() = %q, want %q", got, tt.colors)
+			}
+			var kinds []SymbolKind
+			for _, s := range mc.Symbols {
+				kinds = append(kinds, s.Kind)
+			}
+			if !slices.Equal(kinds, tt.kinds) {
+				t.Errorf("kinds = %v, want %v", kinds, tt.kinds)
+			}
+			if got := mc.String(); got != tt.str {
+				t.Errorf("String() = %q, want %q", got, tt.str)
+			}
+		})
+	}
+}
+
+func TestParseManaCostInvalid(t *testing.T) {
+	for _, cost := range []string{
+		"W",
+		"{W",
+		"{Q}",
+		"{-1}",
+		"{W/U/B}",
+		"{2/P}",
+		"{C/P}",
+		"{W/2}",
+		"{}",
+	} {
+		t.Run(cost, func(t *testing.T) {
+			if _, err := ParseManaCost(cost); !errors.Is(err, ErrInvalidManaCost) {
+				t.Errorf("ParseManaCost(%q) error = %v, want ErrInvalidManaCost", cost, err)
+			}
+		})
+	}
+}
+
+func TestManaCostPips(t *testing.T) {
+	mc, err := ParseManaCost("{1}{W}{W/U}{U/P}{2/W}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		color rune
+		want  int
+	}{
+		{'W', 3},
+		{'U', 2},
+		{'B', 0},
+	} {
+		if got := mc.Pips(tt.color); got != tt.want {
+			t.Errorf("Pips(%c) = %d, want %d", tt.color, got, tt.want)
+		}
+	}
+	if got := mc.Count(SymbolHybrid); got != 2 {
+		t.Errorf("Count(SymbolHybrid) = %d, want 2", got)
+	}
+}
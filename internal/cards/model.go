@@ -11,15 +11,16 @@ import (
 var ErrCardNotFound = errors.New("card not found")
 
 type DBCard struct {
-	ID   int64
-	Name string
+	ID            int64
+	Name          string
+	ColorIdentity string
 }
 
 // EnsureCardByName ensures that the card exists in our DB.
 // 1) Try to find it by exact name in the cards table.
 // 2) If not found, query Scryfall using an exact-name search.
 // 3) If Scryfall returns no results, return ErrCardNotFound.
-// 4) If found, insert a full row and return the DBCard.
+// 4) If found, store it with StoreCard and return the DBCard.
 func EnsureCardByName(ctx context.Context, db *sql.DB, name string) (*DBCard, error) {
 	name = strings.TrimSpace(name)
 	if name == "" {
@@ -29,10 +30,10 @@ func EnsureCardByName(ctx context.Context, db *sql.DB, name string) (*DBCard, er
 	// 1) Try to find card already stored in DB by exact name
 	var existing DBCard
 	err := db.QueryRowContext(ctx, `
-		SELECT id, name
+		SELECT id, name, COALESCE(color_identity, '')
 		FROM cards
 		WHERE name = $1
-	`, name).Scan(&existing.ID, &existing.Name)
+	`, name).Scan(&existing.ID, &existing.Name, &existing.ColorIdentity)
 	if err == nil {
 		return &existing, nil
 	}
@@ -53,27 +54,136 @@ func EnsureCardByName(ctx context.Context, db *sql.DB, name string) (*DBCard, er
 		return nil, ErrCardNotFound
 	}
 
-	c := results[0]
+	return StoreCard(ctx, db, results[0])
+}
+
+// StoreCard returns the stored card with c's name, inserting c first when
+// it isn't in the DB yet. A card that is already stored takes c's price, if
+// it has one, since c was just fetched. Unlike EnsureCardByName it never
+// calls Scryfall, so callers that already hold the card data (e.g. from a
+// set's printings) can store many cards cheaply.
+func StoreCard(ctx context.Context, db *sql.DB, c Card) (*DBCard, error) {
+	var existing DBCard
+	err := db.QueryRowContext(ctx, `
+		SELECT id, name, COALESCE(color_identity, '')
+		FROM cards
+		WHERE name = $1
+	`, c.Name).Scan(&existing.ID, &existing.Name, &existing.ColorIdentity)
+	if err == nil {
+		if c.PriceUSD != "" {
+			if err := storePrice(ctx, db, existing.ID, c.PriceUSD); err != nil {
+				return nil, err
+			}
+		}
+		return &existing, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
 
-	// 3) Insert card into DB using fields that match your Card struct.
 	var newID int64
 	err = db.QueryRowContext(ctx, `
-		INSERT INTO cards (name, mana_cost, type_line, oracle_text, image_uri)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO cards (name, mana_cost, type_line, oracle_text, image_uri, price_usd, price_updated_at, color_identity,
+		                   back_name, back_mana_cost, back_type_line, back_oracle_text, back_image_uri, scryfall_id,
+		                   color_indicator, back_color_indicator, power, toughness)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW(), $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
 		RETURNING id
-	`, c.Name, c.ManaCost, c.TypeLine, c.OracleText, c.ImageURI).Scan(&newID)
+	`, c.Name, c.ManaCost, c.TypeLine, c.OracleText, c.ImageURI, nullIfEmpty(c.PriceUSD), c.ColorIdentity,
+		c.BackName, c.BackManaCost, c.BackTypeLine, c.BackOracleText, c.BackImageURI, c.ScryfallID,
+		c.ColorIndicator, c.BackColorIndicator, c.Power, c.Toughness).Scan(&newID)
 	if err != nil {
 		return nil, err
 	}
 
 	return &DBCard{
-		ID:   newID,
-		Name: c.Name,
+		ID:            newID,
+		Name:          c.Name,
+		ColorIdentity: c.ColorIdentity,
 	}, nil
 }
 
+// cardColumns are the columns scanCard reads, in order.
+const cardColumns = `
+	scryfall_id, name, COALESCE(mana_cost, ''), COALESCE(type_line, ''), COALESCE(oracle_text, ''),
+	COALESCE(image_uri, ''), color_indicator, power, toughness,
+	back_name, back_mana_cost, back_type_line, back_oracle_text, back_image_uri, back_color_indicator`
+
+// scanCard reads a stored card. Its color identity is computed locally
+// rather than trusted from the stored copy.
+func scanCard(row interface{ Scan(...any) error }) (Card, error) {
+	var c Card
+	err := row.Scan(&c.ScryfallID, &c.Name, &c.ManaCost, &c.TypeLine, &c.OracleText,
+		&c.ImageURI, &c.ColorIndicator, &c.Power, &c.Toughness,
+		&c.BackName, &c.BackManaCost, &c.BackTypeLine, &c.BackOracleText, &c.BackImageURI, &c.BackColorIndicator)
+	c.ColorIdentity = ColorIdentity(c)
+	return c, err
+}
+
+// FindCardByName returns the stored card with the exact name, or
+// ErrCardNotFound. Unlike EnsureCardByName it never calls Scryfall.
+func FindCardByName(ctx context.Context, db *sql.DB, name string) (*Card, error) {
+	c, err := scanCard(db.QueryRowContext(ctx, `
+		SELECT `+cardColumns+`
+		FROM cards
+		WHERE name = $1
+		LIMIT 1
+	`, strings.TrimSpace(name)))
+	if err == sql.ErrNoRows {
+		return nil, ErrCardNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// SearchCommanders finds stored cards that can be a commander (or a
+// Background) with names containing query, without calling Scryfall.
+func SearchCommanders(ctx context.Context, db *sql.DB, query string, limit int) ([]Card, error) {
+	pattern := "%" + likeEscaper.Replace(strings.TrimSpace(query)) + "%"
+
+	// The SQL only narrows the candidates; CanBeCommander decides.
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+cardColumns+`
+		FROM cards
+		WHERE name ILIKE $1
+		  AND (type_line ILIKE '%Legendary%' OR oracle_text ILIKE '%can be your commander%')
+		ORDER BY name
+	`, pattern)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Card
+	for rows.Next() {
+		c, err := scanCard(rows)
+		if err != nil {
+			return nil, err
+		}
+		if CanBeCommander(c) || IsBackground(c) {
+			out = append(out, c)
+		}
+		if len(out) == limit {
+			break
+		}
+	}
+	return out, rows.Err()
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// nullIfEmpty maps "" to NULL so optional numeric columns stay unset
+// instead of failing to parse.
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
 func EnsureCardsTable(ctx context.Context, db *sql.DB) error {
-	_, err := db.ExecContext(ctx, `
+	if _, err := db.ExecContext(ctx, `
         CREATE TABLE IF NOT EXISTS cards (
             id BIGSERIAL PRIMARY KEY,
             name TEXT NOT NULL,
@@ -82,6 +192,57 @@ func EnsureCardsTable(ctx context.Context, db *sql.DB) error {
             oracle_text TEXT,
             image_uri TEXT
         );
-    `)
-	return err
+    `); err != nil {
+		return err
+	}
+
+	// Prices come from Scryfall and are used for trade valuations. They are
+	// refreshed by RefreshPrices; price_updated_at is NULL for cards whose
+	// price has never been fetched.
+	if _, err := db.ExecContext(ctx, `
+        ALTER TABLE cards ADD COLUMN IF NOT EXISTS price_usd NUMERIC(10,2);
+        ALTER TABLE cards ADD COLUMN IF NOT EXISTS price_updated_at TIMESTAMPTZ;
+    `); err != nil {
+		return err
+	}
+
+	// Color identity (WUBRG order) groups decks by commander colors.
+	if _, err := db.ExecContext(ctx, `
+        ALTER TABLE cards ADD COLUMN IF NOT EXISTS color_identity TEXT;
+    `); err != nil {
+		return err
+	}
+
+	// Back faces of double-faced cards, for proxies.
+	if _, err := db.ExecContext(ctx, `
+        ALTER TABLE cards
+            ADD COLUMN IF NOT EXISTS back_name TEXT NOT NULL DEFAULT '',
+            ADD COLUMN IF NOT EXISTS back_mana_cost TEXT NOT NULL DEFAULT '',
+            ADD COLUMN IF NOT EXISTS back_type_line TEXT NOT NULL DEFAULT '',
+            ADD COLUMN IF NOT EXISTS back_oracle_text TEXT NOT NULL DEFAULT '',
+            ADD COLUMN IF NOT EXISTS back_image_uri TEXT NOT NULL DEFAULT '';
+    `); err != nil {
+		return err
+	}
+
+	// Scryfall IDs key the local image cache.
+	if _, err := db.ExecContext(ctx, `
+        ALTER TABLE cards ADD COLUMN IF NOT EXISTS scryfall_id TEXT NOT NULL DEFAULT '';
+    `); err != nil {
+		return err
+	}
+
+	// Color indicators and power/toughness, for computing color identity
+	// and commander eligibility locally.
+	if _, err := db.ExecContext(ctx, `
+        ALTER TABLE cards
+            ADD COLUMN IF NOT EXISTS color_indicator TEXT NOT NULL DEFAULT '',
+            ADD COLUMN IF NOT EXISTS back_color_indicator TEXT NOT NULL DEFAULT '',
+            ADD COLUMN IF NOT EXISTS power TEXT NOT NULL DEFAULT '',
+            ADD COLUMN IF NOT EXISTS toughness TEXT NOT NULL DEFAULT '';
+    `); err != nil {
+		return err
+	}
+
+	return nil
 }
@@ -0,0 +1,139 @@
+package cards
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// PriceMaxAge is how old a stored price may get before RefreshPrices
+// fetches it again. Scryfall updates its prices about once a day.
+const PriceMaxAge = 24 * time.Hour
+
+// storePrice records a freshly fetched price for a stored card. An empty
+// price means Scryfall has none, which clears the stored one.
+func storePrice(ctx context.Context, db *sql.DB, cardID int64, price string) error {
+	_, err := db.ExecContext(ctx, `
+		UPDATE cards SET price_usd = $2, price_updated_at = NOW()
+		WHERE id = $1
+	`, cardID, nullIfEmpty(price))
+	return err
+}
+
+type staleCard struct {
+	id         int64
+	name       string
+	scryfallID string
+}
+
+// RefreshPrices fetches new prices from Scryfall for stored cards whose
+// price is older than maxAge or was never fetched, a batch at a time, and
+// returns how many cards it checked. Cards Scryfall no longer finds keep
+// their old price but aren't asked about again until maxAge has passed.
+func RefreshPrices(ctx context.Context, db *sql.DB, maxAge time.Duration) (int, error) {
+	scry := NewScryfallClient()
+	checked := 0
+
+	for {
+		batch, err := staleCards(ctx, db, maxAge)
+		if err != nil || len(batch) == 0 {
+			return checked, err
+		}
+		if checked > 0 {
+			time.Sleep(searchPageDelay)
+		}
+
+		ids := make([]cardIdentifier, len(batch))
+		byScryfallID := make(map[string]int64, len(batch))
+		byName := make(map[string]int64, len(batch))
+		cardIDs := make([]int64, len(batch))
+		for i, sc := range batch {
+			if sc.scryfallID != "" {
+				ids[i] = cardIdentifier{ID: sc.scryfallID}
+				byScryfallID[sc.scryfallID] = sc.id
+			} else {
+				ids[i] = cardIdentifier{Name: sc.name}
+				byName[sc.name] = sc.id
+			}
+			cardIDs[i] = sc.id
+		}
+
+		found, err := scry.fetchCollection(ctx, ids)
+		if err != nil {
+			return checked, err
+		}
+		for _, c := range found {
+			id, ok := byScryfallID[c.ScryfallID]
+			if !ok {
+				id, ok = byName[c.Name]
+			}
+			if !ok {
+				continue
+			}
+			if err := storePrice(ctx, db, id, c.PriceUSD); err != nil {
+				return checked, err
+			}
+		}
+
+		// Mark the rest of the batch too, so unknown cards don't come back
+		// on every pass.
+		if _, err := db.ExecContext(ctx, `
+			UPDATE cards SET price_updated_at = NOW()
+			WHERE id = ANY($1)
+		`, pq.Array(cardIDs)); err != nil {
+			return checked, err
+		}
+		checked += len(batch)
+	}
+}
+
+// staleCards returns up to one collection batch of cards due a price
+// refresh, never-fetched ones first.
+func staleCards(ctx context.Context, db *sql.DB, maxAge time.Duration) ([]staleCard, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, name, scryfall_id
+		FROM cards
+		WHERE price_updated_at IS NULL OR price_updated_at < NOW() - make_interval(secs => $1)
+		ORDER BY price_updated_at NULLS FIRST, id
+		LIMIT $2
+	`, maxAge.Seconds(), collectionBatch)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []staleCard
+	for rows.Next() {
+		var sc staleCard
+		if err := rows.Scan(&sc.id, &sc.name, &sc.scryfallID); err != nil {
+			return nil, err
+		}
+		out = append(out, sc)
+	}
+	return out, rows.Err()
+}
+
+// SweepPrices runs RefreshPrices with PriceMaxAge every interval until ctx
+// is done. The first pass fills in prices for cards that have never had
+// one fetched.
+func SweepPrices(ctx context.Context, db *sql.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := RefreshPrices(ctx, db, PriceMaxAge); err != nil {
+			log.Printf("price refresh error: %v", err)
+		} else if n > 0 {
+			log.Printf("price refresh: checked %d cards", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -1,40 +1,108 @@
 package cards
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 )
 
 type Card struct {
+	ScryfallID string `json:"id"`
 	Name       string `json:"name"`
 	ManaCost   string `json:"mana_cost"`
 	TypeLine   string `json:"type_line"`
 	OracleText string `json:"oracle_text"`
 	ImageURI   string `json:"image_uris_normal"`
 
+	// ColorIdentity is in WUBRG order, e.g. "UB"; colorless is "".
+	ColorIdentity string `json:"color_identity"`
+
+	// ColorIndicator is the color dot of cards without a mana cost to
+	// show their color, in WUBRG order. Power and Toughness are the front
+	// face's, as printed ("*", "1+*"); empty for non-creatures.
+	ColorIndicator string `json:"-"`
+	Power          string `json:"-"`
+	Toughness      string `json:"-"`
+
+	// Back face of double-faced cards; empty for everything else.
+	BackName       string `json:"-"`
+	BackManaCost   string `json:"-"`
+	BackTypeLine   string `json:"-"`
+	BackOracleText string `json:"-"`
+	BackImageURI   string `json:"-"`
+
+	BackColorIndicator string `json:"-"`
+
 	// Extra metadata used by the UI (not required to be persisted).
 	PriceUSD string `json:"-"`
 	Artist   string `json:"-"`
 }
 
+// ImagePath is where pages load the card's image from: the app's image
+// cache when the Scryfall ID is known, otherwise Scryfall directly. size
+// is a Scryfall image version such as "normal" or "large".
+func (c Card) ImagePath(size string) string {
+	if c.ScryfallID == "" {
+		return c.ImageURI
+	}
+	return "/img/" + c.ScryfallID + "/" + size
+}
+
 type scryfallCard struct {
+	ID         string            `json:"id"`
 	Name       string            `json:"name"`
 	ManaCost   string            `json:"mana_cost"`
 	TypeLine   string            `json:"type_line"`
 	OracleText string            `json:"oracle_text"`
 	ImageURIs  map[string]string `json:"image_uris"`
+	ColorIdent []string          `json:"color_identity"`
+	ColorInd   []string          `json:"color_indicator"`
+	Power      string            `json:"power"`
+	Toughness  string            `json:"toughness"`
 	Prices     struct {
 		USD       string `json:"usd"`
 		USDFoil   string `json:"usd_foil"`
 		USDEtched string `json:"usd_etched"`
 	} `json:"prices"`
 	Artist string `json:"artist"`
+
+	Set             string         `json:"set"`
+	CollectorNumber string         `json:"collector_number"`
+	Rarity          string         `json:"rarity"`
+	CardFaces       []scryfallFace `json:"card_faces"`
 }
 
+// scryfallFace is one face of a split, adventure or double-faced card.
+// Only double-faced cards have images per face.
+type scryfallFace struct {
+	Name       string            `json:"name"`
+	ManaCost   string            `json:"mana_cost"`
+	TypeLine   string            `json:"type_line"`
+	OracleText string            `json:"oracle_text"`
+	ImageURIs  map[string]string `json:"image_uris"`
+	ColorInd   []string          `json:"color_indicator"`
+	Power      string            `json:"power"`
+	Toughness  string            `json:"toughness"`
+}
+
+// Printing is one printing of a card in a set, as used for opening
+// booster packs.
+type Printing struct {
+	Card
+	Set             string
+	CollectorNumber string
+	Rarity          string
+}
+
+// searchPageDelay spaces out paginated requests, as Scryfall asks API
+// clients to.
+const searchPageDelay = 100 * time.Millisecond
+
 type ScryfallClient struct {
 	httpClient *http.Client
 }
@@ -90,26 +158,190 @@ func (c *ScryfallClient) SearchByName(ctx context.Context, q string) ([]Card, er
 	// Normal case: zero or more results.
 	out := make([]Card, 0, len(body.Data))
 	for _, sc := range body.Data {
-		img := sc.ImageURIs["normal"]
+		out = append(out, sc.card())
+	}
+	return out, nil
+}
 
-		// Prefer non-foil USD, then fallback to foil / etched if needed.
-		price := sc.Prices.USD
-		if price == "" {
-			price = sc.Prices.USDFoil
+// SetPrintings returns every printing that can appear in a booster of the
+// given set, following Scryfall's pagination.
+func (c *ScryfallClient) SetPrintings(ctx context.Context, setCode string) ([]Printing, error) {
+	values := url.Values{}
+	values.Set("q", "e:"+setCode+" is:booster")
+	values.Set("unique", "prints")
+	next := "https://api.scryfall.com/cards/search?" + values.Encode()
+
+	var out []Printing
+	for next != "" {
+		if len(out) > 0 {
+			time.Sleep(searchPageDelay)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, next, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		var body struct {
+			Object   string         `json:"object"`
+			Code     string         `json:"code"`
+			Details  string         `json:"details"`
+			Data     []scryfallCard `json:"data"`
+			HasMore  bool           `json:"has_more"`
+			NextPage string         `json:"next_page"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		if body.Object == "error" {
+			if body.Code == "not_found" {
+				return out, nil
+			}
+			return nil, fmt.Errorf("scryfall error (%s): %s", body.Code, body.Details)
 		}
-		if price == "" {
-			price = sc.Prices.USDEtched
+
+		for _, sc := range body.Data {
+			out = append(out, Printing{
+				Card:            sc.card(),
+				Set:             sc.Set,
+				CollectorNumber: sc.CollectorNumber,
+				Rarity:          sc.Rarity,
+			})
 		}
 
-		out = append(out, Card{
-			Name:       sc.Name,
-			ManaCost:   sc.ManaCost,
-			TypeLine:   sc.TypeLine,
-			OracleText: sc.OracleText,
-			ImageURI:   img,
-			PriceUSD:   price,
-			Artist:     sc.Artist,
-		})
+		next = ""
+		if body.HasMore {
+			next = body.NextPage
+		}
 	}
 	return out, nil
 }
+
+// collectionBatch is the most identifiers Scryfall's /cards/collection
+// accepts in one request.
+const collectionBatch = 75
+
+// cardIdentifier names a card for /cards/collection, by Scryfall ID or, for
+// cards stored before IDs were kept, by exact name.
+type cardIdentifier struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+// fetchCollection looks up to collectionBatch cards in one request. Cards
+// Scryfall doesn't know are left out of the result.
+func (c *ScryfallClient) fetchCollection(ctx context.Context, ids []cardIdentifier) ([]Card, error) {
+	payload, err := json.Marshal(map[string]any{"identifiers": ids})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		"https://api.scryfall.com/cards/collection", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Object  string         `json:"object"`
+		Code    string         `json:"code"`
+		Details string         `json:"details"`
+		Data    []scryfallCard `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	if body.Object == "error" {
+		return nil, fmt.Errorf("scryfall error (%s): %s", body.Code, body.Details)
+	}
+
+	out := make([]Card, 0, len(body.Data))
+	for _, sc := range body.Data {
+		out = append(out, sc.card())
+	}
+	return out, nil
+}
+
+func (sc scryfallCard) card() Card {
+	// Prefer non-foil USD, then fallback to foil / etched if needed.
+	price := sc.Prices.USD
+	if price == "" {
+		price = sc.Prices.USDFoil
+	}
+	if price == "" {
+		price = sc.Prices.USDEtched
+	}
+
+	c := Card{
+		ScryfallID:     sc.ID,
+		Name:           sc.Name,
+		ManaCost:       sc.ManaCost,
+		TypeLine:       sc.TypeLine,
+		OracleText:     sc.OracleText,
+		ImageURI:       sc.ImageURIs["normal"],
+		ColorIdentity:  joinColors(sc.ColorIdent),
+		ColorIndicator: joinColors(sc.ColorInd),
+		Power:          sc.Power,
+		Toughness:      sc.Toughness,
+		PriceUSD:       price,
+		Artist:         sc.Artist,
+	}
+
+	// Double-faced cards keep their text and images on the faces.
+	if len(sc.CardFaces) == 2 && sc.CardFaces[0].ImageURIs != nil {
+		front, back := sc.CardFaces[0], sc.CardFaces[1]
+		c.ManaCost = front.ManaCost
+		c.TypeLine = front.TypeLine
+		c.OracleText = front.OracleText
+		c.ImageURI = front.ImageURIs["normal"]
+		c.ColorIndicator = joinColors(front.ColorInd)
+		c.Power = front.Power
+		c.Toughness = front.Toughness
+		c.BackName = back.Name
+		c.BackManaCost = back.ManaCost
+		c.BackTypeLine = back.TypeLine
+		c.BackOracleText = back.OracleText
+		c.BackImageURI = back.ImageURIs["normal"]
+		c.BackColorIndicator = joinColors(back.ColorInd)
+		return c
+	}
+
+	// Split and adventure cards share one image but list text per face.
+	if c.OracleText == "" && len(sc.CardFaces) > 0 {
+		var texts []string
+		for _, f := range sc.CardFaces {
+			texts = append(texts, f.Name+" "+f.ManaCost+"\n"+f.TypeLine+"\n"+f.OracleText)
+		}
+		c.OracleText = strings.Join(texts, "\n//\n")
+	}
+	return c
+}
+
+// joinColors turns a list of color letters into a WUBRG-ordered string.
+func joinColors(colors []string) string {
+	var b strings.Builder
+	for _, c := range "WUBRG" {
+		for _, have := range colors {
+			if strings.EqualFold(have, string(c)) {
+				b.WriteRune(c)
+				break
+			}
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,162 @@
+package collection
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+)
+
+// MatchCard is one card that could change hands in a trade.
+type MatchCard struct {
+	CardID   int64
+	CardName string
+	Quantity int
+	PriceUSD sql.NullFloat64
+}
+
+// Value is the stored price of all copies in the match, or zero when the
+// card has no price.
+func (m MatchCard) Value() float64 {
+	return m.PriceUSD.Float64 * float64(m.Quantity)
+}
+
+// TradeMatch pairs the current user with one other user. TheyHave are cards
+// in the other user's binder that are on the current user's wishlist;
+// TheyWant is the reverse.
+type TradeMatch struct {
+	UserID      int64
+	DisplayName string
+	TheyHave    []MatchCard
+	TheyWant    []MatchCard
+}
+
+// ReceiveValue is what the current user would get if every card matched.
+func (m TradeMatch) ReceiveValue() float64 {
+	return sumValue(m.TheyHave)
+}
+
+// GiveValue is what the current user would hand over.
+func (m TradeMatch) GiveValue() float64 {
+	return sumValue(m.TheyWant)
+}
+
+// Difference is positive when the proposed trade favours the current user.
+// Cards without a price count as nothing; see Unpriced.
+func (m TradeMatch) Difference() float64 {
+	return m.ReceiveValue() - m.GiveValue()
+}
+
+// Unpriced is how many matched cards on either side have no stored price.
+func (m TradeMatch) Unpriced() int {
+	return countUnpriced(m.TheyHave) + countUnpriced(m.TheyWant)
+}
+
+func countUnpriced(cards []MatchCard) int {
+	n := 0
+	for _, c := range cards {
+		if !c.PriceUSD.Valid {
+			n++
+		}
+	}
+	return n
+}
+
+func sumValue(cards []MatchCard) float64 {
+	var total float64
+	for _, c := range cards {
+		total += c.Value()
+	}
+	return total
+}
+
+// ListMatches crosses the user's wishlist with other users' binders and the
+// user's binder with other users' wishlists. Users matching in both
+// directions come first.
+func ListMatches(ctx context.Context, db *sql.DB, userID int64) ([]TradeMatch, error) {
+	byUser := map[int64]*TradeMatch{}
+
+	matchUser := func(id int64, name string) *TradeMatch {
+		m, ok := byUser[id]
+		if !ok {
+			m = &TradeMatch{UserID: id, DisplayName: name}
+			byUser[id] = m
+		}
+		return m
+	}
+
+	// Their binder ∩ my wishlist
+	err := scanMatches(ctx, db, `
+		SELECT u.id, u.display_name, c.id, c.name, LEAST(cc.quantity, w.quantity), c.price_usd
+		FROM wishlist_cards w
+		JOIN collection_cards cc ON cc.card_id = w.card_id AND cc.tradeable AND cc.user_id <> w.user_id
+		JOIN users u ON u.id = cc.user_id
+		JOIN cards c ON c.id = w.card_id
+		WHERE w.user_id = $1
+		ORDER BY c.name
+	`, userID, func(id int64, name string, mc MatchCard) {
+		m := matchUser(id, name)
+		m.TheyHave = append(m.TheyHave, mc)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// My binder ∩ their wishlist
+	err = scanMatches(ctx, db, `
+		SELECT u.id, u.display_name, c.id, c.name, LEAST(cc.quantity, w.quantity), c.price_usd
+		FROM collection_cards cc
+		JOIN wishlist_cards w ON w.card_id = cc.card_id AND w.user_id <> cc.user_id
+		JOIN users u ON u.id = w.user_id
+		JOIN cards c ON c.id = cc.card_id
+		WHERE cc.user_id = $1 AND cc.tradeable
+		ORDER BY c.name
+	`, userID, func(id int64, name string, mc MatchCard) {
+		m := matchUser(id, name)
+		m.TheyWant = append(m.TheyWant, mc)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]TradeMatch, 0, len(byUser))
+	for _, m := range byUser {
+		out = append(out, *m)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		bi := len(out[i].TheyHave) > 0 && len(out[i].TheyWant) > 0
+		bj := len(out[j].TheyHave) > 0 && len(out[j].TheyWant) > 0
+		if bi != bj {
+			return bi
+		}
+		ni := len(out[i].TheyHave) + len(out[i].TheyWant)
+		nj := len(out[j].TheyHave) + len(out[j].TheyWant)
+		if ni != nj {
+			return ni > nj
+		}
+		return out[i].DisplayName < out[j].DisplayName
+	})
+
+	return out, nil
+}
+
+func scanMatches(ctx context.Context, db *sql.DB, query string, userID int64, add func(int64, string, MatchCard)) error {
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			otherID   int64
+			otherName string
+			mc        MatchCard
+		)
+		if err := rows.Scan(&otherID, &otherName, &mc.CardID, &mc.CardName, &mc.Quantity, &mc.PriceUSD); err != nil {
+			return err
+		}
+		add(otherID, otherName, mc)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,135 @@
+package collection
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Entry is one card a user owns. Tradeable entries make up the user's
+// binder, which other users can see when looking for trades.
+type Entry struct {
+	CardID    int64
+	CardName  string
+	Quantity  int
+	Tradeable bool
+	PriceUSD  sql.NullFloat64
+}
+
+// AddCard changes how many copies of a card a user owns. Like
+// decks.AddCard, a delta that drops the quantity to zero removes the row.
+func AddCard(ctx context.Context, db *sql.DB, userID, cardID int64, delta int) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var currentQty int
+	err = tx.QueryRowContext(ctx, `
+		SELECT quantity
+		FROM collection_cards
+		WHERE user_id = $1 AND card_id = $2
+	`, userID, cardID).Scan(&currentQty)
+
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	newQty := currentQty + delta
+	if newQty <= 0 {
+		_, err = tx.ExecContext(ctx, `
+			DELETE FROM collection_cards
+			WHERE user_id = $1 AND card_id = $2
+		`, userID, cardID)
+	} else if err == sql.ErrNoRows {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO collection_cards (user_id, card_id, quantity)
+			VALUES ($1, $2, $3)
+		`, userID, cardID, newQty)
+	} else {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE collection_cards
+			SET quantity = $3
+			WHERE user_id = $1 AND card_id = $2
+		`, userID, cardID, newQty)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetTradeable flags (or unflags) a collection card as available for trade.
+func SetTradeable(ctx context.Context, db *sql.DB, userID, cardID int64, tradeable bool) error {
+	_, err := db.ExecContext(ctx, `
+		UPDATE collection_cards
+		SET tradeable = $3
+		WHERE user_id = $1 AND card_id = $2
+	`, userID, cardID, tradeable)
+	return err
+}
+
+func ListCollection(ctx context.Context, db *sql.DB, userID int64) ([]Entry, error) {
+	return listEntries(ctx, db, userID, false)
+}
+
+// ListBinder returns only the tradeable part of a user's collection.
+func ListBinder(ctx context.Context, db *sql.DB, userID int64) ([]Entry, error) {
+	return listEntries(ctx, db, userID, true)
+}
+
+func listEntries(ctx context.Context, db *sql.DB, userID int64, tradeableOnly bool) ([]Entry, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT cc.card_id, c.name, cc.quantity, cc.tradeable, c.price_usd
+		FROM collection_cards cc
+		JOIN cards c ON c.id = cc.card_id
+		WHERE cc.user_id = $1 AND (cc.tradeable OR NOT $2)
+		ORDER BY c.name
+	`, userID, tradeableOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Entry
+	for rows.Next() {
+		var e Entry
+		if err := rows.Scan(&e.CardID, &e.CardName, &e.Quantity, &e.Tradeable, &e.PriceUSD); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+func EnsureCollectionTables(ctx context.Context, db *sql.DB) error {
+	// Owned cards (the tradeable ones form the user's binder)
+	if _, err := db.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS collection_cards (
+            user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+            card_id BIGINT NOT NULL REFERENCES cards(id) ON DELETE CASCADE,
+            quantity INT NOT NULL DEFAULT 1,
+            tradeable BOOLEAN NOT NULL DEFAULT FALSE,
+            PRIMARY KEY (user_id, card_id)
+        );
+    `); err != nil {
+		return err
+	}
+
+	// Wanted cards
+	if _, err := db.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS wishlist_cards (
+            user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+            card_id BIGINT NOT NULL REFERENCES cards(id) ON DELETE CASCADE,
+            quantity INT NOT NULL DEFAULT 1,
+            auto_added BOOLEAN NOT NULL DEFAULT FALSE,
+            PRIMARY KEY (user_id, card_id)
+        );
+    `); err != nil {
+		return err
+	}
+
+	return nil
+}
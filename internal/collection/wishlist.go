@@ -0,0 +1,140 @@
+package collection
+
+import (
+	"context"
+	"database/sql"
+)
+
+// WishlistEntry is a card a user wants. AutoAdded entries were created by
+// SyncWishlistFromDecks rather than added by hand.
+type WishlistEntry struct {
+	CardID    int64
+	CardName  string
+	Quantity  int
+	AutoAdded bool
+	PriceUSD  sql.NullFloat64
+}
+
+// AddWish changes the wanted quantity of a card. Dropping to zero removes it.
+func AddWish(ctx context.Context, db *sql.DB, userID, cardID int64, delta int) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var currentQty int
+	err = tx.QueryRowContext(ctx, `
+		SELECT quantity
+		FROM wishlist_cards
+		WHERE user_id = $1 AND card_id = $2
+	`, userID, cardID).Scan(&currentQty)
+
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	newQty := currentQty + delta
+	if newQty <= 0 {
+		_, err = tx.ExecContext(ctx, `
+			DELETE FROM wishlist_cards
+			WHERE user_id = $1 AND card_id = $2
+		`, userID, cardID)
+	} else if err == sql.ErrNoRows {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO wishlist_cards (user_id, card_id, quantity)
+			VALUES ($1, $2, $3)
+		`, userID, cardID, newQty)
+	} else {
+		// Touching an entry by hand makes it a manual wish, so the next
+		// sync won't drop it.
+		_, err = tx.ExecContext(ctx, `
+			UPDATE wishlist_cards
+			SET quantity = $3, auto_added = FALSE
+			WHERE user_id = $1 AND card_id = $2
+		`, userID, cardID, newQty)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func ListWishlist(ctx context.Context, db *sql.DB, userID int64) ([]WishlistEntry, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT w.card_id, c.name, w.quantity, w.auto_added, c.price_usd
+		FROM wishlist_cards w
+		JOIN cards c ON c.id = w.card_id
+		WHERE w.user_id = $1
+		ORDER BY c.name
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []WishlistEntry
+	for rows.Next() {
+		var e WishlistEntry
+		if err := rows.Scan(&e.CardID, &e.CardName, &e.Quantity, &e.AutoAdded, &e.PriceUSD); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// SyncWishlistFromDecks adds every card the user's decks need but their
+// collection doesn't cover. A card in several decks counts once at its
+// highest quantity, and basic lands are skipped. Auto-added wishes that the
+// collection now covers are removed. It returns how many wishes were added
+// or raised.
+func SyncWishlistFromDecks(ctx context.Context, db *sql.DB, userID int64) (int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO wishlist_cards (user_id, card_id, quantity, auto_added)
+		SELECT $1, need.card_id, need.qty - COALESCE(cc.quantity, 0), TRUE
+		FROM (
+			SELECT dc.card_id, MAX(dc.quantity) AS qty
+			FROM deck_cards dc
+			JOIN decks d ON d.id = dc.deck_id
+			JOIN cards c ON c.id = dc.card_id
+			WHERE d.user_id = $1
+			  AND COALESCE(c.type_line, '') NOT LIKE 'Basic %'
+			GROUP BY dc.card_id
+		) need
+		LEFT JOIN collection_cards cc ON cc.user_id = $1 AND cc.card_id = need.card_id
+		WHERE need.qty > COALESCE(cc.quantity, 0)
+		ON CONFLICT (user_id, card_id) DO UPDATE
+		SET quantity = EXCLUDED.quantity
+		WHERE wishlist_cards.auto_added AND wishlist_cards.quantity < EXCLUDED.quantity
+	`, userID)
+	if err != nil {
+		return 0, err
+	}
+	added, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM wishlist_cards w
+		USING collection_cards cc
+		WHERE w.user_id = $1
+		  AND w.auto_added
+		  AND cc.user_id = w.user_id
+		  AND cc.card_id = w.card_id
+		  AND cc.quantity >= w.quantity
+	`, userID); err != nil {
+		return 0, err
+	}
+
+	return added, tx.Commit()
+}
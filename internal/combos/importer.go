@@ -0,0 +1,165 @@
+package combos
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// spellbookVariant is the subset of a Commander Spellbook variant we keep.
+type spellbookVariant struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Uses   []struct {
+		Card struct {
+			Name string `json:"name"`
+		} `json:"card"`
+		MustBeCommander bool `json:"mustBeCommander"`
+	} `json:"uses"`
+	Requires []struct {
+		Template struct {
+			Name string `json:"name"`
+		} `json:"template"`
+	} `json:"requires"`
+	Produces []struct {
+		Feature struct {
+			Name string `json:"name"`
+		} `json:"feature"`
+	} `json:"produces"`
+	ManaNeeded           string `json:"manaNeeded"`
+	EasyPrerequisites    string `json:"easyPrerequisites"`
+	NotablePrerequisites string `json:"notablePrerequisites"`
+	OtherPrerequisites   string `json:"otherPrerequisites"`
+	Description          string `json:"description"`
+	Identity             string `json:"identity"`
+}
+
+// ImportFile loads a Commander Spellbook-style JSON export from disk and
+// replaces the combo database with it. See Import for the accepted format.
+func ImportFile(ctx context.Context, db *sql.DB, path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	return Import(ctx, db, f)
+}
+
+// Import reads either a bare array of variants or an object with a
+// "variants" array (the shape of Spellbook's bulk export), and replaces all
+// stored combos in one transaction. Variants that aren't marked OK are
+// skipped. It returns how many combos were stored.
+func Import(ctx context.Context, db *sql.DB, r io.Reader) (int, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+
+	var variants []spellbookVariant
+	if trimmed := strings.TrimSpace(string(raw)); strings.HasPrefix(trimmed, "[") {
+		err = json.Unmarshal(raw, &variants)
+	} else {
+		var export struct {
+			Variants []spellbookVariant `json:"variants"`
+		}
+		err = json.Unmarshal(raw, &export)
+		variants = export.Variants
+	}
+	if err != nil {
+		return 0, fmt.Errorf("decode combo export: %w", err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM combos`); err != nil {
+		return 0, err
+	}
+
+	insertCombo, err := tx.PrepareContext(ctx, `
+		INSERT INTO combos (id, description, prerequisites, mana_needed, results, color_identity)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer insertCombo.Close()
+
+	insertCard, err := tx.PrepareContext(ctx, `
+		INSERT INTO combo_cards (combo_id, card_name, must_be_commander)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (combo_id, card_name) DO NOTHING
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer insertCard.Close()
+
+	stored := 0
+	for _, v := range variants {
+		if v.ID == "" || len(v.Uses) == 0 {
+			continue
+		}
+		if v.Status != "" && v.Status != "OK" {
+			continue
+		}
+
+		var prereqs []string
+		for _, req := range v.Requires {
+			if req.Template.Name != "" {
+				prereqs = append(prereqs, req.Template.Name)
+			}
+		}
+		for _, p := range []string{v.EasyPrerequisites, v.NotablePrerequisites, v.OtherPrerequisites} {
+			for _, line := range strings.Split(p, "\n") {
+				if line = strings.TrimSpace(line); line != "" {
+					prereqs = append(prereqs, line)
+				}
+			}
+		}
+
+		var results []string
+		for _, p := range v.Produces {
+			if p.Feature.Name != "" {
+				results = append(results, p.Feature.Name)
+			}
+		}
+
+		if _, err := insertCombo.ExecContext(ctx,
+			v.ID, v.Description, pq.Array(nonNil(prereqs)), v.ManaNeeded, pq.Array(nonNil(results)), v.Identity,
+		); err != nil {
+			return 0, fmt.Errorf("insert combo %s: %w", v.ID, err)
+		}
+
+		for _, u := range v.Uses {
+			if u.Card.Name == "" {
+				continue
+			}
+			if _, err := insertCard.ExecContext(ctx, v.ID, u.Card.Name, u.MustBeCommander); err != nil {
+				return 0, fmt.Errorf("insert combo card %s/%s: %w", v.ID, u.Card.Name, err)
+			}
+		}
+
+		stored++
+	}
+
+	return stored, tx.Commit()
+}
+
+// nonNil keeps pq from sending NULL for an empty list into a NOT NULL column.
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
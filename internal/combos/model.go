@@ -0,0 +1,146 @@
+package combos
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Combo is one entry from the imported combo database.
+type Combo struct {
+	ID            string
+	Cards         []string
+	Description   string
+	Prerequisites []string
+	ManaNeeded    string
+	Results       []string
+}
+
+// Match is a combo that a deck has, or nearly has. Missing is empty for a
+// complete combo and names the missing piece for a near-miss.
+type Match struct {
+	Combo   Combo
+	Missing []string
+}
+
+// Result groups a deck's combo matches.
+type Result struct {
+	Complete   []Match
+	NearMisses []Match
+}
+
+// maxMatches caps how many combos we return per deck; staples like Sol Ring
+// appear in hundreds of near-misses.
+const maxMatches = 200
+
+// FindCombos matches a deck against the combo database. commanders are the
+// deck's commander names and cards every other card in the deck. A piece
+// that must be the commander only counts when it is one.
+func FindCombos(ctx context.Context, db *sql.DB, commanders, cards []string) (Result, error) {
+	var res Result
+
+	names := make([]string, 0, len(commanders)+len(cards))
+	cmdNames := make([]string, 0, len(commanders))
+	for _, c := range commanders {
+		if c == "" {
+			continue
+		}
+		names = append(names, strings.ToLower(c))
+		cmdNames = append(cmdNames, strings.ToLower(c))
+	}
+	for _, c := range cards {
+		names = append(names, strings.ToLower(c))
+	}
+	if len(names) == 0 {
+		return res, nil
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		WITH hits AS (
+			SELECT DISTINCT combo_id
+			FROM combo_cards
+			WHERE lower(card_name) = ANY($1)
+		),
+		scored AS (
+			SELECT cc.combo_id,
+			       array_agg(cc.card_name ORDER BY cc.card_name) AS cards,
+			       array_agg(cc.card_name ORDER BY cc.card_name) FILTER (
+			           WHERE NOT (lower(cc.card_name) = ANY($1)
+			                      AND (NOT cc.must_be_commander OR lower(cc.card_name) = ANY($2)))
+			       ) AS missing
+			FROM combo_cards cc
+			JOIN hits h ON h.combo_id = cc.combo_id
+			GROUP BY cc.combo_id
+		)
+		SELECT c.id, c.description, c.prerequisites, c.mana_needed, c.results, s.cards, COALESCE(s.missing, '{}')
+		FROM scored s
+		JOIN combos c ON c.id = s.combo_id
+		WHERE COALESCE(array_length(s.missing, 1), 0) <= 1
+		ORDER BY COALESCE(array_length(s.missing, 1), 0), array_length(s.cards, 1), c.id
+		LIMIT $3
+	`, pq.Array(names), pq.Array(cmdNames), maxMatches)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m Match
+		if err := rows.Scan(
+			&m.Combo.ID,
+			&m.Combo.Description,
+			pq.Array(&m.Combo.Prerequisites),
+			&m.Combo.ManaNeeded,
+			pq.Array(&m.Combo.Results),
+			pq.Array(&m.Combo.Cards),
+			pq.Array(&m.Missing),
+		); err != nil {
+			return res, err
+		}
+
+		if len(m.Missing) == 0 {
+			res.Complete = append(res.Complete, m)
+		} else {
+			res.NearMisses = append(res.NearMisses, m)
+		}
+	}
+	return res, rows.Err()
+}
+
+func EnsureComboTables(ctx context.Context, db *sql.DB) error {
+	// Combos (one row per Commander Spellbook variant)
+	if _, err := db.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS combos (
+            id TEXT PRIMARY KEY,
+            description TEXT NOT NULL DEFAULT '',
+            prerequisites TEXT[] NOT NULL DEFAULT '{}',
+            mana_needed TEXT NOT NULL DEFAULT '',
+            results TEXT[] NOT NULL DEFAULT '{}',
+            color_identity TEXT NOT NULL DEFAULT ''
+        );
+    `); err != nil {
+		return err
+	}
+
+	// Combo pieces
+	if _, err := db.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS combo_cards (
+            combo_id TEXT NOT NULL REFERENCES combos(id) ON DELETE CASCADE,
+            card_name TEXT NOT NULL,
+            must_be_commander BOOLEAN NOT NULL DEFAULT FALSE,
+            PRIMARY KEY (combo_id, card_name)
+        );
+    `); err != nil {
+		return err
+	}
+
+	if _, err := db.ExecContext(ctx, `
+        CREATE INDEX IF NOT EXISTS idx_combo_cards_lower_name ON combo_cards (lower(card_name));
+    `); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -2,13 +2,55 @@ package config
 
 import (
 	"log"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 )
 
 type Config struct {
 	DatabaseURL   string
 	Port          string
 	SessionSecret string
+	DataDir       string
+
+	// EncryptionKey derives the key that encrypts secrets stored for
+	// users, such as TOTP keys. It defaults to SessionSecret; changing it
+	// leaves stored secrets unreadable.
+	EncryptionKey string
+
+	// BaseURL is the public address of the site, e.g.
+	// "https://manatomb.example", for links that leave the site. When unset
+	// it is taken from each request, except in emails, which aren't sent
+	// without it.
+	BaseURL string
+
+	// TrustProxy takes client addresses from X-Forwarded-For. Only set it
+	// when the app is reachable solely through a proxy that sets the header.
+	TrustProxy bool
+
+	// Mail goes through SMTPAddr when it is set and to the log otherwise.
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+	MailFrom     string
+
+	// Signing in with an external OpenID Connect provider is offered when
+	// OIDCIssuer is set. OIDCName labels it on buttons and defaults to the
+	// issuer's host.
+	OIDCIssuer       string
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCName         string
+
+	// AdminEmails are given the admin role at startup, so a new site has
+	// someone to hand out roles from the admin area.
+	AdminEmails []string
+
+	// Card images are cached on disk up to ImageCacheMB megabytes.
+	ImageCacheDir string
+	ImageCacheMB  int
 }
 
 func Load() *Config {
@@ -16,7 +58,34 @@ func Load() *Config {
 		DatabaseURL:   mustEnv("DATABASE_URL"),
 		Port:          getEnv("PORT", "8080"),
 		SessionSecret: mustEnv("SESSION_SECRET"),
+		DataDir:       getEnv("DATA_DIR", "data"),
+		BaseURL:       strings.TrimRight(os.Getenv("BASE_URL"), "/"),
+		TrustProxy:    getEnvBool("TRUST_PROXY", false),
+		ImageCacheMB:  getEnvInt("IMAGE_CACHE_MB", 512),
+		SMTPAddr:      os.Getenv("SMTP_ADDR"),
+		SMTPUsername:  os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:  os.Getenv("SMTP_PASSWORD"),
+		MailFrom:      getEnv("MAIL_FROM", "Mana Tomb <no-reply@manatomb.local>"),
+	}
+	if cfg.SMTPAddr != "" && cfg.BaseURL == "" {
+		log.Fatalf("BASE_URL must be set when SMTP_ADDR is, for links in emails")
+	}
+	cfg.EncryptionKey = getEnv("ENCRYPTION_KEY", cfg.SessionSecret)
+	if cfg.OIDCIssuer = strings.TrimRight(os.Getenv("OIDC_ISSUER"), "/"); cfg.OIDCIssuer != "" {
+		cfg.OIDCClientID = mustEnv("OIDC_CLIENT_ID")
+		cfg.OIDCClientSecret = mustEnv("OIDC_CLIENT_SECRET")
+		host := cfg.OIDCIssuer
+		if u, err := url.Parse(cfg.OIDCIssuer); err == nil && u.Host != "" {
+			host = u.Host
+		}
+		cfg.OIDCName = getEnv("OIDC_NAME", host)
 	}
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		if email = strings.TrimSpace(email); email != "" {
+			cfg.AdminEmails = append(cfg.AdminEmails, email)
+		}
+	}
+	cfg.ImageCacheDir = getEnv("IMAGE_CACHE_DIR", filepath.Join(cfg.DataDir, "imgcache"))
 	return cfg
 }
 
@@ -27,6 +96,30 @@ func getEnv(key, def string) string {
 	return def
 }
 
+func getEnvInt(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Fatalf("invalid integer in env var %s: %q", key, v)
+	}
+	return n
+}
+
+func getEnvBool(key string, def bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Fatalf("invalid boolean in env var %s: %q", key, v)
+	}
+	return b
+}
+
 func mustEnv(key string) string {
 	v := os.Getenv(key)
 	if v == "" {
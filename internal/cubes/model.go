@@ -0,0 +1,234 @@
+package cubes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrAlreadyInCube = errors.New("card is already in the cube")
+
+// Cube is a singleton card list for drafting. Unlike a deck it has no
+// quantities; each card sits in exactly one section.
+type Cube struct {
+	ID          int64
+	UserID      int64
+	OwnerName   string
+	Name        string
+	Description string
+	CardCount   int
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+type CubeCard struct {
+	CardID        int64
+	CardName      string
+	Section       string
+	ColorIdentity string
+	TypeLine      string
+}
+
+// Section is a named group of cube cards, in display order.
+type Section struct {
+	Name  string
+	Cards []CubeCard
+}
+
+// DefaultSection is the section a card lands in when none is given:
+// its single color, Multicolor or Colorless.
+func DefaultSection(colorIdentity string) string {
+	switch len(colorIdentity) {
+	case 0:
+		return "Colorless"
+	case 1:
+		return map[string]string{"W": "White", "U": "Blue", "B": "Black", "R": "Red", "G": "Green"}[colorIdentity]
+	default:
+		return "Multicolor"
+	}
+}
+
+func CreateCube(ctx context.Context, db *sql.DB, userID int64, name, description string) (int64, error) {
+	var id int64
+	err := db.QueryRowContext(ctx, `
+		INSERT INTO cubes (user_id, name, description)
+		VALUES ($1, $2, $3)
+		RETURNING id
+	`, userID, name, description).Scan(&id)
+	return id, err
+}
+
+const cubeColumns = `
+		cu.id, cu.user_id, u.display_name, cu.name, cu.description,
+		(SELECT COUNT(*) FROM cube_cards cc WHERE cc.cube_id = cu.id),
+		cu.created_at, cu.updated_at`
+
+func scanCube(row interface{ Scan(...any) error }, c *Cube) error {
+	return row.Scan(&c.ID, &c.UserID, &c.OwnerName, &c.Name, &c.Description, &c.CardCount, &c.CreatedAt, &c.UpdatedAt)
+}
+
+// ListCubes returns every cube, the user's own first. Cubes are shared so
+// anyone can draft them; only the owner can edit.
+func ListCubes(ctx context.Context, db *sql.DB, userID int64, limit int) ([]Cube, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+cubeColumns+`
+		FROM cubes cu
+		JOIN users u ON u.id = cu.user_id
+		ORDER BY cu.user_id = $1 DESC, cu.updated_at DESC
+		LIMIT $2
+	`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Cube
+	for rows.Next() {
+		var c Cube
+		if err := scanCube(rows, &c); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+func GetCube(ctx context.Context, db *sql.DB, id int64) (*Cube, error) {
+	var c Cube
+	err := scanCube(db.QueryRowContext(ctx, `
+		SELECT `+cubeColumns+`
+		FROM cubes cu
+		JOIN users u ON u.id = cu.user_id
+		WHERE cu.id = $1
+	`, id), &c)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func UpdateCube(ctx context.Context, db *sql.DB, id int64, name, description string) error {
+	_, err := db.ExecContext(ctx, `
+		UPDATE cubes
+		SET name = $2, description = $3, updated_at = now()
+		WHERE id = $1
+	`, id, name, description)
+	return err
+}
+
+func DeleteCube(ctx context.Context, db *sql.DB, id int64) error {
+	_, err := db.ExecContext(ctx, `DELETE FROM cubes WHERE id = $1`, id)
+	return err
+}
+
+// AddCard puts a card in the cube. Cubes are singleton, so adding a card
+// twice returns ErrAlreadyInCube.
+func AddCard(ctx context.Context, db *sql.DB, cubeID, cardID int64, section string) error {
+	res, err := db.ExecContext(ctx, `
+		INSERT INTO cube_cards (cube_id, card_id, section)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (cube_id, card_id) DO NOTHING
+	`, cubeID, cardID, section)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrAlreadyInCube
+	}
+	return touch(ctx, db, cubeID)
+}
+
+func RemoveCard(ctx context.Context, db *sql.DB, cubeID, cardID int64) error {
+	if _, err := db.ExecContext(ctx, `
+		DELETE FROM cube_cards
+		WHERE cube_id = $1 AND card_id = $2
+	`, cubeID, cardID); err != nil {
+		return err
+	}
+	return touch(ctx, db, cubeID)
+}
+
+// SetSection moves a card to another section.
+func SetSection(ctx context.Context, db *sql.DB, cubeID, cardID int64, section string) error {
+	if _, err := db.ExecContext(ctx, `
+		UPDATE cube_cards
+		SET section = $3
+		WHERE cube_id = $1 AND card_id = $2
+	`, cubeID, cardID, section); err != nil {
+		return err
+	}
+	return touch(ctx, db, cubeID)
+}
+
+func ListCubeCards(ctx context.Context, db *sql.DB, cubeID int64) ([]CubeCard, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT cc.card_id, c.name, cc.section, COALESCE(c.color_identity, ''), COALESCE(c.type_line, '')
+		FROM cube_cards cc
+		JOIN cards c ON c.id = cc.card_id
+		WHERE cc.cube_id = $1
+		ORDER BY cc.section, c.name
+	`, cubeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []CubeCard
+	for rows.Next() {
+		var cc CubeCard
+		if err := rows.Scan(&cc.CardID, &cc.CardName, &cc.Section, &cc.ColorIdentity, &cc.TypeLine); err != nil {
+			return nil, err
+		}
+		out = append(out, cc)
+	}
+	return out, rows.Err()
+}
+
+// GroupBySection splits cards (sorted by section, as ListCubeCards returns
+// them) into sections.
+func GroupBySection(cards []CubeCard) []Section {
+	var out []Section
+	for _, c := range cards {
+		if n := len(out); n == 0 || out[n-1].Name != c.Section {
+			out = append(out, Section{Name: c.Section})
+		}
+		out[len(out)-1].Cards = append(out[len(out)-1].Cards, c)
+	}
+	return out
+}
+
+func touch(ctx context.Context, db *sql.DB, cubeID int64) error {
+	_, err := db.ExecContext(ctx, `UPDATE cubes SET updated_at = now() WHERE id = $1`, cubeID)
+	return err
+}
+
+func EnsureCubeTables(ctx context.Context, db *sql.DB) error {
+	// Cubes
+	if _, err := db.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS cubes (
+            id BIGSERIAL PRIMARY KEY,
+            user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+            name TEXT NOT NULL,
+            description TEXT NOT NULL DEFAULT '',
+            created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+            updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+        );
+    `); err != nil {
+		return err
+	}
+
+	// Cube cards; the primary key keeps cubes singleton.
+	if _, err := db.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS cube_cards (
+            cube_id BIGINT NOT NULL REFERENCES cubes(id) ON DELETE CASCADE,
+            card_id BIGINT NOT NULL REFERENCES cards(id) ON DELETE CASCADE,
+            section TEXT NOT NULL DEFAULT '',
+            PRIMARY KEY (cube_id, card_id)
+        );
+    `); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,23 @@
+-- Stored card prices, used for trade valuations
+
+ALTER TABLE cards ADD COLUMN IF NOT EXISTS price_usd NUMERIC(10,2);
+
+-- Collection: cards a user owns; tradeable rows form their binder
+
+CREATE TABLE IF NOT EXISTS collection_cards (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    card_id BIGINT NOT NULL REFERENCES cards(id) ON DELETE CASCADE,
+    quantity INT NOT NULL DEFAULT 1,
+    tradeable BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (user_id, card_id)
+);
+
+-- Wishlist: cards a user wants, either added by hand or synced from decks
+
+CREATE TABLE IF NOT EXISTS wishlist_cards (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    card_id BIGINT NOT NULL REFERENCES cards(id) ON DELETE CASCADE,
+    quantity INT NOT NULL DEFAULT 1,
+    auto_added BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (user_id, card_id)
+);
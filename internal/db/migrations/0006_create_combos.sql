@@ -0,0 +1,21 @@
+-- Combo database, imported from a Commander Spellbook-style JSON export
+
+CREATE TABLE IF NOT EXISTS combos (
+    id TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    prerequisites TEXT[] NOT NULL DEFAULT '{}',
+    mana_needed TEXT NOT NULL DEFAULT '',
+    results TEXT[] NOT NULL DEFAULT '{}',
+    color_identity TEXT NOT NULL DEFAULT ''
+);
+
+-- Combo pieces, matched against deck cards by name
+
+CREATE TABLE IF NOT EXISTS combo_cards (
+    combo_id TEXT NOT NULL REFERENCES combos(id) ON DELETE CASCADE,
+    card_name TEXT NOT NULL,
+    must_be_commander BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (combo_id, card_name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_combo_cards_lower_name ON combo_cards (lower(card_name));
@@ -0,0 +1,7 @@
+-- Public decks are shared on /decks/public and feed card recommendations
+
+ALTER TABLE decks ADD COLUMN IF NOT EXISTS is_public BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Color identity in WUBRG order, used to group decks by commander colors
+
+ALTER TABLE cards ADD COLUMN IF NOT EXISTS color_identity TEXT;
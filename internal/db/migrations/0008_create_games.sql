@@ -0,0 +1,25 @@
+-- Logged games and the players at each seat
+
+CREATE TABLE IF NOT EXISTS games (
+    id BIGSERIAL PRIMARY KEY,
+    created_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    played_at DATE NOT NULL DEFAULT CURRENT_DATE,
+    win_condition TEXT NOT NULL DEFAULT '',
+    turn_count INT,
+    notes TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS game_players (
+    game_id BIGINT NOT NULL REFERENCES games(id) ON DELETE CASCADE,
+    seat INT NOT NULL,
+    user_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    guest_name TEXT NOT NULL DEFAULT '',
+    deck_id BIGINT REFERENCES decks(id) ON DELETE SET NULL,
+    commander_name TEXT NOT NULL DEFAULT '',
+    is_winner BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (game_id, seat)
+);
+
+CREATE INDEX IF NOT EXISTS idx_game_players_user_id ON game_players(user_id);
+CREATE INDEX IF NOT EXISTS idx_game_players_deck_id ON game_players(deck_id);
@@ -0,0 +1,22 @@
+-- Playgroups with shared house rules
+
+CREATE TABLE IF NOT EXISTS playgroups (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    invite_code TEXT NOT NULL UNIQUE,
+    house_bans TEXT[] NOT NULL DEFAULT '{}',
+    rule_zero TEXT NOT NULL DEFAULT '',
+    target_bracket INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS playgroup_members (
+    group_id BIGINT NOT NULL REFERENCES playgroups(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL DEFAULT 'member',
+    joined_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (group_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_playgroup_members_user_id ON playgroup_members(user_id);
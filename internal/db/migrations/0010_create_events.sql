@@ -0,0 +1,47 @@
+-- Tournaments and leagues: registrations, rounds, pods and results
+
+CREATE TABLE IF NOT EXISTS events (
+    id BIGSERIAL PRIMARY KEY,
+    organizer_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    starts_at TIMESTAMPTZ NOT NULL,
+    status TEXT NOT NULL DEFAULT 'registration',
+    round_minutes INT NOT NULL DEFAULT 75,
+    win_points INT NOT NULL DEFAULT 3,
+    draw_points INT NOT NULL DEFAULT 1,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS event_players (
+    event_id BIGINT NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    deck_id BIGINT REFERENCES decks(id) ON DELETE SET NULL,
+    dropped BOOLEAN NOT NULL DEFAULT FALSE,
+    registered_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (event_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS event_rounds (
+    id BIGSERIAL PRIMARY KEY,
+    event_id BIGINT NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+    number INT NOT NULL,
+    started_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ends_at TIMESTAMPTZ NOT NULL,
+    UNIQUE (event_id, number)
+);
+
+CREATE TABLE IF NOT EXISTS event_pods (
+    id BIGSERIAL PRIMARY KEY,
+    round_id BIGINT NOT NULL REFERENCES event_rounds(id) ON DELETE CASCADE,
+    table_number INT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS event_pod_players (
+    pod_id BIGINT NOT NULL REFERENCES event_pods(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    seat INT NOT NULL,
+    result TEXT NOT NULL DEFAULT '',
+    achievement_points INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (pod_id, user_id)
+);
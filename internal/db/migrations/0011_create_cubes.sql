@@ -0,0 +1,17 @@
+-- Cubes: singleton card lists with sections, used for drafts
+
+CREATE TABLE IF NOT EXISTS cubes (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS cube_cards (
+    cube_id BIGINT NOT NULL REFERENCES cubes(id) ON DELETE CASCADE,
+    card_id BIGINT NOT NULL REFERENCES cards(id) ON DELETE CASCADE,
+    section TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (cube_id, card_id)
+);
@@ -0,0 +1,14 @@
+-- Booster printings per set, cached from Scryfall for opening packs
+
+CREATE TABLE IF NOT EXISTS set_cards (
+    set_code TEXT NOT NULL,
+    collector_number TEXT NOT NULL,
+    name TEXT NOT NULL,
+    rarity TEXT NOT NULL,
+    mana_cost TEXT NOT NULL DEFAULT '',
+    type_line TEXT NOT NULL DEFAULT '',
+    oracle_text TEXT NOT NULL DEFAULT '',
+    image_uri TEXT NOT NULL DEFAULT '',
+    color_identity TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (set_code, collector_number)
+);
@@ -0,0 +1,8 @@
+-- Back faces of double-faced cards, used when printing proxies
+
+ALTER TABLE cards
+    ADD COLUMN IF NOT EXISTS back_name TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS back_mana_cost TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS back_type_line TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS back_oracle_text TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS back_image_uri TEXT NOT NULL DEFAULT '';
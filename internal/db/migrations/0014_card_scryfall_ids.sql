@@ -0,0 +1,5 @@
+-- Scryfall IDs, which key the local card image cache
+
+ALTER TABLE cards ADD COLUMN IF NOT EXISTS scryfall_id TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE set_cards ADD COLUMN IF NOT EXISTS scryfall_id TEXT NOT NULL DEFAULT '';
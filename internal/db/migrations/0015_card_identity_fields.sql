@@ -0,0 +1,13 @@
+-- Color indicators and power/toughness, for computing color identity and
+-- commander eligibility locally
+
+ALTER TABLE cards
+    ADD COLUMN IF NOT EXISTS color_indicator TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS back_color_indicator TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS power TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS toughness TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE set_cards
+    ADD COLUMN IF NOT EXISTS color_indicator TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS power TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS toughness TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,41 @@
+-- Roles, disabled accounts, impersonation, deck moderation and the audit log
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'user',
+    ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMPTZ;
+
+ALTER TABLE sessions
+    ADD COLUMN IF NOT EXISTS impersonator_id BIGINT REFERENCES users(id) ON DELETE CASCADE;
+
+ALTER TABLE decks
+    ADD COLUMN IF NOT EXISTS hidden_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS featured_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS deck_reports (
+    id BIGSERIAL PRIMARY KEY,
+    deck_id BIGINT NOT NULL REFERENCES decks(id) ON DELETE CASCADE,
+    reporter_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    reason TEXT NOT NULL,
+    details TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    resolved_at TIMESTAMPTZ,
+    resolved_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    resolution TEXT NOT NULL DEFAULT ''
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_deck_reports_open
+    ON deck_reports(deck_id, reporter_id) WHERE resolved_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    actor_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    actor_name TEXT NOT NULL DEFAULT '',
+    action TEXT NOT NULL,
+    target_type TEXT NOT NULL DEFAULT '',
+    target_id BIGINT NOT NULL DEFAULT 0,
+    summary TEXT NOT NULL DEFAULT '',
+    ip TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target_type, target_id);
@@ -0,0 +1,28 @@
+-- Emails are stored lowercased and unique whatever their case
+
+UPDATE users u SET email = lower(u.email)
+WHERE u.email <> lower(u.email)
+  AND NOT EXISTS (SELECT 1 FROM users o WHERE o.id <> u.id AND lower(o.email) = lower(u.email));
+
+-- Accounts whose emails differ only in case are reported, not merged: the
+-- unique index waits until they have been merged or changed by hand and
+-- this is run again.
+DO $$
+DECLARE
+    dups TEXT;
+BEGIN
+    SELECT string_agg(email || ' (ids ' || ids || ')', ', ') INTO dups
+    FROM (
+        SELECT lower(email) AS email, string_agg(id::text, ', ' ORDER BY id) AS ids
+        FROM users
+        GROUP BY lower(email)
+        HAVING COUNT(*) > 1
+    ) d;
+
+    IF dups IS NOT NULL THEN
+        RAISE WARNING 'emails used by more than one account, ignoring case: %', dups;
+    ELSE
+        ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+        CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_lower ON users(lower(email));
+    END IF;
+END $$;
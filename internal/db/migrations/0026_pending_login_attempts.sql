@@ -0,0 +1,3 @@
+-- Sign-in attempts are reserved before checking, so in-progress ones have no outcome yet
+
+ALTER TABLE login_attempts ALTER COLUMN succeeded DROP NOT NULL;
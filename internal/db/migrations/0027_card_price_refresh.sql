@@ -0,0 +1,3 @@
+-- Card prices are refreshed from Scryfall; track when each was last fetched
+
+ALTER TABLE cards ADD COLUMN IF NOT EXISTS price_updated_at TIMESTAMPTZ;
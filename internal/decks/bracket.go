@@ -0,0 +1,222 @@
+package decks
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Brackets follow the official Commander bracket names.
+var bracketNames = map[int]string{
+	1: "Exhibition",
+	2: "Core",
+	3: "Upgraded",
+	4: "Optimized",
+	5: "cEDH",
+}
+
+// Thresholds used by EstimateBracket. The card lists are data files; these
+// cut-offs mirror the bracket guidelines and change far less often.
+const (
+	maxGameChangersUpgraded = 3
+	extraTurnChainCount     = 3
+	manyTutorsCount         = 3
+	muchFastManaCount       = 3
+)
+
+// BracketLists holds the maintained card lists used to estimate a deck's
+// bracket. Names are stored normalized (see normalizeCardName).
+type BracketLists struct {
+	GameChangers   map[string]bool
+	Tutors         map[string]bool
+	FastMana       map[string]bool
+	ExtraTurns     map[string]bool
+	MassLandDenial map[string]bool
+	Combos         [][2]string
+}
+
+// LoadBracketLists reads the bracket lists from dir. Each list is a plain
+// text file with one card name per line; two_card_combos.txt holds one
+// "Card A + Card B" pair per line. Lines starting with # are comments.
+func LoadBracketLists(dir string) (*BracketLists, error) {
+	lists := &BracketLists{}
+
+	sets := []struct {
+		file string
+		dst  *map[string]bool
+	}{
+		{"game_changers.txt", &lists.GameChangers},
+		{"tutors.txt", &lists.Tutors},
+		{"fast_mana.txt", &lists.FastMana},
+		{"extra_turns.txt", &lists.ExtraTurns},
+		{"mass_land_denial.txt", &lists.MassLandDenial},
+	}
+
+	for _, s := range sets {
+		lines, err := readListFile(filepath.Join(dir, s.file))
+		if err != nil {
+			return nil, err
+		}
+		m := make(map[string]bool, len(lines))
+		for _, l := range lines {
+			m[normalizeCardName(l)] = true
+		}
+		*s.dst = m
+	}
+
+	lines, err := readListFile(filepath.Join(dir, "two_card_combos.txt"))
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range lines {
+		a, b, ok := strings.Cut(l, " + ")
+		if !ok {
+			return nil, fmt.Errorf("two_card_combos.txt: expected \"Card A + Card B\", got %q", l)
+		}
+		lists.Combos = append(lists.Combos, [2]string{strings.TrimSpace(a), strings.TrimSpace(b)})
+	}
+
+	return lists, nil
+}
+
+func readListFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var out []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		out = append(out, line)
+	}
+	return out, sc.Err()
+}
+
+// normalizeCardName lowercases a name and reduces double-faced cards to
+// their front face, so "Boom // Bust" and "boom" match the same entry.
+func normalizeCardName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if front, _, ok := strings.Cut(name, " // "); ok {
+		name = front
+	}
+	return name
+}
+
+// BracketName returns the official name of a bracket, or "" if n isn't one.
+func BracketName(n int) string {
+	return bracketNames[n]
+}
+
+// BracketEstimate is the suggested bracket for a deck and why.
+type BracketEstimate struct {
+	Bracket        int
+	Name           string
+	GameChangers   []string
+	Tutors         []string
+	FastMana       []string
+	ExtraTurns     []string
+	MassLandDenial []string
+	Combos         []string
+	Reasons        []string
+}
+
+// EstimateBracket scores a deck against the bracket guidelines. Bracket 1 is
+// about a deck's intent and bracket 5 about the competitive metagame, so
+// neither can be inferred from a card list: estimates start at 2 and stop
+// at 4.
+func EstimateBracket(lists *BracketLists, commanderName string, cards []DeckCard) BracketEstimate {
+	est := BracketEstimate{Bracket: 2}
+
+	names := make([]string, 0, len(cards)+1)
+	if commanderName != "" {
+		names = append(names, commanderName)
+	}
+	for _, c := range cards {
+		names = append(names, c.CardName)
+	}
+
+	inDeck := map[string]string{}
+	for _, n := range names {
+		key := normalizeCardName(n)
+		if _, seen := inDeck[key]; seen {
+			continue
+		}
+		inDeck[key] = n
+
+		if lists.GameChangers[key] {
+			est.GameChangers = append(est.GameChangers, n)
+		}
+		if lists.Tutors[key] {
+			est.Tutors = append(est.Tutors, n)
+		}
+		if lists.FastMana[key] {
+			est.FastMana = append(est.FastMana, n)
+		}
+		if lists.ExtraTurns[key] {
+			est.ExtraTurns = append(est.ExtraTurns, n)
+		}
+		if lists.MassLandDenial[key] {
+			est.MassLandDenial = append(est.MassLandDenial, n)
+		}
+	}
+
+	for _, combo := range lists.Combos {
+		a, aok := inDeck[normalizeCardName(combo[0])]
+		b, bok := inDeck[normalizeCardName(combo[1])]
+		if aok && bok {
+			est.Combos = append(est.Combos, a+" + "+b)
+		}
+	}
+
+	raise := func(to int, reason string) {
+		if to > est.Bracket {
+			est.Bracket = to
+		}
+		est.Reasons = append(est.Reasons, reason)
+	}
+
+	switch n := len(est.GameChangers); {
+	case n > maxGameChangersUpgraded:
+		raise(4, fmt.Sprintf("%d Game Changers (more than %d is bracket 4).", n, maxGameChangersUpgraded))
+	case n > 0:
+		raise(3, fmt.Sprintf("%d Game Changer(s) (1–%d is bracket 3).", n, maxGameChangersUpgraded))
+	}
+
+	if n := len(est.MassLandDenial); n > 0 {
+		raise(4, fmt.Sprintf("%d mass land denial card(s) (only allowed in bracket 4+).", n))
+	}
+
+	if n := len(est.Combos); n > 0 {
+		raise(4, fmt.Sprintf("%d two-card combo(s) (brackets 1–3 avoid early two-card combos).", n))
+	}
+
+	switch n := len(est.ExtraTurns); {
+	case n >= extraTurnChainCount:
+		raise(4, fmt.Sprintf("%d extra turn cards, enough to chain turns.", n))
+	case n > 0:
+		raise(2, fmt.Sprintf("%d extra turn card(s), fine in low numbers.", n))
+	}
+
+	if n := len(est.Tutors); n >= manyTutorsCount {
+		raise(3, fmt.Sprintf("%d tutors (brackets 1–2 expect only a few).", n))
+	}
+
+	if n := len(est.FastMana); n >= muchFastManaCount {
+		raise(3, fmt.Sprintf("%d fast mana sources.", n))
+	}
+
+	if len(est.Reasons) == 0 {
+		est.Reasons = append(est.Reasons, "No Game Changers, mass land denial, two-card combos or heavy tutoring found.")
+	}
+
+	est.Name = bracketNames[est.Bracket]
+	return est
+}
@@ -0,0 +1,163 @@
+package decks
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"manatomb/app/internal/cards"
+)
+
+// commanderDeckSize is the exact size of a Commander deck, commander included.
+const commanderDeckSize = 100
+
+// BanList is a set of banned card names, stored normalized (see
+// normalizeCardName).
+type BanList map[string]bool
+
+// LoadBanList reads a ban list file: one card name per line, with blank
+// lines and lines starting with # ignored.
+func LoadBanList(path string) (BanList, error) {
+	lines, err := readListFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewBanList(lines), nil
+}
+
+// NewBanList builds a ban list from card names.
+func NewBanList(names []string) BanList {
+	b := make(BanList, len(names))
+	for _, n := range names {
+		if n = strings.TrimSpace(n); n != "" {
+			b[normalizeCardName(n)] = true
+		}
+	}
+	return b
+}
+
+func (b BanList) Contains(name string) bool {
+	return b[normalizeCardName(name)]
+}
+
+// Rules are the deck-building rules a deck is checked against: the
+// Commander ban list plus, for playgroups, a house ban list and a target
+// bracket (0 for none).
+type Rules struct {
+	Name          string
+	Banned        BanList
+	HouseBanned   BanList
+	TargetBracket int
+}
+
+// Legality is the outcome of checking a deck against a set of rules.
+type Legality struct {
+	Rules    string
+	Problems []string
+}
+
+func (l Legality) Legal() bool {
+	return len(l.Problems) == 0
+}
+
+// CheckLegality checks deck size, singleton, the ban lists and, when the
+// rules set one, the target bracket. When the commander's card is known
+// it also checks that it can be a commander and that every card is in its
+// color identity.
+func CheckLegality(rules Rules, d *Deck, commander *cards.Card, deckCards []DeckCard, bracket BracketEstimate) Legality {
+	out := Legality{Rules: rules.Name}
+	problem := func(format string, args ...any) {
+		out.Problems = append(out.Problems, fmt.Sprintf(format, args...))
+	}
+
+	if d.CommanderName == "" {
+		problem("No commander set.")
+	}
+
+	size := 0
+	commanderListed := false
+	for _, c := range deckCards {
+		size += c.Quantity
+		if normalizeCardName(c.CardName) == normalizeCardName(d.CommanderName) {
+			commanderListed = true
+		}
+	}
+	if d.CommanderName != "" && !commanderListed {
+		size++
+	}
+	if size != commanderDeckSize {
+		problem("Deck has %d cards including the commander; it needs exactly %d.", size, commanderDeckSize)
+	}
+
+	var dupes, banned, houseBanned []string
+	names := make([]string, 0, len(deckCards)+1)
+	if d.CommanderName != "" && !commanderListed {
+		names = append(names, d.CommanderName)
+	}
+	for _, c := range deckCards {
+		names = append(names, c.CardName)
+		if c.Quantity > 1 && !c.SingletonExempt {
+			dupes = append(dupes, fmt.Sprintf("%s (%d)", c.CardName, c.Quantity))
+		}
+	}
+	for _, n := range names {
+		switch {
+		case rules.Banned.Contains(n):
+			banned = append(banned, n)
+		case rules.HouseBanned.Contains(n):
+			houseBanned = append(houseBanned, n)
+		}
+	}
+
+	if commander != nil {
+		switch {
+		case cards.IsBackground(*commander):
+			problem("%s is a Background; it can only be a commander alongside a creature with \"Choose a Background\".", commander.Name)
+		case !cards.CanBeCommander(*commander):
+			problem("%s can't be your commander.", commander.Name)
+		}
+
+		identity := cards.ColorIdentity(*commander)
+		var outside []string
+		for _, c := range deckCards {
+			if !cards.WithinIdentity(c.ColorIdentity, identity) {
+				outside = append(outside, c.CardName)
+			}
+		}
+		if len(outside) > 0 {
+			problem("Outside %s's color identity (%s): %s.", commander.Name, identityName(identity), joinSorted(outside))
+		}
+	}
+
+	if len(dupes) > 0 {
+		problem("More than one copy of: %s.", joinSorted(dupes))
+	}
+	if len(banned) > 0 {
+		problem("Banned in Commander: %s.", joinSorted(banned))
+	}
+	if len(houseBanned) > 0 {
+		problem("Banned by house rules: %s.", joinSorted(houseBanned))
+	}
+
+	// Estimates never go below bracket 2, so a bracket 1 target is checked
+	// as 2.
+	if rules.TargetBracket > 0 && bracket.Bracket > max(rules.TargetBracket, 2) {
+		problem("Estimated bracket %d (%s) is above the target of bracket %d (%s).",
+			bracket.Bracket, bracket.Name, rules.TargetBracket, BracketName(rules.TargetBracket))
+	}
+
+	return out
+}
+
+func joinSorted(items []string) string {
+	sort.Strings(items)
+	return strings.Join(items, ", ")
+}
+
+// identityName spells out a color identity for messages.
+func identityName(identity string) string {
+	if identity == "" {
+		return "colorless"
+	}
+	return identity
+}
@@ -4,6 +4,15 @@ import (
 	"context"
 	"database/sql"
 	"time"
+
+	"manatomb/app/internal/cards"
+)
+
+// Deck formats.
+const (
+	FormatCommander = "commander"
+	FormatDraft     = "draft"
+	FormatSealed    = "sealed"
 )
 
 type Deck struct {
@@ -13,14 +22,26 @@ type Deck struct {
 	Description   string
 	Format        string
 	CommanderName string
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
+	IsPublic      bool
+
+	// Hidden decks were taken off public pages by a moderator, whatever
+	// IsPublic says. Featured ones are listed first on /decks/public.
+	Hidden   bool
+	Featured bool
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
 
+// DeckCard is a card in a deck. SingletonExempt is set for basic lands and
+// cards like Relentless Rats whose text lets a deck run more than one copy.
+// ColorIdentity is computed from the stored card (see cards.ColorIdentity).
 type DeckCard struct {
-	CardID   int64
-	CardName string
-	Quantity int
+	CardID          int64
+	CardName        string
+	Quantity        int
+	SingletonExempt bool
+	ColorIdentity   string
 }
 
 func AddCard(ctx context.Context, db *sql.DB, deckID int64, cardID int64, delta int) error {
@@ -71,7 +92,11 @@ func AddCard(ctx context.Context, db *sql.DB, deckID int64, cardID int64, delta
 
 func ListDeckCards(ctx context.Context, db *sql.DB, deckID int64) ([]DeckCard, error) {
 	rows, err := db.QueryContext(ctx, `
-		SELECT dc.card_id, c.name, dc.quantity
+		SELECT dc.card_id, c.name, dc.quantity,
+		       COALESCE(c.type_line, '') LIKE 'Basic %'
+		       OR COALESCE(c.oracle_text, '') LIKE '%A deck can have % cards named%',
+		       COALESCE(c.mana_cost, ''), COALESCE(c.oracle_text, ''), c.color_indicator,
+		       c.back_mana_cost, c.back_oracle_text, c.back_color_indicator
 		FROM deck_cards dc
 		JOIN cards c ON c.id = dc.card_id
 		WHERE dc.deck_id = $1
@@ -85,28 +110,80 @@ func ListDeckCards(ctx context.Context, db *sql.DB, deckID int64) ([]DeckCard, e
 	var out []DeckCard
 	for rows.Next() {
 		var dc DeckCard
-		if err := rows.Scan(&dc.CardID, &dc.CardName, &dc.Quantity); err != nil {
+		var c cards.Card
+		if err := rows.Scan(&dc.CardID, &dc.CardName, &dc.Quantity, &dc.SingletonExempt,
+			&c.ManaCost, &c.OracleText, &c.ColorIndicator,
+			&c.BackManaCost, &c.BackOracleText, &c.BackColorIndicator); err != nil {
 			return nil, err
 		}
+		c.Name = dc.CardName
+		dc.ColorIdentity = cards.ColorIdentity(c)
 		out = append(out, dc)
 	}
 	return out, rows.Err()
 }
 
 func CreateDeck(ctx context.Context, db *sql.DB, userID int64, name, description, commanderName string) (*Deck, error) {
+	return CreateDeckInFormat(ctx, db, userID, name, description, FormatCommander, commanderName)
+}
+
+// CreateDeckInFormat creates a deck for a format other than Commander, such
+// as the pool from a cube draft or a sealed event.
+func CreateDeckInFormat(ctx context.Context, db *sql.DB, userID int64, name, description, format, commanderName string) (*Deck, error) {
 	var d Deck
 	err := db.QueryRowContext(ctx, `
 		INSERT INTO decks (user_id, name, description, format, commander_name)
-		VALUES ($1, $2, $3, 'commander', $4)
-		RETURNING id, user_id, name, description, format, commander_name, created_at, updated_at
-	`, userID, name, description, commanderName).
-		Scan(&d.ID, &d.UserID, &d.Name, &d.Description, &d.Format, &d.CommanderName, &d.CreatedAt, &d.UpdatedAt)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, user_id, name, description, format, commander_name, is_public, hidden_at IS NOT NULL, featured_at IS NOT NULL, created_at, updated_at
+	`, userID, name, description, format, commanderName).
+		Scan(&d.ID, &d.UserID, &d.Name, &d.Description, &d.Format, &d.CommanderName, &d.IsPublic, &d.Hidden, &d.Featured, &d.CreatedAt, &d.UpdatedAt)
 	return &d, err
 }
 
+// PoolDeck is a limited pool to store as a deck. Cards maps card IDs to
+// how many copies the pool holds.
+type PoolDeck struct {
+	UserID      int64
+	Name        string
+	Description string
+	Cards       map[int64]int
+}
+
+// CreatePoolDecks creates a deck in format for each pool, all in one
+// transaction, so a failure part way leaves none of them behind.
+func CreatePoolDecks(ctx context.Context, db *sql.DB, format string, pools []PoolDeck) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, p := range pools {
+		var deckID int64
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO decks (user_id, name, description, format, commander_name)
+			VALUES ($1, $2, $3, $4, '')
+			RETURNING id
+		`, p.UserID, p.Name, p.Description, format).Scan(&deckID)
+		if err != nil {
+			return err
+		}
+		for cardID, qty := range p.Cards {
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO deck_cards (deck_id, card_id, quantity)
+				VALUES ($1, $2, $3)
+			`, deckID, cardID, qty); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
 func ListDecksByUser(ctx context.Context, db *sql.DB, userID int64) ([]Deck, error) {
 	rows, err := db.QueryContext(ctx, `
-		SELECT id, user_id, name, description, format, commander_name, created_at, updated_at
+		SELECT id, user_id, name, description, format, commander_name, is_public, hidden_at IS NOT NULL, featured_at IS NOT NULL, created_at, updated_at
 		FROM decks
 		WHERE user_id = $1
 		ORDER BY updated_at DESC
@@ -119,7 +196,7 @@ func ListDecksByUser(ctx context.Context, db *sql.DB, userID int64) ([]Deck, err
 	var out []Deck
 	for rows.Next() {
 		var d Deck
-		if err := rows.Scan(&d.ID, &d.UserID, &d.Name, &d.Description, &d.Format, &d.CommanderName, &d.CreatedAt, &d.UpdatedAt); err != nil {
+		if err := rows.Scan(&d.ID, &d.UserID, &d.Name, &d.Description, &d.Format, &d.CommanderName, &d.IsPublic, &d.Hidden, &d.Featured, &d.CreatedAt, &d.UpdatedAt); err != nil {
 			return nil, err
 		}
 		out = append(out, d)
@@ -130,17 +207,82 @@ func ListDecksByUser(ctx context.Context, db *sql.DB, userID int64) ([]Deck, err
 func GetDeck(ctx context.Context, db *sql.DB, id, userID int64) (*Deck, error) {
 	var d Deck
 	err := db.QueryRowContext(ctx, `
-		SELECT id, user_id, name, description, format, commander_name, created_at, updated_at
+		SELECT id, user_id, name, description, format, commander_name, is_public, hidden_at IS NOT NULL, featured_at IS NOT NULL, created_at, updated_at
 		FROM decks
 		WHERE id = $1 AND user_id = $2
 	`, id, userID).
-		Scan(&d.ID, &d.UserID, &d.Name, &d.Description, &d.Format, &d.CommanderName, &d.CreatedAt, &d.UpdatedAt)
+		Scan(&d.ID, &d.UserID, &d.Name, &d.Description, &d.Format, &d.CommanderName, &d.IsPublic, &d.Hidden, &d.Featured, &d.CreatedAt, &d.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
 	return &d, nil
 }
 
+// GetVisibleDeck loads a deck the given user may view: their own or any
+// public deck moderators haven't hidden. Pass userID 0 for anonymous
+// visitors.
+func GetVisibleDeck(ctx context.Context, db *sql.DB, id, userID int64) (*Deck, error) {
+	var d Deck
+	err := db.QueryRowContext(ctx, `
+		SELECT id, user_id, name, description, format, commander_name, is_public, hidden_at IS NOT NULL, featured_at IS NOT NULL, created_at, updated_at
+		FROM decks
+		WHERE id = $1
+		  AND (user_id = $2 OR (is_public AND hidden_at IS NULL))
+	`, id, userID).
+		Scan(&d.ID, &d.UserID, &d.Name, &d.Description, &d.Format, &d.CommanderName, &d.IsPublic, &d.Hidden, &d.Featured, &d.CreatedAt, &d.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// PublicDeck is a public deck together with its owner's display name.
+type PublicDeck struct {
+	Deck
+	OwnerName string
+	CardCount int
+}
+
+// ListPublicDecks lists public decks that aren't hidden, featured ones
+// first and then the most recently updated.
+func ListPublicDecks(ctx context.Context, db *sql.DB, limit int) ([]PublicDeck, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT d.id, d.user_id, d.name, d.description, d.format, d.commander_name, d.is_public, d.hidden_at IS NOT NULL, d.featured_at IS NOT NULL, d.created_at, d.updated_at,
+		       u.display_name,
+		       COALESCE((SELECT SUM(quantity) FROM deck_cards WHERE deck_id = d.id), 0)
+		FROM decks d
+		JOIN users u ON u.id = d.user_id
+		WHERE d.is_public AND d.hidden_at IS NULL
+		ORDER BY d.featured_at DESC NULLS LAST, d.updated_at DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []PublicDeck
+	for rows.Next() {
+		var d PublicDeck
+		if err := rows.Scan(&d.ID, &d.UserID, &d.Name, &d.Description, &d.Format, &d.CommanderName, &d.IsPublic, &d.Hidden, &d.Featured, &d.CreatedAt, &d.UpdatedAt, &d.OwnerName, &d.CardCount); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// SetDeckPublic shares a deck on the public decks page, or hides it again.
+func SetDeckPublic(ctx context.Context, db *sql.DB, deckID int64, public bool) error {
+	_, err := db.ExecContext(ctx, `
+		UPDATE decks
+		SET is_public = $1,
+		    updated_at = NOW()
+		WHERE id = $2
+	`, public, deckID)
+	return err
+}
+
 func UpdateDeck(ctx context.Context, db *sql.DB, deckID int64, name, description, commanderName string) error {
 	_, err := db.ExecContext(ctx, `
 		UPDATE decks
@@ -178,6 +320,22 @@ func EnsureDeckTables(ctx context.Context, db *sql.DB) error {
 		return err
 	}
 
+	// Public decks are shared on /decks/public and feed recommendations.
+	if _, err := db.ExecContext(ctx, `
+        ALTER TABLE decks ADD COLUMN IF NOT EXISTS is_public BOOLEAN NOT NULL DEFAULT FALSE;
+    `); err != nil {
+		return err
+	}
+
+	// Moderators can hide public decks and feature good ones.
+	if _, err := db.ExecContext(ctx, `
+        ALTER TABLE decks
+            ADD COLUMN IF NOT EXISTS hidden_at TIMESTAMPTZ,
+            ADD COLUMN IF NOT EXISTS featured_at TIMESTAMPTZ;
+    `); err != nil {
+		return err
+	}
+
 	// Deck cards table
 	if _, err := db.ExecContext(ctx, `
         CREATE TABLE IF NOT EXISTS deck_cards (
@@ -190,5 +348,26 @@ func EnsureDeckTables(ctx context.Context, db *sql.DB) error {
 		return err
 	}
 
+	// Reports on public decks, kept once resolved so moderators can see
+	// what was done.
+	if _, err := db.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS deck_reports (
+            id BIGSERIAL PRIMARY KEY,
+            deck_id BIGINT NOT NULL REFERENCES decks(id) ON DELETE CASCADE,
+            reporter_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+            reason TEXT NOT NULL,
+            details TEXT NOT NULL DEFAULT '',
+            created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+            resolved_at TIMESTAMPTZ,
+            resolved_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+            resolution TEXT NOT NULL DEFAULT ''
+        );
+
+        CREATE UNIQUE INDEX IF NOT EXISTS idx_deck_reports_open
+            ON deck_reports(deck_id, reporter_id) WHERE resolved_at IS NULL;
+    `); err != nil {
+		return err
+	}
+
 	return nil
 }
@@ -0,0 +1,235 @@
+package decks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Reasons a deck can be reported for.
+const (
+	ReportSpam      = "spam"
+	ReportOffensive = "offensive"
+	ReportOther     = "other"
+)
+
+// ReportReason is a choice on the report form.
+type ReportReason struct {
+	Value string
+	Label string
+}
+
+var ReportReasons = []ReportReason{
+	{ReportSpam, "Spam or advertising"},
+	{ReportOffensive, "Offensive name, description or cards"},
+	{ReportOther, "Something else"},
+}
+
+// maxReportDetails caps the free text a reporter can add.
+const maxReportDetails = 1000
+
+var (
+	ErrInvalidReportReason = errors.New("unknown report reason")
+	ErrReportNotFound      = errors.New("report not found")
+)
+
+// Report is an open complaint about a public deck, waiting for a
+// moderator.
+type Report struct {
+	ID           int64
+	DeckID       int64
+	DeckName     string
+	DeckHidden   bool
+	OwnerName    string
+	ReporterName string
+	Reason       string
+	Details      string
+	CreatedAt    time.Time
+}
+
+// ReasonLabel is the reason as the reporter saw it.
+func (r Report) ReasonLabel() string {
+	for _, rr := range ReportReasons {
+		if rr.Value == r.Reason {
+			return rr.Label
+		}
+	}
+	return r.Reason
+}
+
+// ModeratedDeck is a deck as the moderation list shows it.
+type ModeratedDeck struct {
+	PublicDeck
+	OpenReports int
+}
+
+// GetAnyDeck loads a deck whoever owns it and whether or not it is public,
+// for moderators.
+func GetAnyDeck(ctx context.Context, db *sql.DB, id int64) (*Deck, error) {
+	var d Deck
+	err := db.QueryRowContext(ctx, `
+		SELECT id, user_id, name, description, format, commander_name, is_public, hidden_at IS NOT NULL, featured_at IS NOT NULL, created_at, updated_at
+		FROM decks
+		WHERE id = $1
+	`, id).
+		Scan(&d.ID, &d.UserID, &d.Name, &d.Description, &d.Format, &d.CommanderName, &d.IsPublic, &d.Hidden, &d.Featured, &d.CreatedAt, &d.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// ListDecksForModeration lists public and hidden decks whose name or
+// owner contains query, or whose ID is query, most recently updated first.
+func ListDecksForModeration(ctx context.Context, db *sql.DB, query string, limit int) ([]ModeratedDeck, error) {
+	query = strings.TrimSpace(query)
+	pattern := "%" + likeEscaper.Replace(query) + "%"
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT d.id, d.user_id, d.name, d.description, d.format, d.commander_name, d.is_public, d.hidden_at IS NOT NULL, d.featured_at IS NOT NULL, d.created_at, d.updated_at,
+		       u.display_name,
+		       COALESCE((SELECT SUM(quantity) FROM deck_cards WHERE deck_id = d.id), 0),
+		       (SELECT COUNT(*) FROM deck_reports WHERE deck_id = d.id AND resolved_at IS NULL)
+		FROM decks d
+		JOIN users u ON u.id = d.user_id
+		WHERE (d.is_public OR d.hidden_at IS NOT NULL)
+		  AND ($1 = '' OR d.name ILIKE $2 OR u.display_name ILIKE $2 OR d.id::text = $1)
+		ORDER BY d.updated_at DESC
+		LIMIT $3
+	`, query, pattern, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []ModeratedDeck
+	for rows.Next() {
+		var d ModeratedDeck
+		if err := rows.Scan(&d.ID, &d.UserID, &d.Name, &d.Description, &d.Format, &d.CommanderName, &d.IsPublic, &d.Hidden, &d.Featured, &d.CreatedAt, &d.UpdatedAt,
+			&d.OwnerName, &d.CardCount, &d.OpenReports); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// SetDeckHidden takes a deck off the public pages, or puts it back.
+// Hiding a deck also unfeatures it and settles its open reports.
+func SetDeckHidden(ctx context.Context, db *sql.DB, deckID int64, hidden bool, moderatorID int64) error {
+	if !hidden {
+		_, err := db.ExecContext(ctx, `UPDATE decks SET hidden_at = NULL WHERE id = $1`, deckID)
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE decks
+		SET hidden_at = COALESCE(hidden_at, NOW()),
+		    featured_at = NULL
+		WHERE id = $1
+	`, deckID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE deck_reports
+		SET resolved_at = NOW(), resolved_by = $2, resolution = 'hidden'
+		WHERE deck_id = $1 AND resolved_at IS NULL
+	`, deckID, moderatorID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetDeckFeatured pins a deck to the top of /decks/public, or unpins it.
+func SetDeckFeatured(ctx context.Context, db *sql.DB, deckID int64, featured bool) error {
+	_, err := db.ExecContext(ctx, `
+		UPDATE decks
+		SET featured_at = CASE WHEN $2 THEN COALESCE(featured_at, NOW()) END
+		WHERE id = $1
+	`, deckID, featured)
+	return err
+}
+
+// ReportDeck flags a public deck for moderators. Only decks on the public
+// pages can be reported, not by their owner, and a user's further reports
+// on a deck are ignored while their first is open.
+func ReportDeck(ctx context.Context, db *sql.DB, deckID, reporterID int64, reason, details string) error {
+	valid := false
+	for _, rr := range ReportReasons {
+		valid = valid || rr.Value == reason
+	}
+	if !valid {
+		return ErrInvalidReportReason
+	}
+
+	details = strings.TrimSpace(details)
+	if len(details) > maxReportDetails {
+		details = strings.ToValidUTF8(details[:maxReportDetails], "")
+	}
+
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO deck_reports (deck_id, reporter_id, reason, details)
+		SELECT id, $2, $3, $4
+		FROM decks
+		WHERE id = $1 AND is_public AND hidden_at IS NULL AND user_id <> $2
+		ON CONFLICT DO NOTHING
+	`, deckID, reporterID, reason, details)
+	return err
+}
+
+// ListOpenReports returns reports no moderator has dealt with, oldest
+// first.
+func ListOpenReports(ctx context.Context, db *sql.DB, limit int) ([]Report, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT r.id, r.deck_id, d.name, d.hidden_at IS NOT NULL, owner.display_name,
+		       COALESCE(reporter.display_name, ''), r.reason, r.details, r.created_at
+		FROM deck_reports r
+		JOIN decks d ON d.id = r.deck_id
+		JOIN users owner ON owner.id = d.user_id
+		LEFT JOIN users reporter ON reporter.id = r.reporter_id
+		WHERE r.resolved_at IS NULL
+		ORDER BY r.created_at
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Report
+	for rows.Next() {
+		var r Report
+		if err := rows.Scan(&r.ID, &r.DeckID, &r.DeckName, &r.DeckHidden, &r.OwnerName,
+			&r.ReporterName, &r.Reason, &r.Details, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// DismissReport closes a report without acting on the deck and returns the
+// deck it was about.
+func DismissReport(ctx context.Context, db *sql.DB, reportID, moderatorID int64) (int64, error) {
+	var deckID int64
+	err := db.QueryRowContext(ctx, `
+		UPDATE deck_reports
+		SET resolved_at = NOW(), resolved_by = $2, resolution = 'dismissed'
+		WHERE id = $1 AND resolved_at IS NULL
+		RETURNING deck_id
+	`, reportID, moderatorID).Scan(&deckID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrReportNotFound
+	}
+	return deckID, err
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
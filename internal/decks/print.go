@@ -0,0 +1,92 @@
+package decks
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// Boards a deck's cards can be printed from.
+const (
+	BoardCommander = "commander"
+	BoardMain      = "main"
+)
+
+// PrintCard is a deck card with everything needed to print a proxy of it.
+// The Back fields are set for double-faced cards.
+type PrintCard struct {
+	CardID     int64
+	ScryfallID string
+	Board      string
+	Quantity   int
+	Name       string
+	ManaCost   string
+	TypeLine   string
+	OracleText string
+	ImageURI   string
+
+	// ColorIdentity is in WUBRG order, e.g. "UB"; colorless is "".
+	ColorIdentity string
+
+	BackName       string
+	BackManaCost   string
+	BackTypeLine   string
+	BackOracleText string
+	BackImageURI   string
+}
+
+// ListPrintCards returns the deck's commander (when it is in the cards
+// table) followed by its main deck, sorted by name.
+func ListPrintCards(ctx context.Context, db *sql.DB, d *Deck) ([]PrintCard, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT c.id, c.scryfall_id, b.board, b.quantity, c.name,
+		       COALESCE(c.mana_cost, ''), COALESCE(c.type_line, ''), COALESCE(c.oracle_text, ''), COALESCE(c.image_uri, ''), COALESCE(c.color_identity, ''),
+		       c.back_name, c.back_mana_cost, c.back_type_line, c.back_oracle_text, c.back_image_uri
+		FROM (
+		    SELECT (SELECT id FROM cards WHERE name = $2 LIMIT 1) AS card_id, 'commander' AS board, 1 AS quantity, 0 AS sort
+		    UNION ALL
+		    SELECT card_id, 'main', quantity, 1
+		    FROM deck_cards
+		    WHERE deck_id = $1
+		) b
+		JOIN cards c ON c.id = b.card_id
+		ORDER BY b.sort, c.name
+	`, d.ID, d.CommanderName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []PrintCard
+	for rows.Next() {
+		var pc PrintCard
+		if err := rows.Scan(&pc.CardID, &pc.ScryfallID, &pc.Board, &pc.Quantity, &pc.Name,
+			&pc.ManaCost, &pc.TypeLine, &pc.OracleText, &pc.ImageURI, &pc.ColorIdentity,
+			&pc.BackName, &pc.BackManaCost, &pc.BackTypeLine, &pc.BackOracleText, &pc.BackImageURI); err != nil {
+			return nil, err
+		}
+		out = append(out, pc)
+	}
+	return out, rows.Err()
+}
+
+// ColorIdentity is a deck's color identity in WUBRG order: its
+// commander's when the commander is among the cards, otherwise every
+// card's combined, as for draft and sealed decks.
+func ColorIdentity(printCards []PrintCard) string {
+	var all strings.Builder
+	for _, pc := range printCards {
+		if pc.Board == BoardCommander {
+			return pc.ColorIdentity
+		}
+		all.WriteString(pc.ColorIdentity)
+	}
+
+	var b strings.Builder
+	for _, c := range "WUBRG" {
+		if strings.ContainsRune(all.String(), c) {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
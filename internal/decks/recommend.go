@@ -0,0 +1,122 @@
+package decks
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"sort"
+)
+
+// Recommendation is a card suggested for a deck based on other public decks.
+//
+// Inclusion is the share of public decks with the same commander that run
+// the card; Baseline is the same share across all public decks of the
+// commander's color identity. Synergy is the difference, so staples that
+// every deck in those colors plays score lower than commander-specific picks.
+type Recommendation struct {
+	CardID    int64
+	CardName  string
+	Decks     int
+	Inclusion float64
+	Baseline  float64
+	Synergy   float64
+	Score     float64
+}
+
+// InclusionPercent is Inclusion as a whole percentage, for display.
+func (r Recommendation) InclusionPercent() int {
+	return int(math.Round(r.Inclusion * 100))
+}
+
+// SynergyPercent is Synergy as a whole percentage, for display.
+func (r Recommendation) SynergyPercent() int {
+	return int(math.Round(r.Synergy * 100))
+}
+
+// RecommendCards ranks cards for a deck's commander from the site's public
+// decks. Cards already in the deck, the commander itself and basic lands are
+// left out. colorIdentity is the commander's identity in WUBRG order.
+func RecommendCards(ctx context.Context, db *sql.DB, d *Deck, colorIdentity string, limit int) ([]Recommendation, error) {
+	if d.CommanderName == "" {
+		return nil, nil
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		WITH cmd_decks AS (
+			SELECT id
+			FROM decks
+			WHERE is_public AND hidden_at IS NULL
+			  AND id <> $2
+			  AND lower(commander_name) = lower($1)
+		),
+		base_decks AS (
+			SELECT d.id
+			FROM decks d
+			JOIN cards cmd ON lower(cmd.name) = lower(d.commander_name)
+			WHERE d.is_public AND d.hidden_at IS NULL
+			  AND d.id <> $2
+			  AND COALESCE(cmd.color_identity, '') = $3
+		),
+		cmd_counts AS (
+			SELECT card_id, COUNT(*) AS n
+			FROM deck_cards
+			WHERE deck_id IN (SELECT id FROM cmd_decks)
+			GROUP BY card_id
+		),
+		base_counts AS (
+			SELECT card_id, COUNT(*) AS n
+			FROM deck_cards
+			WHERE deck_id IN (SELECT id FROM base_decks)
+			GROUP BY card_id
+		)
+		SELECT c.id, c.name, cc.n, COALESCE(bc.n, 0),
+		       (SELECT COUNT(*) FROM cmd_decks),
+		       (SELECT COUNT(*) FROM base_decks)
+		FROM cmd_counts cc
+		JOIN cards c ON c.id = cc.card_id
+		LEFT JOIN base_counts bc ON bc.card_id = cc.card_id
+		WHERE cc.card_id NOT IN (SELECT card_id FROM deck_cards WHERE deck_id = $2)
+		  AND lower(c.name) <> lower($1)
+		  AND COALESCE(c.type_line, '') NOT LIKE 'Basic %'
+	`, d.CommanderName, d.ID, colorIdentity)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Recommendation
+	for rows.Next() {
+		var (
+			rec                 Recommendation
+			baseCount           int
+			cmdTotal, baseTotal int
+		)
+		if err := rows.Scan(&rec.CardID, &rec.CardName, &rec.Decks, &baseCount, &cmdTotal, &baseTotal); err != nil {
+			return nil, err
+		}
+
+		rec.Inclusion = float64(rec.Decks) / float64(cmdTotal)
+		if baseTotal > 0 {
+			rec.Baseline = float64(baseCount) / float64(baseTotal)
+		}
+		rec.Synergy = rec.Inclusion - rec.Baseline
+		rec.Score = rec.Inclusion + rec.Synergy
+
+		out = append(out, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		return out[i].CardName < out[j].CardName
+	})
+
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
@@ -0,0 +1,413 @@
+package draft
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Draft statuses.
+const (
+	StatusLobby    = "lobby"
+	StatusDrafting = "drafting"
+	StatusDone     = "done"
+)
+
+const (
+	MinSeats = 2
+	MaxSeats = 8
+)
+
+var (
+	ErrNotEnoughCards = errors.New("not enough cards for that many packs")
+	ErrSeatCount      = errors.New("a draft needs 2 to 8 seats")
+	ErrDraftStarted   = errors.New("draft has already started")
+	ErrDraftFull      = errors.New("draft is full")
+	ErrNotYourPick    = errors.New("no pack waiting for you")
+	ErrUnknownCard    = errors.New("card is not in your pack")
+)
+
+// Card is a card as the draft sees it. Colors are in WUBRG order; an
+// empty string means colorless.
+type Card struct {
+	ID     int64
+	Name   string
+	Colors string
+}
+
+// GeneratePacks deals count packs of size cards from the given list. The
+// same cards and seed always give the same packs.
+func GeneratePacks(cards []Card, count, size int, seed int64) ([][]Card, error) {
+	if count <= 0 || size <= 0 || count*size > len(cards) {
+		return nil, ErrNotEnoughCards
+	}
+
+	deck := append([]Card(nil), cards...)
+	sort.Slice(deck, func(i, j int) bool { return deck[i].ID < deck[j].ID })
+
+	rng := rand.New(rand.NewSource(seed))
+	rng.Shuffle(len(deck), func(i, j int) { deck[i], deck[j] = deck[j], deck[i] })
+
+	packs := make([][]Card, count)
+	for i := range packs {
+		packs[i] = deck[i*size : (i+1)*size : (i+1)*size]
+	}
+	return packs, nil
+}
+
+// Seat is one drafter. Bots have no UserID and pick with the draft's
+// Picker as soon as a pack reaches them.
+type Seat struct {
+	UserID int64
+	Name   string
+	Bot    bool
+	Pool   []Card
+
+	// queue holds the packs passed to this seat, oldest first.
+	queue [][]Card
+}
+
+// Draft is a booster draft over a cube. Packs pass left in odd rounds and
+// right in even rounds; each seat picks one card from the pack at the
+// front of its queue.
+type Draft struct {
+	mu sync.Mutex
+
+	Code      string
+	CubeID    int64
+	CubeName  string
+	HostID    int64
+	PackCount int
+	PackSize  int
+	SeatCount int
+	Seed      int64
+
+	status  string
+	round   int
+	seats   []*Seat
+	cards   []Card
+	bot     Picker
+	saved   bool
+	saving  bool
+	version int64
+	touched time.Time
+
+	watchers map[chan int64]struct{}
+}
+
+// newDraft sets up a draft in the lobby with the host in the first seat.
+// bot picks for every seat no human takes.
+func newDraft(code string, cubeID int64, cubeName string, cards []Card, host Seat, seats, packCount, packSize int, seed int64, bot Picker) (*Draft, error) {
+	if seats < MinSeats || seats > MaxSeats {
+		return nil, ErrSeatCount
+	}
+	if seats*packCount*packSize > len(cards) {
+		return nil, ErrNotEnoughCards
+	}
+
+	host.Bot = false
+	return &Draft{
+		Code:      code,
+		CubeID:    cubeID,
+		CubeName:  cubeName,
+		HostID:    host.UserID,
+		PackCount: packCount,
+		PackSize:  packSize,
+		SeatCount: seats,
+		Seed:      seed,
+		status:    StatusLobby,
+		seats:     []*Seat{&host},
+		cards:     cards,
+		bot:       bot,
+		touched:   time.Now(),
+		watchers:  map[chan int64]struct{}{},
+	}, nil
+}
+
+// Join adds a human drafter while the draft is in the lobby.
+func (d *Draft) Join(userID int64, name string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.status != StatusLobby {
+		return ErrDraftStarted
+	}
+	for _, s := range d.seats {
+		if s.UserID == userID {
+			return nil
+		}
+	}
+	if len(d.seats) >= d.SeatCount {
+		return ErrDraftFull
+	}
+	d.seats = append(d.seats, &Seat{UserID: userID, Name: name})
+	d.changed()
+	return nil
+}
+
+// Start fills the empty seats with bots, opens the first packs and lets
+// the bots make their picks.
+func (d *Draft) Start() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.status != StatusLobby {
+		return ErrDraftStarted
+	}
+
+	for i := len(d.seats); i < d.SeatCount; i++ {
+		d.seats = append(d.seats, &Seat{Name: "Bot " + string(rune('A'+i-1)), Bot: true})
+	}
+
+	// Seat order is shuffled so the host isn't always passing to the
+	// same drafter.
+	rng := rand.New(rand.NewSource(d.Seed))
+	rng.Shuffle(len(d.seats), func(i, j int) { d.seats[i], d.seats[j] = d.seats[j], d.seats[i] })
+
+	d.status = StatusDrafting
+	if err := d.openRound(1); err != nil {
+		return err
+	}
+	d.runBots()
+	d.changed()
+	return nil
+}
+
+// Pick takes a card from the pack waiting for the user and passes the
+// rest on.
+func (d *Draft) Pick(userID, cardID int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	seat := d.seatOf(userID)
+	if seat < 0 || d.status != StatusDrafting || len(d.seats[seat].queue) == 0 {
+		return ErrNotYourPick
+	}
+
+	pack := d.seats[seat].queue[0]
+	idx := -1
+	for i, c := range pack {
+		if c.ID == cardID {
+			idx = i
+		}
+	}
+	if idx < 0 {
+		return ErrUnknownCard
+	}
+
+	d.take(seat, idx)
+	d.runBots()
+	d.changed()
+	return nil
+}
+
+// BeginSave reports whether the caller should save the finished draft's
+// pools, claiming the save so it only happens once. Follow it with
+// SaveDone, or CancelSave if saving failed so it can be tried again.
+func (d *Draft) BeginSave() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.status != StatusDone || d.saved || d.saving {
+		return false
+	}
+	d.saving = true
+	return true
+}
+
+// SaveDone records that the pools are stored.
+func (d *Draft) SaveDone() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.saving = false
+	d.saved = true
+	d.changed()
+}
+
+// CancelSave releases a claim from BeginSave after saving failed.
+func (d *Draft) CancelSave() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.saving = false
+}
+
+// View is what one drafter sees.
+type View struct {
+	Status    string
+	Round     int
+	PackCount int
+	PackSize  int
+	SeatCount int
+	Seated    bool
+	Pack      []Card
+	Pool      []Card
+	Seats     []SeatSummary
+	Saved     bool
+	Version   int64
+}
+
+type SeatSummary struct {
+	Name    string
+	Bot     bool
+	You     bool
+	Picks   int
+	Waiting int
+}
+
+// PassDirection is which way packs move this round.
+func (v View) PassDirection() string {
+	if v.Round%2 == 0 {
+		return "right"
+	}
+	return "left"
+}
+
+// PickNumber is the 1-based pick within the current pack.
+func (v View) PickNumber() int {
+	return v.PackSize - len(v.Pack) + 1
+}
+
+// ViewFor returns the draft from the given user's seat.
+func (d *Draft) ViewFor(userID int64) View {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	v := View{
+		Status:    d.status,
+		Round:     d.round,
+		PackCount: d.PackCount,
+		PackSize:  d.PackSize,
+		SeatCount: d.SeatCount,
+		Saved:     d.saved,
+		Version:   d.version,
+	}
+	for _, s := range d.seats {
+		you := s.UserID == userID && !s.Bot
+		v.Seats = append(v.Seats, SeatSummary{Name: s.Name, Bot: s.Bot, You: you, Picks: len(s.Pool), Waiting: len(s.queue)})
+		if you {
+			v.Seated = true
+			v.Pool = append([]Card(nil), s.Pool...)
+			if len(s.queue) > 0 {
+				v.Pack = append([]Card(nil), s.queue[0]...)
+			}
+		}
+	}
+	return v
+}
+
+// Seats returns a copy of every seat, for saving pools once the draft is
+// done.
+func (d *Draft) Seats() []Seat {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	out := make([]Seat, len(d.seats))
+	for i, s := range d.seats {
+		out[i] = Seat{UserID: s.UserID, Name: s.Name, Bot: s.Bot, Pool: append([]Card(nil), s.Pool...)}
+	}
+	return out
+}
+
+// Subscribe is notified with the new version after every change. Call the
+// returned function to unsubscribe.
+func (d *Draft) Subscribe() (<-chan int64, func()) {
+	ch := make(chan int64, 1)
+
+	d.mu.Lock()
+	d.watchers[ch] = struct{}{}
+	d.mu.Unlock()
+
+	return ch, func() {
+		d.mu.Lock()
+		delete(d.watchers, ch)
+		d.mu.Unlock()
+	}
+}
+
+func (d *Draft) openRound(round int) error {
+	packs, err := GeneratePacks(d.cards, d.SeatCount*d.PackCount, d.PackSize, d.Seed)
+	if err != nil {
+		return err
+	}
+	d.round = round
+	for i, s := range d.seats {
+		s.queue = [][]Card{packs[(round-1)*d.SeatCount+i]}
+	}
+	return nil
+}
+
+// take moves card idx of the seat's current pack into its pool and passes
+// the rest of the pack along, opening the next round when every pack is
+// empty.
+func (d *Draft) take(seat, idx int) {
+	s := d.seats[seat]
+	pack := s.queue[0]
+	s.queue = s.queue[1:]
+
+	s.Pool = append(s.Pool, pack[idx])
+	rest := append(append([]Card(nil), pack[:idx]...), pack[idx+1:]...)
+
+	if len(rest) > 0 {
+		step := 1
+		if d.round%2 == 0 {
+			step = -1
+		}
+		next := (seat + step + len(d.seats)) % len(d.seats)
+		d.seats[next].queue = append(d.seats[next].queue, rest)
+		return
+	}
+
+	for _, other := range d.seats {
+		if len(other.queue) > 0 {
+			return
+		}
+	}
+	if d.round < d.PackCount {
+		// Packs were dealt when the draft started, so this can't fail.
+		_ = d.openRound(d.round + 1)
+		return
+	}
+	d.status = StatusDone
+}
+
+// runBots lets every bot with a pack pick until only humans are waiting.
+func (d *Draft) runBots() {
+	for progress := true; progress && d.status == StatusDrafting; {
+		progress = false
+		for i, s := range d.seats {
+			if s.Bot && len(s.queue) > 0 {
+				d.take(i, d.bot.Pick(s.Pool, s.queue[0]))
+				progress = true
+			}
+		}
+	}
+}
+
+func (d *Draft) seatOf(userID int64) int {
+	for i, s := range d.seats {
+		if !s.Bot && s.UserID == userID {
+			return i
+		}
+	}
+	return -1
+}
+
+// changed bumps the version and wakes subscribers. Callers hold d.mu.
+func (d *Draft) changed() {
+	d.version++
+	d.touched = time.Now()
+	for ch := range d.watchers {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- d.version
+	}
+}
+
+func (d *Draft) idleSince() time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return time.Since(d.touched)
+}
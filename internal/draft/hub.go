@@ -0,0 +1,103 @@
+package draft
+
+import (
+	"crypto/rand"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Drafts nobody has touched for this long are dropped.
+	idleTimeout = 12 * time.Hour
+
+	codeLength   = 6
+	codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+var ErrDraftNotFound = errors.New("draft not found")
+
+// Hub holds running drafts by join code. Drafts only exist in memory; the
+// finished pools are saved as decks.
+type Hub struct {
+	mu     sync.Mutex
+	drafts map[string]*Draft
+	bot    Picker
+}
+
+// NewHub returns an empty hub whose bots pick with bot, or with
+// DefaultPicker when bot is nil.
+func NewHub(bot Picker) *Hub {
+	if bot == nil {
+		bot = DefaultPicker
+	}
+	return &Hub{drafts: map[string]*Draft{}, bot: bot}
+}
+
+// Options describes a new draft.
+type Options struct {
+	CubeID    int64
+	CubeName  string
+	Cards     []Card
+	Seats     int
+	PackCount int
+	PackSize  int
+	Seed      int64
+}
+
+// Create opens a draft lobby hosted by the given user.
+func (h *Hub) Create(host Seat, opts Options) (*Draft, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for code, d := range h.drafts {
+		if d.idleSince() > idleTimeout {
+			delete(h.drafts, code)
+		}
+	}
+
+	var code string
+	for {
+		c, err := newCode()
+		if err != nil {
+			return nil, err
+		}
+		if _, taken := h.drafts[c]; !taken {
+			code = c
+			break
+		}
+	}
+
+	d, err := newDraft(code, opts.CubeID, opts.CubeName, opts.Cards, host, opts.Seats, opts.PackCount, opts.PackSize, opts.Seed, h.bot)
+	if err != nil {
+		return nil, err
+	}
+	h.drafts[code] = d
+	return d, nil
+}
+
+// Get looks up a draft by its join code, ignoring case and spaces.
+func (h *Hub) Get(code string) (*Draft, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	d, ok := h.drafts[code]
+	if !ok || d.idleSince() > idleTimeout {
+		return nil, ErrDraftNotFound
+	}
+	return d, nil
+}
+
+func newCode() (string, error) {
+	b := make([]byte, codeLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = codeAlphabet[int(b[i])%len(codeAlphabet)]
+	}
+	return string(b), nil
+}
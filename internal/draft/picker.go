@@ -0,0 +1,91 @@
+package draft
+
+import "strings"
+
+// Picker chooses a card for a bot. It is given the bot's picks so far and
+// the pack in front of it, and returns the index of the card to take.
+type Picker interface {
+	Pick(pool, pack []Card) int
+}
+
+// ColorCommitment is a simple bot: for its first few picks it takes
+// whatever fits the colors it has seen most, then it settles on its two
+// deepest colors and strongly prefers cards inside them.
+type ColorCommitment struct {
+	// CommitAfter is how many picks the bot makes before committing.
+	CommitAfter int
+}
+
+// DefaultPicker is the bot used when nothing else is configured.
+var DefaultPicker Picker = ColorCommitment{CommitAfter: 5}
+
+func (b ColorCommitment) Pick(pool, pack []Card) int {
+	weight := map[rune]int{}
+	for _, c := range pool {
+		for _, color := range c.Colors {
+			weight[color]++
+		}
+	}
+
+	committed := ""
+	if len(pool) >= b.CommitAfter {
+		committed = topColors(weight, 2)
+	}
+
+	best, bestScore := 0, -1<<31
+	for i, c := range pack {
+		score := 0
+		if committed != "" {
+			score = commitScore(c, committed)
+		} else {
+			for _, color := range c.Colors {
+				score += weight[color]
+			}
+			// Colorless cards fit any deck, so they stay attractive.
+			if c.Colors == "" {
+				score++
+			}
+		}
+		if score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return best
+}
+
+// commitScore rates a card for a bot that has settled on its colors. Cards
+// entirely inside them beat colorless cards, which beat anything else.
+func commitScore(c Card, committed string) int {
+	if c.Colors == "" {
+		return 5
+	}
+	score := 10
+	for _, color := range c.Colors {
+		if !strings.ContainsRune(committed, color) {
+			score -= 10
+		}
+	}
+	return score + len(c.Colors)
+}
+
+// topColors returns the n colors with the most weight, breaking ties in
+// WUBRG order.
+func topColors(weight map[rune]int, n int) string {
+	var out []rune
+	for len(out) < n {
+		var best rune
+		for _, color := range "WUBRG" {
+			if strings.ContainsRune(string(out), color) {
+				continue
+			}
+			if best == 0 || weight[color] > weight[best] {
+				best = color
+			}
+		}
+		if weight[best] == 0 {
+			break
+		}
+		out = append(out, best)
+	}
+	return string(out)
+}
@@ -0,0 +1,431 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Event statuses, in order.
+const (
+	StatusRegistration = "registration"
+	StatusRunning      = "running"
+	StatusFinished     = "finished"
+)
+
+// Pod results for a player. An empty result means the pod hasn't been
+// reported yet.
+const (
+	ResultWin  = "win"
+	ResultDraw = "draw"
+	ResultLoss = "loss"
+)
+
+var (
+	ErrEventFinished = errors.New("event has finished")
+	ErrPodNotFound   = errors.New("pod not found")
+)
+
+// Event is a tournament or league night. Each round seats the active
+// players in pods; points come from pod results plus achievement points.
+type Event struct {
+	ID            int64
+	OrganizerID   int64
+	OrganizerName string
+	Name          string
+	Description   string
+	StartsAt      time.Time
+	Status        string
+	RoundMinutes  int
+	WinPoints     int
+	DrawPoints    int
+	CreatedAt     time.Time
+	PlayerCount   int
+}
+
+// Registration is a player signed up for an event with the deck they play.
+type Registration struct {
+	UserID        int64
+	DisplayName   string
+	DeckID        int64
+	DeckName      string
+	CommanderName string
+	Dropped       bool
+}
+
+type Round struct {
+	ID        int64
+	Number    int
+	StartedAt time.Time
+	EndsAt    time.Time
+	Pods      []Pod
+}
+
+// Complete reports whether every pod in the round has a result.
+func (r Round) Complete() bool {
+	for _, p := range r.Pods {
+		if !p.Reported() {
+			return false
+		}
+	}
+	return true
+}
+
+type Pod struct {
+	ID      int64
+	Table   int
+	Players []PodPlayer
+}
+
+func (p Pod) Reported() bool {
+	return len(p.Players) > 0 && p.Players[0].Result != ""
+}
+
+type PodPlayer struct {
+	UserID        int64
+	DisplayName   string
+	DeckName      string
+	CommanderName string
+	Result        string
+	Achievement   int
+}
+
+func CreateEvent(ctx context.Context, db *sql.DB, e *Event) (int64, error) {
+	err := db.QueryRowContext(ctx, `
+		INSERT INTO events (organizer_id, name, description, starts_at, round_minutes, win_points, draw_points)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, status, created_at
+	`, e.OrganizerID, e.Name, e.Description, e.StartsAt, e.RoundMinutes, e.WinPoints, e.DrawPoints).
+		Scan(&e.ID, &e.Status, &e.CreatedAt)
+	return e.ID, err
+}
+
+const eventColumns = `
+	e.id, e.organizer_id, u.display_name, e.name, e.description, e.starts_at, e.status,
+	e.round_minutes, e.win_points, e.draw_points, e.created_at,
+	(SELECT COUNT(*) FROM event_players p WHERE p.event_id = e.id AND NOT p.dropped)`
+
+func scanEvent(row interface{ Scan(...any) error }, e *Event) error {
+	return row.Scan(&e.ID, &e.OrganizerID, &e.OrganizerName, &e.Name, &e.Description, &e.StartsAt, &e.Status,
+		&e.RoundMinutes, &e.WinPoints, &e.DrawPoints, &e.CreatedAt, &e.PlayerCount)
+}
+
+func GetEvent(ctx context.Context, db *sql.DB, id int64) (*Event, error) {
+	var e Event
+	err := scanEvent(db.QueryRowContext(ctx, `
+		SELECT `+eventColumns+`
+		FROM events e
+		JOIN users u ON u.id = e.organizer_id
+		WHERE e.id = $1
+	`, id), &e)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// ListEvents returns events that haven't finished, soonest first, followed
+// by the most recently finished ones.
+func ListEvents(ctx context.Context, db *sql.DB, limit int) ([]Event, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+eventColumns+`
+		FROM events e
+		JOIN users u ON u.id = e.organizer_id
+		ORDER BY e.status = 'finished',
+		         CASE WHEN e.status = 'finished' THEN NULL ELSE e.starts_at END ASC,
+		         e.starts_at DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Event
+	for rows.Next() {
+		var e Event
+		if err := scanEvent(rows, &e); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+func SetStatus(ctx context.Context, db *sql.DB, eventID int64, status string) error {
+	_, err := db.ExecContext(ctx, `
+		UPDATE events SET status = $2 WHERE id = $1
+	`, eventID, status)
+	return err
+}
+
+// Register signs a player up with a deck, or changes their deck and brings
+// them back if they had dropped.
+func Register(ctx context.Context, db *sql.DB, eventID, userID, deckID int64) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO event_players (event_id, user_id, deck_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (event_id, user_id)
+		DO UPDATE SET deck_id = EXCLUDED.deck_id, dropped = FALSE
+	`, eventID, userID, deckID)
+	return err
+}
+
+// Drop removes a player from future rounds. Players who haven't played yet
+// are removed outright; others stay in the standings.
+func Drop(ctx context.Context, db *sql.DB, eventID, userID int64) error {
+	_, err := db.ExecContext(ctx, `
+		DELETE FROM event_players p
+		WHERE p.event_id = $1 AND p.user_id = $2
+		  AND NOT EXISTS (
+		      SELECT 1
+		      FROM event_pod_players pp
+		      JOIN event_pods pod ON pod.id = pp.pod_id
+		      JOIN event_rounds r ON r.id = pod.round_id
+		      WHERE r.event_id = $1 AND pp.user_id = $2
+		  )
+	`, eventID, userID)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `
+		UPDATE event_players SET dropped = TRUE
+		WHERE event_id = $1 AND user_id = $2
+	`, eventID, userID)
+	return err
+}
+
+func ListRegistrations(ctx context.Context, db *sql.DB, eventID int64) ([]Registration, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT p.user_id, u.display_name, COALESCE(p.deck_id, 0), COALESCE(d.name, ''), COALESCE(d.commander_name, ''), p.dropped
+		FROM event_players p
+		JOIN users u ON u.id = p.user_id
+		LEFT JOIN decks d ON d.id = p.deck_id
+		WHERE p.event_id = $1
+		ORDER BY p.dropped, lower(u.display_name)
+	`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Registration
+	for rows.Next() {
+		var reg Registration
+		if err := rows.Scan(&reg.UserID, &reg.DisplayName, &reg.DeckID, &reg.DeckName, &reg.CommanderName, &reg.Dropped); err != nil {
+			return nil, err
+		}
+		out = append(out, reg)
+	}
+	return out, rows.Err()
+}
+
+// ListRounds returns the event's rounds in order with their pods and
+// players.
+func ListRounds(ctx context.Context, db *sql.DB, eventID int64) ([]Round, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT r.id, r.number, r.started_at, r.ends_at,
+		       pod.id, pod.table_number,
+		       pp.user_id, u.display_name, COALESCE(d.name, ''), COALESCE(d.commander_name, ''),
+		       pp.result, pp.achievement_points
+		FROM event_rounds r
+		JOIN event_pods pod ON pod.round_id = r.id
+		JOIN event_pod_players pp ON pp.pod_id = pod.id
+		JOIN users u ON u.id = pp.user_id
+		LEFT JOIN event_players ep ON ep.event_id = r.event_id AND ep.user_id = pp.user_id
+		LEFT JOIN decks d ON d.id = ep.deck_id
+		WHERE r.event_id = $1
+		ORDER BY r.number, pod.table_number, pp.seat
+	`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Round
+	for rows.Next() {
+		var (
+			r   Round
+			pod Pod
+			p   PodPlayer
+		)
+		if err := rows.Scan(&r.ID, &r.Number, &r.StartedAt, &r.EndsAt, &pod.ID, &pod.Table,
+			&p.UserID, &p.DisplayName, &p.DeckName, &p.CommanderName, &p.Result, &p.Achievement); err != nil {
+			return nil, err
+		}
+
+		if len(out) == 0 || out[len(out)-1].ID != r.ID {
+			out = append(out, r)
+		}
+		round := &out[len(out)-1]
+		if len(round.Pods) == 0 || round.Pods[len(round.Pods)-1].ID != pod.ID {
+			round.Pods = append(round.Pods, pod)
+		}
+		cur := &round.Pods[len(round.Pods)-1]
+		cur.Players = append(cur.Players, p)
+	}
+	return out, rows.Err()
+}
+
+// CreateRound stores a new round with the given pods (user IDs in seat
+// order) and starts its timer.
+func CreateRound(ctx context.Context, db *sql.DB, eventID int64, number int, minutes int, pods [][]int64) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var roundID int64
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO event_rounds (event_id, number, ends_at)
+		VALUES ($1, $2, now() + make_interval(mins => $3))
+		RETURNING id
+	`, eventID, number, minutes).Scan(&roundID)
+	if err != nil {
+		return err
+	}
+
+	for i, players := range pods {
+		var podID int64
+		if err := tx.QueryRowContext(ctx, `
+			INSERT INTO event_pods (round_id, table_number)
+			VALUES ($1, $2)
+			RETURNING id
+		`, roundID, i+1).Scan(&podID); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO event_pod_players (pod_id, user_id, seat)
+			SELECT $1, u.id, u.seat
+			FROM unnest($2::BIGINT[]) WITH ORDINALITY AS u(id, seat)
+		`, podID, pq.Array(players)); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE events SET status = $2 WHERE id = $1
+	`, eventID, StatusRunning); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ExtendRound adds minutes to a round's timer.
+func ExtendRound(ctx context.Context, db *sql.DB, eventID, roundID int64, minutes int) error {
+	_, err := db.ExecContext(ctx, `
+		UPDATE event_rounds
+		SET ends_at = GREATEST(ends_at, now()) + make_interval(mins => $3)
+		WHERE id = $2 AND event_id = $1
+	`, eventID, roundID, minutes)
+	return err
+}
+
+// ReportPod records each player's result and achievement points for a pod
+// of the given event. Reporting again overwrites the earlier result.
+func ReportPod(ctx context.Context, db *sql.DB, eventID, podID int64, results map[int64]string, achievements map[int64]int) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var ok bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT EXISTS (
+		    SELECT 1
+		    FROM event_pods pod
+		    JOIN event_rounds r ON r.id = pod.round_id
+		    WHERE pod.id = $1 AND r.event_id = $2
+		)
+	`, podID, eventID).Scan(&ok)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrPodNotFound
+	}
+
+	for userID, result := range results {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE event_pod_players
+			SET result = $3, achievement_points = $4
+			WHERE pod_id = $1 AND user_id = $2
+		`, podID, userID, result, achievements[userID]); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func EnsureEventTables(ctx context.Context, db *sql.DB) error {
+	// Events
+	if _, err := db.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS events (
+            id BIGSERIAL PRIMARY KEY,
+            organizer_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+            name TEXT NOT NULL,
+            description TEXT NOT NULL DEFAULT '',
+            starts_at TIMESTAMPTZ NOT NULL,
+            status TEXT NOT NULL DEFAULT 'registration',
+            round_minutes INT NOT NULL DEFAULT 75,
+            win_points INT NOT NULL DEFAULT 3,
+            draw_points INT NOT NULL DEFAULT 1,
+            created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+        );
+    `); err != nil {
+		return err
+	}
+
+	// Registrations
+	if _, err := db.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS event_players (
+            event_id BIGINT NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+            user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+            deck_id BIGINT REFERENCES decks(id) ON DELETE SET NULL,
+            dropped BOOLEAN NOT NULL DEFAULT FALSE,
+            registered_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+            PRIMARY KEY (event_id, user_id)
+        );
+    `); err != nil {
+		return err
+	}
+
+	// Rounds, pods and pod seats
+	if _, err := db.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS event_rounds (
+            id BIGSERIAL PRIMARY KEY,
+            event_id BIGINT NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+            number INT NOT NULL,
+            started_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+            ends_at TIMESTAMPTZ NOT NULL,
+            UNIQUE (event_id, number)
+        );
+
+        CREATE TABLE IF NOT EXISTS event_pods (
+            id BIGSERIAL PRIMARY KEY,
+            round_id BIGINT NOT NULL REFERENCES event_rounds(id) ON DELETE CASCADE,
+            table_number INT NOT NULL
+        );
+
+        CREATE TABLE IF NOT EXISTS event_pod_players (
+            pod_id BIGINT NOT NULL REFERENCES event_pods(id) ON DELETE CASCADE,
+            user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+            seat INT NOT NULL,
+            result TEXT NOT NULL DEFAULT '',
+            achievement_points INT NOT NULL DEFAULT 0,
+            PRIMARY KEY (pod_id, user_id)
+        );
+    `); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package events
+
+import (
+	"errors"
+	"math/rand"
+)
+
+// Pods hold 3 to 5 players; four is the norm.
+const (
+	minPodSize = 3
+	maxPodSize = 5
+
+	// pairingAttempts is how many shuffles PairPods tries before improving
+	// the best one by swapping players.
+	pairingAttempts = 200
+)
+
+var ErrTooFewPlayers = errors.New("need at least 3 players to make a pod")
+
+// PodSizes splits n players into pods of 3–4 as evenly as possible; only
+// five players share a single pod of 5. For example 6 → [3 3],
+// 7 → [4 3], 9 → [3 3 3], 10 → [4 3 3].
+func PodSizes(n int) ([]int, error) {
+	if n < minPodSize {
+		return nil, ErrTooFewPlayers
+	}
+
+	pods := (n + 3) / 4
+	if n/pods < minPodSize {
+		pods = n / minPodSize
+	}
+
+	sizes := make([]int, pods)
+	for i := range sizes {
+		sizes[i] = n / pods
+		if i < n%pods {
+			sizes[i]++
+		}
+	}
+	return sizes, nil
+}
+
+// PairPods seats players in pods, keeping repeat opponents from earlier
+// rounds to a minimum. The seed makes pairings reproducible; seat order
+// within a pod is random.
+func PairPods(players []int64, rounds []Round, seed int64) ([][]int64, error) {
+	sizes, err := PodSizes(len(players))
+	if err != nil {
+		return nil, err
+	}
+
+	met := opponentHistory(rounds)
+	rng := rand.New(rand.NewSource(seed))
+
+	var best [][]int64
+	bestCost := -1
+	order := append([]int64(nil), players...)
+	for attempt := 0; attempt < pairingAttempts; attempt++ {
+		rng.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+		pods := greedyPods(order, sizes, met)
+		if c := totalCost(pods, met); bestCost < 0 || c < bestCost {
+			best, bestCost = pods, c
+		}
+		if bestCost == 0 {
+			break
+		}
+	}
+
+	improveBySwaps(best, met)
+
+	for _, pod := range best {
+		rng.Shuffle(len(pod), func(i, j int) { pod[i], pod[j] = pod[j], pod[i] })
+	}
+	return best, nil
+}
+
+type pair [2]int64
+
+func makePair(a, b int64) pair {
+	if a > b {
+		a, b = b, a
+	}
+	return pair{a, b}
+}
+
+// opponentHistory counts how often each pair of players has shared a pod.
+func opponentHistory(rounds []Round) map[pair]int {
+	met := map[pair]int{}
+	for _, r := range rounds {
+		for _, pod := range r.Pods {
+			for i := range pod.Players {
+				for j := i + 1; j < len(pod.Players); j++ {
+					met[makePair(pod.Players[i].UserID, pod.Players[j].UserID)]++
+				}
+			}
+		}
+	}
+	return met
+}
+
+// greedyPods fills pods one at a time, each time taking the remaining
+// player who has met the pod's current players least.
+func greedyPods(order []int64, sizes []int, met map[pair]int) [][]int64 {
+	remaining := append([]int64(nil), order...)
+	pods := make([][]int64, len(sizes))
+
+	for i, size := range sizes {
+		pod := []int64{remaining[0]}
+		remaining = remaining[1:]
+
+		for len(pod) < size {
+			bestIdx, bestCost := 0, -1
+			for j, candidate := range remaining {
+				c := joinCost(pod, candidate, met)
+				if bestCost < 0 || c < bestCost {
+					bestIdx, bestCost = j, c
+				}
+			}
+			pod = append(pod, remaining[bestIdx])
+			remaining = append(remaining[:bestIdx], remaining[bestIdx+1:]...)
+		}
+		pods[i] = pod
+	}
+	return pods
+}
+
+// improveBySwaps swaps players between pods while that lowers the number
+// of repeat pairings.
+func improveBySwaps(pods [][]int64, met map[pair]int) {
+	for improved := true; improved; {
+		improved = false
+		for a := range pods {
+			for b := a + 1; b < len(pods); b++ {
+				for i := range pods[a] {
+					for j := range pods[b] {
+						before := podCost(pods[a], met) + podCost(pods[b], met)
+						pods[a][i], pods[b][j] = pods[b][j], pods[a][i]
+						if podCost(pods[a], met)+podCost(pods[b], met) < before {
+							improved = true
+							continue
+						}
+						pods[a][i], pods[b][j] = pods[b][j], pods[a][i]
+					}
+				}
+			}
+		}
+	}
+}
+
+func joinCost(pod []int64, candidate int64, met map[pair]int) int {
+	c := 0
+	for _, p := range pod {
+		c += met[makePair(p, candidate)]
+	}
+	return c
+}
+
+func podCost(pod []int64, met map[pair]int) int {
+	c := 0
+	for i := range pod {
+		for j := i + 1; j < len(pod); j++ {
+			c += met[makePair(pod[i], pod[j])]
+		}
+	}
+	return c
+}
+
+func totalCost(pods [][]int64, met map[pair]int) int {
+	c := 0
+	for _, pod := range pods {
+		c += podCost(pod, met)
+	}
+	return c
+}
@@ -0,0 +1,118 @@
+package events
+
+import (
+	"sort"
+	"strings"
+)
+
+// Standing is one player's line in the event standings.
+type Standing struct {
+	Rank        int
+	UserID      int64
+	DisplayName string
+	DeckName    string
+	Commander   string
+	Dropped     bool
+	Games       int
+	Wins        int
+	Draws       int
+	Losses      int
+	Achievement int
+	Points      int
+
+	// OpponentAverage is the mean points of everyone this player has
+	// shared a pod with, used to break ties.
+	OpponentAverage float64
+}
+
+// ComputeStandings totals points across all reported pods and ranks
+// players by points, then wins, then opponents' average points.
+func ComputeStandings(e *Event, regs []Registration, rounds []Round) []Standing {
+	byUser := map[int64]*Standing{}
+	var order []int64
+	for _, reg := range regs {
+		byUser[reg.UserID] = &Standing{
+			UserID:      reg.UserID,
+			DisplayName: reg.DisplayName,
+			DeckName:    reg.DeckName,
+			Commander:   reg.CommanderName,
+			Dropped:     reg.Dropped,
+		}
+		order = append(order, reg.UserID)
+	}
+
+	opponents := map[int64][]int64{}
+	for _, r := range rounds {
+		for _, pod := range r.Pods {
+			if !pod.Reported() {
+				continue
+			}
+			for _, p := range pod.Players {
+				s, ok := byUser[p.UserID]
+				if !ok {
+					continue
+				}
+				s.Games++
+				s.Achievement += p.Achievement
+				switch p.Result {
+				case ResultWin:
+					s.Wins++
+				case ResultDraw:
+					s.Draws++
+				default:
+					s.Losses++
+				}
+				for _, o := range pod.Players {
+					if o.UserID != p.UserID {
+						opponents[p.UserID] = append(opponents[p.UserID], o.UserID)
+					}
+				}
+			}
+		}
+	}
+
+	out := make([]Standing, 0, len(order))
+	for _, id := range order {
+		s := byUser[id]
+		s.Points = s.Wins*e.WinPoints + s.Draws*e.DrawPoints + s.Achievement
+	}
+	for _, id := range order {
+		s := byUser[id]
+		if opps := opponents[id]; len(opps) > 0 {
+			total := 0
+			for _, o := range opps {
+				if os, ok := byUser[o]; ok {
+					total += os.Points
+				}
+			}
+			s.OpponentAverage = float64(total) / float64(len(opps))
+		}
+		out = append(out, *s)
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Points != b.Points {
+			return a.Points > b.Points
+		}
+		if a.Wins != b.Wins {
+			return a.Wins > b.Wins
+		}
+		if a.OpponentAverage != b.OpponentAverage {
+			return a.OpponentAverage > b.OpponentAverage
+		}
+		return strings.ToLower(a.DisplayName) < strings.ToLower(b.DisplayName)
+	})
+
+	// Players level on every tiebreak share a rank.
+	for i := range out {
+		out[i].Rank = i + 1
+		if i > 0 {
+			prev := out[i-1]
+			if prev.Points == out[i].Points && prev.Wins == out[i].Wins && prev.OpponentAverage == out[i].OpponentAverage {
+				out[i].Rank = prev.Rank
+			}
+		}
+	}
+	return out
+}
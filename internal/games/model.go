@@ -0,0 +1,239 @@
+package games
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var ErrNotEnoughPlayers = errors.New("a game needs at least two players")
+
+// Game is one logged game of Commander.
+type Game struct {
+	ID           int64
+	CreatedBy    int64
+	PlayedAt     time.Time
+	WinCondition string
+	TurnCount    int
+	Notes        string
+	Players      []Player
+}
+
+// Player is one seat at a game. Seats are numbered from 1 in turn order.
+// UserID is 0 for guests; DeckID is 0 when the deck isn't one stored here.
+type Player struct {
+	Seat          int
+	UserID        int64
+	Name          string
+	DeckID        int64
+	DeckName      string
+	CommanderName string
+	IsWinner      bool
+}
+
+// Winner returns the winning player, or nil for a draw.
+func (g Game) Winner() *Player {
+	for i := range g.Players {
+		if g.Players[i].IsWinner {
+			return &g.Players[i]
+		}
+	}
+	return nil
+}
+
+// HasPlayer reports whether the given site user sat at this game.
+func (g Game) HasPlayer(userID int64) bool {
+	for _, p := range g.Players {
+		if p.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateGame stores a game and its players. For site users Name is ignored
+// (their display name is used); for guests it is stored as the guest name.
+func CreateGame(ctx context.Context, db *sql.DB, g *Game) (int64, error) {
+	if len(g.Players) < 2 {
+		return 0, ErrNotEnoughPlayers
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO games (created_by, played_at, win_condition, turn_count, notes)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, g.CreatedBy, g.PlayedAt, g.WinCondition, nullIfZero(int64(g.TurnCount)), g.Notes).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, p := range g.Players {
+		guestName := ""
+		if p.UserID == 0 {
+			guestName = p.Name
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO game_players (game_id, seat, user_id, guest_name, deck_id, commander_name, is_winner)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`, id, p.Seat, nullIfZero(p.UserID), guestName, nullIfZero(p.DeckID), p.CommanderName, p.IsWinner); err != nil {
+			return 0, err
+		}
+	}
+
+	g.ID = id
+	return id, tx.Commit()
+}
+
+// DeleteGame removes a game; only the user who logged it may delete it.
+func DeleteGame(ctx context.Context, db *sql.DB, gameID, userID int64) error {
+	res, err := db.ExecContext(ctx, `
+		DELETE FROM games
+		WHERE id = $1 AND created_by = $2
+	`, gameID, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ListGamesForUser returns every game the user logged or played in, newest
+// first.
+func ListGamesForUser(ctx context.Context, db *sql.DB, userID int64) ([]Game, error) {
+	return listGames(ctx, db, `
+		WHERE g.created_by = $1
+		   OR EXISTS (SELECT 1 FROM game_players p WHERE p.game_id = g.id AND p.user_id = $1)
+	`, userID)
+}
+
+// ListGamesForDeck returns every game in which the deck was played.
+func ListGamesForDeck(ctx context.Context, db *sql.DB, deckID int64) ([]Game, error) {
+	return listGames(ctx, db, `
+		WHERE EXISTS (SELECT 1 FROM game_players p WHERE p.game_id = g.id AND p.deck_id = $1)
+	`, deckID)
+}
+
+func listGames(ctx context.Context, db *sql.DB, where string, arg any) ([]Game, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT g.id, COALESCE(g.created_by, 0), g.played_at, g.win_condition, COALESCE(g.turn_count, 0), g.notes
+		FROM games g
+		`+where+`
+		ORDER BY g.played_at DESC, g.id DESC
+	`, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Game
+	index := map[int64]int{}
+	var ids []int64
+	for rows.Next() {
+		var g Game
+		if err := rows.Scan(&g.ID, &g.CreatedBy, &g.PlayedAt, &g.WinCondition, &g.TurnCount, &g.Notes); err != nil {
+			return nil, err
+		}
+		index[g.ID] = len(out)
+		ids = append(ids, g.ID)
+		out = append(out, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return out, nil
+	}
+
+	prows, err := db.QueryContext(ctx, `
+		SELECT p.game_id, p.seat, COALESCE(p.user_id, 0), COALESCE(u.display_name, NULLIF(p.guest_name, ''), 'Former member'),
+		       COALESCE(p.deck_id, 0), COALESCE(d.name, ''), p.commander_name, p.is_winner
+		FROM game_players p
+		LEFT JOIN users u ON u.id = p.user_id
+		LEFT JOIN decks d ON d.id = p.deck_id
+		WHERE p.game_id = ANY($1)
+		ORDER BY p.game_id, p.seat
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer prows.Close()
+
+	for prows.Next() {
+		var (
+			gameID int64
+			p      Player
+		)
+		if err := prows.Scan(&gameID, &p.Seat, &p.UserID, &p.Name, &p.DeckID, &p.DeckName, &p.CommanderName, &p.IsWinner); err != nil {
+			return nil, err
+		}
+		g := &out[index[gameID]]
+		g.Players = append(g.Players, p)
+	}
+	return out, prows.Err()
+}
+
+func nullIfZero(v int64) any {
+	if v == 0 {
+		return nil
+	}
+	return v
+}
+
+func EnsureGameTables(ctx context.Context, db *sql.DB) error {
+	// Games
+	if _, err := db.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS games (
+            id BIGSERIAL PRIMARY KEY,
+            created_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+            played_at DATE NOT NULL DEFAULT CURRENT_DATE,
+            win_condition TEXT NOT NULL DEFAULT '',
+            turn_count INT,
+            notes TEXT NOT NULL DEFAULT '',
+            created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+        );
+    `); err != nil {
+		return err
+	}
+
+	// Players, one row per seat in turn order
+	if _, err := db.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS game_players (
+            game_id BIGINT NOT NULL REFERENCES games(id) ON DELETE CASCADE,
+            seat INT NOT NULL,
+            user_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+            guest_name TEXT NOT NULL DEFAULT '',
+            deck_id BIGINT REFERENCES decks(id) ON DELETE SET NULL,
+            commander_name TEXT NOT NULL DEFAULT '',
+            is_winner BOOLEAN NOT NULL DEFAULT FALSE,
+            PRIMARY KEY (game_id, seat)
+        );
+    `); err != nil {
+		return err
+	}
+
+	if _, err := db.ExecContext(ctx, `
+        CREATE INDEX IF NOT EXISTS idx_game_players_user_id ON game_players(user_id);
+        CREATE INDEX IF NOT EXISTS idx_game_players_deck_id ON game_players(deck_id);
+    `); err != nil {
+		return err
+	}
+
+	return nil
+}
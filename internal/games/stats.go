@@ -0,0 +1,154 @@
+package games
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WinRate is a win/game tally for a deck, commander or player.
+type WinRate struct {
+	Label string
+	Games int
+	Wins  int
+}
+
+// Percent is the win rate as a whole percentage.
+func (w WinRate) Percent() int {
+	if w.Games == 0 {
+		return 0
+	}
+	return int(math.Round(float64(w.Wins) * 100 / float64(w.Games)))
+}
+
+// HeadToHead is a win matrix between the players in a set of games.
+// Wins[i][j] counts games player i won while player j was at the table.
+type HeadToHead struct {
+	Players []string
+	Wins    [][]int
+}
+
+// Stats summarises a set of games.
+type Stats struct {
+	Games      int
+	Decks      []WinRate
+	Commanders []WinRate
+	Players    []WinRate
+	HeadToHead HeadToHead
+}
+
+// ComputeStats tallies per-deck, per-commander and per-player win rates and
+// the head-to-head matrix for the given games.
+func ComputeStats(games []Game) Stats {
+	decks := newTally()
+	commanders := newTally()
+	players := newTally()
+
+	for _, g := range games {
+		for _, p := range g.Players {
+			if p.DeckID != 0 {
+				label := p.DeckName
+				if label == "" {
+					label = "Deck #" + strconv.FormatInt(p.DeckID, 10)
+				}
+				decks.add("d:"+strconv.FormatInt(p.DeckID, 10), label, p.IsWinner)
+			}
+			if p.CommanderName != "" {
+				commanders.add(strings.ToLower(p.CommanderName), p.CommanderName, p.IsWinner)
+			}
+			players.add(playerKey(p), p.Name, p.IsWinner)
+		}
+	}
+
+	// Head-to-head, ordered like the player win rates.
+	playerRates, playerKeys := players.sorted()
+	pos := map[string]int{}
+	h2h := HeadToHead{
+		Players: make([]string, len(playerRates)),
+		Wins:    make([][]int, len(playerRates)),
+	}
+	for i, pr := range playerRates {
+		h2h.Players[i] = pr.Label
+		h2h.Wins[i] = make([]int, len(playerRates))
+		pos[playerKeys[i]] = i
+	}
+	for _, g := range games {
+		w := g.Winner()
+		if w == nil {
+			continue
+		}
+		wi := pos[playerKey(*w)]
+		for _, p := range g.Players {
+			if p.Seat == w.Seat {
+				continue
+			}
+			h2h.Wins[wi][pos[playerKey(p)]]++
+		}
+	}
+
+	deckRates, _ := decks.sorted()
+	commanderRates, _ := commanders.sorted()
+
+	return Stats{
+		Games:      len(games),
+		Decks:      deckRates,
+		Commanders: commanderRates,
+		Players:    playerRates,
+		HeadToHead: h2h,
+	}
+}
+
+// playerKey identifies a player across games: site users by ID, guests by
+// name.
+func playerKey(p Player) string {
+	if p.UserID != 0 {
+		return "u:" + strconv.FormatInt(p.UserID, 10)
+	}
+	return "g:" + strings.ToLower(strings.TrimSpace(p.Name))
+}
+
+type tally struct {
+	rates map[string]*WinRate
+}
+
+func newTally() *tally {
+	return &tally{rates: map[string]*WinRate{}}
+}
+
+func (t *tally) add(key, label string, won bool) {
+	r, ok := t.rates[key]
+	if !ok {
+		r = &WinRate{Label: label}
+		t.rates[key] = r
+	}
+	r.Games++
+	if won {
+		r.Wins++
+	}
+}
+
+// sorted returns the tallies by most games, then most wins, then label,
+// along with the key of each entry.
+func (t *tally) sorted() ([]WinRate, []string) {
+	keys := make([]string, 0, len(t.rates))
+	for k := range t.rates {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := t.rates[keys[i]], t.rates[keys[j]]
+		if a.Games != b.Games {
+			return a.Games > b.Games
+		}
+		if a.Wins != b.Wins {
+			return a.Wins > b.Wins
+		}
+		return a.Label < b.Label
+	})
+
+	out := make([]WinRate, len(keys))
+	for i, k := range keys {
+		out[i] = *t.rates[k]
+	}
+	return out, keys
+}
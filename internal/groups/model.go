@@ -0,0 +1,356 @@
+package groups
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Member roles. Owners manage members, house rules and the invite link.
+const (
+	RoleOwner  = "owner"
+	RoleMember = "member"
+)
+
+var (
+	ErrNotMember = errors.New("not a member of this group")
+	ErrLastOwner = errors.New("a group needs at least one owner")
+)
+
+// Group is a playgroup with its own house rules. HouseBans are card names
+// banned on top of the Commander ban list; TargetBracket is 0 when the
+// group hasn't set one.
+type Group struct {
+	ID            int64
+	Name          string
+	Description   string
+	InviteCode    string
+	HouseBans     []string
+	RuleZero      string
+	TargetBracket int
+	CreatedAt     time.Time
+
+	// Role is the viewing user's role, filled in by ListGroupsForUser.
+	Role string
+}
+
+type Member struct {
+	UserID      int64
+	DisplayName string
+	Role        string
+	JoinedAt    time.Time
+}
+
+// MemberDeck is a deck belonging to a group member.
+type MemberDeck struct {
+	DeckID        int64
+	Name          string
+	CommanderName string
+	OwnerID       int64
+	OwnerName     string
+}
+
+// CreateGroup creates a group owned by userID.
+func CreateGroup(ctx context.Context, db *sql.DB, userID int64, name, description string) (*Group, error) {
+	code, err := newInviteCode()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	g := Group{Name: name, Description: description, InviteCode: code}
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO playgroups (name, description, invite_code)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`, name, description, code).Scan(&g.ID, &g.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO playgroup_members (group_id, user_id, role)
+		VALUES ($1, $2, $3)
+	`, g.ID, userID, RoleOwner); err != nil {
+		return nil, err
+	}
+
+	g.Role = RoleOwner
+	return &g, tx.Commit()
+}
+
+const groupColumns = `g.id, g.name, g.description, g.invite_code, g.house_bans, g.rule_zero, g.target_bracket, g.created_at`
+
+func scanGroup(row interface{ Scan(...any) error }, g *Group, extra ...any) error {
+	dest := append([]any{&g.ID, &g.Name, &g.Description, &g.InviteCode, pq.Array(&g.HouseBans), &g.RuleZero, &g.TargetBracket, &g.CreatedAt}, extra...)
+	return row.Scan(dest...)
+}
+
+func GetGroup(ctx context.Context, db *sql.DB, id int64) (*Group, error) {
+	var g Group
+	err := scanGroup(db.QueryRowContext(ctx, `
+		SELECT `+groupColumns+`
+		FROM playgroups g
+		WHERE g.id = $1
+	`, id), &g)
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+func GetGroupByInvite(ctx context.Context, db *sql.DB, code string) (*Group, error) {
+	var g Group
+	err := scanGroup(db.QueryRowContext(ctx, `
+		SELECT `+groupColumns+`
+		FROM playgroups g
+		WHERE g.invite_code = $1
+	`, code), &g)
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// ListGroupsForUser returns the groups a user belongs to, with their role.
+func ListGroupsForUser(ctx context.Context, db *sql.DB, userID int64) ([]Group, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+groupColumns+`, m.role
+		FROM playgroups g
+		JOIN playgroup_members m ON m.group_id = g.id
+		WHERE m.user_id = $1
+		ORDER BY g.name
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Group
+	for rows.Next() {
+		var g Group
+		if err := scanGroup(rows, &g, &g.Role); err != nil {
+			return nil, err
+		}
+		out = append(out, g)
+	}
+	return out, rows.Err()
+}
+
+// MemberRole returns the user's role in the group, or ErrNotMember.
+func MemberRole(ctx context.Context, db *sql.DB, groupID, userID int64) (string, error) {
+	var role string
+	err := db.QueryRowContext(ctx, `
+		SELECT role
+		FROM playgroup_members
+		WHERE group_id = $1 AND user_id = $2
+	`, groupID, userID).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotMember
+	}
+	return role, err
+}
+
+func ListMembers(ctx context.Context, db *sql.DB, groupID int64) ([]Member, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT m.user_id, u.display_name, m.role, m.joined_at
+		FROM playgroup_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.group_id = $1
+		ORDER BY m.role = 'owner' DESC, lower(u.display_name)
+	`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Member
+	for rows.Next() {
+		var m Member
+		if err := rows.Scan(&m.UserID, &m.DisplayName, &m.Role, &m.JoinedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// ListMemberDecks returns the group members' public decks. Private decks
+// stay private to their owner; joining a group doesn't share them.
+func ListMemberDecks(ctx context.Context, db *sql.DB, groupID int64) ([]MemberDeck, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT d.id, d.name, COALESCE(d.commander_name, ''), d.user_id, u.display_name
+		FROM decks d
+		JOIN playgroup_members m ON m.user_id = d.user_id
+		JOIN users u ON u.id = d.user_id
+		WHERE m.group_id = $1 AND d.is_public AND d.hidden_at IS NULL
+		ORDER BY lower(u.display_name), d.name
+	`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []MemberDeck
+	for rows.Next() {
+		var d MemberDeck
+		if err := rows.Scan(&d.DeckID, &d.Name, &d.CommanderName, &d.OwnerID, &d.OwnerName); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// AddMember adds a user to the group as a member. Joining twice is a no-op.
+func AddMember(ctx context.Context, db *sql.DB, groupID, userID int64) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO playgroup_members (group_id, user_id, role)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (group_id, user_id) DO NOTHING
+	`, groupID, userID, RoleMember)
+	return err
+}
+
+// RemoveMember removes a user from the group. The last owner can't leave
+// or be removed; delete the group instead.
+func RemoveMember(ctx context.Context, db *sql.DB, groupID, userID int64) error {
+	return changeMembership(ctx, db, groupID, userID, `
+		DELETE FROM playgroup_members
+		WHERE group_id = $1 AND user_id = $2
+	`)
+}
+
+// SetRole changes a member's role, keeping at least one owner.
+func SetRole(ctx context.Context, db *sql.DB, groupID, userID int64, role string) error {
+	if role != RoleOwner && role != RoleMember {
+		return errors.New("unknown role " + role)
+	}
+	return changeMembership(ctx, db, groupID, userID, `
+		UPDATE playgroup_members
+		SET role = $3
+		WHERE group_id = $1 AND user_id = $2
+	`, role)
+}
+
+func changeMembership(ctx context.Context, db *sql.DB, groupID, userID int64, query string, args ...any) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the group's member rows so two owners can't demote each other
+	// at the same time.
+	if _, err := tx.ExecContext(ctx, `
+		SELECT 1 FROM playgroup_members WHERE group_id = $1 FOR UPDATE
+	`, groupID); err != nil {
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx, query, append([]any{groupID, userID}, args...)...)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotMember
+	}
+
+	var owners int
+	if err := tx.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM playgroup_members WHERE group_id = $1 AND role = 'owner'
+	`, groupID).Scan(&owners); err != nil {
+		return err
+	}
+	if owners == 0 {
+		return ErrLastOwner
+	}
+
+	return tx.Commit()
+}
+
+// UpdateGroup saves the group's details and house rules.
+func UpdateGroup(ctx context.Context, db *sql.DB, g *Group) error {
+	_, err := db.ExecContext(ctx, `
+		UPDATE playgroups
+		SET name = $2, description = $3, house_bans = $4, rule_zero = $5, target_bracket = $6
+		WHERE id = $1
+	`, g.ID, g.Name, g.Description, pq.Array(g.HouseBans), g.RuleZero, g.TargetBracket)
+	return err
+}
+
+// RotateInvite replaces the group's invite code, invalidating old links.
+func RotateInvite(ctx context.Context, db *sql.DB, groupID int64) error {
+	code, err := newInviteCode()
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `
+		UPDATE playgroups SET invite_code = $2 WHERE id = $1
+	`, groupID, code)
+	return err
+}
+
+func DeleteGroup(ctx context.Context, db *sql.DB, groupID int64) error {
+	_, err := db.ExecContext(ctx, `DELETE FROM playgroups WHERE id = $1`, groupID)
+	return err
+}
+
+func newInviteCode() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func EnsureGroupTables(ctx context.Context, db *sql.DB) error {
+	// Playgroups and their house rules
+	if _, err := db.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS playgroups (
+            id BIGSERIAL PRIMARY KEY,
+            name TEXT NOT NULL,
+            description TEXT NOT NULL DEFAULT '',
+            invite_code TEXT NOT NULL UNIQUE,
+            house_bans TEXT[] NOT NULL DEFAULT '{}',
+            rule_zero TEXT NOT NULL DEFAULT '',
+            target_bracket INT NOT NULL DEFAULT 0,
+            created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+        );
+    `); err != nil {
+		return err
+	}
+
+	// Members
+	if _, err := db.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS playgroup_members (
+            group_id BIGINT NOT NULL REFERENCES playgroups(id) ON DELETE CASCADE,
+            user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+            role TEXT NOT NULL DEFAULT 'member',
+            joined_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+            PRIMARY KEY (group_id, user_id)
+        );
+    `); err != nil {
+		return err
+	}
+
+	if _, err := db.ExecContext(ctx, `
+        CREATE INDEX IF NOT EXISTS idx_playgroup_members_user_id ON playgroup_members(user_id);
+    `); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,387 @@
+package imgcache
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	fetchTimeout  = 15 * time.Second
+	maxImageBytes = 8 << 20
+
+	// Scryfall asks API clients to keep to about ten requests a second.
+	fetchInterval = 100 * time.Millisecond
+
+	scryfallCards = "https://api.scryfall.com/cards/"
+
+	warmWorkers = 4
+	tempPrefix  = ".tmp-"
+)
+
+// Sizes are the Scryfall image versions the cache serves. All are JPEGs.
+var Sizes = map[string]bool{"small": true, "normal": true, "large": true, "art_crop": true}
+
+var (
+	ErrInvalid  = errors.New("invalid image reference")
+	ErrNotFound = errors.New("image not found on Scryfall")
+)
+
+// Ref names one cached image. Face is "front" or "back".
+type Ref struct {
+	ID   string
+	Size string
+	Face string
+}
+
+func (r Ref) valid() bool {
+	_, err := uuid.Parse(r.ID)
+	return err == nil && Sizes[r.Size] && (r.Face == "front" || r.Face == "back")
+}
+
+// file is the cache file name, which doubles as the LRU key.
+func (r Ref) file() string {
+	return strings.ToLower(r.ID) + "-" + r.Size + "-" + r.Face + ".jpg"
+}
+
+// Info describes a cached image for serving.
+type Info struct {
+	ETag    string
+	ModTime time.Time
+	Size    int64
+}
+
+type entry struct {
+	name    string
+	size    int64
+	etag    string
+	modTime time.Time
+}
+
+// Cache keeps Scryfall card images on disk, evicting the least recently
+// used ones once the total size passes the limit. The LRU order is kept in
+// memory and restored from file modification times on start.
+type Cache struct {
+	dir      string
+	maxBytes int64
+	endpoint string
+	client   *http.Client
+	tick     *time.Ticker
+
+	mu       sync.Mutex
+	lru      *list.List // of *entry, most recently used first
+	entries  map[string]*list.Element
+	total    int64
+	inflight map[string]*fetchCall
+}
+
+type fetchCall struct {
+	done chan struct{}
+	err  error
+}
+
+// New opens (or creates) a cache in dir holding at most maxBytes of images.
+func New(dir string, maxBytes int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	c := &Cache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		endpoint: scryfallCards,
+		client:   &http.Client{Timeout: fetchTimeout},
+		tick:     time.NewTicker(fetchInterval),
+		lru:      list.New(),
+		entries:  map[string]*list.Element{},
+		inflight: map[string]*fetchCall{},
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var found []*entry
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		if strings.HasPrefix(f.Name(), tempPrefix) {
+			// Left over from a download interrupted by a restart.
+			os.Remove(filepath.Join(dir, f.Name()))
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+		found = append(found, &entry{name: f.Name(), size: info.Size(), modTime: info.ModTime()})
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].modTime.Before(found[j].modTime) })
+	for _, e := range found {
+		c.entries[e.name] = c.lru.PushFront(e)
+		c.total += e.size
+	}
+
+	c.mu.Lock()
+	c.evictLocked()
+	c.mu.Unlock()
+
+	return c, nil
+}
+
+// Open returns the cached image, downloading it first on a miss. The
+// caller closes the file.
+func (c *Cache) Open(ctx context.Context, ref Ref) (*os.File, Info, error) {
+	if !ref.valid() {
+		return nil, Info{}, ErrInvalid
+	}
+
+	// A file can be evicted between the lookup and the open; one retry
+	// covers that.
+	for attempt := 0; attempt < 2; attempt++ {
+		if err := c.ensure(ctx, ref); err != nil {
+			return nil, Info{}, err
+		}
+
+		f, err := os.Open(filepath.Join(c.dir, ref.file()))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, Info{}, err
+		}
+
+		info, err := c.touch(ref.file(), f)
+		if err != nil {
+			f.Close()
+			return nil, Info{}, err
+		}
+		return f, info, nil
+	}
+	return nil, Info{}, errors.New("image evicted while opening")
+}
+
+// Image returns the decoded image, downloading it first on a miss.
+func (c *Cache) Image(ctx context.Context, ref Ref) (image.Image, error) {
+	f, _, err := c.Open(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return jpeg.Decode(f)
+}
+
+// Bytes returns the image file's contents, downloading it first on a
+// miss.
+func (c *Cache) Bytes(ctx context.Context, ref Ref) ([]byte, error) {
+	f, _, err := c.Open(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// Warm downloads any of the images not cached yet and returns how many
+// of them are cached afterwards. Images that fail to download are skipped.
+func (c *Cache) Warm(ctx context.Context, refs []Ref) int {
+	queue := make(chan Ref)
+	var (
+		mu    sync.Mutex
+		ready int
+		wg    sync.WaitGroup
+	)
+	for i := 0; i < warmWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ref := range queue {
+				if err := c.ensure(ctx, ref); err == nil {
+					mu.Lock()
+					ready++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, ref := range refs {
+		if ref.valid() {
+			queue <- ref
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	return ready
+}
+
+// ensure makes sure the image is on disk, sharing one download between
+// concurrent requests for the same image.
+func (c *Cache) ensure(ctx context.Context, ref Ref) error {
+	name := ref.file()
+
+	c.mu.Lock()
+	if _, ok := c.entries[name]; ok {
+		c.mu.Unlock()
+		return nil
+	}
+	if call, ok := c.inflight[name]; ok {
+		c.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	call := &fetchCall{done: make(chan struct{})}
+	c.inflight[name] = call
+	c.mu.Unlock()
+
+	call.err = c.download(ctx, ref)
+
+	c.mu.Lock()
+	delete(c.inflight, name)
+	c.mu.Unlock()
+	close(call.done)
+
+	return call.err
+}
+
+func (c *Cache) download(ctx context.Context, ref Ref) error {
+	select {
+	case <-c.tick.C:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	url := fmt.Sprintf("%s%s?format=image&version=%s", c.endpoint, ref.ID, ref.Size)
+	if ref.Face == "back" {
+		url += "&face=back"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("scryfall image %s: %s", ref.file(), resp.Status)
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "image/jpeg") {
+		return fmt.Errorf("scryfall image %s: unexpected %s", ref.file(), resp.Header.Get("Content-Type"))
+	}
+
+	tmp, err := os.CreateTemp(c.dir, tempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(resp.Body, maxImageBytes+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if n > maxImageBytes {
+		return fmt.Errorf("scryfall image %s: larger than %d bytes", ref.file(), maxImageBytes)
+	}
+
+	name := ref.file()
+	if err := os.Rename(tmp.Name(), filepath.Join(c.dir, name)); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[name] = c.lru.PushFront(&entry{
+		name:    name,
+		size:    n,
+		etag:    etag(hash.Sum(nil)),
+		modTime: time.Now(),
+	})
+	c.total += n
+	c.evictLocked()
+	return nil
+}
+
+// touch marks the image as just used and returns its serving info,
+// hashing the file for its ETag the first time it's served after a
+// restart.
+func (c *Cache) touch(name string, f *os.File) (Info, error) {
+	c.mu.Lock()
+	el, ok := c.entries[name]
+	if !ok {
+		c.mu.Unlock()
+		return Info{}, os.ErrNotExist
+	}
+	c.lru.MoveToFront(el)
+	e := *el.Value.(*entry)
+	c.mu.Unlock()
+
+	now := time.Now()
+	// Keep the order across restarts; a failure only costs LRU accuracy.
+	os.Chtimes(filepath.Join(c.dir, name), now, now)
+
+	if e.etag == "" {
+		hash := sha256.New()
+		if _, err := io.Copy(hash, f); err != nil {
+			return Info{}, err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return Info{}, err
+		}
+		e.etag = etag(hash.Sum(nil))
+
+		c.mu.Lock()
+		if el, ok := c.entries[name]; ok {
+			el.Value.(*entry).etag = e.etag
+		}
+		c.mu.Unlock()
+	}
+
+	return Info{ETag: e.etag, ModTime: e.modTime, Size: e.size}, nil
+}
+
+// evictLocked removes least recently used images until the cache fits.
+// Callers hold c.mu.
+func (c *Cache) evictLocked() {
+	for c.total > c.maxBytes && c.lru.Len() > 1 {
+		el := c.lru.Back()
+		e := el.Value.(*entry)
+		c.lru.Remove(el)
+		delete(c.entries, e.name)
+		c.total -= e.size
+		os.Remove(filepath.Join(c.dir, e.name))
+	}
+}
+
+func etag(sum []byte) string {
+	return `"` + hex.EncodeToString(sum[:12]) + `"`
+}
@@ -0,0 +1,413 @@
+package live
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxSeats is the most players a table can hold.
+	MaxSeats = 6
+
+	// DefaultLife is the Commander starting life total.
+	DefaultLife = 40
+
+	// Thresholds at which a player loses.
+	lethalPoison          = 10
+	lethalCommanderDamage = 21
+
+	// Tables nobody has touched for this long are dropped.
+	idleTimeout = 12 * time.Hour
+
+	codeLength   = 6
+	codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+var (
+	ErrTableNotFound = errors.New("table not found")
+	ErrTableFull     = errors.New("table is full")
+	ErrTableEnded    = errors.New("game has ended")
+	ErrUnknownSeat   = errors.New("unknown seat")
+)
+
+// Player is one seat at a live table. UserID is 0 for guests added by the
+// host. CommanderDamage is keyed by the seat of the opposing commander.
+type Player struct {
+	Seat            int         `json:"seat"`
+	UserID          int64       `json:"user_id"`
+	Name            string      `json:"name"`
+	DeckID          int64       `json:"deck_id"`
+	Commander       string      `json:"commander"`
+	Life            int         `json:"life"`
+	Poison          int         `json:"poison"`
+	Energy          int         `json:"energy"`
+	CommanderDamage map[int]int `json:"commander_damage"`
+	Out             bool        `json:"out"`
+}
+
+// State is everything the table shows. It is sent as JSON to every
+// connected browser after each change.
+type State struct {
+	Code         string   `json:"code"`
+	HostID       int64    `json:"host_id"`
+	StartingLife int      `json:"starting_life"`
+	Turn         int      `json:"turn"`
+	ActiveSeat   int      `json:"active_seat"`
+	Monarch      int      `json:"monarch"`
+	Initiative   int      `json:"initiative"`
+	Players      []Player `json:"players"`
+	Ended        bool     `json:"ended"`
+	GameID       int64    `json:"game_id"`
+	Version      int64    `json:"version"`
+}
+
+// Table is a shared game session. All changes go through apply, which
+// bumps the version and pushes the new state to subscribers.
+type Table struct {
+	mu       sync.Mutex
+	state    State
+	touched  time.Time
+	watchers map[chan []byte]struct{}
+
+	// ending is set while the finished game is being logged, so it is
+	// only logged once.
+	ending bool
+}
+
+// Hub holds the live tables by join code. Tables only exist in memory;
+// the finished game is stored through the games package.
+type Hub struct {
+	mu     sync.Mutex
+	tables map[string]*Table
+}
+
+func NewHub() *Hub {
+	return &Hub{tables: map[string]*Table{}}
+}
+
+// Create starts a table hosted by the given player and returns it.
+func (h *Hub) Create(host Player, startingLife int) (*Table, error) {
+	if startingLife <= 0 {
+		startingLife = DefaultLife
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Drop idle tables while we hold the lock anyway.
+	for code, t := range h.tables {
+		if t.idleSince() > idleTimeout {
+			delete(h.tables, code)
+		}
+	}
+
+	var code string
+	for {
+		c, err := newCode()
+		if err != nil {
+			return nil, err
+		}
+		if _, taken := h.tables[c]; !taken {
+			code = c
+			break
+		}
+	}
+
+	t := &Table{
+		state: State{
+			Code:         code,
+			HostID:       host.UserID,
+			StartingLife: startingLife,
+			Turn:         1,
+			ActiveSeat:   1,
+		},
+		touched:  time.Now(),
+		watchers: map[chan []byte]struct{}{},
+	}
+	t.state.addPlayer(host)
+
+	h.tables[code] = t
+	return t, nil
+}
+
+// Get looks up a table by its join code, ignoring case and spaces.
+func (h *Hub) Get(code string) (*Table, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	t, ok := h.tables[code]
+	if !ok || t.idleSince() > idleTimeout {
+		return nil, ErrTableNotFound
+	}
+	return t, nil
+}
+
+// Snapshot returns a copy of the current state.
+func (t *Table) Snapshot() State {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.state.clone()
+}
+
+// Subscribe registers for state updates. Each update is the JSON-encoded
+// state; a slow reader only ever misses intermediate states. Call the
+// returned function to unsubscribe.
+func (t *Table) Subscribe() (<-chan []byte, func()) {
+	ch := make(chan []byte, 1)
+
+	t.mu.Lock()
+	t.watchers[ch] = struct{}{}
+	t.mu.Unlock()
+
+	return ch, func() {
+		t.mu.Lock()
+		delete(t.watchers, ch)
+		t.mu.Unlock()
+	}
+}
+
+// SeatOf returns the seat of the given user, or 0 if they aren't seated.
+func (t *Table) SeatOf(userID int64) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, p := range t.state.Players {
+		if p.UserID == userID {
+			return p.Seat
+		}
+	}
+	return 0
+}
+
+// Join seats a site user, or updates their deck if they are already seated.
+func (t *Table) Join(p Player) error {
+	return t.apply(func(s *State) error {
+		for i := range s.Players {
+			if s.Players[i].UserID == p.UserID {
+				s.Players[i].DeckID = p.DeckID
+				s.Players[i].Commander = p.Commander
+				return nil
+			}
+		}
+		return s.addPlayer(p)
+	})
+}
+
+// AddGuest seats a player without an account.
+func (t *Table) AddGuest(name, commander string) error {
+	return t.apply(func(s *State) error {
+		return s.addPlayer(Player{Name: name, Commander: commander})
+	})
+}
+
+func (t *Table) AdjustLife(seat, delta int) error {
+	return t.applyPlayer(seat, func(s *State, p *Player) error {
+		p.Life += delta
+		return nil
+	})
+}
+
+func (t *Table) AdjustPoison(seat, delta int) error {
+	return t.applyPlayer(seat, func(s *State, p *Player) error {
+		p.Poison = max(0, p.Poison+delta)
+		return nil
+	})
+}
+
+func (t *Table) AdjustEnergy(seat, delta int) error {
+	return t.applyPlayer(seat, func(s *State, p *Player) error {
+		p.Energy = max(0, p.Energy+delta)
+		return nil
+	})
+}
+
+// AdjustCommanderDamage records damage dealt to seat by the commander at
+// fromSeat. Commander damage is also life loss.
+func (t *Table) AdjustCommanderDamage(seat, fromSeat, delta int) error {
+	return t.applyPlayer(seat, func(s *State, p *Player) error {
+		if fromSeat == seat || s.player(fromSeat) == nil {
+			return ErrUnknownSeat
+		}
+		before := p.CommanderDamage[fromSeat]
+		after := max(0, before+delta)
+		p.CommanderDamage[fromSeat] = after
+		p.Life -= after - before
+		return nil
+	})
+}
+
+// SetMonarch gives the monarch to seat; 0 clears it.
+func (t *Table) SetMonarch(seat int) error {
+	return t.apply(func(s *State) error {
+		if seat != 0 && s.player(seat) == nil {
+			return ErrUnknownSeat
+		}
+		s.Monarch = seat
+		return nil
+	})
+}
+
+// SetInitiative gives the initiative to seat; 0 clears it.
+func (t *Table) SetInitiative(seat int) error {
+	return t.apply(func(s *State) error {
+		if seat != 0 && s.player(seat) == nil {
+			return ErrUnknownSeat
+		}
+		s.Initiative = seat
+		return nil
+	})
+}
+
+// NextTurn passes the turn to the next player still in the game. The turn
+// counter goes up each time play returns to the first seat.
+func (t *Table) NextTurn() error {
+	return t.apply(func(s *State) error {
+		n := len(s.Players)
+		for i := 0; i < n; i++ {
+			s.ActiveSeat++
+			if s.ActiveSeat > n {
+				s.ActiveSeat = 1
+				s.Turn++
+			}
+			if !s.Players[s.ActiveSeat-1].Out {
+				break
+			}
+		}
+		return nil
+	})
+}
+
+// BeginEnd claims the right to log the game and returns the state to log.
+// Until End or CancelEnd, anyone else trying to end the table gets
+// ErrTableEnded.
+func (t *Table) BeginEnd() (State, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.state.Ended || t.ending {
+		return State{}, ErrTableEnded
+	}
+	t.ending = true
+	return t.state.clone(), nil
+}
+
+// CancelEnd gives up a claim from BeginEnd when logging the game failed.
+func (t *Table) CancelEnd() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ending = false
+}
+
+// End marks the game finished once it has been logged as gameID.
+func (t *Table) End(gameID int64) error {
+	return t.apply(func(s *State) error {
+		t.ending = false
+		s.Ended = true
+		s.GameID = gameID
+		return nil
+	})
+}
+
+func (t *Table) applyPlayer(seat int, fn func(*State, *Player) error) error {
+	return t.apply(func(s *State) error {
+		p := s.player(seat)
+		if p == nil {
+			return ErrUnknownSeat
+		}
+		if err := fn(s, p); err != nil {
+			return err
+		}
+		p.Out = p.Life <= 0 || p.Poison >= lethalPoison
+		for _, dmg := range p.CommanderDamage {
+			if dmg >= lethalCommanderDamage {
+				p.Out = true
+			}
+		}
+		return nil
+	})
+}
+
+func (t *Table) apply(fn func(*State) error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.state.Ended {
+		return ErrTableEnded
+	}
+
+	next := t.state.clone()
+	if err := fn(&next); err != nil {
+		return err
+	}
+	next.Version++
+	t.state = next
+	t.touched = time.Now()
+
+	msg, err := json.Marshal(t.state)
+	if err != nil {
+		return err
+	}
+	for ch := range t.watchers {
+		// Replace any update the reader hasn't picked up yet; only the
+		// latest state matters.
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- msg
+	}
+	return nil
+}
+
+func (t *Table) idleSince() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return time.Since(t.touched)
+}
+
+func (s *State) addPlayer(p Player) error {
+	if len(s.Players) >= MaxSeats {
+		return ErrTableFull
+	}
+	p.Seat = len(s.Players) + 1
+	p.Life = s.StartingLife
+	p.CommanderDamage = map[int]int{}
+	s.Players = append(s.Players, p)
+	return nil
+}
+
+func (s *State) player(seat int) *Player {
+	if seat < 1 || seat > len(s.Players) {
+		return nil
+	}
+	return &s.Players[seat-1]
+}
+
+func (s State) clone() State {
+	out := s
+	out.Players = make([]Player, len(s.Players))
+	for i, p := range s.Players {
+		p.CommanderDamage = make(map[int]int, len(p.CommanderDamage))
+		for k, v := range s.Players[i].CommanderDamage {
+			p.CommanderDamage[k] = v
+		}
+		out.Players[i] = p
+	}
+	return out
+}
+
+func newCode() (string, error) {
+	b := make([]byte, codeLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = codeAlphabet[int(b[i])%len(codeAlphabet)]
+	}
+	return string(b), nil
+}
@@ -0,0 +1,91 @@
+// Package mail sends the site's transactional email, such as password
+// reset links.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Message is a plain-text email to one recipient.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+}
+
+// Mailer sends email.
+type Mailer interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// SMTP sends mail through an SMTP server, upgrading to TLS when the server
+// offers STARTTLS. For development it can point at a local catcher such as
+// Mailpit on localhost:1025.
+type SMTP struct {
+	Addr     string // host:port
+	From     string
+	Username string // optional; PLAIN auth when set
+	Password string
+}
+
+func (s *SMTP) Send(ctx context.Context, m Message) error {
+	to, err := mail.ParseAddress(m.To)
+	if err != nil {
+		return fmt.Errorf("mail: bad recipient %q: %w", m.To, err)
+	}
+	from, err := mail.ParseAddress(s.From)
+	if err != nil {
+		return fmt.Errorf("mail: bad sender %q: %w", s.From, err)
+	}
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, _ := strings.Cut(s.Addr, ":")
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	// net/smtp has no context support, so the send can't be cancelled
+	// midway; a cancelled context only stops it from starting.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return smtp.SendMail(s.Addr, auth, from.Address, []string{to.Address}, s.build(from, to, m))
+}
+
+func (s *SMTP) build(from, to *mail.Address, m Message) []byte {
+	var b bytes.Buffer
+	header := func(k, v string) {
+		// Strip line breaks so a value can't add headers of its own.
+		v = strings.NewReplacer("\r", "", "\n", " ").Replace(v)
+		b.WriteString(k + ": " + v + "\r\n")
+	}
+	header("From", from.String())
+	header("To", to.String())
+	header("Subject", mime.QEncoding.Encode("UTF-8", m.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=UTF-8")
+	header("Content-Transfer-Encoding", "8bit")
+	b.WriteString("\r\n")
+
+	text := strings.ReplaceAll(m.Text, "\r\n", "\n")
+	b.WriteString(strings.ReplaceAll(text, "\n", "\r\n"))
+	return b.Bytes()
+}
+
+// Log writes mail to the server log instead of sending it, for
+// development without an SMTP server.
+type Log struct{}
+
+func (Log) Send(ctx context.Context, m Message) error {
+	log.Printf("mail to %s: %s\n%s", m.To, m.Subject, m.Text)
+	return nil
+}
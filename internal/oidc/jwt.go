@@ -0,0 +1,238 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+// publicKey checks a JWS signature made by one of the provider's keys.
+type publicKey interface {
+	verify(alg string, signed, sig []byte) bool
+}
+
+type rsaKey struct{ *rsa.PublicKey }
+
+func (k rsaKey) verify(alg string, signed, sig []byte) bool {
+	if alg != "RS256" {
+		return false
+	}
+	digest := sha256.Sum256(signed)
+	return rsa.VerifyPKCS1v15(k.PublicKey, crypto.SHA256, digest[:], sig) == nil
+}
+
+type ecKey struct{ *ecdsa.PublicKey }
+
+// JWS carries ECDSA signatures as the raw r and s, not ASN.1.
+func (k ecKey) verify(alg string, signed, sig []byte) bool {
+	if alg != "ES256" || len(sig) != 64 {
+		return false
+	}
+	digest := sha256.Sum256(signed)
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:])
+	return ecdsa.Verify(k.PublicKey, digest[:], r, s)
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWK returns nil for keys this package can't use, which providers
+// may publish alongside the ones it can.
+func parseJWK(k jwk) publicKey {
+	if k.Use != "" && k.Use != "sig" {
+		return nil
+	}
+	b64 := base64.RawURLEncoding
+	switch k.Kty {
+	case "RSA":
+		n, err1 := b64.DecodeString(k.N)
+		e, err2 := b64.DecodeString(k.E)
+		if err1 != nil || err2 != nil || len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil
+		}
+		return rsaKey{&rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}}
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil
+		}
+		x, err1 := b64.DecodeString(k.X)
+		y, err2 := b64.DecodeString(k.Y)
+		if err1 != nil || err2 != nil || len(x) != 32 || len(y) != 32 {
+			return nil
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil
+		}
+		return ecKey{pub}
+	}
+	return nil
+}
+
+// key finds the provider key a token names, refetching the key set when
+// it isn't there in case the provider has rotated keys.
+func (p *Provider) key(ctx context.Context, kid string) (publicKey, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if k, ok := p.keys[kid]; ok && time.Since(p.keysFetched) < metadataTTL {
+		return k, nil
+	}
+	if time.Since(p.keysFetched) < keyRefreshInterval {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrInvalid, kid)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := p.getJSON(ctx, meta.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("%w: keys: %v", ErrDiscovery, err)
+	}
+	keys := make(map[string]publicKey)
+	for _, k := range set.Keys {
+		if pk := parseJWK(k); pk != nil {
+			keys[k.Kid] = pk
+		}
+	}
+	p.keys, p.keysFetched = keys, time.Now()
+
+	k, ok := keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrInvalid, kid)
+	}
+	return k, nil
+}
+
+type idTokenClaims struct {
+	Issuer        string          `json:"iss"`
+	Subject       string          `json:"sub"`
+	Audience      audience        `json:"aud"`
+	AuthorizedFor string          `json:"azp"`
+	Expiry        int64           `json:"exp"`
+	IssuedAt      int64           `json:"iat"`
+	Nonce         string          `json:"nonce"`
+	Email         string          `json:"email"`
+	EmailVerified json.RawMessage `json:"email_verified"`
+	Name          string          `json:"name"`
+}
+
+// audience is a JWT "aud", which may be one string or a list.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*a = audience{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+// verify checks an ID token's signature and claims. The token came
+// straight from the token endpoint over TLS, but its signature is checked
+// anyway so a misbehaving endpoint can't vouch for arbitrary users.
+func (p *Provider) verify(ctx context.Context, raw, nonce string) (*Claims, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalid)
+	}
+	b64 := base64.RawURLEncoding
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	hb, err := b64.DecodeString(parts[0])
+	if err != nil || json.Unmarshal(hb, &header) != nil {
+		return nil, fmt.Errorf("%w: header", ErrInvalid)
+	}
+	if header.Alg != "RS256" && header.Alg != "ES256" {
+		return nil, fmt.Errorf("%w: algorithm %q", ErrInvalid, header.Alg)
+	}
+	sig, err := b64.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature", ErrInvalid)
+	}
+
+	key, err := p.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if !key.verify(header.Alg, []byte(parts[0]+"."+parts[1]), sig) {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalid)
+	}
+
+	var c idTokenClaims
+	cb, err := b64.DecodeString(parts[1])
+	if err != nil || json.Unmarshal(cb, &c) != nil {
+		return nil, fmt.Errorf("%w: claims", ErrInvalid)
+	}
+
+	now := time.Now()
+	switch {
+	case strings.TrimRight(c.Issuer, "/") != p.Issuer:
+		return nil, fmt.Errorf("%w: issuer %q", ErrInvalid, c.Issuer)
+	case !slices.Contains(c.Audience, p.ClientID):
+		return nil, fmt.Errorf("%w: audience %q", ErrInvalid, c.Audience)
+	case len(c.Audience) > 1 && c.AuthorizedFor != p.ClientID:
+		return nil, fmt.Errorf("%w: authorized party %q", ErrInvalid, c.AuthorizedFor)
+	case now.After(time.Unix(c.Expiry, 0).Add(clockSkew)):
+		return nil, fmt.Errorf("%w: expired", ErrInvalid)
+	case time.Unix(c.IssuedAt, 0).After(now.Add(clockSkew)):
+		return nil, fmt.Errorf("%w: issued in the future", ErrInvalid)
+	case c.Nonce != nonce:
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalid)
+	case c.Subject == "":
+		return nil, fmt.Errorf("%w: no subject", ErrInvalid)
+	}
+
+	return &Claims{
+		Subject:       c.Subject,
+		Email:         c.Email,
+		EmailVerified: isTrue(c.EmailVerified),
+		Name:          c.Name,
+	}, nil
+}
+
+// isTrue reads email_verified, which a few providers send as the string
+// "true" rather than a boolean.
+func isTrue(raw json.RawMessage) bool {
+	var b bool
+	if json.Unmarshal(raw, &b) == nil {
+		return b
+	}
+	var s string
+	return json.Unmarshal(raw, &s) == nil && s == "true"
+}
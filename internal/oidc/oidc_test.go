@@ -0,0 +1,224 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"manatomb/app/internal/oidc/oidctest"
+)
+
+const testRedirectURI = "https://manatomb.example/login/oidc/callback"
+
+// startIssuer runs the mock issuer and returns a provider configured for
+// it.
+func startIssuer(t *testing.T) (*oidctest.Issuer, *Provider) {
+	t.Helper()
+	iss, err := oidctest.New("manatomb", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(iss.Handler())
+	t.Cleanup(srv.Close)
+	iss.URL = srv.URL
+
+	p := New("Mock", srv.URL+"/", "manatomb", "secret")
+	p.httpClient = srv.Client()
+	return iss, p
+}
+
+// signIn follows the provider's sign-in page as email and returns the code
+// it redirects back with.
+func signIn(t *testing.T, p *Provider, email, nonce, verifier string) string {
+	t.Helper()
+	authURL, err := p.AuthURL(context.Background(), testRedirectURI, "the-state", nonce, verifier)
+	if err != nil {
+		t.Fatalf("AuthURL: %v", err)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.PostForm(authURL, url.Values{
+		"email":          {email},
+		"name":           {"Test Player"},
+		"email_verified": {"on"},
+	})
+	if err != nil {
+		t.Fatalf("sign in: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("sign in status = %d, want %d", resp.StatusCode, http.StatusSeeOther)
+	}
+
+	back, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := back.Scheme + "://" + back.Host + back.Path; got != testRedirectURI {
+		t.Fatalf("redirected to %q, want %q", got, testRedirectURI)
+	}
+	if got := back.Query().Get("state"); got != "the-state" {
+		t.Fatalf("state = %q, want %q", got, "the-state")
+	}
+	return back.Query().Get("code")
+}
+
+func TestAuthURL(t *testing.T) {
+	iss, p := startIssuer(t)
+
+	authURL, err := p.AuthURL(context.Background(), testRedirectURI, "the-state", "the-nonce", "the-verifier")
+	if err != nil {
+		t.Fatalf("AuthURL: %v", err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.Scheme + "://" + u.Host + u.Path; got != iss.URL+"/authorize" {
+		t.Errorf("endpoint = %q, want %q", got, iss.URL+"/authorize")
+	}
+
+	challenge := sha256.Sum256([]byte("the-verifier"))
+	q := u.Query()
+	for param, want := range map[string]string{
+		"response_type":         "code",
+		"client_id":             "manatomb",
+		"redirect_uri":          testRedirectURI,
+		"state":                 "the-state",
+		"nonce":                 "the-nonce",
+		"code_challenge":        base64.RawURLEncoding.EncodeToString(challenge[:]),
+		"code_challenge_method": "S256",
+	} {
+		if got := q.Get(param); got != want {
+			t.Errorf("%s = %q, want %q", param, got, want)
+		}
+	}
+	if !strings.Contains(q.Get("scope"), "openid") {
+		t.Errorf("scope = %q, want openid", q.Get("scope"))
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	iss, p := startIssuer(t)
+	iss.URL = "https://id.elsewhere.example"
+
+	if _, err := p.AuthURL(context.Background(), testRedirectURI, "s", "n", "v"); !errors.Is(err, ErrDiscovery) {
+		t.Errorf("AuthURL error = %v, want ErrDiscovery", err)
+	}
+}
+
+func TestExchange(t *testing.T) {
+	_, p := startIssuer(t)
+	code := signIn(t, p, "Player@Example.com", "the-nonce", "the-verifier")
+
+	claims, err := p.Exchange(context.Background(), testRedirectURI, code, "the-verifier", "the-nonce")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	want := Claims{
+		Subject:       "mock:player@example.com",
+		Email:         "Player@Example.com",
+		EmailVerified: true,
+		Name:          "Test Player",
+	}
+	if *claims != want {
+		t.Errorf("claims = %+v, want %+v", *claims, want)
+	}
+
+	// Codes are single-use.
+	if _, err := p.Exchange(context.Background(), testRedirectURI, code, "the-verifier", "the-nonce"); !errors.Is(err, ErrExchange) {
+		t.Errorf("second Exchange error = %v, want ErrExchange", err)
+	}
+
+	if _, err := p.key(context.Background(), "mock"); err != nil {
+		t.Errorf("signing key not cached from JWKS: %v", err)
+	}
+}
+
+func TestExchangeRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		verifier string
+		nonce    string
+		claims   func(map[string]any)
+		wantErr  error
+	}{
+		{
+			name:     "wrong PKCE verifier",
+			verifier: "another-verifier",
+			wantErr:  ErrExchange,
+		},
+		{
+			name:    "wrong nonce",
+			nonce:   "another-nonce",
+			wantErr: ErrInvalid,
+		},
+		{
+			name:    "wrong issuer",
+			claims:  func(c map[string]any) { c["iss"] = "https://id.elsewhere.example" },
+			wantErr: ErrInvalid,
+		},
+		{
+			name:    "wrong audience",
+			claims:  func(c map[string]any) { c["aud"] = "someone-else" },
+			wantErr: ErrInvalid,
+		},
+		{
+			name:    "several audiences without authorized party",
+			claims:  func(c map[string]any) { c["aud"] = []string{"manatomb", "someone-else"} },
+			wantErr: ErrInvalid,
+		},
+		{
+			name:    "expired",
+			claims:  func(c map[string]any) { c["exp"] = c["iat"].(int64) - 3600 },
+			wantErr: ErrInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iss, p := startIssuer(t)
+			iss.EditClaims = tt.claims
+			code := signIn(t, p, "player@example.com", "the-nonce", "the-verifier")
+
+			verifier, nonce := "the-verifier", "the-nonce"
+			if tt.verifier != "" {
+				verifier = tt.verifier
+			}
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+			if _, err := p.Exchange(context.Background(), testRedirectURI, code, verifier, nonce); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Exchange error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExchangeBadSignature(t *testing.T) {
+	_, p := startIssuer(t)
+	_, other := startIssuer(t)
+
+	// Load each provider's key, then make p check tokens against the other
+	// issuer's key, as if its JWKS had been swapped.
+	for _, prov := range []*Provider{p, other} {
+		code := signIn(t, prov, "player@example.com", "the-nonce", "the-verifier")
+		if _, err := prov.Exchange(context.Background(), testRedirectURI, code, "the-verifier", "the-nonce"); err != nil {
+			t.Fatalf("Exchange: %v", err)
+		}
+	}
+	p.keys["mock"] = other.keys["mock"]
+
+	code := signIn(t, p, "player@example.com", "the-nonce", "the-verifier")
+	if _, err := p.Exchange(context.Background(), testRedirectURI, code, "the-verifier", "the-nonce"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Exchange error = %v, want ErrInvalid", err)
+	}
+}
@@ -0,0 +1,250 @@
+// Package oidctest is a stand-in OpenID Connect provider, for trying
+// external sign-in locally (see cmd/mock-oidc) and for tests. Its sign-in
+// page asks for an email address and signs in as whoever you type; never
+// expose it.
+package oidctest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+type grant struct {
+	clientID    string
+	redirectURI string
+	challenge   string
+	nonce       string
+	email       string
+	verified    bool
+	name        string
+	expires     time.Time
+}
+
+// Issuer serves discovery, sign-in, token and key endpoints for one
+// client. URL is its issuer identifier and must be set, e.g. to an
+// httptest.Server's URL, before the first request.
+type Issuer struct {
+	URL          string
+	ClientID     string
+	ClientSecret string
+
+	// EditClaims, when set, may change an ID token's claims before it is
+	// signed, so tests can make tokens that should be refused.
+	EditClaims func(claims map[string]any)
+
+	key *ecdsa.PrivateKey
+
+	mu     sync.Mutex
+	grants map[string]grant
+}
+
+var signInPage = template.Must(template.New("signin").Parse(`<!doctype html>
+<title>Mock OIDC sign-in</title>
+<h1>Mock OIDC sign-in</h1>
+<p>Signing in to <code>{{ .ClientID }}</code>. Any email works.</p>
+<form method="POST">
+  <p><label>Email <input type="email" name="email" required autofocus></label></p>
+  <p><label>Name <input name="name"></label></p>
+  <p><label><input type="checkbox" name="email_verified" checked> Email verified</label></p>
+  <p><button>Sign in</button></p>
+</form>
+`))
+
+// New returns an issuer for the one client allowed to sign in, with a
+// fresh signing key.
+func New(clientID, clientSecret string) (*Issuer, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &Issuer{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		key:          key,
+		grants:       make(map[string]grant),
+	}, nil
+}
+
+// Handler serves the issuer's endpoints below its URL.
+func (iss *Issuer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", iss.handleDiscovery)
+	mux.HandleFunc("/authorize", iss.handleAuthorize)
+	mux.HandleFunc("/token", iss.handleToken)
+	mux.HandleFunc("/jwks", iss.handleJWKS)
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func tokenError(w http.ResponseWriter, status int, code string) {
+	writeJSON(w, status, map[string]string{"error": code})
+}
+
+func (iss *Issuer) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                iss.URL,
+		"authorization_endpoint":                iss.URL + "/authorize",
+		"token_endpoint":                        iss.URL + "/token",
+		"jwks_uri":                              iss.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"ES256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post"},
+	})
+}
+
+func (iss *Issuer) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	q := r.Form
+	if q.Get("client_id") != iss.ClientID || q.Get("response_type") != "code" ||
+		q.Get("redirect_uri") == "" || q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		http.Error(w, "unknown client or unsupported request", http.StatusBadRequest)
+		return
+	}
+
+	// The form posts back to this URL, query and all.
+	if r.Method != http.MethodPost {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = signInPage.Execute(w, map[string]string{"ClientID": iss.ClientID})
+		return
+	}
+
+	code := rand.Text()
+	iss.mu.Lock()
+	iss.grants[code] = grant{
+		clientID:    iss.ClientID,
+		redirectURI: q.Get("redirect_uri"),
+		challenge:   q.Get("code_challenge"),
+		nonce:       q.Get("nonce"),
+		email:       strings.TrimSpace(q.Get("email")),
+		verified:    q.Get("email_verified") != "",
+		name:        strings.TrimSpace(q.Get("name")),
+		expires:     time.Now().Add(time.Minute),
+	}
+	iss.mu.Unlock()
+
+	back, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, "bad redirect_uri", http.StatusBadRequest)
+		return
+	}
+	bq := back.Query()
+	bq.Set("code", code)
+	bq.Set("state", q.Get("state"))
+	back.RawQuery = bq.Encode()
+	http.Redirect(w, r, back.String(), http.StatusSeeOther)
+}
+
+func (iss *Issuer) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil {
+		tokenError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+
+	id, secret, ok := r.BasicAuth()
+	if ok {
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if id != iss.ClientID || secret != iss.ClientSecret {
+		tokenError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	iss.mu.Lock()
+	g, ok := iss.grants[code]
+	delete(iss.grants, code)
+	iss.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || time.Now().After(g.expires) || r.PostForm.Get("grant_type") != "authorization_code" ||
+		r.PostForm.Get("redirect_uri") != g.redirectURI ||
+		base64.RawURLEncoding.EncodeToString(verifier[:]) != g.challenge {
+		tokenError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	claims := map[string]any{
+		"iss":            iss.URL,
+		"sub":            "mock:" + strings.ToLower(g.email),
+		"aud":            g.clientID,
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          g.nonce,
+		"email":          g.email,
+		"email_verified": g.verified,
+		"name":           g.name,
+	}
+	if iss.EditClaims != nil {
+		iss.EditClaims(claims)
+	}
+	idToken, err := iss.sign(claims)
+	if err != nil {
+		tokenError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": rand.Text(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func (iss *Issuer) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	b64 := base64.RawURLEncoding
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "EC",
+			"crv": "P-256",
+			"kid": "mock",
+			"use": "sig",
+			"alg": "ES256",
+			"x":   b64.EncodeToString(iss.key.PublicKey.X.FillBytes(make([]byte, 32))),
+			"y":   b64.EncodeToString(iss.key.PublicKey.Y.FillBytes(make([]byte, 32))),
+		}},
+	})
+}
+
+// sign makes an ES256 JWS, whose signature is the raw r and s.
+func (iss *Issuer) sign(claims map[string]any) (string, error) {
+	b64 := base64.RawURLEncoding
+	header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": "mock", "typ": "JWT"})
+	body, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := b64.EncodeToString(header) + "." + b64.EncodeToString(body)
+
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, iss.key, digest[:])
+	if err != nil {
+		return "", err
+	}
+	sig := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	return signed + "." + b64.EncodeToString(sig), nil
+}
@@ -0,0 +1,192 @@
+package proxies
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// pdfDoc is just enough of a PDF writer for proxy sheets: pages with
+// vector content, JPEG images passed through as-is, and the standard
+// Helvetica fonts, so no font files need to be embedded.
+type pdfDoc struct {
+	width, height float64 // page size in points
+	objects       [][]byte
+	pages         []int
+	images        []int
+}
+
+// Font resource names used in content streams.
+const (
+	fontRegular = "F1"
+	fontBold    = "F2"
+	fontItalic  = "F3"
+)
+
+func newPDF(width, height float64) *pdfDoc {
+	d := &pdfDoc{width: width, height: height}
+	// Objects 1 and 2 are the catalog and page tree, filled in by write.
+	d.objects = [][]byte{nil, nil}
+	d.add([]byte("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>"))
+	d.add([]byte("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>"))
+	d.add([]byte("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Oblique /Encoding /WinAnsiEncoding >>"))
+	return d
+}
+
+// add stores an object and returns its number.
+func (d *pdfDoc) add(obj []byte) int {
+	d.objects = append(d.objects, obj)
+	return len(d.objects)
+}
+
+func (d *pdfDoc) stream(dict string, data []byte) int {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<< %s /Length %d >>\nstream\n", dict, len(data))
+	b.Write(data)
+	b.WriteString("\nendstream")
+	return d.add(b.Bytes())
+}
+
+// addJPEG embeds a JPEG and returns its index for drawImage.
+func (d *pdfDoc) addJPEG(data []byte, width, height int, colorSpace string) int {
+	obj := d.stream(fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /%s /BitsPerComponent 8 /Filter /DCTDecode",
+		width, height, colorSpace), data)
+	d.images = append(d.images, obj)
+	return len(d.images) - 1
+}
+
+// addPage appends a page drawn by the given content stream.
+func (d *pdfDoc) addPage(content []byte) {
+	d.pages = append(d.pages, d.stream("", content))
+}
+
+func (d *pdfDoc) write(w io.Writer) error {
+	var xobjects strings.Builder
+	for i, obj := range d.images {
+		fmt.Fprintf(&xobjects, " /Im%d %d 0 R", i, obj)
+	}
+	resources := fmt.Sprintf("<< /Font << /%s 3 0 R /%s 4 0 R /%s 5 0 R >> /XObject <<%s >> >>",
+		fontRegular, fontBold, fontItalic, xobjects.String())
+
+	var kids strings.Builder
+	for _, content := range d.pages {
+		page := d.add([]byte(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources %s /Contents %d 0 R >>",
+			d.width, d.height, resources, content)))
+		fmt.Fprintf(&kids, " %d 0 R", page)
+	}
+	d.objects[0] = []byte("<< /Type /Catalog /Pages 2 0 R >>")
+	d.objects[1] = []byte(fmt.Sprintf("<< /Type /Pages /Kids [%s ] /Count %d >>", kids.String(), len(d.pages)))
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(d.objects))
+	for i, obj := range d.objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n", i+1)
+		b.Write(obj)
+		b.WriteString("\nendobj\n")
+	}
+
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(d.objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(d.objects)+1, xref)
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// canvas builds one page's content stream. Coordinates are in points from
+// the bottom-left corner, as in PDF.
+type canvas struct {
+	b bytes.Buffer
+}
+
+func (c *canvas) drawImage(img int, x, y, w, h float64) {
+	fmt.Fprintf(&c.b, "q %.2f 0 0 %.2f %.2f %.2f cm /Im%d Do Q\n", w, h, x, y, img)
+}
+
+func (c *canvas) rect(x, y, w, h, lineWidth, gray float64) {
+	fmt.Fprintf(&c.b, "q %.2f w %.2f G %.2f %.2f %.2f %.2f re S Q\n", lineWidth, gray, x, y, w, h)
+}
+
+func (c *canvas) line(x1, y1, x2, y2, lineWidth, gray float64) {
+	fmt.Fprintf(&c.b, "q %.2f w %.2f G %.2f %.2f m %.2f %.2f l S Q\n", lineWidth, gray, x1, y1, x2, y2)
+}
+
+func (c *canvas) text(font string, size, x, y float64, s string) {
+	fmt.Fprintf(&c.b, "BT /%s %.2f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, y, pdfString(s))
+}
+
+// pdfString encodes s as WinAnsi and escapes it for a literal string.
+func pdfString(s string) string {
+	var b strings.Builder
+	for _, c := range winAnsi(s) {
+		switch c {
+		case '(', ')', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// winAnsiExtra maps the non-Latin-1 characters card text uses to their
+// WinAnsi codes.
+var winAnsiExtra = map[rune]byte{
+	'—': 0x97, '–': 0x96, '•': 0x95, '…': 0x85,
+	'‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94,
+	'−': '-',
+}
+
+func winAnsi(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r >= 0x20 && r < 0x7f, r >= 0xa0 && r <= 0xff:
+			out = append(out, byte(r))
+		case winAnsiExtra[r] != 0:
+			out = append(out, winAnsiExtra[r])
+		default:
+			out = append(out, '?')
+		}
+	}
+	return out
+}
+
+// helveticaWidths are the glyph widths of Helvetica for characters 32-126,
+// in thousandths of the font size.
+var helveticaWidths = [...]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// textWidth measures s in points. Bold is close enough to Helvetica's
+// widths scaled up slightly for wrapping purposes.
+func textWidth(font string, size float64, s string) float64 {
+	total := 0
+	for _, c := range winAnsi(s) {
+		switch {
+		case c >= 32 && c <= 126:
+			total += helveticaWidths[c-32]
+		case c == 0x97:
+			total += 1000
+		default:
+			total += 556
+		}
+	}
+	w := float64(total) * size / 1000
+	if font == fontBold {
+		w *= 1.06
+	}
+	return w
+}
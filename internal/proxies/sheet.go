@@ -0,0 +1,219 @@
+package proxies
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"strings"
+)
+
+// Cards are printed at true size, three by three per page.
+const (
+	cardWidthMM  = 63
+	cardHeightMM = 88
+	perRow       = 3
+	perPage      = perRow * perRow
+
+	cutMarkMM = 4
+)
+
+// Paper is a page size in millimetres.
+type Paper struct {
+	Name   string
+	Width  float64
+	Height float64
+}
+
+var (
+	A4     = Paper{Name: "a4", Width: 210, Height: 297}
+	Letter = Paper{Name: "letter", Width: 215.9, Height: 279.4}
+)
+
+// PaperByName returns the named paper size, defaulting to A4.
+func PaperByName(name string) Paper {
+	if strings.EqualFold(name, Letter.Name) {
+		return Letter
+	}
+	return A4
+}
+
+// Face is one card face to print. Image, when set, must be a JPEG; faces
+// without a usable image are drawn as text. Faces sharing an ImageKey
+// share one embedded image.
+type Face struct {
+	Name       string
+	ManaCost   string
+	TypeLine   string
+	OracleText string
+	ImageKey   string
+	Image      []byte
+}
+
+// Render writes a PDF with the faces laid out in 3x3 grids with cut marks.
+func Render(w io.Writer, faces []Face, paper Paper) error {
+	doc := newPDF(mm(paper.Width), mm(paper.Height))
+	embedded := map[string]int{}
+
+	cardW, cardH := mm(cardWidthMM), mm(cardHeightMM)
+	left := (mm(paper.Width) - perRow*cardW) / 2
+	bottom := (mm(paper.Height) - perRow*cardH) / 2
+
+	for start := 0; start < len(faces) || start == 0; start += perPage {
+		var c canvas
+		end := min(start+perPage, len(faces))
+		for i, f := range faces[start:end] {
+			col, row := i%perRow, i/perRow
+			x := left + float64(col)*cardW
+			y := bottom + float64(perRow-1-row)*cardH
+
+			img, ok := embedImage(doc, embedded, f)
+			if ok {
+				c.drawImage(img, x, y, cardW, cardH)
+			} else {
+				drawTextCard(&c, f, x, y, cardW, cardH)
+			}
+		}
+		drawCutMarks(&c, left, bottom, cardW, cardH)
+		doc.addPage(c.b.Bytes())
+
+		if len(faces) == 0 {
+			break
+		}
+	}
+
+	return doc.write(w)
+}
+
+// embedImage adds the face's JPEG to the document once and reports whether
+// it can be drawn.
+func embedImage(doc *pdfDoc, embedded map[string]int, f Face) (int, bool) {
+	if len(f.Image) == 0 {
+		return 0, false
+	}
+	if img, ok := embedded[f.ImageKey]; ok && f.ImageKey != "" {
+		return img, true
+	}
+
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(f.Image))
+	if err != nil {
+		return 0, false
+	}
+	var colorSpace string
+	switch cfg.ColorModel {
+	case color.GrayModel:
+		colorSpace = "DeviceGray"
+	case color.YCbCrModel, color.RGBAModel:
+		colorSpace = "DeviceRGB"
+	default:
+		// CMYK JPEGs need an inverted decode array in PDF; rare enough
+		// for card scans to fall back to text.
+		return 0, false
+	}
+
+	img := doc.addJPEG(f.Image, cfg.Width, cfg.Height, colorSpace)
+	if f.ImageKey != "" {
+		embedded[f.ImageKey] = img
+	}
+	return img, true
+}
+
+// drawTextCard draws a plain proxy with the card's name, cost, type line
+// and rules text, shrinking the rules text until it fits.
+func drawTextCard(c *canvas, f Face, x, y, w, h float64) {
+	pad := mm(3)
+	inner := w - 2*pad
+	top := y + h - pad
+
+	c.rect(x+mm(1), y+mm(1), w-mm(2), h-mm(2), 0.6, 0.2)
+
+	costSize := 8.0
+	costW := textWidth(fontRegular, costSize, f.ManaCost)
+	nameSize := 9.0
+	for nameSize > 5 && textWidth(fontBold, nameSize, f.Name)+costW+mm(2) > inner {
+		nameSize -= 0.5
+	}
+	c.text(fontBold, nameSize, x+pad, top-nameSize, f.Name)
+	if f.ManaCost != "" {
+		c.text(fontRegular, costSize, x+w-pad-costW, top-nameSize, f.ManaCost)
+	}
+	top -= nameSize + mm(1.5)
+	c.line(x+pad, top, x+w-pad, top, 0.4, 0.5)
+
+	typeSize := 7.0
+	for typeSize > 5 && textWidth(fontItalic, typeSize, f.TypeLine) > inner {
+		typeSize -= 0.5
+	}
+	top -= typeSize + mm(1)
+	c.text(fontItalic, typeSize, x+pad, top, f.TypeLine)
+	top -= mm(1.5)
+	c.line(x+pad, top, x+w-pad, top, 0.4, 0.5)
+	top -= mm(1)
+
+	footer := y + mm(5)
+	size := 7.5
+	var lines []string
+	for ; size >= 4.5; size -= 0.5 {
+		lines = wrap(fontRegular, size, inner, f.OracleText)
+		if float64(len(lines))*size*1.2 <= top-footer {
+			break
+		}
+	}
+	for _, line := range lines {
+		top -= size * 1.2
+		if top < footer {
+			break
+		}
+		c.text(fontRegular, size, x+pad, top, line)
+	}
+
+	c.text(fontRegular, 5, x+pad, y+mm(2.5), "Playtest proxy")
+}
+
+// drawCutMarks draws short guides outside the grid at every card edge.
+func drawCutMarks(c *canvas, left, bottom, cardW, cardH float64) {
+	mark := mm(cutMarkMM)
+	right := left + perRow*cardW
+	top := bottom + perRow*cardH
+	for i := 0; i <= perRow; i++ {
+		x := left + float64(i)*cardW
+		y := bottom + float64(i)*cardH
+		c.line(x, top+mm(1), x, top+mm(1)+mark, 0.3, 0)
+		c.line(x, bottom-mm(1), x, bottom-mm(1)-mark, 0.3, 0)
+		c.line(left-mm(1), y, left-mm(1)-mark, y, 0.3, 0)
+		c.line(right+mm(1), y, right+mm(1)+mark, y, 0.3, 0)
+	}
+}
+
+// wrap breaks text into lines no wider than width, keeping its own line
+// breaks.
+func wrap(font string, size, width float64, text string) []string {
+	var out []string
+	for _, para := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(para) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if line != "" && textWidth(font, size, candidate) > width {
+				out = append(out, line)
+				candidate = word
+			}
+			line = candidate
+		}
+		out = append(out, line)
+	}
+	return out
+}
+
+func mm(v float64) float64 {
+	return v * 72 / 25.4
+}
+
+// isJPEG reports whether data decodes as a JPEG header.
+func isJPEG(data []byte) bool {
+	_, format, err := image.DecodeConfig(bytes.NewReader(data))
+	return err == nil && format == "jpeg"
+}
@@ -0,0 +1,485 @@
+// Package qr encodes short text, such as otpauth:// URIs, as QR codes. It
+// supports byte mode at error correction level M in versions 1 to 15
+// (up to 412 bytes), which is all the site needs.
+package qr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrTooLong = errors.New("qr: text too long")
+
+// Code is an encoded QR symbol, Size modules square, without the quiet zone.
+type Code struct {
+	Size    int
+	modules [][]bool
+}
+
+// Dark reports whether the module at column x, row y is dark.
+func (c *Code) Dark(x, y int) bool {
+	return c.modules[y][x]
+}
+
+// blockSpec is the block structure of one version at level M: ecLen error
+// correction codewords per block, and blocks of short then short+1 data
+// codewords.
+type blockSpec struct {
+	ecLen       int
+	shortBlocks int
+	short       int
+	longBlocks  int
+}
+
+func (b blockSpec) dataLen() int {
+	return b.shortBlocks*b.short + b.longBlocks*(b.short+1)
+}
+
+// Level M blocks for versions 1-15, from ISO/IEC 18004 table 9.
+var specs = [...]blockSpec{
+	1:  {10, 1, 16, 0},
+	2:  {16, 1, 28, 0},
+	3:  {26, 1, 44, 0},
+	4:  {18, 2, 32, 0},
+	5:  {24, 2, 43, 0},
+	6:  {16, 4, 27, 0},
+	7:  {18, 4, 31, 0},
+	8:  {22, 2, 38, 2},
+	9:  {22, 3, 36, 2},
+	10: {26, 4, 43, 1},
+	11: {30, 1, 50, 4},
+	12: {22, 6, 36, 2},
+	13: {22, 8, 37, 1},
+	14: {24, 4, 40, 5},
+	15: {24, 5, 41, 5},
+}
+
+// Alignment pattern centers for versions 2-15.
+var alignment = [...][]int{
+	2:  {6, 18},
+	3:  {6, 22},
+	4:  {6, 26},
+	5:  {6, 30},
+	6:  {6, 34},
+	7:  {6, 22, 38},
+	8:  {6, 24, 42},
+	9:  {6, 26, 46},
+	10: {6, 28, 50},
+	11: {6, 30, 54},
+	12: {6, 32, 58},
+	13: {6, 34, 62},
+	14: {6, 26, 46, 66},
+	15: {6, 26, 48, 70},
+}
+
+// Encode encodes text in the smallest version that holds it.
+func Encode(text string) (*Code, error) {
+	for v := 1; v < len(specs); v++ {
+		if len(text) <= capacity(v) {
+			return encode(v, []byte(text)), nil
+		}
+	}
+	return nil, ErrTooLong
+}
+
+// capacity is how many bytes version v holds in byte mode.
+func capacity(v int) int {
+	return (specs[v].dataLen()*8 - 4 - countBits(v)) / 8
+}
+
+func countBits(v int) int {
+	if v < 10 {
+		return 8
+	}
+	return 16
+}
+
+func encode(v int, data []byte) *Code {
+	spec := specs[v]
+
+	// Mode indicator, length, data, terminator and padding.
+	var bits bitWriter
+	bits.write(0b0100, 4)
+	bits.write(len(data), countBits(v))
+	for _, b := range data {
+		bits.write(int(b), 8)
+	}
+	capBits := spec.dataLen() * 8
+	bits.write(0, min(4, capBits-bits.n))
+	bits.write(0, (8-bits.n%8)%8)
+	for pad := 0xEC; bits.n < capBits; pad ^= 0xEC ^ 0x11 {
+		bits.write(pad, 8)
+	}
+
+	c := newCode(v)
+	c.place(interleave(bits.bytes, spec))
+	c.applyBestMask()
+	return &c.Code
+}
+
+// interleave splits the data into blocks, adds each block's error
+// correction and interleaves the lot.
+func interleave(data []byte, spec blockSpec) []byte {
+	divisor := rsDivisor(spec.ecLen)
+	var blocks, ecs [][]byte
+	for i := 0; i < spec.shortBlocks+spec.longBlocks; i++ {
+		n := spec.short
+		if i >= spec.shortBlocks {
+			n++
+		}
+		blocks = append(blocks, data[:n])
+		ecs = append(ecs, rsRemainder(data[:n], divisor))
+		data = data[n:]
+	}
+
+	var out []byte
+	for i := 0; i <= spec.short; i++ {
+		for _, b := range blocks {
+			if i < len(b) {
+				out = append(out, b[i])
+			}
+		}
+	}
+	for i := 0; i < spec.ecLen; i++ {
+		for _, ec := range ecs {
+			out = append(out, ec[i])
+		}
+	}
+	return out
+}
+
+type bitWriter struct {
+	bytes []byte
+	n     int
+}
+
+func (w *bitWriter) write(val, length int) {
+	for i := length - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.bytes = append(w.bytes, 0)
+		}
+		if val>>i&1 == 1 {
+			w.bytes[w.n/8] |= 0x80 >> (w.n % 8)
+		}
+		w.n++
+	}
+}
+
+// code under construction; function modules are reserved so data and
+// masking skip them.
+type code struct {
+	Code
+	version  int
+	function [][]bool
+}
+
+func newCode(v int) *code {
+	size := 17 + 4*v
+	c := &code{Code: Code{Size: size}, version: v}
+	c.modules = make([][]bool, size)
+	c.function = make([][]bool, size)
+	for i := range c.modules {
+		c.modules[i] = make([]bool, size)
+		c.function[i] = make([]bool, size)
+	}
+
+	for i := 0; i < size; i++ {
+		c.set(6, i, i%2 == 0)
+		c.set(i, 6, i%2 == 0)
+	}
+	c.finder(3, 3)
+	c.finder(size-4, 3)
+	c.finder(3, size-4)
+
+	if v > 1 {
+		pos := alignment[v]
+		last := len(pos) - 1
+		for i, y := range pos {
+			for j, x := range pos {
+				if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+					continue
+				}
+				c.alignment(x, y)
+			}
+		}
+	}
+
+	c.format(0) // reserve; redrawn once the mask is chosen
+	c.versionInfo()
+	return c
+}
+
+func (c *code) set(x, y int, dark bool) {
+	c.modules[y][x] = dark
+	c.function[y][x] = true
+}
+
+func (c *code) finder(cx, cy int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			x, y := cx+dx, cy+dy
+			if x < 0 || y < 0 || x >= c.Size || y >= c.Size {
+				continue
+			}
+			d := max(abs(dx), abs(dy))
+			c.set(x, y, d != 2 && d != 4)
+		}
+	}
+}
+
+func (c *code) alignment(cx, cy int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			c.set(cx+dx, cy+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// format draws both copies of the format information for level M and the
+// mask, plus the dark module.
+func (c *code) format(mask int) {
+	data := 0b00<<3 | mask // level M
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return bits>>i&1 == 1 }
+
+	for i := 0; i <= 5; i++ {
+		c.set(8, i, bit(i))
+	}
+	c.set(8, 7, bit(6))
+	c.set(8, 8, bit(7))
+	c.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		c.set(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		c.set(c.Size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		c.set(8, c.Size-15+i, bit(i))
+	}
+	c.set(8, c.Size-8, true)
+}
+
+func (c *code) versionInfo() {
+	if c.version < 7 {
+		return
+	}
+	rem := c.version
+	for i := 0; i < 12; i++ {
+		rem = rem<<1 ^ (rem>>11)*0x1F25
+	}
+	bits := c.version<<12 | rem
+	for i := 0; i < 18; i++ {
+		dark := bits>>i&1 == 1
+		a, b := c.Size-11+i%3, i/3
+		c.set(a, b, dark)
+		c.set(b, a, dark)
+	}
+}
+
+// place writes the codewords in the zigzag order, two columns at a time
+// from the bottom right, skipping the vertical timing pattern. Leftover
+// remainder modules stay light.
+func (c *code) place(data []byte) {
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < c.Size; vert++ {
+			y := vert
+			if upward {
+				y = c.Size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if c.function[y][x] || i >= len(data)*8 {
+					continue
+				}
+				c.modules[y][x] = data[i/8]>>(7-i%8)&1 == 1
+				i++
+			}
+		}
+	}
+}
+
+func maskBit(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+// mask flips the data modules under the pattern; applying it twice undoes it.
+func (c *code) mask(m int) {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.function[y][x] && maskBit(m, x, y) {
+				c.modules[y][x] = !c.modules[y][x]
+			}
+		}
+	}
+}
+
+func (c *code) applyBestMask() {
+	best, bestScore := 0, -1
+	for m := 0; m < 8; m++ {
+		c.mask(m)
+		c.format(m)
+		if score := c.penalty(); bestScore < 0 || score < bestScore {
+			best, bestScore = m, score
+		}
+		c.mask(m)
+	}
+	c.mask(best)
+	c.format(best)
+}
+
+// penalty scores the symbol by the four rules in ISO/IEC 18004 7.8.3;
+// lower is easier to scan.
+func (c *code) penalty() int {
+	score := 0
+	n := c.Size
+	at := func(x, y int, transpose bool) bool {
+		if transpose {
+			return c.modules[x][y]
+		}
+		return c.modules[y][x]
+	}
+
+	for _, t := range []bool{false, true} {
+		for y := 0; y < n; y++ {
+			// Runs of five or more.
+			run := 1
+			for x := 1; x <= n; x++ {
+				if x < n && at(x, y, t) == at(x-1, y, t) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					score += 3 + run - 5
+				}
+				run = 1
+			}
+
+			// Finder-like 1:1:3:1:1 with four light modules on a side.
+			var line strings.Builder
+			for x := 0; x < n; x++ {
+				if at(x, y, t) {
+					line.WriteByte('1')
+				} else {
+					line.WriteByte('0')
+				}
+			}
+			s := "0000" + line.String() + "0000"
+			for i := 0; i+11 <= len(s); i++ {
+				if s[i:i+11] == "10111010000" || s[i:i+11] == "00001011101" {
+					score += 40
+				}
+			}
+		}
+	}
+
+	dark := 0
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			if c.modules[y][x] {
+				dark++
+			}
+			if x < n-1 && y < n-1 {
+				v := c.modules[y][x]
+				if v == c.modules[y][x+1] && v == c.modules[y+1][x] && v == c.modules[y+1][x+1] {
+					score += 3
+				}
+			}
+		}
+	}
+	percent := dark * 100 / (n * n)
+	score += abs(percent-50) / 5 * 10
+	return score
+}
+
+// Reed-Solomon over GF(256) with the QR polynomial x^8+x^4+x^3+x^2+1.
+
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMul(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMul(root, 2)
+	}
+	return result
+}
+
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i := range result {
+			result[i] ^= gfMul(divisor[i], factor)
+		}
+	}
+	return result
+}
+
+func gfMul(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ (z>>7)*0x11D
+		z ^= int(y>>i&1) * int(x)
+	}
+	return byte(z)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// SVG renders the code as a standalone SVG image with a four-module quiet
+// zone, scaled to fill whatever box it is given.
+func (c *Code) SVG() string {
+	var path strings.Builder
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.Dark(x, y) {
+				fmt.Fprintf(&path, "M%d %dh1v1h-1z", x+4, y+4)
+			}
+		}
+	}
+	n := c.Size + 8
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+
+		`<rect width="%d" height="%d" fill="#fff"/><path d="%s" fill="#000"/></svg>`,
+		n, n, n, n, path.String())
+}
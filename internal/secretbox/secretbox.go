@@ -0,0 +1,67 @@
+// Package secretbox encrypts small secrets, such as TOTP keys, before they
+// are stored, so a copy of the database alone doesn't reveal them.
+package secretbox
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+)
+
+var ErrDecrypt = errors.New("secretbox: cannot decrypt")
+
+// Box seals values with AES-256-GCM under a key derived from a
+// configured secret.
+type Box struct {
+	aead cipher.AEAD
+}
+
+// New derives a Box key from secret with HKDF-SHA256. Purpose separates
+// keys drawn from the same secret; boxes with different purposes can't
+// open each other's values.
+func New(secret []byte, purpose string) (*Box, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("secretbox: empty secret")
+	}
+	key, err := hkdf.Key(sha256.New, secret, nil, "manatomb secretbox "+purpose, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Box{aead: aead}, nil
+}
+
+// Seal encrypts plaintext, returning base64 text safe to store.
+func (b *Box) Seal(plaintext []byte) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize(), b.aead.NonceSize()+len(plaintext)+b.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawStdEncoding.EncodeToString(b.aead.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+// Open decrypts a value from Seal. It fails with ErrDecrypt if the value
+// was tampered with or sealed under another key.
+func (b *Box) Open(sealed string) ([]byte, error) {
+	raw, err := base64.RawStdEncoding.DecodeString(sealed)
+	if err != nil || len(raw) < b.aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	nonce, ciphertext := raw[:b.aead.NonceSize()], raw[b.aead.NonceSize():]
+	plaintext, err := b.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
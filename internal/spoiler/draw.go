@@ -0,0 +1,82 @@
+package spoiler
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// fillRect paints r with c, blending when c is translucent.
+func fillRect(dst *image.RGBA, r image.Rectangle, c color.RGBA) {
+	draw.Draw(dst, r, image.NewUniform(c), image.Point{}, draw.Over)
+}
+
+// fillCircle paints a disc of radius r centred on (cx, cy).
+func fillCircle(dst *image.RGBA, cx, cy, r int, c color.RGBA) {
+	for y := -r; y <= r; y++ {
+		for x := -r; x <= r; x++ {
+			if x*x+y*y <= r*r {
+				dst.SetRGBA(cx+x, cy+y, c)
+			}
+		}
+	}
+}
+
+// drawCover scales src to cover r, cropping whichever dimension
+// overflows, with bilinear sampling.
+func drawCover(dst *image.RGBA, r image.Rectangle, src image.Image) {
+	b := src.Bounds()
+	s := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(s, s.Bounds(), src, b.Min, draw.Src)
+
+	sw, sh := float64(b.Dx()), float64(b.Dy())
+	scale := max(float64(r.Dx())/sw, float64(r.Dy())/sh)
+	offX := (sw - float64(r.Dx())/scale) / 2
+	offY := (sh - float64(r.Dy())/scale) / 2
+
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		fy := offY + (float64(y-r.Min.Y)+0.5)/scale - 0.5
+		for x := r.Min.X; x < r.Max.X; x++ {
+			fx := offX + (float64(x-r.Min.X)+0.5)/scale - 0.5
+			dst.SetRGBA(x, y, bilinear(s, fx, fy))
+		}
+	}
+}
+
+func bilinear(s *image.RGBA, fx, fy float64) color.RGBA {
+	w, h := s.Rect.Dx(), s.Rect.Dy()
+	x0 := min(max(int(fx), 0), w-1)
+	y0 := min(max(int(fy), 0), h-1)
+	x1, y1 := min(x0+1, w-1), min(y0+1, h-1)
+	tx := min(max(fx-float64(x0), 0), 1)
+	ty := min(max(fy-float64(y0), 0), 1)
+
+	var out [4]uint8
+	for i := 0; i < 4; i++ {
+		a := float64(s.Pix[s.PixOffset(x0, y0)+i])
+		b := float64(s.Pix[s.PixOffset(x1, y0)+i])
+		c := float64(s.Pix[s.PixOffset(x0, y1)+i])
+		d := float64(s.Pix[s.PixOffset(x1, y1)+i])
+		top := a + (b-a)*tx
+		bottom := c + (d-c)*tx
+		out[i] = uint8(top + (bottom-top)*ty + 0.5)
+	}
+	return color.RGBA{out[0], out[1], out[2], out[3]}
+}
+
+// shadeDown darkens r with c, fading in from transparent at the top to
+// c's full alpha at the bottom.
+func shadeDown(dst *image.RGBA, r image.Rectangle, c color.RGBA) {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		t := float64(y-r.Min.Y+1) / float64(r.Dy())
+		a := uint8(float64(c.A) * t)
+		// Uniform colors are alpha-premultiplied.
+		row := color.RGBA{
+			R: uint8(uint16(c.R) * uint16(a) / 255),
+			G: uint8(uint16(c.G) * uint16(a) / 255),
+			B: uint8(uint16(c.B) * uint16(a) / 255),
+			A: a,
+		}
+		fillRect(dst, image.Rect(r.Min.X, y, r.Max.X, y+1), row)
+	}
+}
@@ -0,0 +1,172 @@
+// Package spoiler draws shareable images of decks: a spoiler grid of every
+// card and an Open Graph preview card for link unfurls.
+package spoiler
+
+import (
+	"image"
+	"image/color"
+	"strconv"
+)
+
+// Sizes of the images drawn here. Tiles match Scryfall's "small" images
+// so they are drawn without resampling.
+const (
+	TileWidth  = 146
+	TileHeight = 204
+
+	OGWidth  = 1200
+	OGHeight = 630
+)
+
+const (
+	gridCols    = 10
+	gridGap     = 6
+	gridPad     = 16
+	gridHeader  = 56
+	gridMinWide = 480
+
+	ogMargin  = 48
+	pipRadius = 22
+)
+
+var (
+	background = color.RGBA{2, 6, 23, 255}      // slate-950
+	surface    = color.RGBA{15, 23, 42, 255}    // slate-900
+	border     = color.RGBA{51, 65, 85, 255}    // slate-700
+	textColor  = color.RGBA{241, 245, 249, 255} // slate-100
+	muted      = color.RGBA{203, 213, 225, 255} // slate-300
+	accent     = color.RGBA{56, 189, 248, 255}  // sky-400
+
+	manaColors = map[rune]color.RGBA{
+		'W': {248, 231, 185, 255},
+		'U': {14, 104, 171, 255},
+		'B': {72, 62, 60, 255},
+		'R': {211, 32, 42, 255},
+		'G': {0, 115, 62, 255},
+		'C': {190, 182, 176, 255},
+	}
+)
+
+// Tile is one card on a spoiler grid. Without an Image the card's name is
+// drawn in its place.
+type Tile struct {
+	Name     string
+	Quantity int
+	Image    image.Image
+}
+
+// Grid lays the cards out ten to a row under a title bar. Cards with more
+// than one copy get a count badge.
+func Grid(title string, tiles []Tile) *image.RGBA {
+	cols := min(gridCols, max(len(tiles), 1))
+	rows := (len(tiles) + cols - 1) / cols
+
+	width := max(2*gridPad+cols*TileWidth+(cols-1)*gridGap, gridMinWide)
+	height := gridHeader + gridPad + rows*TileHeight + max(rows-1, 0)*gridGap
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	fillRect(img, img.Bounds(), background)
+
+	drawText(img, gridPad, (gridHeader-3*glyphHeight)/2+4, fitText(title, 3, width-2*gridPad), 3, textColor)
+
+	for i, t := range tiles {
+		x := gridPad + (i%cols)*(TileWidth+gridGap)
+		y := gridHeader + (i/cols)*(TileHeight+gridGap)
+		r := image.Rect(x, y, x+TileWidth, y+TileHeight)
+
+		if t.Image != nil {
+			drawCover(img, r, t.Image)
+		} else {
+			drawPlaceholder(img, r, t.Name)
+		}
+
+		if t.Quantity > 1 {
+			label := "x" + strconv.Itoa(t.Quantity)
+			bw := textWidth(label, 2) + 12
+			badge := image.Rect(r.Max.X-bw-6, r.Max.Y-30, r.Max.X-6, r.Max.Y-6)
+			fillRect(img, badge, background)
+			drawText(img, badge.Min.X+6, badge.Min.Y+4, label, 2, accent)
+		}
+	}
+	return img
+}
+
+func drawPlaceholder(img *image.RGBA, r image.Rectangle, name string) {
+	fillRect(img, r, border)
+	fillRect(img, r.Inset(2), surface)
+
+	lines := wrapText(name, 2, r.Dx()-16)
+	maxLines := (r.Dy() - 16) / (2*glyphHeight + 6)
+	if len(lines) > maxLines {
+		lines = lines[:maxLines]
+	}
+	for i, line := range lines {
+		drawText(img, r.Min.X+8, r.Min.Y+10+i*(2*glyphHeight+6), line, 2, textColor)
+	}
+}
+
+// Preview is what the Open Graph card shows for a deck. Art is the
+// commander's art crop; without it the card gets a plain background.
+// ColorIdentity is in WUBRG order, "" for colorless.
+type Preview struct {
+	DeckName      string
+	Commander     string
+	ColorIdentity string
+	CardCount     int
+	Art           image.Image
+}
+
+// OpenGraph draws the 1200x630 preview card link unfurls show.
+func OpenGraph(p Preview) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, OGWidth, OGHeight))
+	fillRect(img, img.Bounds(), background)
+
+	if p.Art != nil {
+		drawCover(img, img.Bounds(), p.Art)
+		fillRect(img, image.Rect(0, 0, OGWidth, 110), color.RGBA{0, 0, 0, 110})
+		shadeDown(img, image.Rect(0, 200, OGWidth, OGHeight), color.RGBA{2, 6, 23, 240})
+	} else {
+		fillRect(img, image.Rect(0, 0, 12, OGHeight), accent)
+	}
+
+	drawText(img, ogMargin, 40, "MANA TOMB", 3, accent)
+
+	// Bottom row: color identity pips and the card count.
+	rowTop := OGHeight - ogMargin - 2*pipRadius
+	identity := p.ColorIdentity
+	if identity == "" {
+		identity = "C"
+	}
+	x := ogMargin + pipRadius
+	for _, c := range identity {
+		fill, ok := manaColors[c]
+		if !ok {
+			continue
+		}
+		fillCircle(img, x, rowTop+pipRadius, pipRadius+3, background)
+		fillCircle(img, x, rowTop+pipRadius, pipRadius, fill)
+		x += 2*pipRadius + 12
+	}
+	count := strconv.Itoa(p.CardCount) + " cards"
+	if p.CardCount == 1 {
+		count = "1 card"
+	}
+	drawText(img, x-pipRadius+12, rowTop+pipRadius-2*glyphHeight, count, 4, muted)
+
+	width := OGWidth - 2*ogMargin
+	y := rowTop - 24
+	if p.Commander != "" {
+		y -= 4 * glyphHeight
+		drawText(img, ogMargin, y, fitText(p.Commander, 4, width), 4, muted)
+		y -= 20
+	}
+
+	// The deck name gets the largest size it fits at.
+	scale := 9
+	for scale > 5 && textWidth(p.DeckName, scale) > width {
+		scale--
+	}
+	y -= scale * glyphHeight
+	drawText(img, ogMargin, y, fitText(p.DeckName, scale, width), scale, textColor)
+
+	return img
+}
@@ -0,0 +1,396 @@
+package web
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"manatomb/app/internal/account"
+	"manatomb/app/internal/audit"
+)
+
+// Staff pages live under /admin. Anyone without the role a page needs gets
+// the not found page, so the area doesn't advertise itself.
+
+// adminPageSize is how many users or audit entries a page lists.
+const adminPageSize = 50
+
+// impersonationBlocked is shown when an admin acting as someone tries to
+// change that person's account settings.
+const impersonationBlocked = "Account settings can't be changed while acting as another user."
+
+type adminUsersData struct {
+	Section  string
+	Query    string
+	Users    []account.UserSummary
+	Roles    []string
+	Page     int
+	PrevPage int
+	NextPage int
+}
+
+type adminAuditData struct {
+	Section    string
+	Entries    []audit.Entry
+	TargetType string
+	TargetID   int64
+	Page       int
+	PrevPage   int
+	NextPage   int
+}
+
+// requireAdmin returns the signed-in user if they are an admin, and
+// otherwise renders not found and returns nil.
+func (a *App) requireAdmin(w http.ResponseWriter, r *http.Request) *account.User {
+	user := CurrentUser(r)
+	if user == nil || !user.IsAdmin() {
+		a.RenderNotFound(w, r)
+		return nil
+	}
+	return user
+}
+
+// requireModerator is requireAdmin for pages moderators may use too.
+func (a *App) requireModerator(w http.ResponseWriter, r *http.Request) *account.User {
+	user := CurrentUser(r)
+	if user == nil || !user.CanModerate() {
+		a.RenderNotFound(w, r)
+		return nil
+	}
+	return user
+}
+
+// audit records a staff action. The action has already happened, so a
+// failure to record it is logged rather than shown.
+func (a *App) audit(r *http.Request, actor *account.User, action, targetType string, targetID int64, summary string) {
+	err := audit.Record(r.Context(), a.DB, audit.Entry{
+		ActorID:    actor.ID,
+		ActorName:  actor.DisplayName + " <" + actor.Email + ">",
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Summary:    summary,
+		IP:         a.clientIP(r),
+	})
+	if err != nil {
+		log.Printf("audit record error: %v (%s %s %d: %s)", err, action, targetType, targetID, summary)
+	}
+}
+
+// pageParam reads the 1-based page number from the query string.
+func pageParam(r *http.Request) int {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		return 1
+	}
+	return page
+}
+
+// GET /admin
+// Lists accounts, newest first, optionally narrowed by a search.
+func (a *App) HandleAdminUsers(w http.ResponseWriter, r *http.Request) {
+	user := a.requireAdmin(w, r)
+	if user == nil {
+		return
+	}
+
+	flash := readFlash(w, r)
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	page := pageParam(r)
+
+	users, err := account.SearchUsers(r.Context(), a.DB, query, adminPageSize+1, (page-1)*adminPageSize)
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	data := adminUsersData{Section: "users", Query: query, Roles: account.Roles, Page: page}
+	if page > 1 {
+		data.PrevPage = page - 1
+	}
+	if len(users) > adminPageSize {
+		users = users[:adminPageSize]
+		data.NextPage = page + 1
+	}
+	data.Users = users
+
+	a.Renderer.Render(w, r, "admin_users", TemplateData{
+		CurrentUser: user,
+		Data:        data,
+		Flash:       flash,
+	})
+}
+
+// POST /admin (different actions based on hidden "action" field)
+func (a *App) HandleAdminUsersPost(w http.ResponseWriter, r *http.Request) {
+	user := a.requireAdmin(w, r)
+	if user == nil {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		setFlash(w, "Invalid form submission.")
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	back := "/admin"
+	if q := strings.TrimSpace(r.Form.Get("q")); q != "" {
+		back += "?q=" + url.QueryEscape(q)
+	}
+
+	targetID, _ := strconv.ParseInt(r.Form.Get("user_id"), 10, 64)
+	target, err := account.GetUser(r.Context(), a.DB, targetID)
+	if errors.Is(err, sql.ErrNoRows) {
+		setFlash(w, "That account no longer exists.")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	action := r.Form.Get("action")
+
+	// Admins can't lock themselves out, and must demote another admin
+	// before acting against them.
+	if target.ID == user.ID {
+		setFlash(w, "You can't change your own account from here.")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	if target.IsAdmin() && action != "set_role" {
+		setFlash(w, target.DisplayName+" is an admin. Change their role first.")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	switch action {
+	case "set_role":
+		role := r.Form.Get("role")
+		if !slices.Contains(account.Roles, role) {
+			setFlash(w, "Choose a role.")
+			break
+		}
+		if role == target.Role {
+			break
+		}
+		if err := account.SetUserRole(r.Context(), a.DB, target.ID, role); err != nil {
+			log.Printf("set user role error: %v", err)
+			setFlash(w, "Could not change the role.")
+			break
+		}
+		a.audit(r, user, audit.ActionUserRole, audit.TargetUser, target.ID,
+			"Changed "+target.Email+" from "+target.Role+" to "+role)
+		setFlash(w, target.DisplayName+" is now "+role+".")
+
+	case "disable":
+		if err := account.SetUserDisabled(r.Context(), a.DB, target.ID, true); err != nil {
+			log.Printf("disable user error: %v", err)
+			setFlash(w, "Could not disable the account.")
+			break
+		}
+		a.audit(r, user, audit.ActionUserDisable, audit.TargetUser, target.ID, "Disabled "+target.Email)
+		setFlash(w, target.DisplayName+"'s account is disabled and signed out everywhere.")
+
+	case "enable":
+		if err := account.SetUserDisabled(r.Context(), a.DB, target.ID, false); err != nil {
+			log.Printf("enable user error: %v", err)
+			setFlash(w, "Could not enable the account.")
+			break
+		}
+		a.audit(r, user, audit.ActionUserEnable, audit.TargetUser, target.ID, "Enabled "+target.Email)
+		setFlash(w, target.DisplayName+"'s account is enabled again.")
+
+	case "delete":
+		if !strings.EqualFold(strings.TrimSpace(r.Form.Get("confirm_email")), target.Email) {
+			setFlash(w, "Type the account's email address to confirm deleting it.")
+			break
+		}
+		if err := account.DeleteAccount(r.Context(), a.DB, target.ID); err != nil {
+			log.Printf("delete user error: %v", err)
+			setFlash(w, "Could not delete the account.")
+			break
+		}
+		a.audit(r, user, audit.ActionUserDelete, audit.TargetUser, target.ID,
+			"Deleted "+target.Email+" ("+target.DisplayName+")")
+		setFlash(w, target.Email+" was deleted.")
+
+	case "impersonate":
+		a.startImpersonation(w, r, user, target, back)
+		return
+
+	default:
+		setFlash(w, "Unknown action.")
+	}
+
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// startImpersonation swaps the admin's session for one acting as target.
+// The admin's own session ends; stopping signs them back in.
+func (a *App) startImpersonation(w http.ResponseWriter, r *http.Request, admin, target *account.User, back string) {
+	if target.CanModerate() {
+		setFlash(w, "Staff accounts can't be impersonated.")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	if target.Disabled {
+		setFlash(w, "Enable the account before acting as it.")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	sess, err := account.CreateImpersonationSession(r.Context(), a.DB, admin.ID, target.ID, r.UserAgent(), a.clientIP(r))
+	if err != nil {
+		log.Printf("create impersonation session error: %v", err)
+		setFlash(w, "Could not act as that user.")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	if own := CurrentSession(r); own != nil {
+		if err := account.DeleteSession(r.Context(), a.DB, own.ID); err != nil {
+			log.Printf("delete session error: %v", err)
+		}
+	}
+	setSessionCookie(w, sess)
+
+	a.audit(r, admin, audit.ActionImpersonateStart, audit.TargetUser, target.ID, "Started acting as "+target.Email)
+	setFlash(w, "You're now acting as "+target.DisplayName+" for up to "+waitText(account.ImpersonationTTL)+".")
+	http.Redirect(w, r, "/decks", http.StatusSeeOther)
+}
+
+// POST /admin/impersonate/stop
+// Ends an impersonation session and signs the admin behind it back in as
+// themselves.
+func (a *App) HandleStopImpersonating(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sess := CurrentSession(r)
+	if sess == nil || sess.ImpersonatorID == 0 {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	target := CurrentUser(r)
+
+	if err := account.DeleteSession(r.Context(), a.DB, sess.ID); err != nil {
+		log.Printf("delete session error: %v", err)
+	}
+
+	admin, err := account.GetUser(r.Context(), a.DB, sess.ImpersonatorID)
+	if err != nil || !admin.IsAdmin() || admin.Disabled {
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("get impersonator error: %v", err)
+		}
+		a.ClearSessionCookie(w, r)
+		setFlash(w, "Please log in again.")
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	own, err := account.CreateSession(r.Context(), a.DB, admin.ID, r.UserAgent(), a.clientIP(r))
+	if err != nil {
+		log.Printf("create session error: %v", err)
+		a.ClearSessionCookie(w, r)
+		setFlash(w, "Please log in again.")
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	setSessionCookie(w, own)
+
+	a.audit(r, admin, audit.ActionImpersonateStop, audit.TargetUser, target.ID, "Stopped acting as "+target.Email)
+	setFlash(w, "You're back as yourself.")
+	http.Redirect(w, r, "/admin?q="+url.QueryEscape(target.Email), http.StatusSeeOther)
+}
+
+// WithImpersonationMiddleware keeps an admin acting as another user out of
+// that user's account settings, and records every change they make in the
+// audit log. It must run inside WithUserMiddleware, and inside the CSRF
+// check so rejected requests aren't recorded.
+func (a *App) WithImpersonationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sess := CurrentSession(r)
+		if sess == nil || sess.ImpersonatorID == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.URL.Path == "/admin/impersonate/stop" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if strings.HasPrefix(r.URL.Path, "/settings") {
+			if strings.HasPrefix(r.URL.Path, "/settings/passkeys") {
+				writeJSONError(w, http.StatusForbidden, impersonationBlocked)
+				return
+			}
+			setFlash(w, impersonationBlocked)
+			http.Redirect(w, r, "/settings", http.StatusSeeOther)
+			return
+		}
+
+		admin, err := account.GetUser(r.Context(), a.DB, sess.ImpersonatorID)
+		if err != nil {
+			a.RenderServerError(w, r, err)
+			return
+		}
+		target := CurrentUser(r)
+		a.audit(r, admin, audit.ActionImpersonateRequest, audit.TargetUser, target.ID,
+			r.Method+" "+r.URL.Path+" as "+target.Email)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// GET /admin/audit
+// The log of staff actions, newest first. ?type=user&id=5 narrows it to
+// entries about one target.
+func (a *App) HandleAdminAudit(w http.ResponseWriter, r *http.Request) {
+	user := a.requireAdmin(w, r)
+	if user == nil {
+		return
+	}
+
+	targetType := r.URL.Query().Get("type")
+	targetID, _ := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if targetID == 0 {
+		targetType = ""
+	}
+	page := pageParam(r)
+
+	entries, err := audit.List(r.Context(), a.DB, targetType, targetID, adminPageSize+1, (page-1)*adminPageSize)
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	data := adminAuditData{Section: "audit", TargetType: targetType, TargetID: targetID, Page: page}
+	if page > 1 {
+		data.PrevPage = page - 1
+	}
+	if len(entries) > adminPageSize {
+		entries = entries[:adminPageSize]
+		data.NextPage = page + 1
+	}
+	data.Entries = entries
+
+	a.Renderer.Render(w, r, "admin_audit", TemplateData{
+		CurrentUser: user,
+		Data:        data,
+	})
+}
@@ -0,0 +1,142 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"manatomb/app/internal/account"
+)
+
+const ctxKeyAPIToken ctxKey = "apiToken"
+
+// apiScopeChoice is a scope offered for new tokens, with what it allows.
+type apiScopeChoice struct {
+	Scope       string
+	Description string
+}
+
+var apiScopeChoices = []apiScopeChoice{
+	{account.ScopeDecksRead, "List and view your decks"},
+	{account.ScopeDecksWrite, "Create, edit and delete decks and their cards"},
+	{account.ScopeCollectionRead, "View your collection and wishlist"},
+	{account.ScopeCollectionWrite, "Change your collection and wishlist"},
+}
+
+// apiTokenLifetimes are the expiry choices settings offers, in days.
+var apiTokenLifetimes = []int{7, 30, 90, 365}
+
+const defaultAPITokenDays = 30
+
+// apiCaller is a request authenticated with an API token rather than a
+// session.
+type apiCaller struct {
+	user  *account.User
+	token *account.APIToken
+}
+
+type apiTokenCreatedData struct {
+	Name   string
+	Token  string
+	Scopes []string
+
+	// ExampleURL is a page the token can read, for a sample request.
+	ExampleURL string
+}
+
+// bearerToken returns the token in an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+func apiCallerFrom(r *http.Request) *apiCaller {
+	c, _ := r.Context().Value(ctxKeyAPIToken).(*apiCaller)
+	return c
+}
+
+// writeBearerError rejects a request whose API token isn't valid, the way
+// RFC 6750 describes, so scripts fail loudly rather than land on the login
+// page.
+func writeBearerError(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	http.Error(w, "Invalid or expired API token.", http.StatusUnauthorized)
+}
+
+// Scoped opens h to API tokens granted scope. Requests signed in with a
+// session pass straight through. Token requests are only signed in on
+// routes wrapped here; anywhere else they are treated as signed out.
+func (a *App) Scoped(scope string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		caller := apiCallerFrom(r)
+		if caller == nil {
+			h(w, r)
+			return
+		}
+		if !caller.token.HasScope(scope) {
+			http.Error(w, "This API token doesn't have the "+scope+" scope.", http.StatusForbidden)
+			return
+		}
+		h(w, r.WithContext(context.WithValue(r.Context(), ctxKeyUser, caller.user)))
+	}
+}
+
+// createAPIToken handles the settings form for a new token. The secret is
+// shown on a page of its own, once, and never stored.
+func (a *App) createAPIToken(w http.ResponseWriter, r *http.Request, user *account.User) {
+	name := strings.TrimSpace(r.Form.Get("name"))
+	if name == "" {
+		setFlash(w, "Give the token a name, such as what will use it.")
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+		return
+	}
+
+	days := defaultAPITokenDays
+	for _, d := range apiTokenLifetimes {
+		if r.Form.Get("expires_days") == strconv.Itoa(d) {
+			days = d
+		}
+	}
+
+	scopes := r.Form["scopes"]
+	token, err := account.CreateAPIToken(r.Context(), a.DB, user.ID, name, scopes, time.Duration(days)*24*time.Hour)
+	switch {
+	case errors.Is(err, account.ErrInvalidScope):
+		setFlash(w, "Choose at least one thing the token may do.")
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+		return
+	case errors.Is(err, account.ErrTooManyAPITokens):
+		setFlash(w, "You have too many API tokens. Revoke one you no longer use first.")
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+		return
+	case err != nil:
+		log.Printf("create API token error: %v", err)
+		setFlash(w, "Could not create the token.")
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+		return
+	}
+
+	created := apiTokenCreatedData{Name: name, Token: token, Scopes: scopes}
+	switch {
+	case slices.Contains(scopes, account.ScopeDecksRead):
+		created.ExampleURL = a.absoluteURL(r, "/decks")
+	case slices.Contains(scopes, account.ScopeCollectionRead):
+		created.ExampleURL = a.absoluteURL(r, "/collection")
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	data := TemplateData{
+		CurrentUser: user,
+		Data:        created,
+	}
+	a.Renderer.Render(w, r, "api_token_created", data)
+}
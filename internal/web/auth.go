@@ -4,34 +4,69 @@ import (
 	"bytes"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"runtime/debug"
+	"strconv"
 	"strings"
 	"time"
 
 	"manatomb/app/internal/account"
+	"manatomb/app/internal/boosters"
 	"manatomb/app/internal/decks"
+	"manatomb/app/internal/draft"
+	"manatomb/app/internal/imgcache"
+	"manatomb/app/internal/live"
+	"manatomb/app/internal/mail"
+	"manatomb/app/internal/oidc"
+	"manatomb/app/internal/secretbox"
 
 	"github.com/google/uuid"
 )
 
 const ctxKeyUser ctxKey = "currentUser"
+const ctxKeySession ctxKey = "currentSession"
 const sessionCookieName = "mt_session"
 
 type ctxKey string
 
 type notFoundRecorder struct {
-	rw     http.ResponseWriter
-	header http.Header
-	status int
-	buf    bytes.Buffer
+	rw        http.ResponseWriter
+	header    http.Header
+	status    int
+	buf       bytes.Buffer
+	streaming bool
 }
 
 type App struct {
 	DB       *sql.DB
 	Renderer *Renderer
+	Brackets *decks.BracketLists
+	Banned   decks.BanList
+	Tables   *live.Hub
+	Drafts   *draft.Hub
+	Boosters []boosters.Template
+	Images   *imgcache.Cache
+	BaseURL  string
+
+	// TrustProxy takes the client address from X-Forwarded-For, as set by
+	// the reverse proxy in front of the app.
+	TrustProxy bool
+
+	// SessionSecret keys the HMACs behind CSRF tokens.
+	SessionSecret []byte
+
+	Mailer mail.Mailer
+
+	// Secrets encrypts secrets stored for users, such as TOTP keys.
+	Secrets *secretbox.Box
+
+	// OIDC is the external identity provider users can sign in with, or
+	// nil when none is configured.
+	OIDC *oidc.Provider
 }
 
 type TemplateData struct {
@@ -39,22 +74,70 @@ type TemplateData struct {
 	Data        any
 	Flash       string
 	Error       string
+
+	// OpenGraph fills the og: meta tags link unfurls read; nil for pages
+	// without a preview.
+	OpenGraph *OpenGraph
+
+	// CSRFToken is set by the Renderer; forms send it back with csrfField.
+	CSRFToken string
+
+	// Impersonating is set by the Renderer when an admin is acting as
+	// CurrentUser, to show the banner saying so.
+	Impersonating bool
+}
+
+// OpenGraph describes a page's link preview. URL and Image are absolute.
+type OpenGraph struct {
+	Title       string
+	Description string
+	URL         string
+	Image       string
 }
 
 func (a *App) withCurrentUser(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var currentUser *account.User
+		var currentSession *account.Session
 
 		cookie, err := r.Cookie(sessionCookieName)
 		if err == nil && cookie.Value != "" {
 			if sid, err := uuid.Parse(cookie.Value); err == nil {
-				if u, err := account.GetUserBySession(r.Context(), a.DB, sid); err == nil {
-					currentUser = u
+				if u, s, err := account.GetUserBySession(r.Context(), a.DB, sid); err == nil {
+					currentUser, currentSession = u, s
 				}
 			}
 		}
 
+		// Activity slides the session's expiry forward, and the cookie's
+		// with it.
+		if currentSession != nil && time.Since(currentSession.LastSeenAt) >= account.SessionTouchInterval {
+			expires, renewed, err := account.TouchSession(r.Context(), a.DB, currentSession.ID, a.clientIP(r))
+			if err != nil {
+				log.Printf("touch session error: %v", err)
+			} else if renewed {
+				currentSession.ExpiresAt = expires
+				setSessionCookie(w, currentSession)
+			}
+		}
+
 		ctx := context.WithValue(r.Context(), ctxKeyUser, currentUser)
+		ctx = context.WithValue(ctx, ctxKeySession, currentSession)
+
+		// Scripts sign in with an API token instead. It stays out of
+		// CurrentUser until a Scoped route lets it in.
+		if token, ok := bearerToken(r); ok && currentUser == nil {
+			u, t, err := account.AuthenticateAPIToken(r.Context(), a.DB, token)
+			if err != nil {
+				if !errors.Is(err, account.ErrInvalidAPIToken) {
+					log.Printf("authenticate API token error: %v", err)
+				}
+				writeBearerError(w)
+				return
+			}
+			ctx = context.WithValue(ctx, ctxKeyAPIToken, &apiCaller{user: u, token: t})
+		}
+
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -64,6 +147,69 @@ func CurrentUser(r *http.Request) *account.User {
 	return u
 }
 
+// CurrentSession is the session the request was signed in with, or nil.
+func CurrentSession(r *http.Request) *account.Session {
+	s, _ := r.Context().Value(ctxKeySession).(*account.Session)
+	return s
+}
+
+// clientIP is the address the request came from. Behind a trusted proxy
+// that is the last X-Forwarded-For entry, the one the proxy itself added;
+// earlier entries are whatever the client claimed.
+func (a *App) clientIP(r *http.Request) string {
+	if a.TrustProxy {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			parts := strings.Split(fwd, ",")
+			if ip := strings.TrimSpace(parts[len(parts)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func setSessionCookie(w http.ResponseWriter, sess *account.Session) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    sess.ID.String(),
+		Path:     "/",
+		Expires:  sess.ExpiresAt,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   false, // set true in prod when behind HTTPS
+	})
+}
+
+// absoluteURL turns a site path into a full URL for use outside the site,
+// such as in link previews. Without a configured BaseURL the request's
+// own host is used, so it must not go into emails; use mailURL there.
+func (a *App) absoluteURL(r *http.Request, path string) string {
+	if a.BaseURL != "" {
+		return a.BaseURL + path
+	}
+	scheme := "http"
+	if r.TLS != nil || (a.TrustProxy && r.Header.Get("X-Forwarded-Proto") == "https") {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + path
+}
+
+var errNoBaseURL = errors.New("BASE_URL is not set")
+
+// mailURL turns a site path into a full URL for an email. Only BaseURL is
+// used: the Host header is up to the client, and a link built from it
+// could send a token to someone else's server.
+func (a *App) mailURL(path string) (string, error) {
+	if a.BaseURL == "" {
+		return "", errNoBaseURL
+	}
+	return a.BaseURL + path, nil
+}
+
 // ===== Handlers =====
 
 func (a *App) HandleHome(w http.ResponseWriter, r *http.Request) {
@@ -77,7 +223,7 @@ func (a *App) HandleHome(w http.ResponseWriter, r *http.Request) {
 			Data:        nil, // no extra data needed
 			Flash:       flash,
 		}
-		a.Renderer.Render(w, "home", data)
+		a.Renderer.Render(w, r, "home", data)
 		return
 	}
 
@@ -105,7 +251,7 @@ func (a *App) HandleHome(w http.ResponseWriter, r *http.Request) {
 		Flash: flash,
 	}
 
-	a.Renderer.Render(w, "home", data)
+	a.Renderer.Render(w, r, "home", data)
 }
 
 func (a *App) HandleSignupShow(w http.ResponseWriter, r *http.Request) {
@@ -121,7 +267,7 @@ func (a *App) HandleSignupShow(w http.ResponseWriter, r *http.Request) {
 		Error: "",
 	}
 
-	a.Renderer.Render(w, "signup", data)
+	a.Renderer.Render(w, r, "signup", data)
 }
 
 func (a *App) HandleSignupPost(w http.ResponseWriter, r *http.Request) {
@@ -134,7 +280,7 @@ func (a *App) HandleSignupPost(w http.ResponseWriter, r *http.Request) {
 			}{},
 			Error: "Invalid form submission. Please try again.",
 		}
-		a.Renderer.Render(w, "signup", data)
+		a.Renderer.Render(w, r, "signup", data)
 		return
 	}
 
@@ -156,7 +302,22 @@ func (a *App) HandleSignupPost(w http.ResponseWriter, r *http.Request) {
 			},
 			Error: "Display name, email, and password are required.",
 		}
-		a.Renderer.Render(w, "signup", data)
+		a.Renderer.Render(w, r, "signup", data)
+		return
+	}
+
+	if !validEmail(email) {
+		data := TemplateData{
+			Data: struct {
+				DisplayName string
+				Email       string
+			}{
+				DisplayName: displayName,
+				Email:       email,
+			},
+			Error: "Please enter a valid email address.",
+		}
+		a.Renderer.Render(w, r, "signup", data)
 		return
 	}
 
@@ -171,7 +332,7 @@ func (a *App) HandleSignupPost(w http.ResponseWriter, r *http.Request) {
 			},
 			Error: "Password must be at least 8 characters long.",
 		}
-		a.Renderer.Render(w, "signup", data)
+		a.Renderer.Render(w, r, "signup", data)
 		return
 	}
 
@@ -188,11 +349,11 @@ func (a *App) HandleSignupPost(w http.ResponseWriter, r *http.Request) {
 			},
 			Error: "Could not create account. This email may already be in use.",
 		}
-		a.Renderer.Render(w, "signup", data)
+		a.Renderer.Render(w, r, "signup", data)
 		return
 	}
 
-	sess, err := account.CreateSession(r.Context(), a.DB, u.ID, 7*24*time.Hour)
+	sess, err := account.CreateSession(r.Context(), a.DB, u.ID, r.UserAgent(), a.clientIP(r))
 	if err != nil {
 		log.Printf("create session error: %v", err)
 		data := TemplateData{
@@ -205,95 +366,196 @@ func (a *App) HandleSignupPost(w http.ResponseWriter, r *http.Request) {
 			},
 			Error: "Account created, but we couldn't log you in automatically. Please try logging in.",
 		}
-		a.Renderer.Render(w, "signup", data)
+		a.Renderer.Render(w, r, "signup", data)
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     sessionCookieName,
-		Value:    sess.ID.String(),
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   false, // set true in prod when behind HTTPS
-	})
+	setSessionCookie(w, sess)
+
+	if err := a.sendVerification(r, u, u.Email); err != nil {
+		log.Printf("send verification error: %v", err)
+	}
 
 	log.Printf("signup success: userID=%d, redirecting to /decks", u.ID)
-	setFlash(w, "Account created. Welcome to Mana Tomb!")
+	setFlash(w, "Account created. Welcome to Mana Tomb! Check your email for a link to verify your address.")
 	http.Redirect(w, r, "/decks", http.StatusSeeOther)
 }
 
+// loginFormData fills the login form. Notice explains a throttled or
+// locked-out sign-in.
+type loginFormData struct {
+	Email  string
+	Notice string
+
+	// Provider names the external identity provider offered as another
+	// way in, empty when there is none.
+	Provider string
+}
+
+func (a *App) loginProvider() string {
+	if a.OIDC == nil {
+		return ""
+	}
+	return a.OIDC.Name
+}
+
 func (a *App) HandleLoginShow(w http.ResponseWriter, r *http.Request) {
 	flash := readFlash(w, r)
 
 	data := TemplateData{
 		CurrentUser: CurrentUser(r),
-		Data: struct {
-			Email string
-		}{},
-		Flash: flash,
-		Error: "",
+		Data:        loginFormData{Provider: a.loginProvider()},
+		Flash:       flash,
+		Error:       "",
 	}
 
-	a.Renderer.Render(w, "login", data)
+	a.Renderer.Render(w, r, "login", data)
 }
 
 func (a *App) HandleLoginPost(w http.ResponseWriter, r *http.Request) {
 	if err := r.ParseForm(); err != nil {
 		data := TemplateData{
-			Data: struct {
-				Email string
-			}{},
+			Data:  loginFormData{},
 			Error: "Invalid form submission. Please try again.",
 		}
-		a.Renderer.Render(w, "login", data)
+		a.Renderer.Render(w, r, "login", data)
 		return
 	}
 
 	email := strings.TrimSpace(r.Form.Get("email"))
 	password := r.Form.Get("password")
+	ip := a.clientIP(r)
+
+	attempt, throttle, err := account.BeginLogin(r.Context(), a.DB, email, ip, r.UserAgent())
+	if err != nil {
+		log.Printf("check login throttle error: %v", err)
+	}
+	if throttle.Wait > 0 {
+		notice := "Too many failed attempts. Please wait " + waitText(throttle.Wait) + " before trying again."
+		if throttle.Locked {
+			notice = "Too many failed sign-in attempts, so signing in is locked for now. Try again in " + waitText(throttle.Wait) + "."
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(int((throttle.Wait+time.Second-1)/time.Second)))
+		w.WriteHeader(http.StatusTooManyRequests)
+		data := TemplateData{
+			Data: loginFormData{Email: email, Notice: notice, Provider: a.loginProvider()},
+		}
+		a.Renderer.Render(w, r, "login", data)
+		return
+	}
 
 	u, err := account.Authenticate(r.Context(), a.DB, email, password)
+	a.settleLogin(r, attempt, errors.Is(err, account.ErrInvalidCredentials))
+	if errors.Is(err, account.ErrAccountDisabled) {
+		data := TemplateData{
+			Data:  loginFormData{Email: email, Provider: a.loginProvider()},
+			Error: accountDisabledMessage,
+		}
+		a.Renderer.Render(w, r, "login", data)
+		return
+	}
 	if err != nil {
 		log.Printf("authenticate error: %v", err)
 		data := TemplateData{
-			Data: struct {
-				Email string
-			}{
-				Email: email,
-			},
+			Data:  loginFormData{Email: email, Provider: a.loginProvider()},
 			Error: "Invalid email or password.",
 		}
-		a.Renderer.Render(w, "login", data)
+		a.Renderer.Render(w, r, "login", data)
+		return
+	}
+
+	// With two-factor on, the password only earns the code step. Success
+	// isn't recorded until then, so it can't reset the failure count.
+	if u.TOTPEnabled {
+		a.setTwoFactorCookie(w, u.ID)
+		http.Redirect(w, r, "/login/2fa", http.StatusSeeOther)
 		return
 	}
 
-	sess, err := account.CreateSession(r.Context(), a.DB, u.ID, 7*24*time.Hour)
+	a.completeLogin(w, r, u, "Welcome back!")
+}
+
+// settleLogin records the attempt BeginLogin reserved as failed, or drops
+// it when it didn't fail; success is recorded when the session starts.
+func (a *App) settleLogin(r *http.Request, attempt int64, failed bool) {
+	if attempt == 0 {
+		return
+	}
+	settle := account.CancelLogin
+	if failed {
+		settle = account.FailLogin
+	}
+	if err := settle(r.Context(), a.DB, attempt); err != nil {
+		log.Printf("record login attempt error: %v", err)
+	}
+}
+
+// accountDisabledMessage is shown to people whose account an admin has
+// turned off, whichever way they try to sign in.
+const accountDisabledMessage = "This account has been disabled. Contact the site's administrators if you think this is a mistake."
+
+// completeLogin signs u in once every step has passed.
+func (a *App) completeLogin(w http.ResponseWriter, r *http.Request, u *account.User, flash string) {
+	err := a.startSession(w, r, u)
+	if errors.Is(err, account.ErrAccountDisabled) {
+		data := TemplateData{
+			Data:  loginFormData{Email: u.Email, Provider: a.loginProvider()},
+			Error: accountDisabledMessage,
+		}
+		a.Renderer.Render(w, r, "login", data)
+		return
+	}
 	if err != nil {
 		log.Printf("create session error: %v", err)
 		data := TemplateData{
-			Data: struct {
-				Email string
-			}{
-				Email: email,
-			},
+			Data:  loginFormData{Email: u.Email},
 			Error: "Could not create session. Please try logging in again.",
 		}
-		a.Renderer.Render(w, "login", data)
+		a.Renderer.Render(w, r, "login", data)
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     sessionCookieName,
-		Value:    sess.ID.String(),
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   false,
-	})
-
-	setFlash(w, "Welcome back!")
+	setFlash(w, flash)
 	http.Redirect(w, r, "/decks", http.StatusSeeOther)
 }
 
+// startSession records a successful sign-in and gives this browser a new
+// session. Disabled accounts get account.ErrAccountDisabled instead.
+func (a *App) startSession(w http.ResponseWriter, r *http.Request, u *account.User) error {
+	if u.Disabled {
+		return account.ErrAccountDisabled
+	}
+
+	ip := a.clientIP(r)
+
+	if err := account.RecordLoginAttempt(r.Context(), a.DB, u.Email, ip, r.UserAgent(), true); err != nil {
+		log.Printf("record login attempt error: %v", err)
+	}
+
+	sess, err := account.CreateSession(r.Context(), a.DB, u.ID, r.UserAgent(), ip)
+	if err != nil {
+		return err
+	}
+	setSessionCookie(w, sess)
+	return nil
+}
+
+// waitText renders a throttling wait for people, rounded up.
+func waitText(d time.Duration) string {
+	if d < time.Minute {
+		secs := int((d + time.Second - 1) / time.Second)
+		if secs == 1 {
+			return "1 second"
+		}
+		return strconv.Itoa(secs) + " seconds"
+	}
+	mins := int((d + time.Minute - 1) / time.Minute)
+	if mins == 1 {
+		return "1 minute"
+	}
+	return strconv.Itoa(mins) + " minutes"
+}
+
 // ClearSessionCookie clears the current session in the database (if present)
 // and removes the session cookie from the client.
 func (a *App) ClearSessionCookie(w http.ResponseWriter, r *http.Request) {
@@ -310,6 +572,7 @@ func (a *App) ClearSessionCookie(w http.ResponseWriter, r *http.Request) {
 		Path:     "/",
 		MaxAge:   -1,
 		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
 	})
 }
 
@@ -332,7 +595,7 @@ func (a *App) RenderNotFound(w http.ResponseWriter, r *http.Request) {
 		Error:       "",
 	}
 
-	a.Renderer.Render(w, "not_found", data)
+	a.Renderer.Render(w, r, "not_found", data)
 }
 
 func (a *App) RenderServerError(w http.ResponseWriter, r *http.Request, err error) {
@@ -347,7 +610,7 @@ func (a *App) RenderServerError(w http.ResponseWriter, r *http.Request, err erro
 		Error:       "",
 	}
 
-	a.Renderer.Render(w, "error", data)
+	a.Renderer.Render(w, r, "error", data)
 }
 
 func (a *App) WithRecoveryMiddleware(next http.Handler) http.Handler {
@@ -374,13 +637,48 @@ func (r *notFoundRecorder) Header() http.Header {
 }
 
 func (r *notFoundRecorder) WriteHeader(status int) {
+	if r.streaming {
+		return
+	}
 	r.status = status
 }
 
 func (r *notFoundRecorder) Write(b []byte) (int, error) {
+	if r.streaming {
+		return r.rw.Write(b)
+	}
 	return r.buf.Write(b)
 }
 
+// Flush switches the recorder to pass-through so streaming responses
+// (Server-Sent Events) reach the client as they are written.
+func (r *notFoundRecorder) Flush() {
+	if !r.streaming {
+		r.streaming = true
+		r.copyTo(r.rw)
+	}
+	if f, ok := r.rw.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *notFoundRecorder) copyTo(w http.ResponseWriter) {
+	for k, vv := range r.Header() {
+		for _, v := range vv {
+			w.Header().Add(k, v)
+		}
+	}
+
+	// If no status was explicitly set, treat it as 200 OK.
+	status := r.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	_, _ = w.Write(r.buf.Bytes())
+	r.buf.Reset()
+}
+
 func (a *App) WithNotFoundMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		rec := &notFoundRecorder{
@@ -390,6 +688,11 @@ func (a *App) WithNotFoundMiddleware(next http.Handler) http.Handler {
 
 		next.ServeHTTP(rec, r)
 
+		// Streaming responses have already been passed through.
+		if rec.streaming {
+			return
+		}
+
 		// If the wrapped handler (typically the mux) reported a 404,
 		// render our pretty not_found page instead of the default text.
 		if rec.status == http.StatusNotFound {
@@ -398,18 +701,6 @@ func (a *App) WithNotFoundMiddleware(next http.Handler) http.Handler {
 		}
 
 		// Otherwise, copy recorded headers and body through to the real ResponseWriter.
-		for k, vv := range rec.Header() {
-			for _, v := range vv {
-				w.Header().Add(k, v)
-			}
-		}
-
-		// If no status was explicitly set, treat it as 200 OK.
-		status := rec.status
-		if status == 0 {
-			status = http.StatusOK
-		}
-		w.WriteHeader(status)
-		_, _ = w.Write(rec.buf.Bytes())
+		rec.copyTo(w)
 	})
 }
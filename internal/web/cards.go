@@ -100,7 +100,7 @@ func (a *App) HandleCardSearch(w http.ResponseWriter, r *http.Request) {
 		Error: errMsg, // 🔴 shows in red banner via layout_header
 	}
 
-	a.Renderer.Render(w, "cards_search", data)
+	a.Renderer.Render(w, r, "cards_search", data)
 }
 
 func (a *App) HandleCardAddToDeck(w http.ResponseWriter, r *http.Request) {
@@ -155,22 +155,47 @@ func (a *App) HandleCardAddToDeck(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/decks/"+strconv.FormatInt(deckID, 10), http.StatusSeeOther)
 }
 
+// commanderSearchLimit caps commander search results; Scryfall is only
+// asked when the stored cards give fewer than commanderSearchEnough.
+const (
+	commanderSearchLimit  = 50
+	commanderSearchEnough = 10
+)
+
+// GET /commanders/search
+//
+// Searches the stored cards first, so search works without Scryfall, and
+// tops the results up from Scryfall's is:commander search when reachable.
 func (a *App) HandleCommanderSearch(w http.ResponseWriter, r *http.Request) {
 	user := CurrentUser(r)
-	query := r.URL.Query().Get("q")
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
 	flash := readFlash(w, r)
 
-	var results []cards.Card
+	var (
+		results []cards.Card
+		errMsg  string
+	)
 	if query != "" {
-		scry := cards.NewScryfallClient()
-		// Bias search toward commander-legal cards
-		searchQuery := query + " is:commander"
 		var err error
-		results, err = scry.SearchByName(r.Context(), searchQuery)
+		results, err = cards.SearchCommanders(r.Context(), a.DB, query, commanderSearchLimit)
 		if err != nil {
-			http.Error(w, "error searching commanders", http.StatusBadGateway)
+			a.RenderServerError(w, r, err)
 			return
 		}
+
+		if len(results) < commanderSearchEnough {
+			scry := cards.NewScryfallClient()
+			remote, err := scry.SearchByName(r.Context(), query+" is:commander")
+			switch {
+			case err != nil && len(results) == 0:
+				log.Printf("commander search %q: %v", query, err)
+				errMsg = "Couldn't reach Scryfall, and no stored cards match. Please try again."
+			case err != nil:
+				log.Printf("commander search %q: %v", query, err)
+			default:
+				results = mergeCards(results, remote, commanderSearchLimit)
+			}
+		}
 	}
 
 	data := TemplateData{
@@ -183,7 +208,27 @@ func (a *App) HandleCommanderSearch(w http.ResponseWriter, r *http.Request) {
 			Results: results,
 		},
 		Flash: flash,
+		Error: errMsg,
 	}
 
-	a.Renderer.Render(w, "commanders_search", data)
+	a.Renderer.Render(w, r, "commanders_search", data)
+}
+
+// mergeCards appends the extra cards not already in list, by name, up to
+// limit cards.
+func mergeCards(list, extra []cards.Card, limit int) []cards.Card {
+	seen := make(map[string]bool, len(list))
+	for _, c := range list {
+		seen[c.Name] = true
+	}
+	for _, c := range extra {
+		if len(list) >= limit {
+			break
+		}
+		if !seen[c.Name] {
+			seen[c.Name] = true
+			list = append(list, c)
+		}
+	}
+	return list
 }
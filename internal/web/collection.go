@@ -0,0 +1,272 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"manatomb/app/internal/cards"
+	"manatomb/app/internal/collection"
+)
+
+// GET /collection
+func (a *App) HandleCollectionShow(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	flash := readFlash(w, r)
+
+	entries, err := collection.ListCollection(r.Context(), a.DB, user.ID)
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	var total float64
+	tradeable, unpriced := 0, 0
+	for _, e := range entries {
+		if e.PriceUSD.Valid {
+			total += e.PriceUSD.Float64 * float64(e.Quantity)
+		} else {
+			unpriced++
+		}
+		if e.Tradeable {
+			tradeable++
+		}
+	}
+
+	data := TemplateData{
+		CurrentUser: user,
+		Data: struct {
+			Entries    []collection.Entry
+			TotalValue float64
+			Unpriced   int
+			Tradeable  int
+		}{
+			Entries:    entries,
+			TotalValue: total,
+			Unpriced:   unpriced,
+			Tradeable:  tradeable,
+		},
+		Flash: flash,
+	}
+
+	a.Renderer.Render(w, r, "collection", data)
+}
+
+// POST /collection (different actions based on hidden "action" field)
+func (a *App) HandleCollectionPost(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Form.Get("action") {
+	case "add":
+		cardName := strings.TrimSpace(r.Form.Get("card_name"))
+		qty := parseQuantity(r.Form.Get("quantity"))
+
+		c, err := cards.EnsureCardByName(r.Context(), a.DB, cardName)
+		if err != nil {
+			if errors.Is(err, cards.ErrCardNotFound) {
+				setFlash(w, fmt.Sprintf("No card found named “%s”.", cardName))
+				http.Redirect(w, r, "/collection", http.StatusSeeOther)
+				return
+			}
+			a.RenderServerError(w, r, err)
+			return
+		}
+
+		if err := collection.AddCard(r.Context(), a.DB, user.ID, c.ID, qty); err != nil {
+			a.RenderServerError(w, r, err)
+			return
+		}
+
+		setFlash(w, fmt.Sprintf("Added %dx %s to your collection.", qty, c.Name))
+
+	case "increment", "decrement":
+		cardID, err := strconv.ParseInt(r.Form.Get("card_id"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid card id", http.StatusBadRequest)
+			return
+		}
+
+		delta := 1
+		if r.Form.Get("action") == "decrement" {
+			delta = -1
+		}
+
+		if err := collection.AddCard(r.Context(), a.DB, user.ID, cardID, delta); err != nil {
+			a.RenderServerError(w, r, err)
+			return
+		}
+
+	case "set_tradeable":
+		cardID, err := strconv.ParseInt(r.Form.Get("card_id"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid card id", http.StatusBadRequest)
+			return
+		}
+
+		tradeable := r.Form.Get("tradeable") == "1"
+		if err := collection.SetTradeable(r.Context(), a.DB, user.ID, cardID, tradeable); err != nil {
+			a.RenderServerError(w, r, err)
+			return
+		}
+
+	default:
+		setFlash(w, "Unknown action.")
+	}
+
+	http.Redirect(w, r, "/collection", http.StatusSeeOther)
+}
+
+// GET /wishlist
+func (a *App) HandleWishlistShow(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	flash := readFlash(w, r)
+
+	entries, err := collection.ListWishlist(r.Context(), a.DB, user.ID)
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	var total float64
+	unpriced := 0
+	for _, e := range entries {
+		if e.PriceUSD.Valid {
+			total += e.PriceUSD.Float64 * float64(e.Quantity)
+		} else {
+			unpriced++
+		}
+	}
+
+	data := TemplateData{
+		CurrentUser: user,
+		Data: struct {
+			Entries    []collection.WishlistEntry
+			TotalValue float64
+			Unpriced   int
+		}{
+			Entries:    entries,
+			TotalValue: total,
+			Unpriced:   unpriced,
+		},
+		Flash: flash,
+	}
+
+	a.Renderer.Render(w, r, "wishlist", data)
+}
+
+// POST /wishlist (different actions based on hidden "action" field)
+func (a *App) HandleWishlistPost(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Form.Get("action") {
+	case "add":
+		cardName := strings.TrimSpace(r.Form.Get("card_name"))
+		qty := parseQuantity(r.Form.Get("quantity"))
+
+		c, err := cards.EnsureCardByName(r.Context(), a.DB, cardName)
+		if err != nil {
+			if errors.Is(err, cards.ErrCardNotFound) {
+				setFlash(w, fmt.Sprintf("No card found named “%s”.", cardName))
+				http.Redirect(w, r, "/wishlist", http.StatusSeeOther)
+				return
+			}
+			a.RenderServerError(w, r, err)
+			return
+		}
+
+		if err := collection.AddWish(r.Context(), a.DB, user.ID, c.ID, qty); err != nil {
+			a.RenderServerError(w, r, err)
+			return
+		}
+
+	case "remove":
+		cardID, err := strconv.ParseInt(r.Form.Get("card_id"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid card id", http.StatusBadRequest)
+			return
+		}
+
+		if err := collection.AddWish(r.Context(), a.DB, user.ID, cardID, -1); err != nil {
+			a.RenderServerError(w, r, err)
+			return
+		}
+
+	case "sync":
+		added, err := collection.SyncWishlistFromDecks(r.Context(), a.DB, user.ID)
+		if err != nil {
+			a.RenderServerError(w, r, err)
+			return
+		}
+
+		setFlash(w, fmt.Sprintf("Wishlist synced from your decks (%d cards added or updated).", added))
+
+	default:
+		setFlash(w, "Unknown action.")
+	}
+
+	http.Redirect(w, r, "/wishlist", http.StatusSeeOther)
+}
+
+// GET /trades
+func (a *App) HandleTradeMatches(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	flash := readFlash(w, r)
+
+	matches, err := collection.ListMatches(r.Context(), a.DB, user.ID)
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	data := TemplateData{
+		CurrentUser: user,
+		Data:        matches,
+		Flash:       flash,
+	}
+
+	a.Renderer.Render(w, r, "trade_matches", data)
+}
+
+// parseQuantity reads an optional quantity field, defaulting to 1.
+func parseQuantity(s string) int {
+	qty, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || qty < 1 {
+		return 1
+	}
+	return qty
+}
@@ -0,0 +1,168 @@
+package web
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+)
+
+const (
+	csrfCookieName = "mt_csrf"
+	csrfFieldName  = "csrf_token"
+	csrfHeaderName = "X-CSRF-Token"
+
+	ctxKeyCSRF ctxKey = "csrfToken"
+)
+
+var (
+	errCSRFOrigin = errors.New("cross-origin request")
+	errCSRFToken  = errors.New("missing or invalid token")
+)
+
+// WithCSRFMiddleware rejects unsafe requests (anything but GET, HEAD,
+// OPTIONS and TRACE) that don't carry the CSRF token for their session,
+// in a form field or the X-CSRF-Token header, or that come from another
+// origin. It must run inside WithUserMiddleware so it can see the session.
+//
+// Tokens are an HMAC of the session ID, so they need no storage and change
+// when the user signs in or out. Visitors without a session get a random
+// mt_csrf cookie to sign instead, which covers the login and signup forms.
+// Requests made with an API token and no session cookie are exempt.
+func (a *App) WithCSRFMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Browsers never attach bearer tokens on their own, so requests
+		// that authenticate with one and send no session cookie can't be
+		// forged cross-site.
+		if apiCallerFrom(r) != nil {
+			if _, err := r.Cookie(sessionCookieName); err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		token := a.csrfToken(a.csrfKey(w, r))
+		r = r.WithContext(context.WithValue(r.Context(), ctxKeyCSRF, token))
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		default:
+			if err := a.checkCSRF(r, token); err != nil {
+				log.Printf("csrf: %s %s rejected: %v", r.Method, r.URL.Path, err)
+				a.RenderCSRFError(w, r)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CSRFToken is the token forms on this request must send back.
+func CSRFToken(r *http.Request) string {
+	t, _ := r.Context().Value(ctxKeyCSRF).(string)
+	return t
+}
+
+// csrfField renders the hidden form field carrying the CSRF token. Every
+// POST form includes it as {{ csrfField $.CSRFToken }}.
+func csrfField(token string) template.HTML {
+	return template.HTML(`<input type="hidden" name="` + csrfFieldName + `" value="` +
+		template.HTMLEscapeString(token) + `">`)
+}
+
+// csrfKey is what the request's token signs: the session ID when signed in,
+// otherwise the visitor's mt_csrf cookie, issued here on first visit.
+func (a *App) csrfKey(w http.ResponseWriter, r *http.Request) string {
+	if sess := CurrentSession(r); sess != nil {
+		return "session:" + sess.ID.String()
+	}
+
+	if c, err := r.Cookie(csrfCookieName); err == nil && len(c.Value) == 43 {
+		return "visitor:" + c.Value
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	value := base64.RawURLEncoding.EncodeToString(b)
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return "visitor:" + value
+}
+
+func (a *App) csrfToken(key string) string {
+	mac := hmac.New(sha256.New, a.SessionSecret)
+	mac.Write([]byte("csrf:" + key))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// checkCSRF compares the submitted token with the expected one. As defense
+// in depth it also requires Origin, or Referer when there is no Origin, to
+// name this site. Requests with neither are judged on the token alone, as
+// some privacy tools strip both.
+func (a *App) checkCSRF(r *http.Request, token string) error {
+	source := r.Header.Get("Origin")
+	if source == "" {
+		source = r.Header.Get("Referer")
+	}
+	if source != "" && !a.sameSite(r, source) {
+		return errCSRFOrigin
+	}
+
+	sent := r.Header.Get(csrfHeaderName)
+	if sent == "" {
+		sent = r.PostFormValue(csrfFieldName)
+	}
+	if sent == "" || !hmac.Equal([]byte(sent), []byte(token)) {
+		return errCSRFToken
+	}
+	return nil
+}
+
+// sameSite reports whether an Origin or Referer value points at this site,
+// either the host the request was made to or the configured BaseURL.
+func (a *App) sameSite(r *http.Request, source string) bool {
+	u, err := url.Parse(source)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if u.Host == r.Host {
+		return true
+	}
+	if a.BaseURL != "" {
+		if base, err := url.Parse(a.BaseURL); err == nil && base.Host == u.Host {
+			return true
+		}
+	}
+	return false
+}
+
+// RenderCSRFError explains a rejected form submission. Scripted requests,
+// which send the token as a header, get a plain-text message they can show.
+func (a *App) RenderCSRFError(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get(csrfHeaderName) != "" {
+		http.Error(w, "Your session changed. Reload the page and try again.", http.StatusForbidden)
+		return
+	}
+
+	w.WriteHeader(http.StatusForbidden)
+
+	data := TemplateData{
+		CurrentUser: CurrentUser(r),
+	}
+
+	a.Renderer.Render(w, r, "csrf_error", data)
+}
@@ -0,0 +1,297 @@
+package web
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"manatomb/app/internal/cards"
+	"manatomb/app/internal/cubes"
+	"manatomb/app/internal/draft"
+)
+
+const (
+	cubesListLimit = 100
+
+	// cubeAddLimit caps how many lines one "Add cards" submission looks
+	// up, since unknown cards each cost a Scryfall request.
+	cubeAddLimit = 100
+
+	// Defaults for the sample pack and new drafts.
+	defaultPackSize  = 15
+	defaultPackCount = 3
+	defaultSeats     = 8
+)
+
+// GET /cubes
+func (a *App) HandleCubesList(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	flash := readFlash(w, r)
+
+	list, err := cubes.ListCubes(r.Context(), a.DB, user.ID, cubesListLimit)
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	data := TemplateData{
+		CurrentUser: user,
+		Data: struct {
+			Cubes []cubes.Cube
+		}{
+			Cubes: list,
+		},
+		Flash: flash,
+	}
+
+	a.Renderer.Render(w, r, "cubes_list", data)
+}
+
+// POST /cubes
+func (a *App) HandleCubeCreatePost(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	name := strings.TrimSpace(r.Form.Get("name"))
+	if name == "" {
+		setFlash(w, "Please give the cube a name.")
+		http.Redirect(w, r, "/cubes", http.StatusSeeOther)
+		return
+	}
+
+	id, err := cubes.CreateCube(r.Context(), a.DB, user.ID, name, strings.TrimSpace(r.Form.Get("description")))
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	setFlash(w, "Cube created. Add cards one per line.")
+	http.Redirect(w, r, "/cubes/"+strconv.FormatInt(id, 10), http.StatusSeeOther)
+}
+
+// GET /cubes/{id}
+//
+// Shows the cube by section with a sample pack. ?seed= picks the pack so
+// the same seed always shows the same cards.
+func (a *App) HandleCubeShow(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	flash := readFlash(w, r)
+
+	c, ok := a.loadCube(w, r)
+	if !ok {
+		return
+	}
+
+	cubeCards, err := cubes.ListCubeCards(r.Context(), a.DB, c.ID)
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	seed, err := strconv.ParseInt(r.URL.Query().Get("seed"), 10, 64)
+	if err != nil {
+		seed = time.Now().UnixNano() % 1000000
+	}
+
+	var sample []draft.Card
+	if packs, err := draft.GeneratePacks(draftCards(cubeCards), 1, defaultPackSize, seed); err == nil {
+		sample = packs[0]
+	}
+
+	data := TemplateData{
+		CurrentUser: user,
+		Data: struct {
+			Cube        *cubes.Cube
+			IsOwner     bool
+			Sections    []cubes.Section
+			Sample      []draft.Card
+			Seed        int64
+			PackSize    int
+			PackCount   int
+			Seats       int
+			MinSeats    int
+			MaxSeats    int
+			CardsNeeded int
+		}{
+			Cube:        c,
+			IsOwner:     c.UserID == user.ID,
+			Sections:    cubes.GroupBySection(cubeCards),
+			Sample:      sample,
+			Seed:        seed,
+			PackSize:    defaultPackSize,
+			PackCount:   defaultPackCount,
+			Seats:       defaultSeats,
+			MinSeats:    draft.MinSeats,
+			MaxSeats:    draft.MaxSeats,
+			CardsNeeded: defaultSeats * defaultPackCount * defaultPackSize,
+		},
+		Flash: flash,
+	}
+
+	a.Renderer.Render(w, r, "cube_show", data)
+}
+
+// POST /cubes/{id}
+func (a *App) HandleCubePost(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	c, ok := a.loadCube(w, r)
+	if !ok {
+		return
+	}
+	if c.UserID != user.ID {
+		http.Error(w, "only the owner can edit this cube", http.StatusForbidden)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	cubeURL := "/cubes/" + strconv.FormatInt(c.ID, 10)
+	cardID, _ := strconv.ParseInt(r.Form.Get("card_id"), 10, 64)
+	section := strings.TrimSpace(r.Form.Get("section"))
+
+	var (
+		err error
+		msg string
+	)
+	switch r.Form.Get("action") {
+	case "update":
+		name := strings.TrimSpace(r.Form.Get("name"))
+		if name == "" {
+			msg = "The cube needs a name."
+			break
+		}
+		err = cubes.UpdateCube(r.Context(), a.DB, c.ID, name, strings.TrimSpace(r.Form.Get("description")))
+		msg = "Cube updated."
+	case "add":
+		msg, err = a.addCubeCards(r, c.ID, parseCardLines(r.Form.Get("cards")), section)
+	case "remove":
+		err = cubes.RemoveCard(r.Context(), a.DB, c.ID, cardID)
+		msg = "Card removed."
+	case "move":
+		if section == "" {
+			msg = "Please name the section."
+			break
+		}
+		err = cubes.SetSection(r.Context(), a.DB, c.ID, cardID, section)
+		msg = "Card moved to " + section + "."
+	case "delete":
+		err = cubes.DeleteCube(r.Context(), a.DB, c.ID)
+		msg = "Cube deleted."
+		cubeURL = "/cubes"
+	default:
+		http.Error(w, "unknown action", http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		log.Printf("cube %d %s: %v", c.ID, r.Form.Get("action"), err)
+		msg = "Something went wrong. Please try again."
+	}
+
+	setFlash(w, msg)
+	http.Redirect(w, r, cubeURL, http.StatusSeeOther)
+}
+
+// addCubeCards looks up each name and adds it to the cube, into section or
+// the card's color section when section is empty.
+func (a *App) addCubeCards(r *http.Request, cubeID int64, names []string, section string) (string, error) {
+	if len(names) == 0 {
+		return "Enter at least one card name.", nil
+	}
+	if len(names) > cubeAddLimit {
+		return "Please add at most " + strconv.Itoa(cubeAddLimit) + " cards at a time.", nil
+	}
+
+	var added int
+	var unknown, dupes []string
+	for _, name := range names {
+		card, err := cards.EnsureCardByName(r.Context(), a.DB, name)
+		if errors.Is(err, cards.ErrCardNotFound) {
+			unknown = append(unknown, name)
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		s := section
+		if s == "" {
+			s = cubes.DefaultSection(card.ColorIdentity)
+		}
+		err = cubes.AddCard(r.Context(), a.DB, cubeID, card.ID, s)
+		if errors.Is(err, cubes.ErrAlreadyInCube) {
+			dupes = append(dupes, card.Name)
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		added++
+	}
+
+	msg := "Added " + strconv.Itoa(added) + " card"
+	if added != 1 {
+		msg += "s"
+	}
+	msg += "."
+	if len(dupes) > 0 {
+		msg += " Already in the cube: " + strings.Join(dupes, ", ") + "."
+	}
+	if len(unknown) > 0 {
+		msg += " Not found: " + strings.Join(unknown, ", ") + "."
+	}
+	return msg, nil
+}
+
+func (a *App) loadCube(w http.ResponseWriter, r *http.Request) (*cubes.Cube, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		a.RenderNotFound(w, r)
+		return nil, false
+	}
+
+	c, err := cubes.GetCube(r.Context(), a.DB, id)
+	if err != nil {
+		a.RenderNotFound(w, r)
+		return nil, false
+	}
+	return c, true
+}
+
+// draftCards converts cube cards for the draft package.
+func draftCards(list []cubes.CubeCard) []draft.Card {
+	out := make([]draft.Card, len(list))
+	for i, c := range list {
+		out[i] = draft.Card{ID: c.CardID, Name: c.CardName, Colors: c.ColorIdentity}
+	}
+	return out
+}
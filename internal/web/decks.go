@@ -3,12 +3,15 @@ package web
 import (
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"manatomb/app/internal/cards"
+	"manatomb/app/internal/combos"
 	"manatomb/app/internal/decks"
+	"manatomb/app/internal/groups"
 )
 
 // List all decks for the current user.
@@ -32,7 +35,7 @@ func (a *App) HandleDecksList(w http.ResponseWriter, r *http.Request) {
 		Flash:       flash,
 	}
 
-	a.Renderer.Render(w, "decks_list", data)
+	a.Renderer.Render(w, r, "decks_list", data)
 }
 
 func (a *App) HandleDeckNewShow(w http.ResponseWriter, r *http.Request) {
@@ -62,7 +65,7 @@ func (a *App) HandleDeckNewShow(w http.ResponseWriter, r *http.Request) {
 		Error: "",
 	}
 
-	a.Renderer.Render(w, "decks_new", data)
+	a.Renderer.Render(w, r, "decks_new", data)
 }
 
 // Handle POST from "new deck" form.
@@ -97,7 +100,7 @@ func (a *App) HandleDeckNewPost(w http.ResponseWriter, r *http.Request) {
 			},
 			Error: "Deck name is required.",
 		}
-		a.Renderer.Render(w, "decks_new", data)
+		a.Renderer.Render(w, r, "decks_new", data)
 		return
 	}
 
@@ -108,16 +111,19 @@ func (a *App) HandleDeckNewPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	a.storeCommanderCard(r, commander)
+
 	setFlash(w, "Deck created.")
 	http.Redirect(w, r, "/decks/"+strconv.FormatInt(d.ID, 10), http.StatusSeeOther)
 }
 
 // Show a single deck, its cards, and commander details.
 // Also handles POSTs to add/decrement cards.
+// Public decks can be viewed by anyone; only the owner can change them.
 func (a *App) HandleDeckShow(w http.ResponseWriter, r *http.Request) {
 	user := CurrentUser(r)
 	flash := readFlash(w, r)
-	if user == nil {
+	if user == nil && r.Method == http.MethodPost {
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
 	}
@@ -131,6 +137,11 @@ func (a *App) HandleDeckShow(w http.ResponseWriter, r *http.Request) {
 
 	// Handle add / decrement operations
 	if r.Method == http.MethodPost {
+		if _, err := decks.GetDeck(r.Context(), a.DB, id, user.ID); err != nil {
+			a.RenderNotFound(w, r)
+			return
+		}
+
 		if err := r.ParseForm(); err != nil {
 			http.Error(w, "invalid form", http.StatusBadRequest)
 			return
@@ -151,40 +162,20 @@ func (a *App) HandleDeckShow(w http.ResponseWriter, r *http.Request) {
 						return
 					}
 
-					deckCards, derr := decks.ListDeckCards(r.Context(), a.DB, id)
+					page, derr := a.loadDeckPage(r, d)
 					if derr != nil {
 						a.RenderServerError(w, r, derr)
 						return
 					}
 
-					// Try to fetch commander details again (optional).
-					var commanderCard *cards.Card
-					if d.CommanderName != "" {
-						scry := cards.NewScryfallClient()
-						results, serr := scry.SearchByName(r.Context(), d.CommanderName+" is:commander")
-						if serr == nil && len(results) > 0 {
-							commanderCard = &results[0]
-						}
-					}
-
-					type deckPageData struct {
-						Deck      *decks.Deck
-						DeckCards []decks.DeckCard
-						Commander *cards.Card
-					}
-
 					data := TemplateData{
 						CurrentUser: user,
-						Data: deckPageData{
-							Deck:      d,
-							DeckCards: deckCards,
-							Commander: commanderCard,
-						},
-						Flash: flash,
-						Error: fmt.Sprintf("No card found named “%s”. Please check the spelling.", cardName),
+						Data:        page,
+						Flash:       flash,
+						Error:       fmt.Sprintf("No card found named “%s”. Please check the spelling.", cardName),
 					}
 
-					a.Renderer.Render(w, "deck_show", data)
+					a.Renderer.Render(w, r, "deck_show", data)
 					return
 				}
 
@@ -226,46 +217,158 @@ func (a *App) HandleDeckShow(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// GET: load deck, cards, and commander details
-	d, err := decks.GetDeck(r.Context(), a.DB, id, user.ID)
+	var viewerID int64
+	if user != nil {
+		viewerID = user.ID
+	}
+
+	d, err := decks.GetVisibleDeck(r.Context(), a.DB, id, viewerID)
 	if err != nil {
 		a.RenderNotFound(w, r)
 		return
 	}
 
-	deckCards, err := decks.ListDeckCards(r.Context(), a.DB, id)
+	page, err := a.loadDeckPage(r, d)
 	if err != nil {
 		a.RenderServerError(w, r, err)
 		return
 	}
 
-	// Try to fetch commander details from Scryfall, if we have a commander name
+	data := TemplateData{
+		CurrentUser: user,
+		Data:        page,
+		Flash:       flash,
+		OpenGraph:   a.deckOpenGraph(r, d, page.DeckCards),
+	}
+
+	a.Renderer.Render(w, r, "deck_show", data)
+}
+
+type deckPageData struct {
+	Deck        *decks.Deck
+	DeckCards   []decks.DeckCard
+	Commander   *cards.Card
+	Bracket     decks.BracketEstimate
+	Combos      combos.Result
+	IsOwner     bool
+	Suggestions []decks.Recommendation
+
+	// Legality is checked under the Commander rules, or under the house
+	// rules of one of the viewer's playgroups (RulesGroupID) when picked.
+	Legality     decks.Legality
+	RuleGroups   []groups.Group
+	RulesGroupID int64
+
+	// ReportReasons are offered to signed-in visitors of a public deck
+	// that isn't theirs.
+	ReportReasons []decks.ReportReason
+}
+
+// suggestionLimit is how many recommended cards the deck page offers.
+const suggestionLimit = 15
+
+// loadDeckPage gathers everything deck_show needs for a deck the current
+// user is allowed to see.
+func (a *App) loadDeckPage(r *http.Request, d *decks.Deck) (deckPageData, error) {
+	deckCards, err := decks.ListDeckCards(r.Context(), a.DB, d.ID)
+	if err != nil {
+		return deckPageData{}, err
+	}
+
+	// Commander details come from the cards table, falling back to Scryfall
+	// for a commander that isn't stored yet.
 	var commanderCard *cards.Card
 	if d.CommanderName != "" {
-		scry := cards.NewScryfallClient()
-		results, err := scry.SearchByName(r.Context(), d.CommanderName+" is:commander")
-		if err == nil && len(results) > 0 {
-			commanderCard = &results[0]
+		commanderCard, err = cards.FindCardByName(r.Context(), a.DB, d.CommanderName)
+		if err != nil && !errors.Is(err, cards.ErrCardNotFound) {
+			return deckPageData{}, err
+		}
+		if commanderCard == nil {
+			scry := cards.NewScryfallClient()
+			results, err := scry.SearchByName(r.Context(), d.CommanderName+" is:commander")
+			if err == nil && len(results) > 0 {
+				commanderCard = &results[0]
+			}
+			// If there is an error or no results, we just leave commanderCard nil
 		}
-		// If there is an error or no results, we just leave commanderCard nil
 	}
 
-	type deckPageData struct {
-		Deck      *decks.Deck
-		DeckCards []decks.DeckCard
-		Commander *cards.Card
+	cardNames := make([]string, 0, len(deckCards))
+	for _, dc := range deckCards {
+		cardNames = append(cardNames, dc.CardName)
 	}
 
-	data := TemplateData{
-		CurrentUser: user,
-		Data: deckPageData{
-			Deck:      d,
-			DeckCards: deckCards,
-			Commander: commanderCard,
-		},
-		Flash: flash,
+	deckCombos, err := combos.FindCombos(r.Context(), a.DB, []string{d.CommanderName}, cardNames)
+	if err != nil {
+		return deckPageData{}, err
+	}
+
+	user := CurrentUser(r)
+	isOwner := user != nil && user.ID == d.UserID
+
+	// Suggestions are only useful to someone who can add them.
+	var suggestions []decks.Recommendation
+	if isOwner && d.CommanderName != "" {
+		cmd, err := cards.EnsureCardByName(r.Context(), a.DB, d.CommanderName)
+		if err != nil {
+			log.Printf("suggestions: commander lookup for deck %d: %v", d.ID, err)
+		} else {
+			suggestions, err = decks.RecommendCards(r.Context(), a.DB, d, cmd.ColorIdentity, suggestionLimit)
+			if err != nil {
+				return deckPageData{}, err
+			}
+		}
 	}
 
-	a.Renderer.Render(w, "deck_show", data)
+	bracket := decks.EstimateBracket(a.Brackets, d.CommanderName, deckCards)
+
+	rules := a.commanderRules()
+	var ruleGroups []groups.Group
+	var rulesGroupID int64
+	if user != nil {
+		ruleGroups, err = groups.ListGroupsForUser(r.Context(), a.DB, user.ID)
+		if err != nil {
+			return deckPageData{}, err
+		}
+		groupID, _ := strconv.ParseInt(r.URL.Query().Get("rules"), 10, 64)
+		for i := range ruleGroups {
+			if ruleGroups[i].ID == groupID {
+				rules = a.groupRules(&ruleGroups[i])
+				rulesGroupID = groupID
+			}
+		}
+	}
+
+	var reportReasons []decks.ReportReason
+	if user != nil && !isOwner && d.IsPublic && !d.Hidden {
+		reportReasons = decks.ReportReasons
+	}
+
+	return deckPageData{
+		Deck:          d,
+		DeckCards:     deckCards,
+		Commander:     commanderCard,
+		Bracket:       bracket,
+		Combos:        deckCombos,
+		IsOwner:       isOwner,
+		Suggestions:   suggestions,
+		Legality:      decks.CheckLegality(rules, d, commanderCard, deckCards, bracket),
+		RuleGroups:    ruleGroups,
+		RulesGroupID:  rulesGroupID,
+		ReportReasons: reportReasons,
+	}, nil
+}
+
+// storeCommanderCard makes sure a deck's commander is in the cards table so
+// its color identity is known when grouping decks for recommendations.
+// Failures only cost recommendation quality, so they are logged and ignored.
+func (a *App) storeCommanderCard(r *http.Request, commanderName string) {
+	if strings.TrimSpace(commanderName) == "" {
+		return
+	}
+	if _, err := cards.EnsureCardByName(r.Context(), a.DB, commanderName); err != nil {
+		log.Printf("store commander card %q: %v", commanderName, err)
+	}
 }
 
 func (a *App) HandleDeckEditShow(w http.ResponseWriter, r *http.Request) {
@@ -300,7 +403,7 @@ func (a *App) HandleDeckEditShow(w http.ResponseWriter, r *http.Request) {
 		Flash:       flash,
 	}
 
-	a.Renderer.Render(w, "decks_edit", data)
+	a.Renderer.Render(w, r, "decks_edit", data)
 }
 
 func (a *App) HandleDeckEditPost(w http.ResponseWriter, r *http.Request) {
@@ -327,7 +430,8 @@ func (a *App) HandleDeckEditPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if _, err := decks.GetDeck(r.Context(), a.DB, id, user.ID); err != nil {
+	d, err := decks.GetDeck(r.Context(), a.DB, id, user.ID)
+	if err != nil {
 		a.RenderNotFound(w, r)
 		return
 	}
@@ -341,7 +445,23 @@ func (a *App) HandleDeckEditPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	setFlash(w, "Deck updated.")
+	// Sharing a deck publicly needs a verified email; decks that are
+	// already public stay that way.
+	public := r.Form.Get("is_public") == "1"
+	flash := "Deck updated."
+	if public && !d.IsPublic && !user.EmailVerified {
+		public = false
+		flash = "Deck updated. Verify your email address in Settings to share decks publicly."
+	}
+
+	if err := decks.SetDeckPublic(r.Context(), a.DB, id, public); err != nil {
+		http.Error(w, "could not update deck", http.StatusInternalServerError)
+		return
+	}
+
+	a.storeCommanderCard(r, commander)
+
+	setFlash(w, flash)
 	http.Redirect(w, r, "/decks/"+strconv.FormatInt(id, 10), http.StatusSeeOther)
 }
 
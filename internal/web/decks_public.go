@@ -2,17 +2,28 @@ package web
 
 import (
 	"net/http"
+
+	"manatomb/app/internal/decks"
 )
 
+// publicDecksLimit caps how many decks the browse page lists.
+const publicDecksLimit = 100
+
 func (a *App) HandlePublicDecks(w http.ResponseWriter, r *http.Request) {
 	user := CurrentUser(r)
 	flash := readFlash(w, r)
 
+	publicDecks, err := decks.ListPublicDecks(r.Context(), a.DB, publicDecksLimit)
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
 	data := TemplateData{
 		CurrentUser: user,
+		Data:        publicDecks,
 		Flash:       flash,
-		// Data is unused for now
 	}
 
-	a.Renderer.Render(w, "decks_public", data)
+	a.Renderer.Render(w, r, "decks_public", data)
 }
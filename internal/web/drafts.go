@@ -0,0 +1,263 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"manatomb/app/internal/cubes"
+	"manatomb/app/internal/decks"
+	"manatomb/app/internal/draft"
+)
+
+// POST /drafts
+//
+// Opens a draft lobby for a cube. Seats nobody joins are filled with bots
+// when the host starts the draft.
+func (a *App) HandleDraftCreatePost(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	cubeID, _ := strconv.ParseInt(r.Form.Get("cube_id"), 10, 64)
+	c, err := cubes.GetCube(r.Context(), a.DB, cubeID)
+	if err != nil {
+		a.RenderNotFound(w, r)
+		return
+	}
+	cubeURL := "/cubes/" + strconv.FormatInt(c.ID, 10)
+
+	cubeCards, err := cubes.ListCubeCards(r.Context(), a.DB, c.ID)
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	seed, err := strconv.ParseInt(r.Form.Get("seed"), 10, 64)
+	if err != nil {
+		seed = time.Now().UnixNano()
+	}
+
+	opts := draft.Options{
+		CubeID:    c.ID,
+		CubeName:  c.Name,
+		Cards:     draftCards(cubeCards),
+		Seats:     formInt(r, "seats", defaultSeats),
+		PackCount: formInt(r, "packs", defaultPackCount),
+		PackSize:  formInt(r, "pack_size", defaultPackSize),
+		Seed:      seed,
+	}
+	if opts.Seats < draft.MinSeats || opts.Seats > draft.MaxSeats || opts.PackCount <= 0 || opts.PackSize <= 0 {
+		setFlash(w, fmt.Sprintf("A draft needs %d to %d seats and at least one card per pack.", draft.MinSeats, draft.MaxSeats))
+		http.Redirect(w, r, cubeURL, http.StatusSeeOther)
+		return
+	}
+
+	d, err := a.Drafts.Create(draft.Seat{UserID: user.ID, Name: user.DisplayName}, opts)
+	if errors.Is(err, draft.ErrNotEnoughCards) {
+		setFlash(w, fmt.Sprintf("That draft needs %d cards; the cube has %d.", opts.Seats*opts.PackCount*opts.PackSize, len(cubeCards)))
+		http.Redirect(w, r, cubeURL, http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/drafts/"+d.Code, http.StatusSeeOther)
+}
+
+// GET /drafts/{code}
+func (a *App) HandleDraftShow(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	flash := readFlash(w, r)
+
+	d, err := a.Drafts.Get(r.PathValue("code"))
+	if err != nil {
+		a.RenderNotFound(w, r)
+		return
+	}
+
+	data := TemplateData{
+		CurrentUser: user,
+		Data: struct {
+			Draft  *draft.Draft
+			View   draft.View
+			IsHost bool
+		}{
+			Draft:  d,
+			View:   d.ViewFor(user.ID),
+			IsHost: d.HostID == user.ID,
+		},
+		Flash: flash,
+	}
+
+	a.Renderer.Render(w, r, "draft_show", data)
+}
+
+// POST /drafts/{code}
+func (a *App) HandleDraftPost(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	d, err := a.Drafts.Get(r.PathValue("code"))
+	if err != nil {
+		a.RenderNotFound(w, r)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	var msg string
+	switch r.Form.Get("action") {
+	case "join":
+		err = d.Join(user.ID, user.DisplayName)
+	case "start":
+		if d.HostID != user.ID {
+			http.Error(w, "only the host can start the draft", http.StatusForbidden)
+			return
+		}
+		err = d.Start()
+	case "pick":
+		cardID, _ := strconv.ParseInt(r.Form.Get("card_id"), 10, 64)
+		err = d.Pick(user.ID, cardID)
+		if err == nil && d.BeginSave() {
+			msg, err = a.saveDraftPools(r, d)
+		}
+	case "save":
+		// Retries a save that failed when the last pick was made.
+		if d.BeginSave() {
+			msg, err = a.saveDraftPools(r, d)
+		}
+	default:
+		http.Error(w, "unknown action", http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, draft.ErrDraftFull):
+			msg = "This draft is full."
+		case errors.Is(err, draft.ErrDraftStarted):
+			msg = "This draft has already started."
+		case errors.Is(err, draft.ErrNotYourPick), errors.Is(err, draft.ErrUnknownCard):
+			msg = "That pick is no longer available."
+		default:
+			log.Printf("draft %s %s: %v", d.Code, r.Form.Get("action"), err)
+			msg = "Something went wrong. Please try again."
+		}
+	}
+
+	if msg != "" {
+		setFlash(w, msg)
+	}
+	http.Redirect(w, r, "/drafts/"+d.Code, http.StatusSeeOther)
+}
+
+// GET /drafts/{code}/events
+//
+// Streams the draft's version number as Server-Sent Events; the page
+// reloads when it changes.
+func (a *App) HandleDraftEvents(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	d, err := a.Drafts.Get(r.PathValue("code"))
+	if err != nil {
+		http.Error(w, "draft not found", http.StatusNotFound)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	updates, unsubscribe := d.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	fmt.Fprintf(w, "data: %d\n\n", d.ViewFor(user.ID).Version)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(tableKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case version := <-updates:
+			fmt.Fprintf(w, "data: %d\n\n", version)
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// saveDraftPools stores every drafter's picks as a draft-format deck. Bot
+// pools go to the host so they can be played against. The caller must
+// have claimed the save with BeginSave; if storing fails nothing is kept
+// and the save can be tried again.
+func (a *App) saveDraftPools(r *http.Request, d *draft.Draft) (string, error) {
+	var pools []decks.PoolDeck
+	for _, s := range d.Seats() {
+		owner, name := s.UserID, d.CubeName+" draft"
+		if s.Bot {
+			owner, name = d.HostID, d.CubeName+" draft ("+s.Name+")"
+		}
+
+		cardCounts := map[int64]int{}
+		for _, c := range s.Pool {
+			cardCounts[c.ID]++
+		}
+		pools = append(pools, decks.PoolDeck{
+			UserID:      owner,
+			Name:        name,
+			Description: "Drafted from " + d.CubeName + " (seed " + strconv.FormatInt(d.Seed, 10) + ").",
+			Cards:       cardCounts,
+		})
+	}
+
+	if err := decks.CreatePoolDecks(r.Context(), a.DB, decks.FormatDraft, pools); err != nil {
+		d.CancelSave()
+		return "", err
+	}
+	d.SaveDone()
+	return "The draft is over. Every pool has been saved as a deck.", nil
+}
@@ -0,0 +1,121 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"time"
+
+	"manatomb/app/internal/account"
+	mailer "manatomb/app/internal/mail"
+)
+
+// validEmail accepts a bare address such as "name@example.com", without a
+// display name or angle brackets.
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
+
+// sendMail sends in the background so a slow mail server doesn't hold up
+// the response, or give away through its timing whether an account exists.
+func (a *App) sendMail(m mailer.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if err := a.Mailer.Send(ctx, m); err != nil {
+			log.Printf("send mail %q error: %v", m.Subject, err)
+		}
+	}()
+}
+
+// sendVerification emails u a link proving they can read mail at email:
+// their current address to verify it, or a new one to move the account.
+func (a *App) sendVerification(r *http.Request, u *account.User, email string) error {
+	page, err := a.mailURL("/verify-email")
+	if err != nil {
+		return err
+	}
+	token, err := account.CreateEmailVerification(r.Context(), a.DB, u.ID, email)
+	if err != nil {
+		return err
+	}
+	link := page + "?token=" + url.QueryEscape(token)
+
+	if email == u.Email {
+		a.sendMail(mailer.Message{
+			To:      email,
+			Subject: "Verify your Mana Tomb email",
+			Text: "Hi " + u.DisplayName + ",\n\n" +
+				"Please confirm this is your email address by opening this link within the next day:\n\n" +
+				link + "\n\n" +
+				"If you didn't create a Mana Tomb account, you can ignore this email.\n",
+		})
+		return nil
+	}
+
+	a.sendMail(mailer.Message{
+		To:      email,
+		Subject: "Confirm your new Mana Tomb email",
+		Text: "Hi " + u.DisplayName + ",\n\n" +
+			"You asked to move your Mana Tomb account to this address. " +
+			"To confirm, open this link within the next day:\n\n" +
+			link + "\n\n" +
+			"Until you do, your account keeps using " + u.Email + ". " +
+			"If you didn't ask for this, you can ignore this email.\n",
+	})
+	return nil
+}
+
+// GET /verify-email?token=...
+// Follows an emailed verification link. The token is the proof, so this
+// works whether or not the browser is signed in.
+func (a *App) HandleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Referrer-Policy", "no-referrer")
+
+	next := "/login"
+	if CurrentUser(r) != nil {
+		next = "/settings"
+	}
+
+	change, err := account.ConfirmEmail(r.Context(), a.DB, r.URL.Query().Get("token"))
+	switch {
+	case errors.Is(err, account.ErrInvalidVerifyToken):
+		setFlash(w, "That verification link has expired or was already used.")
+		http.Redirect(w, r, next, http.StatusSeeOther)
+		return
+	case errors.Is(err, account.ErrEmailTaken):
+		setFlash(w, "That email address now belongs to another account.")
+		http.Redirect(w, r, next, http.StatusSeeOther)
+		return
+	case err != nil:
+		log.Printf("confirm email error: %v", err)
+		setFlash(w, "Could not verify your email. Please try again.")
+		http.Redirect(w, r, next, http.StatusSeeOther)
+		return
+	}
+
+	if !change.Changed() {
+		setFlash(w, "Email verified. Thanks!")
+		http.Redirect(w, r, next, http.StatusSeeOther)
+		return
+	}
+
+	// Tell the old address, in case this wasn't its owner's doing.
+	a.sendMail(mailer.Message{
+		To:      change.OldEmail,
+		Subject: "Your Mana Tomb email was changed",
+		Text: "Hi,\n\n" +
+			"The email address for your Mana Tomb account was just changed from " +
+			change.OldEmail + " to " + change.NewEmail + ".\n\n" +
+			"If you made this change, there's nothing else to do. If you didn't, " +
+			"someone else may have access to your account; reply to this email so we can help.\n",
+	})
+
+	setFlash(w, "Email changed to "+change.NewEmail+".")
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
@@ -0,0 +1,403 @@
+package web
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"manatomb/app/internal/decks"
+	"manatomb/app/internal/events"
+)
+
+const (
+	eventsListLimit = 100
+
+	// Defaults for new events; organizers can change them.
+	defaultRoundMinutes = 75
+	defaultWinPoints    = 3
+	defaultDrawPoints   = 1
+
+	// extendRoundMinutes is how much time "Add time" puts on the clock.
+	extendRoundMinutes = 5
+)
+
+// GET /events
+func (a *App) HandleEventsList(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	flash := readFlash(w, r)
+
+	list, err := events.ListEvents(r.Context(), a.DB, eventsListLimit)
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	data := TemplateData{
+		CurrentUser: user,
+		Data: struct {
+			Events       []events.Event
+			Today        string
+			RoundMinutes int
+			WinPoints    int
+			DrawPoints   int
+		}{
+			Events:       list,
+			Today:        time.Now().Format("2006-01-02T15:04"),
+			RoundMinutes: defaultRoundMinutes,
+			WinPoints:    defaultWinPoints,
+			DrawPoints:   defaultDrawPoints,
+		},
+		Flash: flash,
+	}
+
+	a.Renderer.Render(w, r, "events_list", data)
+}
+
+// POST /events
+func (a *App) HandleEventCreatePost(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	e := &events.Event{
+		OrganizerID:  user.ID,
+		Name:         strings.TrimSpace(r.Form.Get("name")),
+		Description:  strings.TrimSpace(r.Form.Get("description")),
+		RoundMinutes: formInt(r, "round_minutes", defaultRoundMinutes),
+		WinPoints:    formInt(r, "win_points", defaultWinPoints),
+		DrawPoints:   formInt(r, "draw_points", defaultDrawPoints),
+	}
+
+	startsAt, err := time.ParseInLocation("2006-01-02T15:04", r.Form.Get("starts_at"), time.Local)
+	if e.Name == "" || err != nil || e.RoundMinutes <= 0 {
+		setFlash(w, "Please give the event a name, a start time and a round length.")
+		http.Redirect(w, r, "/events", http.StatusSeeOther)
+		return
+	}
+	e.StartsAt = startsAt
+
+	id, err := events.CreateEvent(r.Context(), a.DB, e)
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	setFlash(w, "Event created. Players can register from the event page.")
+	http.Redirect(w, r, "/events/"+strconv.FormatInt(id, 10), http.StatusSeeOther)
+}
+
+// GET /events/{id}
+func (a *App) HandleEventShow(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	flash := readFlash(w, r)
+
+	e, ok := a.loadEvent(w, r)
+	if !ok {
+		return
+	}
+
+	regs, err := events.ListRegistrations(r.Context(), a.DB, e.ID)
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	rounds, err := events.ListRounds(r.Context(), a.DB, e.ID)
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	userDecks, err := decks.ListDecksByUser(r.Context(), a.DB, user.ID)
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	var mine *events.Registration
+	for i := range regs {
+		if regs[i].UserID == user.ID {
+			mine = &regs[i]
+		}
+	}
+
+	var current *events.Round
+	if n := len(rounds); n > 0 {
+		current = &rounds[n-1]
+	}
+
+	data := TemplateData{
+		CurrentUser: user,
+		Data: struct {
+			Event         *events.Event
+			IsOrganizer   bool
+			Registrations []events.Registration
+			Mine          *events.Registration
+			Decks         []decks.Deck
+			Rounds        []events.Round
+			Current       *events.Round
+			CanStartRound bool
+			Standings     []events.Standing
+		}{
+			Event:         e,
+			IsOrganizer:   e.OrganizerID == user.ID,
+			Registrations: regs,
+			Mine:          mine,
+			Decks:         userDecks,
+			Rounds:        rounds,
+			Current:       current,
+			CanStartRound: e.Status != events.StatusFinished && (current == nil || current.Complete()),
+			Standings:     events.ComputeStandings(e, regs, rounds),
+		},
+		Flash: flash,
+	}
+
+	a.Renderer.Render(w, r, "event_show", data)
+}
+
+// POST /events/{id}
+func (a *App) HandleEventPost(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	e, ok := a.loadEvent(w, r)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	eventURL := "/events/" + strconv.FormatInt(e.ID, 10)
+	action := r.Form.Get("action")
+
+	if action != "register" && action != "drop" && e.OrganizerID != user.ID {
+		http.Error(w, "only the organizer can do that", http.StatusForbidden)
+		return
+	}
+	if e.Status == events.StatusFinished {
+		setFlash(w, "This event has finished.")
+		http.Redirect(w, r, eventURL, http.StatusSeeOther)
+		return
+	}
+
+	var (
+		err error
+		msg string
+	)
+	switch action {
+	case "register":
+		deckID, _ := strconv.ParseInt(r.Form.Get("deck_id"), 10, 64)
+		if _, derr := decks.GetDeck(r.Context(), a.DB, deckID, user.ID); derr != nil {
+			msg = "Please pick one of your decks to register with."
+			break
+		}
+		err = events.Register(r.Context(), a.DB, e.ID, user.ID, deckID)
+		msg = "You're registered."
+	case "drop":
+		err = events.Drop(r.Context(), a.DB, e.ID, user.ID)
+		msg = "You've dropped from the event."
+	case "start_round":
+		msg, err = a.startEventRound(r, e)
+	case "extend_round":
+		roundID, _ := strconv.ParseInt(r.Form.Get("round_id"), 10, 64)
+		err = events.ExtendRound(r.Context(), a.DB, e.ID, roundID, extendRoundMinutes)
+		msg = "Added " + strconv.Itoa(extendRoundMinutes) + " minutes to the round."
+	case "report_pod":
+		msg, err = a.reportEventPod(r, e)
+	case "finish":
+		err = events.SetStatus(r.Context(), a.DB, e.ID, events.StatusFinished)
+		msg = "Event finished. The final report is ready."
+		eventURL += "/report"
+	default:
+		http.Error(w, "unknown action", http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, events.ErrTooFewPlayers):
+			msg = "At least 3 active players are needed to start a round."
+		case errors.Is(err, events.ErrPodNotFound):
+			msg = "That pod isn't part of this event."
+		default:
+			log.Printf("event %d %s: %v", e.ID, action, err)
+			msg = "Something went wrong. Please try again."
+		}
+		eventURL = "/events/" + strconv.FormatInt(e.ID, 10)
+	}
+
+	setFlash(w, msg)
+	http.Redirect(w, r, eventURL, http.StatusSeeOther)
+}
+
+// GET /events/{id}/report
+func (a *App) HandleEventReport(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	e, ok := a.loadEvent(w, r)
+	if !ok {
+		return
+	}
+
+	regs, err := events.ListRegistrations(r.Context(), a.DB, e.ID)
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	rounds, err := events.ListRounds(r.Context(), a.DB, e.ID)
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	data := TemplateData{
+		CurrentUser: user,
+		Data: struct {
+			Event     *events.Event
+			Rounds    []events.Round
+			Standings []events.Standing
+		}{
+			Event:     e,
+			Rounds:    rounds,
+			Standings: events.ComputeStandings(e, regs, rounds),
+		},
+	}
+
+	a.Renderer.Render(w, r, "event_report", data)
+}
+
+// startEventRound pairs the active players into pods for the next round.
+func (a *App) startEventRound(r *http.Request, e *events.Event) (string, error) {
+	rounds, err := events.ListRounds(r.Context(), a.DB, e.ID)
+	if err != nil {
+		return "", err
+	}
+	if n := len(rounds); n > 0 && !rounds[n-1].Complete() {
+		return "Report every pod in the current round first.", nil
+	}
+
+	regs, err := events.ListRegistrations(r.Context(), a.DB, e.ID)
+	if err != nil {
+		return "", err
+	}
+	var players []int64
+	for _, reg := range regs {
+		if !reg.Dropped {
+			players = append(players, reg.UserID)
+		}
+	}
+
+	number := len(rounds) + 1
+	pods, err := events.PairPods(players, rounds, e.ID*1000+int64(number))
+	if err != nil {
+		return "", err
+	}
+
+	if err := events.CreateRound(r.Context(), a.DB, e.ID, number, e.RoundMinutes, pods); err != nil {
+		return "", err
+	}
+	return "Round " + strconv.Itoa(number) + " has started.", nil
+}
+
+// reportEventPod records a pod's winner (or a draw) and achievement points.
+func (a *App) reportEventPod(r *http.Request, e *events.Event) (string, error) {
+	podID, _ := strconv.ParseInt(r.Form.Get("pod_id"), 10, 64)
+
+	rounds, err := events.ListRounds(r.Context(), a.DB, e.ID)
+	if err != nil {
+		return "", err
+	}
+
+	var pod *events.Pod
+	for i := range rounds {
+		for j := range rounds[i].Pods {
+			if rounds[i].Pods[j].ID == podID {
+				pod = &rounds[i].Pods[j]
+			}
+		}
+	}
+	if pod == nil {
+		return "", events.ErrPodNotFound
+	}
+
+	winner := r.Form.Get("winner")
+	if winner == "" {
+		return "Pick a winner or mark the pod as a draw.", nil
+	}
+
+	results := map[int64]string{}
+	achievements := map[int64]int{}
+	for _, p := range pod.Players {
+		id := strconv.FormatInt(p.UserID, 10)
+		switch winner {
+		case "draw":
+			results[p.UserID] = events.ResultDraw
+		case id:
+			results[p.UserID] = events.ResultWin
+		default:
+			results[p.UserID] = events.ResultLoss
+		}
+		achievements[p.UserID] = formInt(r, "ach_"+id, 0)
+	}
+
+	if err := events.ReportPod(r.Context(), a.DB, e.ID, podID, results, achievements); err != nil {
+		return "", err
+	}
+	return "Table " + strconv.Itoa(pod.Table) + " reported.", nil
+}
+
+func (a *App) loadEvent(w http.ResponseWriter, r *http.Request) (*events.Event, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		a.RenderNotFound(w, r)
+		return nil, false
+	}
+
+	e, err := events.GetEvent(r.Context(), a.DB, id)
+	if err != nil {
+		a.RenderNotFound(w, r)
+		return nil, false
+	}
+	return e, true
+}
+
+// formInt reads an integer form field, falling back to def when it is
+// missing or malformed.
+func formInt(r *http.Request, name string, def int) int {
+	n, err := strconv.Atoi(strings.TrimSpace(r.Form.Get(name)))
+	if err != nil {
+		return def
+	}
+	return n
+}
@@ -0,0 +1,352 @@
+package web
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"manatomb/app/internal/account"
+	"manatomb/app/internal/decks"
+	"manatomb/app/internal/games"
+)
+
+// maxGameSeats is how many player rows the "log a game" form offers.
+const maxGameSeats = 6
+
+// winConditions are offered as suggestions on the "log a game" form.
+var winConditions = []string{
+	"Combat damage",
+	"Commander damage",
+	"Combo",
+	"Alternate win",
+	"Poison",
+	"Mill",
+	"Concession",
+}
+
+type gameSeatForm struct {
+	Seat      int
+	Player    string
+	DeckID    int64
+	Commander string
+}
+
+type gameFormData struct {
+	PlayedAt      string
+	WinCondition  string
+	TurnCount     string
+	Notes         string
+	Winner        int
+	Seats         []gameSeatForm
+	Decks         []decks.Deck
+	WinConditions []string
+}
+
+// GET /games
+func (a *App) HandleGamesList(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	flash := readFlash(w, r)
+
+	userGames, err := games.ListGamesForUser(r.Context(), a.DB, user.ID)
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	data := TemplateData{
+		CurrentUser: user,
+		Data: struct {
+			Games []games.Game
+			Stats games.Stats
+		}{
+			Games: userGames,
+			Stats: games.ComputeStats(userGames),
+		},
+		Flash: flash,
+	}
+
+	a.Renderer.Render(w, r, "games_list", data)
+}
+
+// GET /games/new
+func (a *App) HandleGameNewShow(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	flash := readFlash(w, r)
+
+	form, err := a.newGameForm(r, user)
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	// Pre-fill the first seat with the current user, and their deck if we
+	// came from a deck page.
+	form.Seats[0].Player = user.Email
+	if deckID, err := strconv.ParseInt(r.URL.Query().Get("deck_id"), 10, 64); err == nil {
+		form.Seats[0].DeckID = deckID
+	}
+
+	data := TemplateData{
+		CurrentUser: user,
+		Data:        form,
+		Flash:       flash,
+	}
+
+	a.Renderer.Render(w, r, "games_new", data)
+}
+
+// POST /games/new
+func (a *App) HandleGameNewPost(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	form, err := a.newGameForm(r, user)
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	form.PlayedAt = strings.TrimSpace(r.Form.Get("played_at"))
+	form.WinCondition = strings.TrimSpace(r.Form.Get("win_condition"))
+	form.TurnCount = strings.TrimSpace(r.Form.Get("turn_count"))
+	form.Notes = strings.TrimSpace(r.Form.Get("notes"))
+	form.Winner, _ = strconv.Atoi(r.Form.Get("winner"))
+	for i := range form.Seats {
+		n := strconv.Itoa(i + 1)
+		form.Seats[i].Player = strings.TrimSpace(r.Form.Get("player_" + n))
+		form.Seats[i].DeckID, _ = strconv.ParseInt(r.Form.Get("deck_"+n), 10, 64)
+		form.Seats[i].Commander = strings.TrimSpace(r.Form.Get("commander_" + n))
+	}
+
+	renderErr := func(msg string) {
+		data := TemplateData{
+			CurrentUser: user,
+			Data:        form,
+			Error:       msg,
+		}
+		a.Renderer.Render(w, r, "games_new", data)
+	}
+
+	playedAt, err := time.Parse("2006-01-02", form.PlayedAt)
+	if err != nil {
+		renderErr("Please enter the date the game was played.")
+		return
+	}
+
+	turnCount := 0
+	if form.TurnCount != "" {
+		turnCount, err = strconv.Atoi(form.TurnCount)
+		if err != nil || turnCount < 0 {
+			renderErr("Turn count must be a positive number.")
+			return
+		}
+	}
+
+	g := &games.Game{
+		CreatedBy:    user.ID,
+		PlayedAt:     playedAt,
+		WinCondition: form.WinCondition,
+		TurnCount:    turnCount,
+		Notes:        form.Notes,
+	}
+
+	myDecks := map[int64]decks.Deck{}
+	for _, d := range form.Decks {
+		myDecks[d.ID] = d
+	}
+
+	seen := map[string]bool{}
+	for i, s := range form.Seats {
+		if s.Player == "" {
+			continue
+		}
+
+		p := games.Player{
+			Seat:          len(g.Players) + 1,
+			Name:          s.Player,
+			CommanderName: s.Commander,
+			IsWinner:      form.Winner == i+1,
+		}
+
+		// Emails of site users link the seat to their account; anything
+		// else, including an email no account uses, is a guest name. The
+		// form answers the same either way so it can't be used to find
+		// accounts.
+		if strings.Contains(s.Player, "@") {
+			key := strings.ToLower(s.Player)
+			if seen[key] {
+				renderErr("“" + s.Player + "” is listed more than once.")
+				return
+			}
+			seen[key] = true
+
+			u, err := account.GetUserByEmail(r.Context(), a.DB, s.Player)
+			switch {
+			case err == nil:
+				p.UserID = u.ID
+				p.Name = u.DisplayName
+			case !errors.Is(err, sql.ErrNoRows):
+				a.RenderServerError(w, r, err)
+				return
+			}
+		}
+
+		// Only your own decks are linked; other seats keep the commander
+		// name, which is enough for per-commander stats.
+		if p.UserID == user.ID && s.DeckID != 0 {
+			d, ok := myDecks[s.DeckID]
+			if !ok {
+				renderErr("Please pick one of your own decks.")
+				return
+			}
+			p.DeckID = d.ID
+			if p.CommanderName == "" {
+				p.CommanderName = d.CommanderName
+			}
+		}
+
+		g.Players = append(g.Players, p)
+	}
+
+	if _, err := games.CreateGame(r.Context(), a.DB, g); err != nil {
+		if errors.Is(err, games.ErrNotEnoughPlayers) {
+			renderErr("Add at least two players.")
+			return
+		}
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	setFlash(w, "Game logged.")
+	http.Redirect(w, r, "/games", http.StatusSeeOther)
+}
+
+// POST /games/delete
+func (a *App) HandleGameDeletePost(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.Form.Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid game id", http.StatusBadRequest)
+		return
+	}
+
+	if err := games.DeleteGame(r.Context(), a.DB, id, user.ID); err != nil {
+		log.Printf("delete game %d: %v", id, err)
+		setFlash(w, "Could not delete game.")
+		http.Redirect(w, r, "/games", http.StatusSeeOther)
+		return
+	}
+
+	setFlash(w, "Game deleted.")
+	http.Redirect(w, r, "/games", http.StatusSeeOther)
+}
+
+// GET /decks/{id}/games
+func (a *App) HandleDeckGames(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	flash := readFlash(w, r)
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		a.RenderNotFound(w, r)
+		return
+	}
+
+	var viewerID int64
+	if user != nil {
+		viewerID = user.ID
+	}
+
+	d, err := decks.GetVisibleDeck(r.Context(), a.DB, id, viewerID)
+	if err != nil {
+		a.RenderNotFound(w, r)
+		return
+	}
+
+	deckGames, err := games.ListGamesForDeck(r.Context(), a.DB, d.ID)
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	var record games.WinRate
+	for _, g := range deckGames {
+		record.Games++
+		if w := g.Winner(); w != nil && w.DeckID == d.ID {
+			record.Wins++
+		}
+	}
+
+	data := TemplateData{
+		CurrentUser: user,
+		Data: struct {
+			Deck    *decks.Deck
+			Games   []games.Game
+			Record  games.WinRate
+			IsOwner bool
+		}{
+			Deck:    d,
+			Games:   deckGames,
+			Record:  record,
+			IsOwner: user != nil && user.ID == d.UserID,
+		},
+		Flash: flash,
+	}
+
+	a.Renderer.Render(w, r, "deck_games", data)
+}
+
+func (a *App) newGameForm(r *http.Request, user *account.User) (gameFormData, error) {
+	userDecks, err := decks.ListDecksByUser(r.Context(), a.DB, user.ID)
+	if err != nil {
+		return gameFormData{}, err
+	}
+
+	form := gameFormData{
+		PlayedAt:      time.Now().Format("2006-01-02"),
+		Seats:         make([]gameSeatForm, maxGameSeats),
+		Decks:         userDecks,
+		WinConditions: winConditions,
+	}
+	for i := range form.Seats {
+		form.Seats[i].Seat = i + 1
+	}
+	return form, nil
+}
@@ -0,0 +1,331 @@
+package web
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"manatomb/app/internal/decks"
+	"manatomb/app/internal/groups"
+)
+
+// commanderRules are the plain Commander deck-building rules.
+func (a *App) commanderRules() decks.Rules {
+	return decks.Rules{Name: "Commander rules", Banned: a.Banned}
+}
+
+// groupRules are the Commander rules plus a playgroup's house rules.
+func (a *App) groupRules(g *groups.Group) decks.Rules {
+	return decks.Rules{
+		Name:          g.Name + " house rules",
+		Banned:        a.Banned,
+		HouseBanned:   decks.NewBanList(g.HouseBans),
+		TargetBracket: g.TargetBracket,
+	}
+}
+
+type bracketOption struct {
+	Value int
+	Label string
+}
+
+// bracketOptions are the choices for a group's target bracket.
+func bracketOptions() []bracketOption {
+	out := []bracketOption{{0, "No target"}}
+	for n := 1; n <= 5; n++ {
+		out = append(out, bracketOption{n, strconv.Itoa(n) + " · " + decks.BracketName(n)})
+	}
+	return out
+}
+
+// GET /groups
+func (a *App) HandleGroupsList(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	flash := readFlash(w, r)
+
+	userGroups, err := groups.ListGroupsForUser(r.Context(), a.DB, user.ID)
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	data := TemplateData{
+		CurrentUser: user,
+		Data:        userGroups,
+		Flash:       flash,
+	}
+
+	a.Renderer.Render(w, r, "groups_list", data)
+}
+
+// POST /groups
+func (a *App) HandleGroupCreatePost(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	name := strings.TrimSpace(r.Form.Get("name"))
+	description := strings.TrimSpace(r.Form.Get("description"))
+	if name == "" {
+		setFlash(w, "Please give your playgroup a name.")
+		http.Redirect(w, r, "/groups", http.StatusSeeOther)
+		return
+	}
+
+	g, err := groups.CreateGroup(r.Context(), a.DB, user.ID, name, description)
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	setFlash(w, "Playgroup created. Share the invite link to add members.")
+	http.Redirect(w, r, "/groups/"+strconv.FormatInt(g.ID, 10), http.StatusSeeOther)
+}
+
+// GET /groups/{id}
+func (a *App) HandleGroupShow(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	flash := readFlash(w, r)
+
+	g, role, ok := a.loadGroup(w, r, user.ID)
+	if !ok {
+		return
+	}
+
+	members, err := groups.ListMembers(r.Context(), a.DB, g.ID)
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	memberDecks, err := groups.ListMemberDecks(r.Context(), a.DB, g.ID)
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	data := TemplateData{
+		CurrentUser: user,
+		Data: struct {
+			Group          *groups.Group
+			IsOwner        bool
+			Members        []groups.Member
+			Decks          []groups.MemberDeck
+			HouseBans      string
+			BracketOptions []bracketOption
+			TargetName     string
+		}{
+			Group:          g,
+			IsOwner:        role == groups.RoleOwner,
+			Members:        members,
+			Decks:          memberDecks,
+			HouseBans:      strings.Join(g.HouseBans, "\n"),
+			BracketOptions: bracketOptions(),
+			TargetName:     decks.BracketName(g.TargetBracket),
+		},
+		Flash: flash,
+	}
+
+	a.Renderer.Render(w, r, "group_show", data)
+}
+
+// POST /groups/{id}
+func (a *App) HandleGroupPost(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	g, role, ok := a.loadGroup(w, r, user.ID)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	groupURL := "/groups/" + strconv.FormatInt(g.ID, 10)
+	action := r.Form.Get("action")
+
+	// Everyone may leave; everything else is for owners.
+	if action != "leave" && role != groups.RoleOwner {
+		http.Error(w, "only group owners can do that", http.StatusForbidden)
+		return
+	}
+
+	memberID, _ := strconv.ParseInt(r.Form.Get("user_id"), 10, 64)
+
+	var (
+		err error
+		msg string
+	)
+	switch action {
+	case "update":
+		name := strings.TrimSpace(r.Form.Get("name"))
+		if name == "" {
+			setFlash(w, "The group needs a name.")
+			http.Redirect(w, r, groupURL, http.StatusSeeOther)
+			return
+		}
+		g.Name = name
+		g.Description = strings.TrimSpace(r.Form.Get("description"))
+		g.RuleZero = strings.TrimSpace(r.Form.Get("rule_zero"))
+		g.TargetBracket, _ = strconv.Atoi(r.Form.Get("target_bracket"))
+		if decks.BracketName(g.TargetBracket) == "" {
+			g.TargetBracket = 0
+		}
+		g.HouseBans = parseCardLines(r.Form.Get("house_bans"))
+		err = groups.UpdateGroup(r.Context(), a.DB, g)
+		msg = "House rules saved."
+	case "rotate_invite":
+		err = groups.RotateInvite(r.Context(), a.DB, g.ID)
+		msg = "New invite link created; the old one no longer works."
+	case "promote":
+		err = groups.SetRole(r.Context(), a.DB, g.ID, memberID, groups.RoleOwner)
+		msg = "Member promoted to owner."
+	case "demote":
+		err = groups.SetRole(r.Context(), a.DB, g.ID, memberID, groups.RoleMember)
+		msg = "Owner changed to member."
+	case "remove":
+		err = groups.RemoveMember(r.Context(), a.DB, g.ID, memberID)
+		msg = "Member removed."
+	case "leave":
+		err = groups.RemoveMember(r.Context(), a.DB, g.ID, user.ID)
+		msg = "You left " + g.Name + "."
+		groupURL = "/groups"
+	case "delete":
+		err = groups.DeleteGroup(r.Context(), a.DB, g.ID)
+		msg = "Playgroup deleted."
+		groupURL = "/groups"
+	default:
+		http.Error(w, "unknown action", http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, groups.ErrLastOwner):
+			msg = "A playgroup needs at least one owner. Promote someone else first, or delete the group."
+		case errors.Is(err, groups.ErrNotMember):
+			msg = "That person isn't in this group."
+		default:
+			log.Printf("group %d %s: %v", g.ID, action, err)
+			msg = "Something went wrong. Please try again."
+		}
+		groupURL = "/groups/" + strconv.FormatInt(g.ID, 10)
+	}
+
+	setFlash(w, msg)
+	http.Redirect(w, r, groupURL, http.StatusSeeOther)
+}
+
+// GET/POST /groups/join/{code}
+func (a *App) HandleGroupJoin(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	g, err := groups.GetGroupByInvite(r.Context(), a.DB, r.PathValue("code"))
+	if err != nil {
+		a.RenderNotFound(w, r)
+		return
+	}
+
+	groupURL := "/groups/" + strconv.FormatInt(g.ID, 10)
+
+	_, err = groups.MemberRole(r.Context(), a.DB, g.ID, user.ID)
+	if err == nil {
+		http.Redirect(w, r, groupURL, http.StatusSeeOther)
+		return
+	}
+	if !errors.Is(err, groups.ErrNotMember) {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		data := TemplateData{
+			CurrentUser: user,
+			Data:        g,
+		}
+		a.Renderer.Render(w, r, "group_join", data)
+	case http.MethodPost:
+		if err := groups.AddMember(r.Context(), a.DB, g.ID, user.ID); err != nil {
+			a.RenderServerError(w, r, err)
+			return
+		}
+		setFlash(w, "Welcome to "+g.Name+"!")
+		http.Redirect(w, r, groupURL, http.StatusSeeOther)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// loadGroup loads the group named in the path and the user's role in it,
+// rendering a 404 for non-members.
+func (a *App) loadGroup(w http.ResponseWriter, r *http.Request, userID int64) (*groups.Group, string, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		a.RenderNotFound(w, r)
+		return nil, "", false
+	}
+
+	role, err := groups.MemberRole(r.Context(), a.DB, id, userID)
+	if errors.Is(err, groups.ErrNotMember) {
+		a.RenderNotFound(w, r)
+		return nil, "", false
+	}
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return nil, "", false
+	}
+
+	g, err := groups.GetGroup(r.Context(), a.DB, id)
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return nil, "", false
+	}
+	return g, role, true
+}
+
+// parseCardLines splits a textarea into card names, one per line, dropping
+// blanks and duplicates.
+func parseCardLines(s string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		key := strings.ToLower(line)
+		if line == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, line)
+	}
+	return out
+}
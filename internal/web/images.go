@@ -0,0 +1,106 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"manatomb/app/internal/decks"
+	"manatomb/app/internal/imgcache"
+)
+
+// Card images never change for a Scryfall ID, so browsers may keep them
+// for a month and revalidate with the ETag after that.
+const cardImageCacheControl = "public, max-age=2592000"
+
+// GET /img/{scryfall_id}/{size}
+//
+// Serves a card image through the disk cache; ?face=back gives the back
+// face of a double-faced card. size is one of small, normal, large or
+// art_crop.
+func (a *App) HandleCardImage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ref := imgcache.Ref{ID: r.PathValue("scryfall_id"), Size: r.PathValue("size"), Face: "front"}
+	if r.URL.Query().Get("face") == "back" {
+		ref.Face = "back"
+	}
+
+	f, info, err := a.Images.Open(r.Context(), ref)
+	if errors.Is(err, imgcache.ErrInvalid) || errors.Is(err, imgcache.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("card image %s/%s: %v", ref.ID, ref.Size, err)
+		http.Error(w, "image unavailable", http.StatusBadGateway)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", cardImageCacheControl)
+	w.Header().Set("ETag", info.ETag)
+	http.ServeContent(w, r, "", info.ModTime, f)
+}
+
+// POST /decks/{id}/images
+//
+// Downloads the images of every card in the deck into the cache ahead of
+// time, so the deck's pages don't wait on Scryfall.
+func (a *App) HandleDeckImagesPost(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		a.RenderNotFound(w, r)
+		return
+	}
+	d, err := decks.GetDeck(r.Context(), a.DB, id, user.ID)
+	if err != nil {
+		a.RenderNotFound(w, r)
+		return
+	}
+
+	printCards, err := decks.ListPrintCards(r.Context(), a.DB, d)
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	// Cards stored before Scryfall IDs were kept can't be cached; they
+	// still count toward the total so the message stays honest.
+	var refs []imgcache.Ref
+	total := 0
+	for _, pc := range printCards {
+		total++
+		if pc.BackName != "" {
+			total++
+		}
+		if pc.ScryfallID == "" {
+			continue
+		}
+		refs = append(refs, imgcache.Ref{ID: pc.ScryfallID, Size: "normal", Face: "front"})
+		if pc.BackName != "" {
+			refs = append(refs, imgcache.Ref{ID: pc.ScryfallID, Size: "normal", Face: "back"})
+		}
+	}
+
+	ready := a.Images.Warm(r.Context(), refs)
+
+	setFlash(w, fmt.Sprintf("%d of %d card images are cached.", ready, total))
+	http.Redirect(w, r, "/decks/"+strconv.FormatInt(d.ID, 10), http.StatusSeeOther)
+}
@@ -0,0 +1,106 @@
+package web
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+
+	"manatomb/app/internal/cards"
+)
+
+// Symbol colors, after the printed mana symbols.
+var manaFills = map[rune]string{
+	'W': "#f8f6d8",
+	'U': "#c1d7e9",
+	'B': "#bab1ab",
+	'R': "#e49977",
+	'G': "#a3c095",
+}
+
+const (
+	genericFill = "#cac5c0"
+	snowFill    = "#e6f0f7"
+	symbolInk   = "#0d0f0f"
+)
+
+// manaCostHTML renders a mana cost as inline SVG symbols. Costs that
+// don't parse are shown as plain text.
+func manaCostHTML(cost string) template.HTML {
+	var faces []string
+	for _, face := range strings.Split(cost, "//") {
+		mc, err := cards.ParseManaCost(face)
+		if err != nil {
+			return template.HTML(template.HTMLEscapeString(cost))
+		}
+		var b strings.Builder
+		for _, s := range mc.Symbols {
+			b.WriteString(manaSymbolSVG(s))
+		}
+		faces = append(faces, b.String())
+	}
+
+	out := strings.Join(faces, `<span class="mx-1 text-slate-500">//</span>`)
+	if strings.TrimSpace(out) == "" {
+		return ""
+	}
+	return template.HTML(`<span class="inline-flex items-center gap-0.5 align-middle">` + out + `</span>`)
+}
+
+// manaSymbolSVG draws one symbol on a 32x32 canvas. Raw only holds the
+// characters the parser accepts, so it is safe to write unescaped.
+func manaSymbolSVG(s cards.ManaSymbol) string {
+	var body string
+	switch s.Kind {
+	case cards.SymbolColored:
+		body = manaDisc(manaFills[rune(s.Colors[0])]) + manaText(16, 21.5, 17, s.Colors)
+	case cards.SymbolGeneric, cards.SymbolX:
+		size := 17.0
+		if len(s.Raw) > 1 {
+			size = 13
+		}
+		body = manaDisc(genericFill) + manaText(16, 16+size*0.34, size, s.Raw)
+	case cards.SymbolColorless:
+		body = manaDisc(genericFill) +
+			`<path d="M16 7L25 16L16 25L7 16Z" fill="none" stroke="` + symbolInk + `" stroke-width="2.5"/>`
+	case cards.SymbolSnow:
+		body = manaDisc(snowFill) +
+			`<path d="M16 7V25M8.2 11.5L23.8 20.5M8.2 20.5L23.8 11.5" stroke="` + symbolInk + `" stroke-width="2.5" stroke-linecap="round"/>`
+	case cards.SymbolHybrid, cards.SymbolPhyrexian:
+		// Halves follow the printed order, e.g. {R/W} is red first.
+		parts := strings.Split(strings.TrimSuffix(s.Raw, "/P"), "/")
+		first, last := parts[0], parts[len(parts)-1]
+		firstFill, ok := manaFills[rune(first[0])]
+		if !ok {
+			firstFill = genericFill
+		}
+		if len(parts) == 1 {
+			body = manaDisc(firstFill)
+		} else {
+			body = manaHalves(firstFill, manaFills[rune(last[0])])
+		}
+		if s.Kind == cards.SymbolHybrid {
+			body += manaText(11, 15, 11, first) + manaText(21, 26, 11, last)
+		} else {
+			body += `<circle cx="16" cy="16" r="6" fill="none" stroke="` + symbolInk + `" stroke-width="2.5"/>` +
+				`<path d="M16 7V25" stroke="` + symbolInk + `" stroke-width="2.5" stroke-linecap="round"/>`
+		}
+	}
+
+	return `<svg viewBox="0 0 32 32" role="img" aria-label="{` + s.Raw + `}" class="inline-block" style="width:1.15em;height:1.15em">` +
+		`<title>{` + s.Raw + `}</title>` + body + `</svg>`
+}
+
+func manaDisc(fill string) string {
+	return `<circle cx="16" cy="16" r="15" fill="` + fill + `"/>`
+}
+
+// manaHalves splits the disc diagonally, first color top left.
+func manaHalves(first, second string) string {
+	return `<path d="M26.6 5.4A15 15 0 0 0 5.4 26.6Z" fill="` + first + `"/>` +
+		`<path d="M26.6 5.4A15 15 0 0 1 5.4 26.6Z" fill="` + second + `"/>`
+}
+
+func manaText(x, y, size float64, s string) string {
+	return fmt.Sprintf(`<text x="%g" y="%g" font-size="%g" font-weight="700" font-family="sans-serif" text-anchor="middle" fill="%s">%s</text>`,
+		x, y, size, symbolInk, s)
+}
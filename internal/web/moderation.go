@@ -0,0 +1,233 @@
+package web
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"manatomb/app/internal/audit"
+	"manatomb/app/internal/decks"
+)
+
+// moderationLimit caps how many decks or reports a moderation page lists.
+const moderationLimit = 100
+
+type adminDecksData struct {
+	Section string
+	Query   string
+	Decks   []decks.ModeratedDeck
+}
+
+type adminReportsData struct {
+	Section string
+	Reports []decks.Report
+}
+
+// GET /admin/decks
+// Public and hidden decks, for moderators to hide or feature.
+func (a *App) HandleAdminDecks(w http.ResponseWriter, r *http.Request) {
+	user := a.requireModerator(w, r)
+	if user == nil {
+		return
+	}
+
+	flash := readFlash(w, r)
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	list, err := decks.ListDecksForModeration(r.Context(), a.DB, query, moderationLimit)
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	a.Renderer.Render(w, r, "admin_decks", TemplateData{
+		CurrentUser: user,
+		Data:        adminDecksData{Section: "decks", Query: query, Decks: list},
+		Flash:       flash,
+	})
+}
+
+// POST /admin/decks (different actions based on hidden "action" field)
+func (a *App) HandleAdminDecksPost(w http.ResponseWriter, r *http.Request) {
+	user := a.requireModerator(w, r)
+	if user == nil {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		setFlash(w, "Invalid form submission.")
+		http.Redirect(w, r, "/admin/decks", http.StatusSeeOther)
+		return
+	}
+
+	back := "/admin/decks"
+	if q := strings.TrimSpace(r.Form.Get("q")); q != "" {
+		back += "?q=" + url.QueryEscape(q)
+	}
+	if r.Form.Get("from") == "reports" {
+		back = "/admin/reports"
+	}
+
+	deckID, _ := strconv.ParseInt(r.Form.Get("deck_id"), 10, 64)
+	d, err := decks.GetAnyDeck(r.Context(), a.DB, deckID)
+	if errors.Is(err, sql.ErrNoRows) {
+		setFlash(w, "That deck no longer exists.")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	label := "deck " + strconv.FormatInt(d.ID, 10) + " “" + d.Name + "”"
+
+	switch r.Form.Get("action") {
+	case "hide":
+		if err := decks.SetDeckHidden(r.Context(), a.DB, d.ID, true, user.ID); err != nil {
+			log.Printf("hide deck error: %v", err)
+			setFlash(w, "Could not hide the deck.")
+			break
+		}
+		a.audit(r, user, audit.ActionDeckHide, audit.TargetDeck, d.ID, "Hid "+label)
+		setFlash(w, "“"+d.Name+"” is hidden from public pages, and its reports are closed.")
+
+	case "unhide":
+		if err := decks.SetDeckHidden(r.Context(), a.DB, d.ID, false, user.ID); err != nil {
+			log.Printf("unhide deck error: %v", err)
+			setFlash(w, "Could not unhide the deck.")
+			break
+		}
+		a.audit(r, user, audit.ActionDeckUnhide, audit.TargetDeck, d.ID, "Unhid "+label)
+		setFlash(w, "“"+d.Name+"” is no longer hidden.")
+
+	case "feature":
+		if !d.IsPublic || d.Hidden {
+			setFlash(w, "Only public decks that aren't hidden can be featured.")
+			break
+		}
+		if err := decks.SetDeckFeatured(r.Context(), a.DB, d.ID, true); err != nil {
+			log.Printf("feature deck error: %v", err)
+			setFlash(w, "Could not feature the deck.")
+			break
+		}
+		a.audit(r, user, audit.ActionDeckFeature, audit.TargetDeck, d.ID, "Featured "+label)
+		setFlash(w, "“"+d.Name+"” is featured on the public decks page.")
+
+	case "unfeature":
+		if err := decks.SetDeckFeatured(r.Context(), a.DB, d.ID, false); err != nil {
+			log.Printf("unfeature deck error: %v", err)
+			setFlash(w, "Could not unfeature the deck.")
+			break
+		}
+		a.audit(r, user, audit.ActionDeckUnfeature, audit.TargetDeck, d.ID, "Unfeatured "+label)
+		setFlash(w, "“"+d.Name+"” is no longer featured.")
+
+	default:
+		setFlash(w, "Unknown action.")
+	}
+
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// GET /admin/reports
+// Open reports on public decks, oldest first.
+func (a *App) HandleAdminReports(w http.ResponseWriter, r *http.Request) {
+	user := a.requireModerator(w, r)
+	if user == nil {
+		return
+	}
+
+	flash := readFlash(w, r)
+
+	reports, err := decks.ListOpenReports(r.Context(), a.DB, moderationLimit)
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	a.Renderer.Render(w, r, "admin_reports", TemplateData{
+		CurrentUser: user,
+		Data:        adminReportsData{Section: "reports", Reports: reports},
+		Flash:       flash,
+	})
+}
+
+// POST /admin/reports
+// Dismisses a report. Acting on the deck goes through /admin/decks.
+func (a *App) HandleAdminReportsPost(w http.ResponseWriter, r *http.Request) {
+	user := a.requireModerator(w, r)
+	if user == nil {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		setFlash(w, "Invalid form submission.")
+		http.Redirect(w, r, "/admin/reports", http.StatusSeeOther)
+		return
+	}
+
+	reportID, _ := strconv.ParseInt(r.Form.Get("report_id"), 10, 64)
+	deckID, err := decks.DismissReport(r.Context(), a.DB, reportID, user.ID)
+	switch {
+	case errors.Is(err, decks.ErrReportNotFound):
+		setFlash(w, "That report was already dealt with.")
+	case err != nil:
+		log.Printf("dismiss report error: %v", err)
+		setFlash(w, "Could not dismiss the report.")
+	default:
+		a.audit(r, user, audit.ActionReportDismiss, audit.TargetReport, reportID,
+			"Dismissed report "+strconv.FormatInt(reportID, 10)+" on deck "+strconv.FormatInt(deckID, 10))
+		setFlash(w, "Report dismissed.")
+	}
+
+	http.Redirect(w, r, "/admin/reports", http.StatusSeeOther)
+}
+
+// POST /decks/{id}/report
+// Lets a signed-in visitor flag someone else's public deck for moderators.
+func (a *App) HandleDeckReportPost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := CurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		a.RenderNotFound(w, r)
+		return
+	}
+	d, err := decks.GetVisibleDeck(r.Context(), a.DB, id, user.ID)
+	if err != nil || !d.IsPublic || d.Hidden || d.UserID == user.ID {
+		a.RenderNotFound(w, r)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	deckURL := "/decks/" + strconv.FormatInt(d.ID, 10)
+	err = decks.ReportDeck(r.Context(), a.DB, d.ID, user.ID, r.Form.Get("reason"), r.Form.Get("details"))
+	switch {
+	case errors.Is(err, decks.ErrInvalidReportReason):
+		setFlash(w, "Choose why you're reporting this deck.")
+	case err != nil:
+		log.Printf("report deck error: %v", err)
+		setFlash(w, "Could not send your report. Please try again.")
+	default:
+		setFlash(w, "Thanks for letting us know. A moderator will take a look.")
+	}
+	http.Redirect(w, r, deckURL, http.StatusSeeOther)
+}
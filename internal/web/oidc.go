@@ -0,0 +1,295 @@
+package web
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"manatomb/app/internal/account"
+	"manatomb/app/internal/mail"
+	"manatomb/app/internal/oidc"
+)
+
+const (
+	oidcCookieName   = "mt_oidc"
+	oidcCallbackPath = "/login/oidc/callback"
+
+	// oidcTTL is how long a sign-in at the provider can take.
+	oidcTTL = 10 * time.Minute
+)
+
+// oidcFlow is one trip to the identity provider and back. UserID is set
+// when a signed-in user is linking an account rather than logging in.
+type oidcFlow struct {
+	State    string
+	Nonce    string
+	Verifier string
+	UserID   int64
+}
+
+// setOIDCCookie keeps the flow's secrets in the browser that started it,
+// so the callback can only be completed there. It is signed like the
+// two-factor cookie and carries its own expiry.
+func (a *App) setOIDCCookie(w http.ResponseWriter, f oidcFlow) {
+	expires := time.Now().Add(oidcTTL)
+	payload := strings.Join([]string{
+		f.State, f.Nonce, f.Verifier,
+		strconv.FormatInt(f.UserID, 10),
+		strconv.FormatInt(expires.Unix(), 10),
+	}, ".")
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookieName,
+		Value:    payload + "." + a.oidcMAC(payload),
+		Path:     "/login/oidc",
+		Expires:  expires,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (a *App) oidcMAC(payload string) string {
+	mac := hmac.New(sha256.New, a.SessionSecret)
+	mac.Write([]byte("oidc:" + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (a *App) oidcFlowFromCookie(r *http.Request) (oidcFlow, bool) {
+	c, err := r.Cookie(oidcCookieName)
+	if err != nil {
+		return oidcFlow{}, false
+	}
+	i := strings.LastIndexByte(c.Value, '.')
+	if i < 0 {
+		return oidcFlow{}, false
+	}
+	payload, sig := c.Value[:i], c.Value[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(a.oidcMAC(payload))) {
+		return oidcFlow{}, false
+	}
+
+	parts := strings.Split(payload, ".")
+	if len(parts) != 5 {
+		return oidcFlow{}, false
+	}
+	exp, err := strconv.ParseInt(parts[4], 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return oidcFlow{}, false
+	}
+	userID, err := strconv.ParseInt(parts[3], 10, 64)
+	if err != nil {
+		return oidcFlow{}, false
+	}
+	return oidcFlow{State: parts[0], Nonce: parts[1], Verifier: parts[2], UserID: userID}, true
+}
+
+func clearOIDCCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookieName,
+		Value:    "",
+		Path:     "/login/oidc",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// startOIDC sends the browser to the identity provider, to log in or, with
+// a userID, to link the account there to that user.
+func (a *App) startOIDC(w http.ResponseWriter, r *http.Request, userID int64) {
+	back := "/login"
+	if userID != 0 {
+		back = "/settings"
+	}
+
+	flow := oidcFlow{UserID: userID}
+	for _, s := range []*string{&flow.State, &flow.Nonce, &flow.Verifier} {
+		v, err := oidc.RandomString()
+		if err != nil {
+			log.Printf("oidc random error: %v", err)
+			setFlash(w, "Could not start signing in with "+a.OIDC.Name+". Please try again.")
+			http.Redirect(w, r, back, http.StatusSeeOther)
+			return
+		}
+		*s = v
+	}
+
+	authURL, err := a.OIDC.AuthURL(r.Context(), a.absoluteURL(r, oidcCallbackPath), flow.State, flow.Nonce, flow.Verifier)
+	if err != nil {
+		log.Printf("oidc auth url error: %v", err)
+		setFlash(w, a.OIDC.Name+" sign-in isn't available right now. Please try again later.")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	a.setOIDCCookie(w, flow)
+	http.Redirect(w, r, authURL, http.StatusSeeOther)
+}
+
+// GET /login/oidc
+func (a *App) HandleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if a.OIDC == nil {
+		a.RenderNotFound(w, r)
+		return
+	}
+	a.startOIDC(w, r, 0)
+}
+
+// GET /login/oidc/callback
+func (a *App) HandleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if a.OIDC == nil {
+		a.RenderNotFound(w, r)
+		return
+	}
+
+	flow, ok := a.oidcFlowFromCookie(r)
+	clearOIDCCookie(w)
+	q := r.URL.Query()
+	if !ok || !hmac.Equal([]byte(q.Get("state")), []byte(flow.State)) {
+		setFlash(w, "Your sign-in timed out. Please try again.")
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	back := "/login"
+	if flow.UserID != 0 {
+		back = "/settings"
+	}
+
+	// The provider reports cancellations and refusals as an error
+	// parameter instead of a code.
+	if e := q.Get("error"); e != "" {
+		if e != "access_denied" {
+			log.Printf("oidc provider error: %s %s", e, q.Get("error_description"))
+		}
+		setFlash(w, "Signing in with "+a.OIDC.Name+" didn't finish.")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	claims, err := a.OIDC.Exchange(r.Context(), a.absoluteURL(r, oidcCallbackPath), q.Get("code"), flow.Verifier, flow.Nonce)
+	if err != nil {
+		log.Printf("oidc exchange error: %v", err)
+		setFlash(w, "Could not sign you in with "+a.OIDC.Name+". Please try again.")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	if flow.UserID != 0 {
+		a.linkOIDC(w, r, flow.UserID, claims)
+		return
+	}
+	a.loginOIDC(w, r, claims)
+}
+
+// linkOIDC finishes linking the provider account in claims to the user
+// who started the flow from their settings.
+func (a *App) linkOIDC(w http.ResponseWriter, r *http.Request, userID int64, claims *oidc.Claims) {
+	user := CurrentUser(r)
+	if user == nil || user.ID != userID {
+		setFlash(w, "Please log in again, then link your "+a.OIDC.Name+" account from settings.")
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	err := account.LinkIdentity(r.Context(), a.DB, user.ID, a.OIDC.Issuer, claims.Subject, claims.Email)
+	switch {
+	case errors.Is(err, account.ErrIdentityLinked):
+		setFlash(w, "That "+a.OIDC.Name+" account is already linked to another Mana Tomb account.")
+	case err != nil:
+		log.Printf("link identity error: %v", err)
+		setFlash(w, "Could not link your "+a.OIDC.Name+" account.")
+	default:
+		a.sendIdentityNotice(user, a.OIDC.Name, true)
+		setFlash(w, a.OIDC.Name+" account linked. You can now log in with it.")
+	}
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+}
+
+// loginOIDC signs in the user the provider account in claims belongs to:
+// the one it is linked to or, failing that, the one with the same email.
+func (a *App) loginOIDC(w http.ResponseWriter, r *http.Request, claims *oidc.Claims) {
+	u, err := account.GetUserByIdentity(r.Context(), a.DB, a.OIDC.Issuer, claims.Subject, claims.Email)
+	if errors.Is(err, account.ErrIdentityNotFound) {
+		u, err = a.matchOIDCEmail(r, claims)
+	}
+	if errors.Is(err, account.ErrIdentityNotFound) {
+		setFlash(w, "No Mana Tomb account is linked to that "+a.OIDC.Name+" account. "+
+			"Log in with your password, then link it from your settings.")
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		log.Printf("oidc login error: %v", err)
+		setFlash(w, "Could not sign you in with "+a.OIDC.Name+". Please try again.")
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	// The provider stands in for the password only; accounts with
+	// two-factor on still need a code.
+	if u.TOTPEnabled {
+		a.setTwoFactorCookie(w, u.ID)
+		http.Redirect(w, r, "/login/2fa", http.StatusSeeOther)
+		return
+	}
+
+	a.completeLogin(w, r, u, "Welcome back!")
+}
+
+// matchOIDCEmail links a provider account to the user with the same email
+// on first sign-in. Both sides must have verified the address: otherwise
+// someone could sign up here with another person's email and later
+// inherit their provider sign-ins, or the reverse.
+func (a *App) matchOIDCEmail(r *http.Request, claims *oidc.Claims) (*account.User, error) {
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, account.ErrIdentityNotFound
+	}
+
+	u, err := account.GetUserByEmail(r.Context(), a.DB, claims.Email)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !u.EmailVerified) {
+		return nil, account.ErrIdentityNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := account.LinkIdentity(r.Context(), a.DB, u.ID, a.OIDC.Issuer, claims.Subject, claims.Email); err != nil {
+		return nil, err
+	}
+	a.sendIdentityNotice(u, a.OIDC.Name, true)
+	return u, nil
+}
+
+// providerName labels a linked identity's provider: the configured name
+// for the current issuer, or the host of one configured before.
+func (a *App) providerName(issuer string) string {
+	if a.OIDC != nil && a.OIDC.Issuer == issuer {
+		return a.OIDC.Name
+	}
+	if u, err := url.Parse(issuer); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return issuer
+}
+
+func (a *App) sendIdentityNotice(u *account.User, provider string, linked bool) {
+	subject, change := provider+" account linked", "linked to"
+	if !linked {
+		subject, change = provider+" account unlinked", "unlinked from"
+	}
+	a.sendMail(mail.Message{
+		To:      u.Email,
+		Subject: subject,
+		Text: "Hi " + u.DisplayName + ",\n\n" +
+			"Your " + provider + " account was just " + change + " your Mana Tomb account.\n\n" +
+			"If this wasn't you, unlink it on your settings page, reset your password and check the signed-in devices there.\n",
+	})
+}
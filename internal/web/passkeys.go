@@ -0,0 +1,288 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"manatomb/app/internal/account"
+	"manatomb/app/internal/webauthn"
+)
+
+// Passkey ceremonies run from JavaScript: the page fetches options, hands
+// them to navigator.credentials, and posts the authenticator's response
+// back. These endpoints speak JSON, errors included.
+
+const maxPasskeyBody = 64 << 10
+
+type passkeyRegisterRequest struct {
+	Name     string                `json:"name"`
+	Response webauthn.Registration `json:"response"`
+}
+
+// relyingParty describes this site to WebAuthn. Passkeys are bound to the
+// host, so BASE_URL should be set in production; registering on one host
+// and signing in on another won't work.
+func (a *App) relyingParty(r *http.Request) webauthn.RelyingParty {
+	origin := a.absoluteURL(r, "")
+	rp := webauthn.RelyingParty{Name: "Mana Tomb", Origin: origin}
+	if u, err := url.Parse(origin); err == nil {
+		rp.ID = u.Hostname()
+	}
+	return rp
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("write json error: %v", err)
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	return json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPasskeyBody)).Decode(v)
+}
+
+// POST /settings/passkeys/options
+func (a *App) HandlePasskeyRegisterOptions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := CurrentUser(r)
+	if user == nil {
+		writeJSONError(w, http.StatusUnauthorized, "Please log in again.")
+		return
+	}
+
+	handle, err := account.PasskeyUserHandle(r.Context(), a.DB, user.ID)
+	if err != nil {
+		log.Printf("passkey user handle error: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Could not start adding a passkey.")
+		return
+	}
+
+	existing, err := account.ListPasskeys(r.Context(), a.DB, user.ID)
+	if err != nil {
+		log.Printf("list passkeys error: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Could not start adding a passkey.")
+		return
+	}
+	var exclude []webauthn.CredentialDescriptor
+	for _, p := range existing {
+		exclude = append(exclude, webauthn.CredentialDescriptor{
+			Type: "public-key", ID: p.CredentialID, Transports: p.Transports,
+		})
+	}
+
+	challenge, err := a.newPasskeyChallenge(r, user.ID, account.PasskeyRegister)
+	if err != nil {
+		log.Printf("create passkey challenge error: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Could not start adding a passkey.")
+		return
+	}
+
+	entity := webauthn.UserEntity{ID: handle, Name: user.Email, DisplayName: user.DisplayName}
+	writeJSON(w, http.StatusOK, a.relyingParty(r).CreationOptions(challenge, entity, exclude))
+}
+
+func (a *App) newPasskeyChallenge(r *http.Request, userID int64, purpose string) ([]byte, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, err
+	}
+	if err := account.CreatePasskeyChallenge(r.Context(), a.DB, userID, purpose, challenge); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// takePasskeyChallenge spends the challenge a response answers and returns
+// it with the user it was issued to.
+func (a *App) takePasskeyChallenge(r *http.Request, clientDataJSON []byte, purpose string) ([]byte, int64, error) {
+	challenge, err := webauthn.Challenge(clientDataJSON)
+	if err != nil {
+		return nil, 0, err
+	}
+	userID, err := account.TakePasskeyChallenge(r.Context(), a.DB, challenge, purpose)
+	return challenge, userID, err
+}
+
+// POST /settings/passkeys
+func (a *App) HandlePasskeyRegister(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := CurrentUser(r)
+	if user == nil {
+		writeJSONError(w, http.StatusUnauthorized, "Please log in again.")
+		return
+	}
+
+	var req passkeyRegisterRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request.")
+		return
+	}
+
+	challenge, userID, err := a.takePasskeyChallenge(r, req.Response.ClientDataJSON, account.PasskeyRegister)
+	if err != nil || userID != user.ID {
+		if err != nil && !errors.Is(err, account.ErrInvalidChallenge) && !errors.Is(err, webauthn.ErrVerify) {
+			log.Printf("take passkey challenge error: %v", err)
+		}
+		writeJSONError(w, http.StatusBadRequest, "That took too long. Please try again.")
+		return
+	}
+
+	cred, err := a.relyingParty(r).VerifyRegistration(challenge, req.Response)
+	if err != nil {
+		log.Printf("passkey registration rejected: %v", err)
+		writeJSONError(w, http.StatusBadRequest, "Your passkey couldn't be verified.")
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = "Passkey"
+	}
+	transports := make([]string, 0, len(req.Response.Transports))
+	for _, t := range req.Response.Transports {
+		if t != "" && !strings.Contains(t, ",") {
+			transports = append(transports, t)
+		}
+	}
+
+	err = account.AddPasskey(r.Context(), a.DB, &account.Passkey{
+		UserID:       user.ID,
+		CredentialID: cred.ID,
+		PublicKey:    cred.PublicKey,
+		SignCount:    cred.SignCount,
+		Name:         name,
+		Transports:   transports,
+	})
+	switch {
+	case errors.Is(err, account.ErrPasskeyRegistered):
+		writeJSONError(w, http.StatusConflict, "That passkey is already registered.")
+		return
+	case err != nil:
+		log.Printf("add passkey error: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Could not save your passkey.")
+		return
+	}
+
+	setFlash(w, "Passkey added. You can now log in with it instead of your password.")
+	writeJSON(w, http.StatusOK, map[string]string{"redirect": "/settings"})
+}
+
+// POST /login/passkey/options
+func (a *App) HandlePasskeyLoginOptions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	challenge, err := a.newPasskeyChallenge(r, 0, account.PasskeyLogin)
+	if err != nil {
+		log.Printf("create passkey challenge error: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Could not start signing in with a passkey.")
+		return
+	}
+	writeJSON(w, http.StatusOK, a.relyingParty(r).RequestOptions(challenge))
+}
+
+// POST /login/passkey
+// A passkey with user verification stands in for both the password and
+// two-factor: it is something the user has, unlocked by something they
+// know or are.
+func (a *App) HandlePasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var assertion webauthn.Assertion
+	if err := readJSON(w, r, &assertion); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request.")
+		return
+	}
+
+	challenge, _, err := a.takePasskeyChallenge(r, assertion.ClientDataJSON, account.PasskeyLogin)
+	if err != nil {
+		if !errors.Is(err, account.ErrInvalidChallenge) && !errors.Is(err, webauthn.ErrVerify) {
+			log.Printf("take passkey challenge error: %v", err)
+		}
+		writeJSONError(w, http.StatusBadRequest, "That took too long. Please try again.")
+		return
+	}
+
+	const rejected = "That passkey isn't registered here. Log in with your password and add it in settings."
+	key, err := account.GetPasskeyByCredentialID(r.Context(), a.DB, assertion.CredentialID)
+	if errors.Is(err, account.ErrPasskeyNotFound) {
+		writeJSONError(w, http.StatusUnauthorized, rejected)
+		return
+	}
+	if err != nil {
+		log.Printf("get passkey error: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Could not sign you in. Please try again.")
+		return
+	}
+
+	if len(assertion.UserHandle) > 0 {
+		handle, err := account.PasskeyUserHandle(r.Context(), a.DB, key.UserID)
+		if err != nil {
+			log.Printf("passkey user handle error: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "Could not sign you in. Please try again.")
+			return
+		}
+		if !bytes.Equal(handle, assertion.UserHandle) {
+			writeJSONError(w, http.StatusUnauthorized, rejected)
+			return
+		}
+	}
+
+	cred := webauthn.Credential{ID: key.CredentialID, PublicKey: key.PublicKey, SignCount: key.SignCount}
+	count, err := a.relyingParty(r).VerifyAssertion(challenge, cred, assertion)
+	if err != nil {
+		log.Printf("passkey sign-in rejected for user %d: %v", key.UserID, err)
+		writeJSONError(w, http.StatusUnauthorized, "Your passkey couldn't be verified.")
+		return
+	}
+
+	if err := account.TouchPasskey(r.Context(), a.DB, key.ID, count); err != nil {
+		log.Printf("touch passkey error: %v", err)
+	}
+
+	u, err := account.GetUser(r.Context(), a.DB, key.UserID)
+	if err != nil {
+		log.Printf("get user error: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Could not sign you in. Please try again.")
+		return
+	}
+
+	err = a.startSession(w, r, u)
+	if errors.Is(err, account.ErrAccountDisabled) {
+		writeJSONError(w, http.StatusForbidden, accountDisabledMessage)
+		return
+	}
+	if err != nil {
+		log.Printf("create session error: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Could not create session. Please try again.")
+		return
+	}
+
+	setFlash(w, "Welcome back!")
+	writeJSON(w, http.StatusOK, map[string]string{"redirect": "/decks"})
+}
@@ -0,0 +1,157 @@
+package web
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"manatomb/app/internal/account"
+	"manatomb/app/internal/mail"
+)
+
+type passwordResetFormData struct {
+	Token string
+	Valid bool
+}
+
+// GET /password/forgot
+func (a *App) HandleForgotPasswordShow(w http.ResponseWriter, r *http.Request) {
+	flash := readFlash(w, r)
+
+	data := TemplateData{
+		CurrentUser: CurrentUser(r),
+		Flash:       flash,
+		Data:        passwordResetFormData{},
+	}
+
+	a.Renderer.Render(w, r, "password_forgot", data)
+}
+
+// POST /password/forgot
+// Emails a reset link if the address belongs to an account. The response
+// is the same either way so the form can't be used to find accounts.
+func (a *App) HandleForgotPasswordPost(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		setFlash(w, "Invalid form submission.")
+		http.Redirect(w, r, "/password/forgot", http.StatusSeeOther)
+		return
+	}
+
+	email := strings.TrimSpace(r.Form.Get("email"))
+	if email == "" {
+		setFlash(w, "Enter the email address you signed up with.")
+		http.Redirect(w, r, "/password/forgot", http.StatusSeeOther)
+		return
+	}
+
+	if u, err := account.GetUserByEmail(r.Context(), a.DB, email); err == nil {
+		token, err := account.CreatePasswordReset(r.Context(), a.DB, u.ID)
+		switch {
+		case errors.Is(err, account.ErrResetTooSoon):
+		case err != nil:
+			log.Printf("create password reset error: %v", err)
+		default:
+			link, err := a.mailURL("/password/reset?token=" + url.QueryEscape(token))
+			if err != nil {
+				log.Printf("password reset link error: %v", err)
+				break
+			}
+			a.sendPasswordReset(u, link)
+		}
+	}
+
+	setFlash(w, "If an account uses that email, a reset link is on its way. It works for one hour.")
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+func (a *App) sendPasswordReset(u *account.User, link string) {
+	a.sendMail(mail.Message{
+		To:      u.Email,
+		Subject: "Reset your Mana Tomb password",
+		Text: "Hi " + u.DisplayName + ",\n\n" +
+			"Someone asked to reset the password for your Mana Tomb account. " +
+			"To choose a new one, open this link within the next hour:\n\n" +
+			link + "\n\n" +
+			"Resetting your password signs you out on every device. " +
+			"If you didn't ask for this, you can ignore this email and your password won't change.\n",
+	})
+}
+
+// GET /password/reset?token=...
+func (a *App) HandlePasswordResetShow(w http.ResponseWriter, r *http.Request) {
+	// Keep the token out of Referer headers sent to other sites.
+	w.Header().Set("Referrer-Policy", "no-referrer")
+
+	token := r.URL.Query().Get("token")
+	form := passwordResetFormData{Token: token}
+
+	data := TemplateData{
+		CurrentUser: CurrentUser(r),
+		Flash:       readFlash(w, r),
+	}
+
+	err := account.CheckPasswordReset(r.Context(), a.DB, token)
+	switch {
+	case err == nil:
+		form.Valid = true
+	case errors.Is(err, account.ErrInvalidResetToken):
+		data.Error = "This reset link has expired or was already used. Request a new one below."
+	default:
+		log.Printf("check password reset error: %v", err)
+		data.Error = "Could not check your reset link. Please try again."
+	}
+
+	data.Data = form
+	a.Renderer.Render(w, r, "password_reset", data)
+}
+
+// POST /password/reset
+func (a *App) HandlePasswordResetPost(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Referrer-Policy", "no-referrer")
+
+	if err := r.ParseForm(); err != nil {
+		setFlash(w, "Invalid form submission.")
+		http.Redirect(w, r, "/password/forgot", http.StatusSeeOther)
+		return
+	}
+
+	token := r.Form.Get("token")
+	newPW := r.Form.Get("new_password")
+	confirm := r.Form.Get("confirm_password")
+
+	renderError := func(msg string) {
+		data := TemplateData{
+			CurrentUser: CurrentUser(r),
+			Data:        passwordResetFormData{Token: token, Valid: true},
+			Error:       msg,
+		}
+		a.Renderer.Render(w, r, "password_reset", data)
+	}
+
+	if len(newPW) < 8 {
+		renderError("Password must be at least 8 characters long.")
+		return
+	}
+	if newPW != confirm {
+		renderError("New password and confirmation do not match.")
+		return
+	}
+
+	if _, err := account.ResetPassword(r.Context(), a.DB, token, newPW); err != nil {
+		if errors.Is(err, account.ErrInvalidResetToken) {
+			setFlash(w, "That reset link has expired or was already used. Request a new one.")
+			http.Redirect(w, r, "/password/forgot", http.StatusSeeOther)
+			return
+		}
+		log.Printf("reset password error: %v", err)
+		renderError("Could not reset your password. Please try again.")
+		return
+	}
+
+	// Every session was revoked with the reset, this browser's included.
+	a.ClearSessionCookie(w, r)
+	setFlash(w, "Password updated. You've been signed out everywhere; log in with your new password.")
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
@@ -0,0 +1,189 @@
+package web
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"manatomb/app/internal/decks"
+	"manatomb/app/internal/imgcache"
+	"manatomb/app/internal/proxies"
+)
+
+// maxProxyCopies caps the copies of one card on a proxy sheet.
+const maxProxyCopies = 99
+
+// GET /decks/{id}/proxies
+//
+// Lets the viewer choose boards, cards and copies before printing.
+func (a *App) HandleDeckProxies(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+
+	d, ok := a.loadVisibleDeck(w, r)
+	if !ok {
+		return
+	}
+
+	printCards, err := decks.ListPrintCards(r.Context(), a.DB, d)
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	data := TemplateData{
+		CurrentUser: user,
+		Data: struct {
+			Deck  *decks.Deck
+			Cards []decks.PrintCard
+		}{
+			Deck:  d,
+			Cards: printCards,
+		},
+	}
+
+	a.Renderer.Render(w, r, "deck_proxies", data)
+}
+
+// GET /decks/{id}/proxies.pdf
+//
+// Without options the whole deck is printed with images and back faces.
+// The form on /decks/{id}/proxies sends custom=1 with the chosen boards,
+// copies (qty_<card id>), backs, mode (images or text) and paper.
+func (a *App) HandleDeckProxiesPDF(w http.ResponseWriter, r *http.Request) {
+	d, ok := a.loadVisibleDeck(w, r)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	printCards, err := decks.ListPrintCards(r.Context(), a.DB, d)
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	custom := r.Form.Get("custom") != ""
+	boards := map[string]bool{decks.BoardCommander: true, decks.BoardMain: true}
+	backs := true
+	if custom {
+		boards = map[string]bool{}
+		for _, b := range r.Form["board"] {
+			boards[b] = true
+		}
+		backs = r.Form.Get("backs") != ""
+	}
+	withImages := r.Form.Get("mode") != "text"
+
+	type entry struct {
+		card   decks.PrintCard
+		copies int
+	}
+	var chosen []entry
+	var refs []imgcache.Ref
+	for _, pc := range printCards {
+		if !boards[pc.Board] {
+			continue
+		}
+		copies := pc.Quantity
+		if custom {
+			copies = min(max(formInt(r, "qty_"+pc.Board+"_"+strconv.FormatInt(pc.CardID, 10), 0), 0), maxProxyCopies)
+		}
+		if copies == 0 {
+			continue
+		}
+		chosen = append(chosen, entry{pc, copies})
+		if pc.ScryfallID != "" {
+			refs = append(refs, imgcache.Ref{ID: pc.ScryfallID, Size: "normal", Face: "front"})
+			if backs && pc.BackImageURI != "" {
+				refs = append(refs, imgcache.Ref{ID: pc.ScryfallID, Size: "normal", Face: "back"})
+			}
+		}
+	}
+
+	// Images come from the local cache, which fetches the missing ones
+	// from Scryfall at its rate limit. Cards without one print as text.
+	images := map[imgcache.Ref][]byte{}
+	if withImages {
+		a.Images.Warm(r.Context(), refs)
+		for _, ref := range refs {
+			if data, err := a.Images.Bytes(r.Context(), ref); err == nil {
+				images[ref] = data
+			}
+		}
+	}
+
+	var faces []proxies.Face
+	for _, e := range chosen {
+		pc := e.card
+		frontRef := imgcache.Ref{ID: pc.ScryfallID, Size: "normal", Face: "front"}
+		backRef := imgcache.Ref{ID: pc.ScryfallID, Size: "normal", Face: "back"}
+		front := proxies.Face{
+			Name: pc.Name, ManaCost: pc.ManaCost, TypeLine: pc.TypeLine, OracleText: pc.OracleText,
+			ImageKey: pc.ScryfallID + "/front", Image: images[frontRef],
+		}
+		back := proxies.Face{
+			Name: pc.BackName, ManaCost: pc.BackManaCost, TypeLine: pc.BackTypeLine, OracleText: pc.BackOracleText,
+			ImageKey: pc.ScryfallID + "/back", Image: images[backRef],
+		}
+		for i := 0; i < e.copies; i++ {
+			faces = append(faces, front)
+			if backs && pc.BackName != "" {
+				faces = append(faces, back)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := proxies.Render(&buf, faces, proxies.PaperByName(r.Form.Get("paper"))); err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `inline; filename="`+proxyFilename(d.Name)+`"`)
+	w.Write(buf.Bytes())
+}
+
+// loadVisibleDeck loads the {id} deck if the current user (or an anonymous
+// visitor) may view it, rendering a 404 otherwise.
+func (a *App) loadVisibleDeck(w http.ResponseWriter, r *http.Request) (*decks.Deck, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		a.RenderNotFound(w, r)
+		return nil, false
+	}
+
+	var viewerID int64
+	if user := CurrentUser(r); user != nil {
+		viewerID = user.ID
+	}
+
+	d, err := decks.GetVisibleDeck(r.Context(), a.DB, id, viewerID)
+	if err != nil {
+		a.RenderNotFound(w, r)
+		return nil, false
+	}
+	return d, true
+}
+
+// proxyFilename turns a deck name into a safe PDF file name.
+func proxyFilename(deckName string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-':
+			return r
+		case r == ' ' || r == '_':
+			return '-'
+		}
+		return -1
+	}, deckName)
+	if name == "" {
+		name = "deck"
+	}
+	return name + "-proxies.pdf"
+}
@@ -7,20 +7,36 @@ import (
 	"path/filepath"
 )
 
+// templateFuncs are the helpers templates can call.
+var templateFuncs = template.FuncMap{
+	"manaCost":  manaCostHTML,
+	"csrfField": csrfField,
+}
+
 type Renderer struct {
 	tmpl *template.Template
 }
 
 func NewRenderer() *Renderer {
 	pattern := filepath.Join("internal", "web", "templates", "*.html.tmpl")
-	tmpl, err := template.ParseGlob(pattern)
+	tmpl, err := template.New("").Funcs(templateFuncs).ParseGlob(pattern)
 	if err != nil {
 		log.Fatalf("failed to parse templates: %v", err)
 	}
 	return &Renderer{tmpl: tmpl}
 }
 
-func (r *Renderer) Render(w http.ResponseWriter, name string, data any) {
+// Render executes the named template. TemplateData gets the request's CSRF
+// token and impersonation state filled in, so handlers don't have to.
+func (r *Renderer) Render(w http.ResponseWriter, req *http.Request, name string, data any) {
+	if td, ok := data.(TemplateData); ok {
+		td.CSRFToken = CSRFToken(req)
+		if sess := CurrentSession(req); sess != nil && sess.ImpersonatorID != 0 {
+			td.Impersonating = true
+		}
+		data = td
+	}
+
 	err := r.tmpl.ExecuteTemplate(w, name, data)
 	if err != nil {
 		log.Printf("template error: %v", err)
@@ -14,5 +14,5 @@ func (a *App) HandleRulesHome(w http.ResponseWriter, r *http.Request) {
 		// Data/Error unused for now
 	}
 
-	a.Renderer.Render(w, "rules_home", data)
+	a.Renderer.Render(w, r, "rules_home", data)
 }
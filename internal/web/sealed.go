@@ -0,0 +1,195 @@
+package web
+
+import (
+	"errors"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"manatomb/app/internal/boosters"
+	"manatomb/app/internal/cards"
+	"manatomb/app/internal/decks"
+)
+
+const (
+	defaultSealedPacks = 6
+	maxSealedPacks     = 24
+)
+
+// sealedParams are the inputs that fully determine a sealed pool, so the
+// pool can be shared as a link.
+type sealedParams struct {
+	Set      string
+	Template string
+	Packs    int
+	Seed     int64
+}
+
+func (p sealedParams) Query() string {
+	v := url.Values{}
+	v.Set("set", p.Set)
+	v.Set("template", p.Template)
+	v.Set("packs", strconv.Itoa(p.Packs))
+	v.Set("seed", strconv.FormatInt(p.Seed, 10))
+	return v.Encode()
+}
+
+// sealedPack is one opened pack, numbered for display.
+type sealedPack struct {
+	Number int
+	Cards  []boosters.PackCard
+}
+
+func readSealedParams(values url.Values) sealedParams {
+	p := sealedParams{
+		Set:      strings.ToLower(strings.TrimSpace(values.Get("set"))),
+		Template: values.Get("template"),
+		Packs:    defaultSealedPacks,
+	}
+	if n, err := strconv.Atoi(values.Get("packs")); err == nil {
+		p.Packs = n
+	}
+	p.Seed, _ = strconv.ParseInt(values.Get("seed"), 10, 64)
+	return p
+}
+
+// GET /sealed
+//
+// With ?set= opens a sealed pool. A missing seed is filled in with a
+// redirect, so the address bar always holds a link to this exact pool.
+func (a *App) HandleSealed(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	flash := readFlash(w, r)
+
+	q := r.URL.Query()
+	params := readSealedParams(q)
+	if params.Template == "" && len(a.Boosters) > 0 {
+		params.Template = a.Boosters[0].Name
+	}
+
+	if params.Set != "" && q.Get("seed") == "" {
+		params.Seed = rand.Int63n(1_000_000_000)
+		http.Redirect(w, r, "/sealed?"+params.Query(), http.StatusSeeOther)
+		return
+	}
+
+	var (
+		packs  []sealedPack
+		pool   []boosters.PoolCard
+		errMsg string
+	)
+	if params.Set != "" {
+		opened, err := a.openSealed(r, params)
+		switch {
+		case err == nil:
+			pool = boosters.Pool(opened)
+			for i, contents := range opened {
+				packs = append(packs, sealedPack{Number: i + 1, Cards: contents})
+			}
+		case errors.Is(err, boosters.ErrUnknownSet):
+			errMsg = "No booster cards were found for set \"" + params.Set + "\"."
+		case errors.Is(err, boosters.ErrUnknownTemplate), errors.Is(err, errSealedPackCount):
+			errMsg = err.Error()
+		default:
+			log.Printf("sealed %s: %v", params.Query(), err)
+			errMsg = "Couldn't load that set right now. Please try again."
+		}
+	}
+
+	data := TemplateData{
+		CurrentUser: user,
+		Data: struct {
+			Params    sealedParams
+			Templates []boosters.Template
+			MaxPacks  int
+			Packs     []sealedPack
+			Pool      []boosters.PoolCard
+		}{
+			Params:    params,
+			Templates: a.Boosters,
+			MaxPacks:  maxSealedPacks,
+			Packs:     packs,
+			Pool:      pool,
+		},
+		Flash: flash,
+		Error: errMsg,
+	}
+
+	a.Renderer.Render(w, r, "sealed", data)
+}
+
+// POST /sealed
+//
+// Saves a sealed pool as a deck. The pool is opened again from its
+// parameters rather than trusting a card list from the form.
+func (a *App) HandleSealedDeckPost(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	params := readSealedParams(r.PostForm)
+	packs, err := a.openSealed(r, params)
+	if err != nil {
+		setFlash(w, "Couldn't open that pool again. Please try again.")
+		http.Redirect(w, r, "/sealed?"+params.Query(), http.StatusSeeOther)
+		return
+	}
+
+	name := strings.ToUpper(params.Set) + " sealed pool"
+	desc := "Opened from " + strconv.Itoa(params.Packs) + " " + params.Template + " boosters (seed " + strconv.FormatInt(params.Seed, 10) + ")."
+	d, err := decks.CreateDeckInFormat(r.Context(), a.DB, user.ID, name, desc, decks.FormatSealed, "")
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	for _, pc := range boosters.Pool(packs) {
+		c, err := cards.StoreCard(r.Context(), a.DB, pc.Card)
+		if err != nil {
+			a.RenderServerError(w, r, err)
+			return
+		}
+		if err := decks.AddCard(r.Context(), a.DB, d.ID, c.ID, pc.Count); err != nil {
+			a.RenderServerError(w, r, err)
+			return
+		}
+	}
+
+	setFlash(w, "Your sealed pool is saved as a deck.")
+	http.Redirect(w, r, "/decks/"+strconv.FormatInt(d.ID, 10), http.StatusSeeOther)
+}
+
+var errSealedPackCount = errors.New("a sealed pool has 1 to " + strconv.Itoa(maxSealedPacks) + " packs")
+
+func (a *App) openSealed(r *http.Request, p sealedParams) ([][]boosters.PackCard, error) {
+	if p.Packs < 1 || p.Packs > maxSealedPacks {
+		return nil, errSealedPackCount
+	}
+
+	t, err := boosters.Find(a.Boosters, p.Template)
+	if err != nil {
+		return nil, err
+	}
+
+	set, err := boosters.LoadSet(r.Context(), a.DB, cards.NewScryfallClient(), p.Set)
+	if err != nil {
+		return nil, err
+	}
+
+	return boosters.Sealed(set, t, p.Packs, p.Seed), nil
+}
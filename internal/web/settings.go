@@ -1,16 +1,58 @@
 package web
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"manatomb/app/internal/account"
+
+	"github.com/google/uuid"
 )
 
 type settingsFormData struct {
 	DisplayName string
 	Email       string
+
+	// EmailVerified mirrors the user's flag; PendingEmail is an address
+	// change waiting for its confirmation link to be followed.
+	EmailVerified bool
+	PendingEmail  string
+
+	// Sessions are the user's signed-in devices; CurrentSessionID marks
+	// the one making this request.
+	Sessions         []account.Session
+	CurrentSessionID uuid.UUID
+
+	// FailedLogins are recent wrong-password attempts on the account.
+	FailedLogins []account.LoginAttempt
+
+	// TOTPEnabled mirrors the user's flag; RecoveryCodesLeft counts the
+	// unused recovery codes that go with it.
+	TOTPEnabled       bool
+	RecoveryCodesLeft int
+
+	// Passkeys are the user's registered WebAuthn credentials.
+	Passkeys []account.Passkey
+
+	// Identities are the external accounts the user can log in with;
+	// Provider names the configured provider, empty when there is none.
+	Identities []linkedIdentity
+	Provider   string
+
+	// APITokens are the user's tokens for scripts; Scopes and Lifetimes
+	// are the choices offered for a new one.
+	APITokens []account.APIToken
+	Scopes    []apiScopeChoice
+	Lifetimes []int
+}
+
+type linkedIdentity struct {
+	account.Identity
+	Provider string
 }
 
 var displayNameRegex = regexp.MustCompile(`^[a-zA-Z0-9 .,_'-]{1,32}$`)
@@ -29,16 +71,73 @@ func (a *App) HandleSettingsShow(w http.ResponseWriter, r *http.Request) {
 
 	flash := readFlash(w, r)
 
+	form := settingsFormData{
+		DisplayName:   user.DisplayName,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+	}
+	if sess := CurrentSession(r); sess != nil {
+		form.CurrentSessionID = sess.ID
+	}
+	pending, err := account.PendingEmailChange(r.Context(), a.DB, user.ID)
+	if err != nil {
+		log.Printf("pending email change error: %v", err)
+	}
+	form.PendingEmail = pending
+
+	sessions, err := account.ListSessions(r.Context(), a.DB, user.ID)
+	if err != nil {
+		log.Printf("list sessions error: %v", err)
+	}
+	form.Sessions = sessions
+
+	failed, err := account.ListFailedLogins(r.Context(), a.DB, user.Email, 10)
+	if err != nil {
+		log.Printf("list failed logins error: %v", err)
+	}
+	form.FailedLogins = failed
+
+	passkeys, err := account.ListPasskeys(r.Context(), a.DB, user.ID)
+	if err != nil {
+		log.Printf("list passkeys error: %v", err)
+	}
+	form.Passkeys = passkeys
+
+	if a.OIDC != nil {
+		form.Provider = a.OIDC.Name
+	}
+	identities, err := account.ListIdentities(r.Context(), a.DB, user.ID)
+	if err != nil {
+		log.Printf("list identities error: %v", err)
+	}
+	for _, id := range identities {
+		form.Identities = append(form.Identities, linkedIdentity{Identity: id, Provider: a.providerName(id.Issuer)})
+	}
+
+	tokens, err := account.ListAPITokens(r.Context(), a.DB, user.ID)
+	if err != nil {
+		log.Printf("list API tokens error: %v", err)
+	}
+	form.APITokens = tokens
+	form.Scopes = apiScopeChoices
+	form.Lifetimes = apiTokenLifetimes
+
+	if user.TOTPEnabled {
+		form.TOTPEnabled = true
+		left, err := account.RecoveryCodesLeft(r.Context(), a.DB, user.ID)
+		if err != nil {
+			log.Printf("count recovery codes error: %v", err)
+		}
+		form.RecoveryCodesLeft = left
+	}
+
 	data := TemplateData{
 		CurrentUser: user,
 		Flash:       flash,
-		Data: settingsFormData{
-			DisplayName: user.DisplayName,
-			Email:       user.Email,
-		},
+		Data:        form,
 	}
 
-	a.Renderer.Render(w, "settings", data)
+	a.Renderer.Render(w, r, "settings", data)
 }
 
 // POST /settings (different actions based on hidden "action" field)
@@ -73,7 +172,7 @@ func (a *App) HandleSettingsPost(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		if err := account.UpdateProfile(r.Context(), a.DB, user.ID, displayName, user.Email); err != nil {
+		if err := account.UpdateProfile(r.Context(), a.DB, user.ID, displayName); err != nil {
 			setFlash(w, "Could not update profile.")
 			http.Redirect(w, r, "/settings", http.StatusSeeOther)
 			return
@@ -83,6 +182,58 @@ func (a *App) HandleSettingsPost(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/settings", http.StatusSeeOther)
 		return
 
+	case "resend_verification":
+		if user.EmailVerified {
+			setFlash(w, "Your email is already verified.")
+			http.Redirect(w, r, "/settings", http.StatusSeeOther)
+			return
+		}
+
+		switch err := a.sendVerification(r, user, user.Email); {
+		case errors.Is(err, account.ErrVerifyTooSoon):
+			setFlash(w, "We just sent a link. Give it a minute before asking for another.")
+		case err != nil:
+			log.Printf("send verification error: %v", err)
+			setFlash(w, "Could not send a verification email.")
+		default:
+			setFlash(w, "Verification link sent to "+user.Email+".")
+		}
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+		return
+
+	case "change_email":
+		newEmail := strings.TrimSpace(r.Form.Get("new_email"))
+
+		if !validEmail(newEmail) {
+			setFlash(w, "Please enter a valid email address.")
+			http.Redirect(w, r, "/settings", http.StatusSeeOther)
+			return
+		}
+		if strings.EqualFold(newEmail, user.Email) {
+			setFlash(w, "That's already your email address.")
+			http.Redirect(w, r, "/settings", http.StatusSeeOther)
+			return
+		}
+		if err := account.CheckPassword(r.Context(), a.DB, user.ID, r.Form.Get("current_password")); err != nil {
+			setFlash(w, "Could not change email. Check your current password.")
+			http.Redirect(w, r, "/settings", http.StatusSeeOther)
+			return
+		}
+
+		switch err := a.sendVerification(r, user, newEmail); {
+		case errors.Is(err, account.ErrEmailTaken):
+			setFlash(w, "That email address belongs to another account.")
+		case errors.Is(err, account.ErrVerifyTooSoon):
+			setFlash(w, "We just sent a link. Give it a minute before asking for another.")
+		case err != nil:
+			log.Printf("send email change error: %v", err)
+			setFlash(w, "Could not send a confirmation email.")
+		default:
+			setFlash(w, "We sent a confirmation link to "+newEmail+". Your email changes once you follow it.")
+		}
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+		return
+
 	case "change_password":
 		current := r.Form.Get("current_password")
 		newPW := r.Form.Get("new_password")
@@ -109,6 +260,179 @@ func (a *App) HandleSettingsPost(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/settings", http.StatusSeeOther)
 		return
 
+	case "totp_begin":
+		if err := account.BeginTOTP(r.Context(), a.DB, a.Secrets, user.ID); err != nil {
+			if errors.Is(err, account.ErrTOTPEnabled) {
+				setFlash(w, "Two-factor authentication is already on.")
+			} else {
+				log.Printf("begin totp error: %v", err)
+				setFlash(w, "Could not start two-factor setup.")
+			}
+			http.Redirect(w, r, "/settings", http.StatusSeeOther)
+			return
+		}
+
+		http.Redirect(w, r, "/settings/2fa", http.StatusSeeOther)
+		return
+
+	case "totp_disable":
+		if err := account.CheckPassword(r.Context(), a.DB, user.ID, r.Form.Get("current_password")); err != nil {
+			setFlash(w, "Could not turn off two-factor authentication. Check your current password.")
+			http.Redirect(w, r, "/settings", http.StatusSeeOther)
+			return
+		}
+		if !a.checkSettingsCode(w, r, user) {
+			return
+		}
+
+		if err := account.DisableTOTP(r.Context(), a.DB, user.ID); err != nil {
+			log.Printf("disable totp error: %v", err)
+			setFlash(w, "Could not turn off two-factor authentication.")
+			http.Redirect(w, r, "/settings", http.StatusSeeOther)
+			return
+		}
+
+		a.sendTwoFactorNotice(user, false)
+		setFlash(w, "Two-factor authentication is off.")
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+		return
+
+	case "regenerate_recovery_codes":
+		if !a.checkSettingsCode(w, r, user) {
+			return
+		}
+
+		codes, err := account.RegenerateRecoveryCodes(r.Context(), a.DB, user.ID)
+		if err != nil {
+			log.Printf("regenerate recovery codes error: %v", err)
+			setFlash(w, "Could not make new recovery codes.")
+			http.Redirect(w, r, "/settings", http.StatusSeeOther)
+			return
+		}
+
+		a.renderRecoveryCodes(w, r, user, codes, false)
+		return
+
+	case "rename_passkey", "delete_passkey":
+		id, err := strconv.ParseInt(r.Form.Get("passkey_id"), 10, 64)
+		if err != nil {
+			setFlash(w, "Unknown passkey.")
+			http.Redirect(w, r, "/settings", http.StatusSeeOther)
+			return
+		}
+
+		if action == "rename_passkey" {
+			name := strings.TrimSpace(r.Form.Get("name"))
+			if name == "" {
+				setFlash(w, "Give the passkey a name.")
+			} else if err := account.RenamePasskey(r.Context(), a.DB, user.ID, id, name); err != nil {
+				setFlash(w, "Could not rename that passkey.")
+			} else {
+				setFlash(w, "Passkey renamed.")
+			}
+		} else {
+			if err := account.DeletePasskey(r.Context(), a.DB, user.ID, id); err != nil {
+				setFlash(w, "Could not remove that passkey.")
+			} else {
+				setFlash(w, "Passkey removed. Remember to delete it from your device too.")
+			}
+		}
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+		return
+
+	case "link_identity":
+		if a.OIDC == nil {
+			setFlash(w, "Signing in with another provider isn't set up on this site.")
+			http.Redirect(w, r, "/settings", http.StatusSeeOther)
+			return
+		}
+		a.startOIDC(w, r, user.ID)
+		return
+
+	case "unlink_identity":
+		id, err := strconv.ParseInt(r.Form.Get("identity_id"), 10, 64)
+		if err != nil {
+			setFlash(w, "Unknown linked account.")
+			http.Redirect(w, r, "/settings", http.StatusSeeOther)
+			return
+		}
+
+		issuer, err := account.UnlinkIdentity(r.Context(), a.DB, user.ID, id)
+		if err != nil {
+			if !errors.Is(err, account.ErrIdentityNotFound) {
+				log.Printf("unlink identity error: %v", err)
+			}
+			setFlash(w, "Could not unlink that account.")
+			http.Redirect(w, r, "/settings", http.StatusSeeOther)
+			return
+		}
+
+		provider := a.providerName(issuer)
+		a.sendIdentityNotice(user, provider, false)
+		setFlash(w, provider+" account unlinked.")
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+		return
+
+	case "create_api_token":
+		a.createAPIToken(w, r, user)
+		return
+
+	case "delete_api_token":
+		id, err := strconv.ParseInt(r.Form.Get("api_token_id"), 10, 64)
+		if err != nil {
+			setFlash(w, "Unknown API token.")
+			http.Redirect(w, r, "/settings", http.StatusSeeOther)
+			return
+		}
+
+		if err := account.DeleteAPIToken(r.Context(), a.DB, user.ID, id); err != nil {
+			if !errors.Is(err, account.ErrAPITokenNotFound) {
+				log.Printf("delete API token error: %v", err)
+			}
+			setFlash(w, "Could not revoke that token.")
+		} else {
+			setFlash(w, "API token revoked. Scripts using it will stop working.")
+		}
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+		return
+
+	case "revoke_session":
+		sid, err := uuid.Parse(r.Form.Get("session_id"))
+		if err != nil {
+			setFlash(w, "Unknown session.")
+			http.Redirect(w, r, "/settings", http.StatusSeeOther)
+			return
+		}
+
+		if sess := CurrentSession(r); sess != nil && sess.ID == sid {
+			a.ClearSessionCookie(w, r)
+			setFlash(w, "Signed out of this device.")
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+
+		if err := account.DeleteUserSession(r.Context(), a.DB, user.ID, sid); err != nil {
+			setFlash(w, "Could not sign out that device.")
+			http.Redirect(w, r, "/settings", http.StatusSeeOther)
+			return
+		}
+
+		setFlash(w, "Signed out of that device.")
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+		return
+
+	case "revoke_all_sessions":
+		if err := account.DeleteUserSessions(r.Context(), a.DB, user.ID); err != nil {
+			setFlash(w, "Could not sign out everywhere.")
+			http.Redirect(w, r, "/settings", http.StatusSeeOther)
+			return
+		}
+
+		a.ClearSessionCookie(w, r)
+		setFlash(w, "Signed out everywhere.")
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+
 	case "delete_account":
 		// You can optionally require a confirm string or password here later.
 		if err := account.DeleteAccount(r.Context(), a.DB, user.ID); err != nil {
@@ -129,3 +453,22 @@ func (a *App) HandleSettingsPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// checkSettingsCode checks the two-factor code sent with a settings form,
+// redirecting back with a message when it doesn't pass.
+func (a *App) checkSettingsCode(w http.ResponseWriter, r *http.Request, user *account.User) bool {
+	_, throttle, err := a.verifySecondFactor(r, user, r.Form.Get("code"))
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, errTooManyAttempts):
+		setFlash(w, "Too many failed attempts. Please wait "+waitText(throttle.Wait)+" before trying again.")
+	case errors.Is(err, account.ErrInvalidTOTPCode):
+		setFlash(w, "That two-factor code didn't work.")
+	default:
+		log.Printf("verify second factor error: %v", err)
+		setFlash(w, "Could not check your two-factor code.")
+	}
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+	return false
+}
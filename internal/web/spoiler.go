@@ -0,0 +1,145 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/jpeg"
+	"log"
+	"net/http"
+	"strconv"
+
+	"manatomb/app/internal/decks"
+	"manatomb/app/internal/imgcache"
+	"manatomb/app/internal/spoiler"
+)
+
+// GET /decks/{id}/spoiler.jpg
+//
+// Every card in the deck as a grid of card images, commander first.
+func (a *App) HandleDeckSpoiler(w http.ResponseWriter, r *http.Request) {
+	d, ok := a.loadVisibleDeck(w, r)
+	if !ok {
+		return
+	}
+
+	printCards, err := decks.ListPrintCards(r.Context(), a.DB, d)
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	// Fetch the missing images side by side before drawing them in order.
+	var refs []imgcache.Ref
+	for _, pc := range printCards {
+		if pc.ScryfallID != "" {
+			refs = append(refs, imgcache.Ref{ID: pc.ScryfallID, Size: "small", Face: "front"})
+		}
+	}
+	a.Images.Warm(r.Context(), refs)
+
+	tiles := make([]spoiler.Tile, 0, len(printCards))
+	for _, pc := range printCards {
+		tiles = append(tiles, spoiler.Tile{
+			Name:     pc.Name,
+			Quantity: pc.Quantity,
+			Image:    a.cardImage(r.Context(), pc.ScryfallID, "small"),
+		})
+	}
+
+	a.writeDeckImage(w, r, d, spoiler.Grid(d.Name, tiles))
+}
+
+// GET /decks/{id}/og.jpg
+//
+// The deck's link preview: commander art, name, color identity and card
+// count on a 1200x630 card.
+func (a *App) HandleDeckOpenGraph(w http.ResponseWriter, r *http.Request) {
+	d, ok := a.loadVisibleDeck(w, r)
+	if !ok {
+		return
+	}
+
+	printCards, err := decks.ListPrintCards(r.Context(), a.DB, d)
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	p := spoiler.Preview{
+		DeckName:      d.Name,
+		Commander:     d.CommanderName,
+		ColorIdentity: decks.ColorIdentity(printCards),
+	}
+	for _, pc := range printCards {
+		p.CardCount += pc.Quantity
+		if pc.Board == decks.BoardCommander {
+			p.Art = a.cardImage(r.Context(), pc.ScryfallID, "art_crop")
+		}
+	}
+
+	a.writeDeckImage(w, r, d, spoiler.OpenGraph(p))
+}
+
+// deckOpenGraph is the link preview for a deck page.
+func (a *App) deckOpenGraph(r *http.Request, d *decks.Deck, deckCards []decks.DeckCard) *OpenGraph {
+	deckPath := "/decks/" + strconv.FormatInt(d.ID, 10)
+
+	cardCount := 0
+	if d.CommanderName != "" {
+		cardCount++
+	}
+	for _, dc := range deckCards {
+		cardCount += dc.Quantity
+	}
+
+	desc := d.Description
+	if desc == "" {
+		desc = strconv.Itoa(cardCount) + " cards"
+		if d.CommanderName != "" {
+			desc = d.CommanderName + " · " + desc
+		}
+	}
+
+	return &OpenGraph{
+		Title:       d.Name,
+		Description: desc,
+		URL:         a.absoluteURL(r, deckPath),
+		Image:       a.absoluteURL(r, deckPath+"/og.jpg"),
+	}
+}
+
+// cardImage loads a card image through the cache. It returns nil when the
+// image can't be had, so callers draw without it.
+func (a *App) cardImage(ctx context.Context, scryfallID, size string) image.Image {
+	if scryfallID == "" {
+		return nil
+	}
+	img, err := a.Images.Image(ctx, imgcache.Ref{ID: scryfallID, Size: size, Face: "front"})
+	if err != nil {
+		if !errors.Is(err, imgcache.ErrNotFound) {
+			log.Printf("card image %s/%s: %v", scryfallID, size, err)
+		}
+		return nil
+	}
+	return img
+}
+
+// writeDeckImage sends a generated deck image. Private decks' images are
+// only cached by the viewer's browser.
+func (a *App) writeDeckImage(w http.ResponseWriter, r *http.Request, d *decks.Deck, img image.Image) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	cacheControl := "private, max-age=300"
+	if d.IsPublic && !d.Hidden {
+		cacheControl = "public, max-age=3600"
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Write(buf.Bytes())
+}
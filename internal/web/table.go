@@ -0,0 +1,382 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"manatomb/app/internal/account"
+	"manatomb/app/internal/decks"
+	"manatomb/app/internal/games"
+	"manatomb/app/internal/live"
+)
+
+// tableKeepAlive is how often an idle event stream sends a comment so
+// proxies don't close it.
+const tableKeepAlive = 25 * time.Second
+
+// GET /table
+func (a *App) HandleTableHome(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	flash := readFlash(w, r)
+
+	userDecks, err := decks.ListDecksByUser(r.Context(), a.DB, user.ID)
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	data := TemplateData{
+		CurrentUser: user,
+		Data: struct {
+			Decks       []decks.Deck
+			DefaultLife int
+			Code        string
+		}{
+			Decks:       userDecks,
+			DefaultLife: live.DefaultLife,
+			Code:        strings.ToUpper(r.URL.Query().Get("code")),
+		},
+		Flash: flash,
+	}
+
+	a.Renderer.Render(w, r, "table_home", data)
+}
+
+// POST /table/new
+func (a *App) HandleTableNewPost(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	p, err := a.tablePlayer(r, user)
+	if err != nil {
+		setFlash(w, "Please pick one of your own decks.")
+		http.Redirect(w, r, "/table", http.StatusSeeOther)
+		return
+	}
+
+	life, _ := strconv.Atoi(r.Form.Get("starting_life"))
+
+	t, err := a.Tables.Create(p, life)
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/table/"+t.Snapshot().Code, http.StatusSeeOther)
+}
+
+// POST /table/join
+func (a *App) HandleTableJoinPost(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	t, err := a.Tables.Get(r.Form.Get("code"))
+	if err != nil {
+		setFlash(w, "No table uses that code.")
+		http.Redirect(w, r, "/table", http.StatusSeeOther)
+		return
+	}
+	code := t.Snapshot().Code
+
+	p, err := a.tablePlayer(r, user)
+	if err != nil {
+		setFlash(w, "Please pick one of your own decks.")
+		http.Redirect(w, r, "/table?code="+code, http.StatusSeeOther)
+		return
+	}
+
+	if err := t.Join(p); err != nil {
+		switch {
+		case errors.Is(err, live.ErrTableFull):
+			setFlash(w, "That table is full.")
+		case errors.Is(err, live.ErrTableEnded):
+			setFlash(w, "That game has already ended.")
+		default:
+			a.RenderServerError(w, r, err)
+			return
+		}
+		http.Redirect(w, r, "/table", http.StatusSeeOther)
+		return
+	}
+
+	http.Redirect(w, r, "/table/"+code, http.StatusSeeOther)
+}
+
+// GET /table/{code}
+func (a *App) HandleTableShow(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	flash := readFlash(w, r)
+
+	t, err := a.Tables.Get(r.PathValue("code"))
+	if err != nil {
+		a.RenderNotFound(w, r)
+		return
+	}
+
+	state := t.Snapshot()
+
+	data := TemplateData{
+		CurrentUser: user,
+		Data: struct {
+			State         live.State
+			MySeat        int
+			IsHost        bool
+			MaxSeats      int
+			WinConditions []string
+		}{
+			State:         state,
+			MySeat:        t.SeatOf(user.ID),
+			IsHost:        state.HostID == user.ID,
+			MaxSeats:      live.MaxSeats,
+			WinConditions: winConditions,
+		},
+		Flash: flash,
+	}
+
+	a.Renderer.Render(w, r, "table_show", data)
+}
+
+// GET /table/{code}/events
+//
+// Streams the table state as Server-Sent Events: the current state first,
+// then a new one after every change.
+func (a *App) HandleTableEvents(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	t, err := a.Tables.Get(r.PathValue("code"))
+	if err != nil {
+		http.Error(w, "table not found", http.StatusNotFound)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	updates, unsubscribe := t.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	initial, err := json.Marshal(t.Snapshot())
+	if err != nil {
+		log.Printf("table %s: %v", r.PathValue("code"), err)
+		return
+	}
+	fmt.Fprintf(w, "data: %s\n\n", initial)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(tableKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case msg := <-updates:
+			fmt.Fprintf(w, "data: %s\n\n", msg)
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// POST /table/{code}/action
+//
+// Called from the table page with fetch; replies 204 and lets the event
+// stream deliver the new state.
+func (a *App) HandleTableAction(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	t, err := a.Tables.Get(r.PathValue("code"))
+	if err != nil {
+		http.Error(w, "table not found", http.StatusNotFound)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	state := t.Snapshot()
+	isHost := state.HostID == user.ID
+	if !isHost && t.SeatOf(user.ID) == 0 {
+		http.Error(w, "join the table first", http.StatusForbidden)
+		return
+	}
+
+	seat, _ := strconv.Atoi(r.Form.Get("seat"))
+	delta, _ := strconv.Atoi(r.Form.Get("delta"))
+
+	switch r.Form.Get("action") {
+	case "life":
+		err = t.AdjustLife(seat, delta)
+	case "poison":
+		err = t.AdjustPoison(seat, delta)
+	case "energy":
+		err = t.AdjustEnergy(seat, delta)
+	case "commander_damage":
+		from, _ := strconv.Atoi(r.Form.Get("from"))
+		err = t.AdjustCommanderDamage(seat, from, delta)
+	case "monarch":
+		err = t.SetMonarch(seat)
+	case "initiative":
+		err = t.SetInitiative(seat)
+	case "next_turn":
+		err = t.NextTurn()
+	case "add_guest":
+		name := strings.TrimSpace(r.Form.Get("name"))
+		if !isHost || name == "" {
+			http.Error(w, "only the host can add guests", http.StatusForbidden)
+			return
+		}
+		err = t.AddGuest(name, strings.TrimSpace(r.Form.Get("commander")))
+	case "end":
+		if !isHost {
+			http.Error(w, "only the host can end the game", http.StatusForbidden)
+			return
+		}
+		err = a.endTable(r, t, user)
+	default:
+		http.Error(w, "unknown action", http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, live.ErrUnknownSeat), errors.Is(err, live.ErrTableFull),
+			errors.Is(err, live.ErrTableEnded), errors.Is(err, games.ErrNotEnoughPlayers):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			log.Printf("table %s: %v", state.Code, err)
+			http.Error(w, "could not update table", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// endTable logs the table's game and closes it. The winner is a seat
+// number; 0 records a draw.
+func (a *App) endTable(r *http.Request, t *live.Table, user *account.User) error {
+	state, err := t.BeginEnd()
+	if err != nil {
+		return err
+	}
+
+	winner, _ := strconv.Atoi(r.Form.Get("winner"))
+
+	g := &games.Game{
+		CreatedBy:    user.ID,
+		PlayedAt:     time.Now(),
+		WinCondition: strings.TrimSpace(r.Form.Get("win_condition")),
+		TurnCount:    state.Turn,
+	}
+	for _, p := range state.Players {
+		g.Players = append(g.Players, games.Player{
+			Seat:          p.Seat,
+			UserID:        p.UserID,
+			Name:          p.Name,
+			DeckID:        p.DeckID,
+			CommanderName: p.Commander,
+			IsWinner:      p.Seat == winner,
+		})
+	}
+
+	id, err := games.CreateGame(r.Context(), a.DB, g)
+	if err != nil {
+		t.CancelEnd()
+		return err
+	}
+	return t.End(id)
+}
+
+// tablePlayer builds the user's seat from the submitted deck_id (optional)
+// and commander fields.
+func (a *App) tablePlayer(r *http.Request, user *account.User) (live.Player, error) {
+	p := live.Player{
+		UserID:    user.ID,
+		Name:      user.DisplayName,
+		Commander: strings.TrimSpace(r.Form.Get("commander")),
+	}
+
+	if raw := r.Form.Get("deck_id"); raw != "" {
+		deckID, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return p, err
+		}
+		d, err := decks.GetDeck(r.Context(), a.DB, deckID, user.ID)
+		if err != nil {
+			return p, err
+		}
+		p.DeckID = d.ID
+		if p.Commander == "" {
+			p.Commander = d.CommanderName
+		}
+	}
+
+	return p, nil
+}
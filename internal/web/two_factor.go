@@ -0,0 +1,307 @@
+package web
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"manatomb/app/internal/account"
+	"manatomb/app/internal/mail"
+	"manatomb/app/internal/qr"
+)
+
+const (
+	twoFactorCookieName = "mt_2fa"
+
+	// twoFactorTTL is how long after a correct password the second step
+	// can be completed.
+	twoFactorTTL = 5 * time.Minute
+
+	totpIssuer = "Mana Tomb"
+)
+
+var errTooManyAttempts = errors.New("too many failed attempts")
+
+type twoFactorSetupData struct {
+	QR     template.HTML
+	Secret string
+}
+
+type twoFactorCodesData struct {
+	Codes []string
+
+	// Enabled is set when the codes come with a fresh enrollment rather
+	// than a regeneration.
+	Enabled bool
+}
+
+// setTwoFactorCookie remembers, between the password and code steps, whose
+// password was just checked. The cookie is signed like CSRF tokens and
+// carries its own expiry.
+func (a *App) setTwoFactorCookie(w http.ResponseWriter, userID int64) {
+	expires := time.Now().Add(twoFactorTTL)
+	payload := strconv.FormatInt(userID, 10) + "." + strconv.FormatInt(expires.Unix(), 10)
+	http.SetCookie(w, &http.Cookie{
+		Name:     twoFactorCookieName,
+		Value:    payload + "." + a.twoFactorMAC(payload),
+		Path:     "/login",
+		Expires:  expires,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (a *App) twoFactorMAC(payload string) string {
+	mac := hmac.New(sha256.New, a.SessionSecret)
+	mac.Write([]byte("2fa:" + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// twoFactorUserID returns the user waiting on the second sign-in step.
+func (a *App) twoFactorUserID(r *http.Request) (int64, bool) {
+	c, err := r.Cookie(twoFactorCookieName)
+	if err != nil {
+		return 0, false
+	}
+	i := strings.LastIndexByte(c.Value, '.')
+	if i < 0 {
+		return 0, false
+	}
+	payload, sig := c.Value[:i], c.Value[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(a.twoFactorMAC(payload))) {
+		return 0, false
+	}
+
+	idText, expText, _ := strings.Cut(payload, ".")
+	exp, err := strconv.ParseInt(expText, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(idText, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return id, true
+}
+
+func clearTwoFactorCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     twoFactorCookieName,
+		Value:    "",
+		Path:     "/login",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// verifySecondFactor checks an authenticator or recovery code for u.
+// Wrong codes count as failed sign-ins, so they are throttled along with
+// wrong passwords.
+func (a *App) verifySecondFactor(r *http.Request, u *account.User, code string) (bool, account.LoginThrottle, error) {
+	ip := a.clientIP(r)
+
+	attempt, throttle, err := account.BeginLogin(r.Context(), a.DB, u.Email, ip, r.UserAgent())
+	if err != nil {
+		log.Printf("check login throttle error: %v", err)
+	}
+	if throttle.Wait > 0 {
+		return false, throttle, errTooManyAttempts
+	}
+
+	recovery, err := account.VerifySecondFactor(r.Context(), a.DB, a.Secrets, u.ID, code)
+	a.settleLogin(r, attempt, errors.Is(err, account.ErrInvalidTOTPCode))
+	return recovery, throttle, err
+}
+
+// GET /login/2fa
+func (a *App) HandleLoginTwoFactorShow(w http.ResponseWriter, r *http.Request) {
+	if _, ok := a.twoFactorUserID(r); !ok {
+		setFlash(w, "Your sign-in timed out. Please log in again.")
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	data := TemplateData{
+		Flash: readFlash(w, r),
+		Data:  loginFormData{},
+	}
+	a.Renderer.Render(w, r, "login_two_factor", data)
+}
+
+// POST /login/2fa
+func (a *App) HandleLoginTwoFactorPost(w http.ResponseWriter, r *http.Request) {
+	userID, ok := a.twoFactorUserID(r)
+	if !ok {
+		setFlash(w, "Your sign-in timed out. Please log in again.")
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		setFlash(w, "Invalid form submission.")
+		http.Redirect(w, r, "/login/2fa", http.StatusSeeOther)
+		return
+	}
+
+	u, err := account.GetUser(r.Context(), a.DB, userID)
+	if err != nil {
+		log.Printf("get user error: %v", err)
+		clearTwoFactorCookie(w)
+		setFlash(w, "Please log in again.")
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	recovery, throttle, err := a.verifySecondFactor(r, u, r.Form.Get("code"))
+	switch {
+	case errors.Is(err, errTooManyAttempts):
+		w.Header().Set("Retry-After", strconv.Itoa(int((throttle.Wait+time.Second-1)/time.Second)))
+		w.WriteHeader(http.StatusTooManyRequests)
+		data := TemplateData{
+			Data: loginFormData{Notice: "Too many failed attempts. Please wait " + waitText(throttle.Wait) + " before trying again."},
+		}
+		a.Renderer.Render(w, r, "login_two_factor", data)
+		return
+	case errors.Is(err, account.ErrInvalidTOTPCode):
+		data := TemplateData{
+			Data:  loginFormData{},
+			Error: "That code didn't work. Check your app and try again.",
+		}
+		a.Renderer.Render(w, r, "login_two_factor", data)
+		return
+	case errors.Is(err, account.ErrTOTPNotEnabled):
+		// Turned off since the password step; the password was right.
+	case err != nil:
+		log.Printf("verify second factor error: %v", err)
+		data := TemplateData{
+			Data:  loginFormData{},
+			Error: "Could not check your code. Please try again.",
+		}
+		a.Renderer.Render(w, r, "login_two_factor", data)
+		return
+	}
+
+	clearTwoFactorCookie(w)
+
+	flash := "Welcome back!"
+	if recovery {
+		left, err := account.RecoveryCodesLeft(r.Context(), a.DB, u.ID)
+		if err != nil {
+			log.Printf("count recovery codes error: %v", err)
+		}
+		flash = "Welcome back! You used a recovery code and have " + strconv.Itoa(left) + " left; you can make new ones in settings."
+	}
+	a.completeLogin(w, r, u, flash)
+}
+
+// GET /settings/2fa
+// Shows the QR code for an enrollment started from the settings page.
+func (a *App) HandleTwoFactorSetupShow(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	a.renderTwoFactorSetup(w, r, user, readFlash(w, r), "")
+}
+
+func (a *App) renderTwoFactorSetup(w http.ResponseWriter, r *http.Request, user *account.User, flash, errMsg string) {
+	secret, err := account.PendingTOTPSecret(r.Context(), a.DB, a.Secrets, user.ID)
+	if errors.Is(err, account.ErrTOTPNotPending) {
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	code, err := qr.Encode(account.TOTPKeyURI(secret, totpIssuer, user.Email))
+	if err != nil {
+		a.RenderServerError(w, r, err)
+		return
+	}
+
+	// The page holds the secret; keep it out of caches.
+	w.Header().Set("Cache-Control", "no-store")
+
+	data := TemplateData{
+		CurrentUser: user,
+		Flash:       flash,
+		Error:       errMsg,
+		Data: twoFactorSetupData{
+			QR:     template.HTML(code.SVG()),
+			Secret: account.FormatTOTPSecret(secret),
+		},
+	}
+	a.Renderer.Render(w, r, "two_factor_setup", data)
+}
+
+// POST /settings/2fa
+// Turns two-factor on once the first code from the app checks out.
+func (a *App) HandleTwoFactorSetupPost(w http.ResponseWriter, r *http.Request) {
+	user := CurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		setFlash(w, "Invalid form submission.")
+		http.Redirect(w, r, "/settings/2fa", http.StatusSeeOther)
+		return
+	}
+
+	codes, err := account.EnableTOTP(r.Context(), a.DB, a.Secrets, user.ID, r.Form.Get("code"))
+	switch {
+	case errors.Is(err, account.ErrInvalidTOTPCode):
+		a.renderTwoFactorSetup(w, r, user, "", "That code didn't match. Make sure your phone's clock is right and enter the newest code.")
+		return
+	case errors.Is(err, account.ErrTOTPNotPending):
+		setFlash(w, "Start two-factor setup again from this page.")
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+		return
+	case err != nil:
+		log.Printf("enable totp error: %v", err)
+		a.renderTwoFactorSetup(w, r, user, "", "Could not turn on two-factor authentication. Please try again.")
+		return
+	}
+
+	a.sendTwoFactorNotice(user, true)
+	a.renderRecoveryCodes(w, r, user, codes, true)
+}
+
+// renderRecoveryCodes shows freshly made recovery codes, the only time
+// they can be seen.
+func (a *App) renderRecoveryCodes(w http.ResponseWriter, r *http.Request, user *account.User, codes []string, enabled bool) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	data := TemplateData{
+		CurrentUser: user,
+		Data:        twoFactorCodesData{Codes: codes, Enabled: enabled},
+	}
+	a.Renderer.Render(w, r, "two_factor_codes", data)
+}
+
+func (a *App) sendTwoFactorNotice(u *account.User, enabled bool) {
+	subject, change := "Two-factor authentication turned off", "turned off"
+	if enabled {
+		subject, change = "Two-factor authentication turned on", "turned on"
+	}
+	a.sendMail(mail.Message{
+		To:      u.Email,
+		Subject: subject,
+		Text: "Hi " + u.DisplayName + ",\n\n" +
+			"Two-factor authentication was just " + change + " for your Mana Tomb account.\n\n" +
+			"If this wasn't you, reset your password right away and check the signed-in devices on your settings page.\n",
+	})
+}
@@ -0,0 +1,103 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"math/big"
+)
+
+// COSE key parameters (RFC 9052, RFC 9053).
+const (
+	coseKty = 1
+	coseAlg = 3
+
+	ktyOKP = 1
+	ktyEC2 = 2
+	ktyRSA = 3
+
+	crvP256    = 1
+	crvEd25519 = 6
+)
+
+// publicKey is a credential key that can check signatures.
+type publicKey interface {
+	verify(signed, sig []byte) bool
+}
+
+type ecdsaKey struct{ *ecdsa.PublicKey }
+
+func (k ecdsaKey) verify(signed, sig []byte) bool {
+	sum := sha256.Sum256(signed)
+	return ecdsa.VerifyASN1(k.PublicKey, sum[:], sig)
+}
+
+type ed25519Key ed25519.PublicKey
+
+func (k ed25519Key) verify(signed, sig []byte) bool {
+	return ed25519.Verify(ed25519.PublicKey(k), signed, sig)
+}
+
+type rsaKey struct{ *rsa.PublicKey }
+
+func (k rsaKey) verify(signed, sig []byte) bool {
+	sum := sha256.Sum256(signed)
+	return rsa.VerifyPKCS1v15(k.PublicKey, crypto.SHA256, sum[:], sig) == nil
+}
+
+// parseCOSEKey decodes a COSE_Key for one of the algorithms offered in
+// CreationOptions.
+func parseCOSEKey(b []byte) (publicKey, error) {
+	v, rest, err := decodeCBOR(b)
+	if err != nil || len(rest) != 0 {
+		return nil, ErrKeyType
+	}
+	m, ok := v.(map[any]any)
+	if !ok {
+		return nil, ErrKeyType
+	}
+	param := func(label int64) any { return m[label] }
+	num := func(label int64) int64 { n, _ := param(label).(int64); return n }
+	bin := func(label int64) []byte { b, _ := param(label).([]byte); return b }
+
+	switch {
+	case num(coseKty) == ktyEC2 && num(coseAlg) == algES256 && num(-1) == crvP256:
+		x, y := bin(-2), bin(-3)
+		if len(x) != 32 || len(y) != 32 {
+			return nil, ErrKeyType
+		}
+		// crypto/ecdh rejects points that aren't on the curve.
+		point := append(append([]byte{4}, x...), y...)
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, ErrKeyType
+		}
+		return ecdsaKey{&ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}}, nil
+
+	case num(coseKty) == ktyOKP && num(coseAlg) == algEdDSA && num(-1) == crvEd25519:
+		x := bin(-2)
+		if len(x) != ed25519.PublicKeySize {
+			return nil, ErrKeyType
+		}
+		return ed25519Key(x), nil
+
+	case num(coseKty) == ktyRSA && num(coseAlg) == algRS256:
+		n, e := bin(-1), bin(-2)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, ErrKeyType
+		}
+		exp := new(big.Int).SetBytes(e)
+		if exp.Int64() < 3 {
+			return nil, ErrKeyType
+		}
+		return rsaKey{&rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}}, nil
+	}
+	return nil, ErrKeyType
+}
@@ -0,0 +1,354 @@
+// Package webauthn verifies passkey (WebAuthn Level 2) registrations and
+// sign-ins on the server. It checks what the browser and authenticator
+// sign: the client data, the authenticator data and, for sign-ins, the
+// signature. Attestation statements are not verified, since the site asks
+// for "none" attestation and doesn't restrict authenticator makes.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrVerify  = errors.New("webauthn: verification failed")
+	ErrCloned  = errors.New("webauthn: signature counter went backwards")
+	ErrKeyType = errors.New("webauthn: unsupported key type")
+)
+
+// RelyingParty is the site credentials are bound to. ID is its domain,
+// e.g. "manatomb.example"; Origin is the scheme, host and any port pages
+// are served from, e.g. "https://manatomb.example".
+type RelyingParty struct {
+	ID     string
+	Name   string
+	Origin string
+}
+
+// Bytes marshals to JSON as unpadded base64url, as the browser-side
+// WebAuthn JSON encodings expect.
+type Bytes []byte
+
+func (b Bytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *Bytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return err
+	}
+	*b = v
+	return nil
+}
+
+// NewChallenge returns a fresh random challenge for one ceremony.
+func NewChallenge() ([]byte, error) {
+	c := make([]byte, 32)
+	if _, err := rand.Read(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Options sent to navigator.credentials.create and .get, in the JSON form
+// of WebAuthn Level 3 (PublicKeyCredentialCreationOptionsJSON and
+// PublicKeyCredentialRequestOptionsJSON).
+
+type CreationOptions struct {
+	Challenge              Bytes                  `json:"challenge"`
+	RP                     rpEntity               `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	PubKeyCredParams       []credParam            `json:"pubKeyCredParams"`
+	Timeout                int                    `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection authenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+type RequestOptions struct {
+	Challenge        Bytes                  `json:"challenge"`
+	RPID             string                 `json:"rpId"`
+	Timeout          int                    `json:"timeout"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+type rpEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// UserEntity identifies the account a passkey signs in to. ID is an opaque
+// handle, not an email or database ID.
+type UserEntity struct {
+	ID          Bytes  `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type credParam struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         Bytes    `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+type authenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	RequireResident  bool   `json:"requireResidentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// COSE algorithm identifiers this package verifies.
+const (
+	algES256 = -7
+	algEdDSA = -8
+	algRS256 = -257
+)
+
+const ceremonyTimeout = 5 * 60 * 1000 // milliseconds
+
+// CreationOptions asks the browser for a new discoverable passkey, so it
+// can later sign in without a username. Existing credentials are excluded
+// so the same authenticator isn't registered twice.
+func (rp RelyingParty) CreationOptions(challenge []byte, user UserEntity, exclude []CredentialDescriptor) CreationOptions {
+	if exclude == nil {
+		exclude = []CredentialDescriptor{}
+	}
+	return CreationOptions{
+		Challenge: challenge,
+		RP:        rpEntity{ID: rp.ID, Name: rp.Name},
+		User:      user,
+		PubKeyCredParams: []credParam{
+			{Type: "public-key", Alg: algES256},
+			{Type: "public-key", Alg: algEdDSA},
+			{Type: "public-key", Alg: algRS256},
+		},
+		Timeout:            ceremonyTimeout,
+		ExcludeCredentials: exclude,
+		AuthenticatorSelection: authenticatorSelection{
+			ResidentKey:      "required",
+			RequireResident:  true,
+			UserVerification: "required",
+		},
+		Attestation: "none",
+	}
+}
+
+// RequestOptions asks the browser to sign in with any passkey for the site.
+func (rp RelyingParty) RequestOptions(challenge []byte) RequestOptions {
+	return RequestOptions{
+		Challenge:        challenge,
+		RPID:             rp.ID,
+		Timeout:          ceremonyTimeout,
+		AllowCredentials: []CredentialDescriptor{},
+		UserVerification: "required",
+	}
+}
+
+// Registration is what the browser returns from navigator.credentials.create.
+type Registration struct {
+	ClientDataJSON    Bytes    `json:"clientDataJSON"`
+	AttestationObject Bytes    `json:"attestationObject"`
+	Transports        []string `json:"transports"`
+}
+
+// Assertion is what the browser returns from navigator.credentials.get.
+type Assertion struct {
+	CredentialID      Bytes `json:"id"`
+	ClientDataJSON    Bytes `json:"clientDataJSON"`
+	AuthenticatorData Bytes `json:"authenticatorData"`
+	Signature         Bytes `json:"signature"`
+	UserHandle        Bytes `json:"userHandle"`
+}
+
+// Credential is a verified new passkey. PublicKey is kept in its COSE
+// encoding and handed back to VerifyAssertion.
+type Credential struct {
+	ID        []byte
+	PublicKey []byte
+	SignCount uint32
+}
+
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// Challenge extracts the challenge a response answers, so the server can
+// find the ceremony it belongs to before verifying the rest.
+func Challenge(clientDataJSON []byte) ([]byte, error) {
+	var cd clientData
+	if err := json.Unmarshal(clientDataJSON, &cd); err != nil {
+		return nil, ErrVerify
+	}
+	c, err := base64.RawURLEncoding.DecodeString(cd.Challenge)
+	if err != nil {
+		return nil, ErrVerify
+	}
+	return c, nil
+}
+
+func (rp RelyingParty) checkClientData(raw []byte, typ string, challenge []byte) error {
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return fmt.Errorf("%w: client data: %v", ErrVerify, err)
+	}
+	got, err := base64.RawURLEncoding.DecodeString(cd.Challenge)
+	switch {
+	case cd.Type != typ:
+		return fmt.Errorf("%w: type %q", ErrVerify, cd.Type)
+	case err != nil || subtle.ConstantTimeCompare(got, challenge) != 1:
+		return fmt.Errorf("%w: challenge mismatch", ErrVerify)
+	case cd.Origin != rp.Origin:
+		return fmt.Errorf("%w: origin %q", ErrVerify, cd.Origin)
+	case cd.CrossOrigin:
+		return fmt.Errorf("%w: cross-origin", ErrVerify)
+	}
+	return nil
+}
+
+// Authenticator data flags.
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+type authData struct {
+	rpIDHash  []byte
+	flags     byte
+	signCount uint32
+
+	// Set when flagAttested is.
+	credentialID []byte
+	publicKey    []byte
+}
+
+func parseAuthData(b []byte) (*authData, error) {
+	if len(b) < 37 {
+		return nil, fmt.Errorf("%w: short authenticator data", ErrVerify)
+	}
+	ad := &authData{
+		rpIDHash:  b[:32],
+		flags:     b[32],
+		signCount: binary.BigEndian.Uint32(b[33:37]),
+	}
+	if ad.flags&flagAttested == 0 {
+		return ad, nil
+	}
+
+	rest := b[37:]
+	if len(rest) < 18 {
+		return nil, fmt.Errorf("%w: short attested credential data", ErrVerify)
+	}
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if idLen > 1023 || len(rest) < idLen {
+		return nil, fmt.Errorf("%w: bad credential ID", ErrVerify)
+	}
+	ad.credentialID = append([]byte(nil), rest[:idLen]...)
+	rest = rest[idLen:]
+
+	_, after, err := decodeCBOR(rest)
+	if err != nil {
+		return nil, fmt.Errorf("%w: credential public key", ErrVerify)
+	}
+	ad.publicKey = append([]byte(nil), rest[:len(rest)-len(after)]...)
+	return ad, nil
+}
+
+func (rp RelyingParty) checkAuthData(ad *authData) error {
+	want := sha256.Sum256([]byte(rp.ID))
+	switch {
+	case !bytes.Equal(ad.rpIDHash, want[:]):
+		return fmt.Errorf("%w: RP ID hash mismatch", ErrVerify)
+	case ad.flags&flagUserPresent == 0:
+		return fmt.Errorf("%w: user not present", ErrVerify)
+	case ad.flags&flagUserVerified == 0:
+		return fmt.Errorf("%w: user not verified", ErrVerify)
+	}
+	return nil
+}
+
+// VerifyRegistration checks a response to CreationOptions built with
+// challenge and returns the new credential.
+func (rp RelyingParty) VerifyRegistration(challenge []byte, reg Registration) (*Credential, error) {
+	if err := rp.checkClientData(reg.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	obj, _, err := decodeCBOR(reg.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: attestation object", ErrVerify)
+	}
+	m, _ := obj.(map[any]any)
+	raw, _ := m["authData"].([]byte)
+	ad, err := parseAuthData(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.checkAuthData(ad); err != nil {
+		return nil, err
+	}
+	if ad.credentialID == nil {
+		return nil, fmt.Errorf("%w: no credential in response", ErrVerify)
+	}
+	if _, err := parseCOSEKey(ad.publicKey); err != nil {
+		return nil, err
+	}
+
+	return &Credential{ID: ad.credentialID, PublicKey: ad.publicKey, SignCount: ad.signCount}, nil
+}
+
+// VerifyAssertion checks a response to RequestOptions built with challenge
+// against the stored credential and returns its new signature counter.
+func (rp RelyingParty) VerifyAssertion(challenge []byte, cred Credential, a Assertion) (uint32, error) {
+	if err := rp.checkClientData(a.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	ad, err := parseAuthData(a.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+	if err := rp.checkAuthData(ad); err != nil {
+		return 0, err
+	}
+
+	key, err := parseCOSEKey(cred.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientHash := sha256.Sum256(a.ClientDataJSON)
+	signed := append(append([]byte(nil), a.AuthenticatorData...), clientHash[:]...)
+	if !key.verify(signed, a.Signature) {
+		return 0, fmt.Errorf("%w: bad signature", ErrVerify)
+	}
+
+	// Authenticators that count (many synced passkeys always send zero)
+	// must count up; going backwards suggests a cloned key.
+	if (ad.signCount != 0 || cred.SignCount != 0) && ad.signCount <= cred.SignCount {
+		return 0, ErrCloned
+	}
+	return ad.signCount, nil
+}
@@ -0,0 +1,289 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+var testRP = RelyingParty{ID: "manatomb.example", Name: "Mana Tomb", Origin: "https://manatomb.example"}
+
+// softAuthenticator is a P-256 passkey held in memory, standing in for the
+// browser and authenticator.
+type softAuthenticator struct {
+	key    *ecdsa.PrivateKey
+	credID []byte
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &softAuthenticator{key: key, credID: []byte("test-credential-id")}
+}
+
+// ceremony is what the browser and authenticator put into one response.
+type ceremony struct {
+	typ       string
+	challenge []byte
+	origin    string
+	rpID      string
+	flags     byte
+	signCount uint32
+}
+
+func newCeremony(typ string, challenge []byte) ceremony {
+	return ceremony{
+		typ:       typ,
+		challenge: challenge,
+		origin:    testRP.Origin,
+		rpID:      testRP.ID,
+		flags:     flagUserPresent | flagUserVerified,
+	}
+}
+
+func (c ceremony) clientDataJSON() []byte {
+	b, _ := json.Marshal(clientData{
+		Type:      c.typ,
+		Challenge: base64.RawURLEncoding.EncodeToString(c.challenge),
+		Origin:    c.origin,
+	})
+	return b
+}
+
+func (a *softAuthenticator) authData(c ceremony, attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(c.rpID))
+	b := append([]byte(nil), rpIDHash[:]...)
+	flags := c.flags
+	if attested {
+		flags |= flagAttested
+	}
+	b = append(b, flags)
+	b = binary.BigEndian.AppendUint32(b, c.signCount)
+	if attested {
+		b = append(b, make([]byte, 16)...) // AAGUID
+		b = binary.BigEndian.AppendUint16(b, uint16(len(a.credID)))
+		b = append(b, a.credID...)
+		b = append(b, a.coseKey()...)
+	}
+	return b
+}
+
+// coseKey is the authenticator's public key as an EC2 COSE_Key.
+func (a *softAuthenticator) coseKey() []byte {
+	pub, err := a.key.PublicKey.ECDH()
+	if err != nil {
+		panic(err)
+	}
+	point := pub.Bytes() // 0x04 || x || y
+	b := []byte{0xa5}
+	b = append(b, 0x01, 0x02) // kty: EC2
+	b = append(b, 0x03, 0x26) // alg: ES256
+	b = append(b, 0x20, 0x01) // crv: P-256
+	b = append(b, 0x21)
+	b = append(b, cborBytes(point[1:33])...)
+	b = append(b, 0x22)
+	b = append(b, cborBytes(point[33:])...)
+	return b
+}
+
+func (a *softAuthenticator) register(c ceremony) Registration {
+	obj := []byte{0xa3}
+	obj = append(obj, cborText("fmt")...)
+	obj = append(obj, cborText("none")...)
+	obj = append(obj, cborText("attStmt")...)
+	obj = append(obj, 0xa0)
+	obj = append(obj, cborText("authData")...)
+	obj = append(obj, cborBytes(a.authData(c, true))...)
+	return Registration{ClientDataJSON: c.clientDataJSON(), AttestationObject: obj}
+}
+
+func (a *softAuthenticator) assert(t *testing.T, c ceremony) Assertion {
+	t.Helper()
+	clientJSON := c.clientDataJSON()
+	ad := a.authData(c, false)
+	clientHash := sha256.Sum256(clientJSON)
+	sum := sha256.Sum256(append(append([]byte(nil), ad...), clientHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Assertion{
+		CredentialID:      a.credID,
+		ClientDataJSON:    clientJSON,
+		AuthenticatorData: ad,
+		Signature:         sig,
+	}
+}
+
+func cborHead(major byte, n int) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n < 256:
+		return []byte{major<<5 | 24, byte(n)}
+	}
+	return []byte{major<<5 | 25, byte(n >> 8), byte(n)}
+}
+
+func cborBytes(b []byte) []byte { return append(cborHead(2, len(b)), b...) }
+func cborText(s string) []byte  { return append(cborHead(3, len(s)), s...) }
+
+func TestVerifyRegistration(t *testing.T) {
+	challenge := []byte("registration-challenge-0123456789")
+
+	tests := []struct {
+		name   string
+		modify func(*ceremony)
+	}{
+		{"wrong type", func(c *ceremony) { c.typ = "webauthn.get" }},
+		{"wrong origin", func(c *ceremony) { c.origin = "https://evil.example" }},
+		{"wrong challenge", func(c *ceremony) { c.challenge = []byte("some-other-challenge") }},
+		{"wrong RP ID hash", func(c *ceremony) { c.rpID = "evil.example" }},
+		{"user not verified", func(c *ceremony) { c.flags = flagUserPresent }},
+	}
+
+	t.Run("success", func(t *testing.T) {
+		auth := newSoftAuthenticator(t)
+		c := newCeremony("webauthn.create", challenge)
+		c.signCount = 3
+
+		cred, err := testRP.VerifyRegistration(challenge, auth.register(c))
+		if err != nil {
+			t.Fatalf("VerifyRegistration: %v", err)
+		}
+		if !bytes.Equal(cred.ID, auth.credID) {
+			t.Errorf("credential ID = %q, want %q", cred.ID, auth.credID)
+		}
+		if !bytes.Equal(cred.PublicKey, auth.coseKey()) {
+			t.Errorf("public key = %x, want %x", cred.PublicKey, auth.coseKey())
+		}
+		if cred.SignCount != 3 {
+			t.Errorf("sign count = %d, want 3", cred.SignCount)
+		}
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := newSoftAuthenticator(t)
+			c := newCeremony("webauthn.create", challenge)
+			tt.modify(&c)
+
+			if _, err := testRP.VerifyRegistration(challenge, auth.register(c)); !errors.Is(err, ErrVerify) {
+				t.Errorf("VerifyRegistration error = %v, want ErrVerify", err)
+			}
+		})
+	}
+}
+
+func TestVerifyAssertion(t *testing.T) {
+	challenge := []byte("assertion-challenge-0123456789ab")
+
+	tests := []struct {
+		name      string
+		modify    func(*ceremony)
+		tamper    func(*Assertion)
+		stored    uint32
+		signCount uint32
+		wantCount uint32
+		wantErr   error
+	}{
+		{
+			name:      "success",
+			stored:    4,
+			signCount: 5,
+			wantCount: 5,
+		},
+		{
+			name: "authenticator without a counter",
+		},
+		{
+			name:    "wrong type",
+			modify:  func(c *ceremony) { c.typ = "webauthn.create" },
+			wantErr: ErrVerify,
+		},
+		{
+			name:    "wrong origin",
+			modify:  func(c *ceremony) { c.origin = "http://manatomb.example" },
+			wantErr: ErrVerify,
+		},
+		{
+			name:    "wrong challenge",
+			modify:  func(c *ceremony) { c.challenge = []byte("a stale challenge") },
+			wantErr: ErrVerify,
+		},
+		{
+			name:    "wrong RP ID hash",
+			modify:  func(c *ceremony) { c.rpID = "other.example" },
+			wantErr: ErrVerify,
+		},
+		{
+			name:    "user not present",
+			modify:  func(c *ceremony) { c.flags = flagUserVerified },
+			wantErr: ErrVerify,
+		},
+		{
+			name:      "bad signature",
+			stored:    4,
+			signCount: 5,
+			tamper:    func(a *Assertion) { a.AuthenticatorData[36]++ },
+			wantErr:   ErrVerify,
+		},
+		{
+			name:      "sign count regression",
+			stored:    10,
+			signCount: 7,
+			wantErr:   ErrCloned,
+		},
+		{
+			name:      "sign count repeated",
+			stored:    10,
+			signCount: 10,
+			wantErr:   ErrCloned,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := newSoftAuthenticator(t)
+			cred := Credential{ID: auth.credID, PublicKey: auth.coseKey(), SignCount: tt.stored}
+
+			c := newCeremony("webauthn.get", challenge)
+			c.signCount = tt.signCount
+			if tt.modify != nil {
+				tt.modify(&c)
+			}
+			a := auth.assert(t, c)
+			if tt.tamper != nil {
+				tt.tamper(&a)
+			}
+
+			count, err := testRP.VerifyAssertion(challenge, cred, a)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("VerifyAssertion error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && count != tt.wantCount {
+				t.Errorf("sign count = %d, want %d", count, tt.wantCount)
+			}
+		})
+	}
+
+	t.Run("another authenticator's key", func(t *testing.T) {
+		auth, other := newSoftAuthenticator(t), newSoftAuthenticator(t)
+		cred := Credential{ID: auth.credID, PublicKey: auth.coseKey()}
+
+		a := other.assert(t, newCeremony("webauthn.get", challenge))
+		if _, err := testRP.VerifyAssertion(challenge, cred, a); !errors.Is(err, ErrVerify) {
+			t.Errorf("VerifyAssertion error = %v, want ErrVerify", err)
+		}
+	})
+}